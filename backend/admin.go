@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flushCacheHandler serves POST /admin/flush-cache, dropping every cached
+// search response, or only those whose query starts with the prefix query
+// parameter, for when the index changed without going through this API
+func flushCacheHandler(cache Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cache == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "The query cache is disabled",
+			})
+			return
+		}
+
+		prefix := c.Query("prefix")
+		flushed, err := cache.Flush(prefix)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Failed to flush cache: %v", err),
+				"flushed": flushed,
+			})
+			return
+		}
+
+		slog.Info("Flushed query cache", "prefix", prefix, "flushed", flushed)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"flushed": flushed,
+		})
+	}
+}
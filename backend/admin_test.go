@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryCacheFlush(t *testing.T) {
+	queries := []string{"gopher", "Gopher  Guide", "go*", "rust"}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		wantFlushed int
+		wantKept    []string
+	}{
+		{"everything", "", 4, nil},
+		{"prefix", "GOPHER", 2, []string{"go*", "rust"}},
+		{"prefix with spacing", "gopher   g", 1, []string{"gopher", "go*", "rust"}},
+		{"no match", "python", 0, queries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newQueryCache(100, time.Minute, time.Hour)
+			for _, query := range queries {
+				cache.Set(cacheKey(query), &SearchResponse{Success: true, Query: query})
+			}
+
+			flushed, err := cache.Flush(tt.prefix)
+			if err != nil || flushed != tt.wantFlushed {
+				t.Errorf("Flush(%q) = %d, %v, want %d", tt.prefix, flushed, err, tt.wantFlushed)
+			}
+			for _, query := range queries {
+				_, fresh := cache.Get(cacheKey(query))
+				_, stale := cache.GetStale(cacheKey(query))
+				want := slices.Contains(tt.wantKept, query)
+				if fresh != want || stale != want {
+					t.Errorf("%q cached = %v, stale copy = %v, want %v", query, fresh, stale, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlushCacheEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		wantFlushed int
+		wantMisses  []string
+	}{
+		{"everything", "/admin/flush-cache", 3, []string{"gopher", "gopher%20guide", "rust"}},
+		{"prefix", "/admin/flush-cache?prefix=Gopher", 2, []string{"gopher", "gopher%20guide"}},
+		{"no match", "/admin/flush-cache?prefix=python", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(
+				map[string]interface{}{"id": "1", "title": "Gopher guide"},
+				map[string]interface{}{"id": "2", "title": "Rust book"},
+			)
+			config := testConfig(meili.URL)
+			config.APIAuthKey = "secret"
+			api := newTestAPI(meili, config)
+			api.cache = newQueryCache(100, time.Minute, 0)
+			router := mountAPI(api)
+
+			queries := []string{"gopher", "gopher%20guide", "rust"}
+			for _, query := range queries {
+				searchCache(t, router, query)
+			}
+
+			if w := serve(router, http.MethodPost, tt.target, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("unauthenticated flush status = %d, want 401", w.Code)
+			}
+			w := serve(router, http.MethodPost, tt.target, "", "Authorization", "Bearer secret")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response struct {
+				Success bool `json:"success"`
+				Flushed int  `json:"flushed"`
+			}
+			decodeJSON(t, w, &response)
+			if !response.Success || response.Flushed != tt.wantFlushed {
+				t.Errorf("response = %+v, want %d flushed", response, tt.wantFlushed)
+			}
+
+			for _, query := range queries {
+				want := cacheHit
+				if slices.Contains(tt.wantMisses, query) {
+					want = cacheMiss
+				}
+				if _, status := searchCache(t, router, query); status != want {
+					t.Errorf("X-Cache for %q after the flush = %q, want %q", query, status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlushCacheDisabled(t *testing.T) {
+	meili := newFakeMeili(t)
+	router := newAPIRouter(meili, testConfig(meili.URL))
+
+	w := serve(router, http.MethodPost, "/admin/flush-cache", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without a query cache", w.Code)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// analyticsKeyTotal carries the total hit count of a search from
+	// runSearch to the analytics middleware
+	analyticsKeyTotal = "analytics.total"
+
+	// maxAnalyticsEvents caps the events kept in memory; the oldest are
+	// dropped first
+	maxAnalyticsEvents = 100000
+	// analyticsSinkSize is the most events waiting to be written to
+	// ANALYTICS_FILE; events recorded while it is full are not written
+	analyticsSinkSize = 1024
+
+	defaultTopQueries = 10
+	maxTopQueries     = 100
+)
+
+// AnalyticsEvent is one recorded search or result click, as kept in memory
+// and appended to ANALYTICS_FILE
+type AnalyticsEvent struct {
+	Type        string    `json:"type"`
+	Query       string    `json:"query"`
+	Results     int       `json:"results,omitempty"`
+	ZeroResults bool      `json:"zero_results,omitempty"`
+	DocumentID  string    `json:"document_id,omitempty"`
+	Position    int       `json:"position,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// ClickRequest is the JSON body accepted by POST /analytics/click. Position
+// is the 1-based rank of the clicked result.
+type ClickRequest struct {
+	Query      string `json:"query"`
+	DocumentID string `json:"document_id"`
+	Position   int    `json:"position"`
+}
+
+// QueryCTR is the click-through rate of a query: clicks per search
+type QueryCTR struct {
+	Query    string  `json:"query"`
+	Searches int     `json:"searches"`
+	Clicks   int     `json:"clicks"`
+	CTR      float64 `json:"ctr"`
+}
+
+// QueryCount is a query and how often it was searched for
+type QueryCount struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+}
+
+// Analytics records searches and result clicks for the analytics endpoints.
+// Events within the rolling window are kept in memory; when a file is
+// configured every event is also appended to it as a JSON line. A nil
+// *Analytics records nothing.
+type Analytics struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	events []AnalyticsEvent
+	// dropped counts the pruned events still occupying the start of the
+	// backing array of events
+	dropped int
+
+	sink chan AnalyticsEvent
+	wg   sync.WaitGroup
+}
+
+// newAnalytics creates a recorder keeping events for window, appending them
+// to the file at path unless it is empty
+func newAnalytics(window time.Duration, path string) (*Analytics, error) {
+	a := &Analytics{window: window}
+	if path == "" {
+		return a, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open analytics file: %w", err)
+	}
+	a.sink = make(chan AnalyticsEvent, analyticsSinkSize)
+	a.wg.Add(1)
+	go a.writeLoop(file)
+	return a, nil
+}
+
+// recordSearch records a search for query that found total hits
+func (a *Analytics) recordSearch(query string, total int, now time.Time) {
+	if a == nil || query == "" {
+		return
+	}
+	a.record(AnalyticsEvent{
+		Type:        "search",
+		Query:       query,
+		Results:     total,
+		ZeroResults: total == 0,
+		Timestamp:   now.UTC(),
+	})
+}
+
+// recordClick records a click on the result documentID shown at position for
+// query
+func (a *Analytics) recordClick(query, documentID string, position int, now time.Time) {
+	if a == nil {
+		return
+	}
+	a.record(AnalyticsEvent{
+		Type:       "click",
+		Query:      query,
+		DocumentID: documentID,
+		Position:   position,
+		Timestamp:  now.UTC(),
+	})
+}
+
+func (a *Analytics) record(event AnalyticsEvent) {
+	a.mu.Lock()
+	a.prune(event.Timestamp)
+	if len(a.events) >= maxAnalyticsEvents {
+		a.drop(1)
+	}
+	capacity := cap(a.events)
+	a.events = append(a.events, event)
+	if cap(a.events) != capacity {
+		// append moved the events to a new array, leaving the pruned ones
+		a.dropped = 0
+	}
+	a.mu.Unlock()
+
+	if a.sink != nil {
+		select {
+		case a.sink <- event:
+		default:
+			slog.Debug("Analytics sink full, dropping event", "query", event.Query)
+		}
+	}
+}
+
+// prune drops the events older than the window. Callers must hold a.mu.
+func (a *Analytics) prune(now time.Time) {
+	cutoff := now.Add(-a.window)
+	i := sort.Search(len(a.events), func(i int) bool {
+		return !a.events[i].Timestamp.Before(cutoff)
+	})
+	if i > 0 {
+		a.drop(i)
+	}
+}
+
+// drop forgets the n oldest events. Events are resliced away rather than
+// copied, and the rest is only moved to a new array once the dropped ones
+// take up more than half of the old one, so recording stays O(1) amortized.
+// Callers must hold a.mu.
+func (a *Analytics) drop(n int) {
+	a.events = a.events[n:]
+	a.dropped += n
+	if a.dropped > (a.dropped+cap(a.events))/2 {
+		a.events = append([]AnalyticsEvent(nil), a.events...)
+		a.dropped = 0
+	}
+}
+
+// topQueries returns the limit queries searched for most often within the
+// window, case-insensitively, most frequent first
+func (a *Analytics) topQueries(limit int, now time.Time) []QueryCount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+
+	counts := make(map[string]int)
+	for _, event := range a.events {
+		if event.Type == "search" {
+			counts[strings.ToLower(event.Query)]++
+		}
+	}
+	return sortedQueryCounts(counts, limit)
+}
+
+// zeroResultQueries returns the limit queries that most often found nothing
+// within the window, case-insensitively, most frequent first. A query is
+// listed as long as any of its searches found nothing.
+func (a *Analytics) zeroResultQueries(limit int, now time.Time) []QueryCount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+
+	counts := make(map[string]int)
+	for _, event := range a.events {
+		if event.Type == "search" && event.ZeroResults {
+			counts[strings.ToLower(event.Query)]++
+		}
+	}
+	return sortedQueryCounts(counts, limit)
+}
+
+// clickThroughRates returns the click-through rate of the limit queries
+// searched for most often within the window, case-insensitively
+func (a *Analytics) clickThroughRates(limit int, now time.Time) []QueryCTR {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+
+	searches := make(map[string]int)
+	clicks := make(map[string]int)
+	for _, event := range a.events {
+		switch event.Type {
+		case "search":
+			searches[strings.ToLower(event.Query)]++
+		case "click":
+			clicks[strings.ToLower(event.Query)]++
+		}
+	}
+
+	top := sortedQueryCounts(searches, limit)
+	rates := make([]QueryCTR, 0, len(top))
+	for _, query := range top {
+		rates = append(rates, QueryCTR{
+			Query:    query.Query,
+			Searches: query.Count,
+			Clicks:   clicks[query.Query],
+			CTR:      float64(clicks[query.Query]) / float64(query.Count),
+		})
+	}
+	return rates
+}
+
+// sortedQueryCounts orders counts by count, then query, and keeps the first
+// limit entries
+func sortedQueryCounts(counts map[string]int, limit int) []QueryCount {
+	queries := make([]QueryCount, 0, len(counts))
+	for query, count := range counts {
+		queries = append(queries, QueryCount{Query: query, Count: count})
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].Count != queries[j].Count {
+			return queries[i].Count > queries[j].Count
+		}
+		return queries[i].Query < queries[j].Query
+	})
+	if len(queries) > limit {
+		queries = queries[:limit]
+	}
+	return queries
+}
+
+// middleware records the searches served by the handlers after it
+func (a *Analytics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if a == nil {
+			return
+		}
+		// A 304 answers a repeated search that was still performed
+		if status := c.Writer.Status(); status != http.StatusOK && status != http.StatusNotModified {
+			return
+		}
+		total, ok := c.Get(analyticsKeyTotal)
+		if !ok {
+			return
+		}
+		a.recordSearch(c.GetString(logKeyQuery), total.(int), time.Now())
+	}
+}
+
+// topQueriesHandler serves GET /analytics/top-queries
+func (a *Analytics) topQueriesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := a.parseLimit(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"window":  a.window.String(),
+			"queries": a.topQueries(limit, time.Now()),
+		})
+	}
+}
+
+// zeroResultsHandler serves GET /analytics/zero-results
+func (a *Analytics) zeroResultsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := a.parseLimit(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"window":  a.window.String(),
+			"queries": a.zeroResultQueries(limit, time.Now()),
+		})
+	}
+}
+
+// clickHandler serves POST /analytics/click
+func (a *Analytics) clickHandler(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled(c) {
+			return
+		}
+
+		var body ClickRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+
+		query, err := normalizeQuery(body.Query, config.MaxQueryLength)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if query == "" || body.DocumentID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Fields 'query' and 'document_id' are required",
+			})
+			return
+		}
+		if body.Position < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Field 'position' must be a positive integer",
+			})
+			return
+		}
+
+		a.recordClick(query, body.DocumentID, body.Position, time.Now())
+		c.JSON(http.StatusAccepted, gin.H{"success": true})
+	}
+}
+
+// ctrHandler serves GET /analytics/ctr
+func (a *Analytics) ctrHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := a.parseLimit(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"window":  a.window.String(),
+			"queries": a.clickThroughRates(limit, time.Now()),
+		})
+	}
+}
+
+// enabled writes a 404 response and returns false when analytics are
+// disabled
+func (a *Analytics) enabled(c *gin.Context) bool {
+	if a == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Analytics are disabled, set ANALYTICS_ENABLED=true to enable them",
+		})
+		return false
+	}
+	return true
+}
+
+// parseLimit reads the limit query parameter of the analytics endpoints. It
+// writes the error response and returns false when analytics are disabled or
+// the limit is invalid.
+func (a *Analytics) parseLimit(c *gin.Context) (int, bool) {
+	if !a.enabled(c) {
+		return 0, false
+	}
+
+	limit := defaultTopQueries
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Query parameter 'limit' must be a positive integer",
+			})
+			return 0, false
+		}
+		limit = min(parsed, maxTopQueries)
+	}
+	return limit, true
+}
+
+// writeLoop appends events to file as JSON lines until Close
+func (a *Analytics) writeLoop(file *os.File) {
+	defer a.wg.Done()
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for event := range a.sink {
+		if err := encoder.Encode(event); err != nil {
+			slog.Warn("Failed to write analytics event", "error", err)
+		}
+	}
+}
+
+// Close writes the events still waiting for the analytics file
+func (a *Analytics) Close() {
+	if a == nil || a.sink == nil {
+		return
+	}
+	close(a.sink)
+	a.wg.Wait()
+}
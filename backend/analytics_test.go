@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAnalyticsRouter mounts the API with analytics recorded into analytics
+func newAnalyticsRouter(meili *fakeMeili, analytics *Analytics) *gin.Engine {
+	api := newTestAPI(meili, testConfig(meili.URL))
+	api.analytics = analytics
+	return mountAPI(api)
+}
+
+type analyticsResponse struct {
+	Success bool         `json:"success"`
+	Error   string       `json:"error"`
+	Window  string       `json:"window"`
+	Queries []QueryCount `json:"queries"`
+}
+
+func TestTopQueries(t *testing.T) {
+	now := time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+	type search struct {
+		query string
+		age   time.Duration
+	}
+
+	tests := []struct {
+		name     string
+		searches []search
+		limit    int
+		want     []QueryCount
+	}{
+		{"no searches", nil, 10, []QueryCount{}},
+		{
+			name:     "most frequent first",
+			searches: []search{{"rust", 0}, {"gopher", 0}, {"gopher", 0}, {"badger", 0}, {"gopher", 0}, {"rust", 0}},
+			limit:    10,
+			want:     []QueryCount{{"gopher", 3}, {"rust", 2}, {"badger", 1}},
+		},
+		{
+			name:     "case-insensitive",
+			searches: []search{{"Gopher", 0}, {"gopher", 0}, {"GOPHER", 0}},
+			limit:    10,
+			want:     []QueryCount{{"gopher", 3}},
+		},
+		{
+			name:     "ties by query",
+			searches: []search{{"rust", 0}, {"badger", 0}, {"gopher", 0}},
+			limit:    10,
+			want:     []QueryCount{{"badger", 1}, {"gopher", 1}, {"rust", 1}},
+		},
+		{
+			name:     "limited",
+			searches: []search{{"rust", 0}, {"gopher", 0}, {"gopher", 0}, {"badger", 0}},
+			limit:    2,
+			want:     []QueryCount{{"gopher", 2}, {"badger", 1}},
+		},
+		{
+			name:     "outside the window",
+			searches: []search{{"old", 2 * time.Hour}, {"old", 90 * time.Minute}, {"gopher", 30 * time.Minute}, {"gopher", 0}},
+			limit:    10,
+			want:     []QueryCount{{"gopher", 2}},
+		},
+		{
+			name:     "empty queries are not recorded",
+			searches: []search{{"", 0}, {"gopher", 0}},
+			limit:    10,
+			want:     []QueryCount{{"gopher", 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analytics, err := newAnalytics(time.Hour, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The searches are listed oldest first, as they happen
+			for _, s := range tt.searches {
+				analytics.recordSearch(s.query, 1, now.Add(-s.age))
+			}
+
+			if got := analytics.topQueries(tt.limit, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("topQueries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsPrune(t *testing.T) {
+	analytics, err := newAnalytics(10*time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10000; i++ {
+		analytics.recordSearch(fmt.Sprintf("query %d", i), 1, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// Only the window is kept, without the pruned events pinning a backing
+	// array that grew with every search
+	if n := len(analytics.events); n != 11 {
+		t.Errorf("kept %d events, want the 11 within the window", n)
+	}
+	if size := analytics.dropped + cap(analytics.events); size > 64 {
+		t.Errorf("backing array holds %d events for a window of 11", size)
+	}
+	if got := analytics.events[0].Query; got != "query 9989" {
+		t.Errorf("oldest event = %q, want query 9989", got)
+	}
+}
+
+func TestAnalyticsTopQueriesEndpoint(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 3)
+	analytics, err := newAnalytics(24*time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newAnalyticsRouter(meili, analytics)
+
+	searches := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/v1/search?q=gopher", "", http.StatusOK},
+		{http.MethodGet, "/v1/search?q=Gopher&limit=1", "", http.StatusOK},
+		{http.MethodPost, "/v1/search", `{"query":"gopher"}`, http.StatusOK},
+		{http.MethodGet, "/search?q=badger", "", http.StatusOK},
+		{http.MethodGet, "/v1/search?q=badger", "", http.StatusOK},
+		{http.MethodGet, "/v1/search?q=rust", "", http.StatusOK},
+		// Failed searches are not recorded
+		{http.MethodGet, "/v1/search?q=rust&page=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/v1/search", "", http.StatusBadRequest},
+	}
+	for _, s := range searches {
+		if w := serve(router, s.method, s.target, s.body); w.Code != s.want {
+			t.Fatalf("%s %s status = %d, want %d, body %s", s.method, s.target, w.Code, s.want, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []QueryCount
+	}{
+		{"all", "/v1/analytics/top-queries", []QueryCount{{"gopher", 3}, {"badger", 2}, {"rust", 1}}},
+		{"limited", "/v1/analytics/top-queries?limit=2", []QueryCount{{"gopher", 3}, {"badger", 2}}},
+		{"deprecated path", "/analytics/top-queries?limit=1", []QueryCount{{"gopher", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response analyticsResponse
+			decodeJSON(t, w, &response)
+			if !response.Success || response.Window != "24h0m0s" || !reflect.DeepEqual(response.Queries, tt.want) {
+				t.Errorf("response = %+v, want window 24h0m0s and queries %v", response, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsRejectsBadLimit(t *testing.T) {
+	meili := newFakeMeili(t)
+	analytics, _ := newAnalytics(time.Hour, "")
+	router := newAnalyticsRouter(meili, analytics)
+
+	for _, endpoint := range []string{"/v1/analytics/top-queries", "/v1/analytics/zero-results", "/v1/analytics/ctr"} {
+		for _, limit := range []string{"0", "-1", "ten"} {
+			w := serve(router, http.MethodGet, endpoint+"?limit="+limit, "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s?limit=%s status = %d, want 400", endpoint, limit, w.Code)
+			}
+		}
+	}
+}
+
+func TestAnalyticsDisabled(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 1)
+	router := newAnalyticsRouter(meili, nil)
+
+	if w := serve(router, http.MethodGet, "/v1/search?q=gopher", ""); w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, body %s", w.Code, w.Body)
+	}
+	for _, endpoint := range []string{"/v1/analytics/top-queries", "/v1/analytics/zero-results", "/v1/analytics/ctr"} {
+		w := serve(router, http.MethodGet, endpoint, "")
+		var response analyticsResponse
+		decodeJSON(t, w, &response)
+		if w.Code != http.StatusNotFound || response.Success || response.Error == "" {
+			t.Errorf("%s status = %d, response = %+v, want 404 with an error", endpoint, w.Code, response)
+		}
+	}
+}
+
+func TestAnalyticsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.jsonl")
+	analytics, err := newAnalytics(time.Hour, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+	analytics.recordSearch("gopher", 3, now)
+	analytics.recordSearch("badger", 0, now.Add(time.Second))
+	analytics.recordClick("gopher", "2", 2, now.Add(2*time.Second))
+	analytics.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []AnalyticsEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event AnalyticsEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not a JSON event: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	want := []AnalyticsEvent{
+		{Type: "search", Query: "gopher", Results: 3, Timestamp: now},
+		{Type: "search", Query: "badger", ZeroResults: true, Timestamp: now.Add(time.Second)},
+		{Type: "click", Query: "gopher", DocumentID: "2", Position: 2, Timestamp: now.Add(2 * time.Second)},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("file events = %+v, want %+v", events, want)
+	}
+}
+
+func TestNewAnalyticsRejectsUnwritableFile(t *testing.T) {
+	if _, err := newAnalytics(time.Hour, filepath.Join(t.TempDir(), "missing", "analytics.jsonl")); err == nil {
+		t.Error("newAnalytics() = nil error, want the file error")
+	}
+}
+
+func TestZeroResultQueries(t *testing.T) {
+	now := time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+	type search struct {
+		query string
+		total int
+		age   time.Duration
+	}
+
+	tests := []struct {
+		name     string
+		searches []search
+		limit    int
+		want     []QueryCount
+	}{
+		{"no searches", nil, 10, []QueryCount{}},
+		{"only matches", []search{{"gopher", 3, 0}, {"rust", 1, 0}}, 10, []QueryCount{}},
+		{
+			name:     "most frequent first",
+			searches: []search{{"badger", 0, 0}, {"gopher", 3, 0}, {"wombat", 0, 0}, {"badger", 0, 0}},
+			limit:    10,
+			want:     []QueryCount{{"badger", 2}, {"wombat", 1}},
+		},
+		{
+			name:     "only the searches that found nothing count",
+			searches: []search{{"gopher", 0, 0}, {"gopher", 2, 0}, {"gopher", 0, 0}, {"gopher", 5, 0}},
+			limit:    10,
+			want:     []QueryCount{{"gopher", 2}},
+		},
+		{
+			name:     "case-insensitive",
+			searches: []search{{"Badger", 0, 0}, {"BADGER", 0, 0}},
+			limit:    10,
+			want:     []QueryCount{{"badger", 2}},
+		},
+		{
+			name:     "limited",
+			searches: []search{{"badger", 0, 0}, {"wombat", 0, 0}, {"wombat", 0, 0}, {"quokka", 0, 0}},
+			limit:    1,
+			want:     []QueryCount{{"wombat", 2}},
+		},
+		{
+			name:     "outside the window",
+			searches: []search{{"badger", 0, 2 * time.Hour}, {"wombat", 0, time.Minute}},
+			limit:    10,
+			want:     []QueryCount{{"wombat", 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analytics, err := newAnalytics(time.Hour, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.searches {
+				analytics.recordSearch(s.query, s.total, now.Add(-s.age))
+			}
+
+			if got := analytics.zeroResultQueries(tt.limit, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("zeroResultQueries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsZeroResultsEndpoint(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 3)
+	analytics, err := newAnalytics(24*time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newAnalyticsRouter(meili, analytics)
+
+	for _, target := range []string{"/v1/search?q=gopher", "/v1/search?q=badger", "/v1/search?q=wombat", "/v1/search?q=Badger", "/v1/search?q=gopher+1"} {
+		if w := serve(router, http.MethodGet, target, ""); w.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, body %s", target, w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []QueryCount
+	}{
+		{"all", "/v1/analytics/zero-results", []QueryCount{{"badger", 2}, {"wombat", 1}}},
+		{"limited", "/v1/analytics/zero-results?limit=1", []QueryCount{{"badger", 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response analyticsResponse
+			decodeJSON(t, w, &response)
+			if !response.Success || !reflect.DeepEqual(response.Queries, tt.want) {
+				t.Errorf("queries = %v, want %v", response.Queries, tt.want)
+			}
+		})
+	}
+}
+
+func TestClickThroughRates(t *testing.T) {
+	now := time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+	type event struct {
+		click bool
+		query string
+		age   time.Duration
+	}
+
+	tests := []struct {
+		name   string
+		events []event
+		limit  int
+		want   []QueryCTR
+	}{
+		{"no events", nil, 10, []QueryCTR{}},
+		{
+			name:   "clicks per search",
+			events: []event{{false, "gopher", 0}, {false, "gopher", 0}, {false, "gopher", 0}, {false, "gopher", 0}, {true, "gopher", 0}, {false, "rust", 0}, {true, "rust", 0}, {true, "rust", 0}},
+			limit:  10,
+			want:   []QueryCTR{{"gopher", 4, 1, 0.25}, {"rust", 1, 2, 2}},
+		},
+		{
+			name:   "searches without clicks",
+			events: []event{{false, "badger", 0}, {false, "badger", 0}},
+			limit:  10,
+			want:   []QueryCTR{{"badger", 2, 0, 0}},
+		},
+		{
+			name:   "clicks without searches are not listed",
+			events: []event{{false, "gopher", 0}, {true, "wombat", 0}},
+			limit:  10,
+			want:   []QueryCTR{{"gopher", 1, 0, 0}},
+		},
+		{
+			name:   "case-insensitive",
+			events: []event{{false, "Gopher", 0}, {false, "gopher", 0}, {true, "GOPHER", 0}},
+			limit:  10,
+			want:   []QueryCTR{{"gopher", 2, 1, 0.5}},
+		},
+		{
+			name:   "the most searched queries",
+			events: []event{{false, "gopher", 0}, {false, "gopher", 0}, {false, "rust", 0}, {true, "rust", 0}},
+			limit:  1,
+			want:   []QueryCTR{{"gopher", 2, 0, 0}},
+		},
+		{
+			name:   "outside the window",
+			events: []event{{false, "gopher", 2 * time.Hour}, {true, "gopher", 90 * time.Minute}, {false, "gopher", time.Minute}, {true, "gopher", 0}},
+			limit:  10,
+			want:   []QueryCTR{{"gopher", 1, 1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analytics, err := newAnalytics(time.Hour, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, e := range tt.events {
+				if e.click {
+					analytics.recordClick(e.query, "doc", i+1, now.Add(-e.age))
+				} else {
+					analytics.recordSearch(e.query, 1, now.Add(-e.age))
+				}
+			}
+
+			if got := analytics.clickThroughRates(tt.limit, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clickThroughRates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsClickEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"click", `{"query":"gopher","document_id":"1","position":1}`, http.StatusAccepted, ""},
+		{"query is normalized", `{"query":"  Gopher   guide ","document_id":"1","position":3}`, http.StatusAccepted, ""},
+		{"malformed", `{"query":`, http.StatusBadRequest, "Invalid request body"},
+		{"missing query", `{"document_id":"1","position":1}`, http.StatusBadRequest, "Fields 'query' and 'document_id' are required"},
+		{"missing document", `{"query":"gopher","position":1}`, http.StatusBadRequest, "Fields 'query' and 'document_id' are required"},
+		{"zero position", `{"query":"gopher","document_id":"1","position":0}`, http.StatusBadRequest, "Field 'position' must be a positive integer"},
+		{"negative position", `{"query":"gopher","document_id":"1","position":-2}`, http.StatusBadRequest, "Field 'position' must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			analytics, _ := newAnalytics(time.Hour, "")
+			router := newAnalyticsRouter(meili, analytics)
+
+			w := serve(router, http.MethodPost, "/v1/analytics/click", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response analyticsResponse
+			decodeJSON(t, w, &response)
+			if response.Success != (tt.wantError == "") || !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("response = %+v, want error %q", response, tt.wantError)
+			}
+
+			analytics.mu.Lock()
+			events := analytics.events
+			analytics.mu.Unlock()
+			if tt.wantError != "" {
+				if len(events) != 0 {
+					t.Errorf("recorded %v, want nothing", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Type != "click" || events[0].DocumentID != "1" || events[0].Timestamp.IsZero() {
+				t.Errorf("recorded %+v, want one timestamped click on document 1", events)
+			}
+		})
+	}
+}
+
+func TestAnalyticsCTREndpoint(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 3)
+	analytics, err := newAnalytics(24*time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newAnalyticsRouter(meili, analytics)
+
+	requests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/v1/search?q=gopher", ""},
+		{http.MethodGet, "/v1/search?q=gopher", ""},
+		{http.MethodGet, "/v1/search?q=gopher", ""},
+		{http.MethodGet, "/v1/search?q=gopher", ""},
+		{http.MethodPost, "/v1/analytics/click", `{"query":"gopher","document_id":"0","position":1}`},
+		{http.MethodPost, "/v1/analytics/click", `{"query":"Gopher","document_id":"2","position":3}`},
+		{http.MethodGet, "/v1/search?q=badger", ""},
+	}
+	for _, r := range requests {
+		if w := serve(router, r.method, r.target, r.body); w.Code >= 300 {
+			t.Fatalf("%s %s status = %d, body %s", r.method, r.target, w.Code, w.Body)
+		}
+	}
+
+	w := serve(router, http.MethodGet, "/v1/analytics/ctr", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var response struct {
+		Success bool       `json:"success"`
+		Queries []QueryCTR `json:"queries"`
+	}
+	decodeJSON(t, w, &response)
+	want := []QueryCTR{{"gopher", 4, 2, 0.5}, {"badger", 1, 0, 0}}
+	if !response.Success || !reflect.DeepEqual(response.Queries, want) {
+		t.Errorf("queries = %+v, want %+v", response.Queries, want)
+	}
+}
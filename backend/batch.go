@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxBatchQueries caps the number of queries in one POST /search/batch
+	maxBatchQueries = 20
+	// batchSearchWorkers is how many queries of a batch run at the same time
+	batchSearchWorkers = 4
+)
+
+// batchSearchHandler runs several searches against the request's index
+// concurrently and returns one SearchResponse per query, in request order. A
+// query that is invalid or fails only fails its own entry.
+func batchSearchHandler(searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var queries []SearchRequestBody
+		if err := c.ShouldBindJSON(&queries); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Invalid request body, expected a JSON array of queries: %v", err),
+			})
+			return
+		}
+
+		if len(queries) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "At least one query is required",
+			})
+			return
+		}
+		if len(queries) > maxBatchQueries {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("At most %d queries are allowed per batch, got %d", maxBatchQueries, len(queries)),
+			})
+			return
+		}
+
+		indexName := indexFor(c, config)
+		results := make([]*SearchResponse, len(queries))
+
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < min(batchSearchWorkers, len(queries)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					params, err := queries[i].searchParams(config)
+					if err != nil {
+						results[i] = &SearchResponse{
+							Success:   false,
+							Error:     err.Error(),
+							ErrorCode: errorCode(err, errCodeInvalidParameter),
+							Query:     queries[i].Query,
+						}
+						continue
+					}
+					_, results[i], _ = executeSearch(c.Request.Context(), searcher, cache, config, indexName, params)
+				}
+			}()
+		}
+		for i := range queries {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"results": results,
+		})
+	}
+}
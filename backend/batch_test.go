@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newBatchRouter mounts POST /search/batch in front of meili
+func newBatchRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.POST("/search/batch", batchSearchHandler(meili.searcher(), nil, config))
+	return router
+}
+
+// titleIndex returns the docs whose title contains the query, and fails the
+// search for the query "broken"
+func titleIndex(docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query string `json:"q"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Query == "broken" {
+			writeFakeJSON(w, http.StatusInternalServerError, map[string]string{"message": "internal error", "code": "internal", "type": "internal"})
+			return
+		}
+
+		var hits []map[string]interface{}
+		for _, doc := range docs {
+			if strings.Contains(strings.ToLower(getString(doc, "title")), request.Query) {
+				hits = append(hits, doc)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+	}
+}
+
+type batchResponse struct {
+	Success bool             `json:"success"`
+	Error   string           `json:"error"`
+	Results []SearchResponse `json:"results"`
+}
+
+func TestBatchSearch(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"id": "1", "title": "Gopher guide"},
+		{"id": "2", "title": "Rust book"},
+		{"id": "3", "title": "Gopher tricks"},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []SearchResponse
+	}{
+		{
+			name: "results in request order",
+			body: `[{"query":"rust"},{"query":"gopher"},{"query":"missing"}]`,
+			want: []SearchResponse{
+				{Success: true, Query: "rust", Total: 1},
+				{Success: true, Query: "gopher", Total: 2},
+				{Success: true, Query: "missing", Total: 0},
+			},
+		},
+		{
+			name: "invalid queries fail alone",
+			body: `[{"query":"gopher"},{"query":""},{"query":"gopher","matching_strategy":"some"},{"query":"rust"}]`,
+			want: []SearchResponse{
+				{Success: true, Query: "gopher", Total: 2},
+				{ErrorCode: errCodeMissingQuery},
+				{ErrorCode: errCodeInvalidParameter, Query: "gopher"},
+				{Success: true, Query: "rust", Total: 1},
+			},
+		},
+		{
+			name: "failed searches fail alone",
+			body: `[{"query":"broken"},{"query":"gopher","limit":1}]`,
+			want: []SearchResponse{
+				{ErrorCode: errCodeSearchFailed, Query: "broken"},
+				{Success: true, Query: "gopher", Total: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, titleIndex(docs...))
+			router := newBatchRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodPost, "/search/batch", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response batchResponse
+			decodeJSON(t, w, &response)
+			if !response.Success || len(response.Results) != len(tt.want) {
+				t.Fatalf("response = %+v, want %d results", response, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := response.Results[i]
+				if got.Success != want.Success || got.Query != want.Query || got.ErrorCode != want.ErrorCode {
+					t.Errorf("result %d = success %v query %q error %q, want %v %q %q", i, got.Success, got.Query, got.ErrorCode, want.Success, want.Query, want.ErrorCode)
+				}
+				if got.Success && got.Total != want.Total {
+					t.Errorf("result %d total = %d, want %d", i, got.Total, want.Total)
+				}
+				if !got.Success && got.Error == "" {
+					t.Errorf("result %d has no error message", i)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchSearchRunsQueriesConcurrently(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		writeFakeJSON(w, http.StatusOK, searchHits())
+	})
+	router := newBatchRouter(meili, testConfig(meili.URL))
+
+	queries := make([]string, 12)
+	for i := range queries {
+		queries[i] = fmt.Sprintf(`{"query":"q%d"}`, i)
+	}
+	w := serve(router, http.MethodPost, "/search/batch", "["+strings.Join(queries, ",")+"]")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var response batchResponse
+	decodeJSON(t, w, &response)
+	for i, result := range response.Results {
+		if want := fmt.Sprintf("q%d", i); result.Query != want {
+			t.Errorf("result %d query = %q, want %q", i, result.Query, want)
+		}
+	}
+
+	if p := peak.Load(); p < 2 || p > batchSearchWorkers {
+		t.Errorf("at most %d searches ran at once, want between 2 and %d", p, batchSearchWorkers)
+	}
+}
+
+func TestBatchSearchUsesTheTenantIndex(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, "/indexes/documents_acme/search", titleIndex(map[string]interface{}{"id": "1", "title": "Acme gopher"}))
+	router := newBatchRouter(meili, testConfig(meili.URL))
+
+	w := serve(router, http.MethodPost, "/search/batch", `[{"query":"gopher"},{"query":"acme"}]`, tenantHeader, "acme")
+	var response batchResponse
+	decodeJSON(t, w, &response)
+	if len(response.Results) != 2 || response.Results[0].Total != 1 || response.Results[1].Total != 1 {
+		t.Errorf("response = %+v, want both queries to find the tenant's document", response)
+	}
+	if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+		t.Errorf("the default index received %d searches, want none", n)
+	}
+}
+
+func TestBatchSearchRejectsBadRequests(t *testing.T) {
+	tooMany := "[" + strings.Repeat(`{"query":"gopher"},`, maxBatchQueries) + `{"query":"gopher"}]`
+
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"malformed", `[{"query":`, "Invalid request body, expected a JSON array of queries"},
+		{"not an array", `{"query":"gopher"}`, "Invalid request body, expected a JSON array of queries"},
+		{"empty", `[]`, "At least one query is required"},
+		{"too many", tooMany, fmt.Sprintf("At most %d queries are allowed per batch, got %d", maxBatchQueries, maxBatchQueries+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			router := newBatchRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodPost, "/search/batch", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response batchResponse
+			decodeJSON(t, w, &response)
+			if response.Success || !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+				t.Errorf("Meilisearch received %d searches, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Blocklist holds the terms queries must not contain. Terms of several
+// words only match when the words appear together in that order. A nil
+// *Blocklist blocks nothing.
+type Blocklist struct {
+	terms [][]string
+}
+
+// loadBlocklist reads the blocked terms from the file at path, one per line.
+// Blank lines and lines starting with # are skipped.
+func loadBlocklist(path string) (*Blocklist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BLOCKLIST_FILE: %w", err)
+	}
+
+	blocklist := &Blocklist{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if words := splitWords(line); len(words) > 0 {
+			blocklist.terms = append(blocklist.terms, words)
+		}
+	}
+	return blocklist, nil
+}
+
+// blocks reports whether query contains a blocked term as whole words,
+// case-insensitively
+func (b *Blocklist) blocks(query string) bool {
+	if b == nil {
+		return false
+	}
+
+	words := splitWords(query)
+	for _, term := range b.terms {
+		for i := 0; i+len(term) <= len(words); i++ {
+			if slices.Equal(words[i:i+len(term)], term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitWords lowercases text and splits it into runs of letters and digits
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
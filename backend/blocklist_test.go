@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeBlocklist writes content to a blocklist file and returns its path
+func writeBlocklist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    [][]string
+	}{
+		{"empty", "", nil},
+		{"one term per line", "spam\nscam\n", [][]string{{"spam"}, {"scam"}}},
+		{"comments and blank lines", "# abusive terms\n\n  spam  \n#scam\n", [][]string{{"spam"}}},
+		{"lowercased", "SPAM\n", [][]string{{"spam"}}},
+		{"several words", "buy now\n", [][]string{{"buy", "now"}}},
+		{"punctuation dropped", "buy-now!\n", [][]string{{"buy", "now"}}},
+		{"only punctuation", "!!!\n", nil},
+		{"Windows line endings", "spam\r\nscam\r\n", [][]string{{"spam"}, {"scam"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocklist, err := loadBlocklist(writeBlocklist(t, tt.content))
+			if err != nil {
+				t.Fatalf("loadBlocklist() error = %v", err)
+			}
+			if !reflect.DeepEqual(blocklist.terms, tt.want) {
+				t.Errorf("terms = %q, want %q", blocklist.terms, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+			t.Error("loadBlocklist() succeeded, want an error")
+		}
+	})
+}
+
+func TestBlocklistBlocks(t *testing.T) {
+	blocklist := &Blocklist{terms: [][]string{{"spam"}, {"buy", "now"}, {"café"}}}
+	tests := []struct {
+		name      string
+		blocklist *Blocklist
+		query     string
+		want      bool
+	}{
+		{"nil blocklist", nil, "spam", false},
+		{"allowed", blocklist, "gopher guide", false},
+		{"blocked", blocklist, "spam", true},
+		{"blocked among other words", blocklist, "cheap spam offers", true},
+		{"case-insensitive", blocklist, "SPAM Offers", true},
+		{"next to punctuation", blocklist, "spam!", true},
+		{"inside a word", blocklist, "spammer", false},
+		{"at the end of a word", blocklist, "antispam", false},
+		{"several words", blocklist, "please buy now", true},
+		{"several words in another order", blocklist, "now buy", false},
+		{"several words apart", blocklist, "buy it now", false},
+		{"several words across punctuation", blocklist, "buy-now", true},
+		{"accented term", blocklist, "Café near me", true},
+		{"empty query", blocklist, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.blocklist.blocks(tt.query); got != tt.want {
+				t.Errorf("blocks(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// Blocked queries never reach Meilisearch
+func TestSearchBlocklist(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantCount  int
+		wantSearch bool
+	}{
+		{"allowed", "empty", http.MethodGet, "/search?q=gopher", "", http.StatusOK, "", 1, true},
+		{"allowed with a blocked word inside another", "empty", http.MethodGet, "/search?q=spammer", "", http.StatusOK, "", 0, true},
+		{"empty results", "empty", http.MethodGet, "/search?q=gopher%20SPAM", "", http.StatusOK, "", 0, false},
+		{"empty results for POST", "empty", http.MethodPost, "/search", `{"query":"gopher spam"}`, http.StatusOK, "", 0, false},
+		{"empty raw hits", "empty", http.MethodGet, "/search?q=gopher%20spam&raw=true", "", http.StatusOK, "", 0, false},
+		{"rejected", "reject", http.MethodGet, "/search?q=gopher%20spam", "", http.StatusBadRequest, errCodeBlockedQuery, 0, false},
+		{"rejected POST", "reject", http.MethodPost, "/search", `{"query":"buy now"}`, http.StatusBadRequest, errCodeBlockedQuery, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(
+				map[string]interface{}{"id": "1", "title": "Gopher guide"},
+				map[string]interface{}{"id": "2", "title": "Canned spam recipes"},
+			)
+			config := testConfig(meili.URL)
+			config.BlocklistAction = tt.action
+			config.Blocklist = &Blocklist{terms: [][]string{{"spam"}, {"buy", "now"}}}
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantCode || response.Count != tt.wantCount {
+				t.Errorf("error code, count = %q, %d, want %q, %d", response.ErrorCode, response.Count, tt.wantCode, tt.wantCount)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); (n > 0) != tt.wantSearch {
+				t.Errorf("Meilisearch received %d searches", n)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			// Clients get an array even when nothing matched
+			list := "results"
+			if strings.Contains(tt.target, "raw=true") {
+				list = "hits"
+			}
+			var body map[string]interface{}
+			decodeJSON(t, w, &body)
+			if items, ok := body[list].([]interface{}); !ok || len(items) != tt.wantCount {
+				t.Errorf("%s = %v, want an array of %d", list, body[list], tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBlocklist(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		action    string
+		wantTerms int
+		wantErr   bool
+	}{
+		{"unset", "", "", 0, false},
+		{"file", writeBlocklist(t, "spam\nbuy now\n"), "", 2, false},
+		{"reject", writeBlocklist(t, "spam\n"), "reject", 1, false},
+		{"missing file", filepath.Join(t.TempDir(), "missing.txt"), "", 0, true},
+		{"unknown action", writeBlocklist(t, "spam\n"), "hide", 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("BLOCKLIST_FILE", tt.file)
+			t.Setenv("BLOCKLIST_ACTION", tt.action)
+
+			config, err := loadConfig()
+			if err == nil {
+				err = config.Validate()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() and Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (config.Blocklist != nil) != (tt.wantTerms > 0) {
+				t.Errorf("Blocklist = %v, want %d terms", config.Blocklist, tt.wantTerms)
+			}
+			if err == nil && config.Blocklist != nil && len(config.Blocklist.terms) != tt.wantTerms {
+				t.Errorf("Blocklist has %d terms, want %d", len(config.Blocklist.terms), tt.wantTerms)
+			}
+		})
+	}
+}
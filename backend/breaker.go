@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// errCircuitOpen is returned instead of calling Meilisearch while the circuit
+// breaker is open
+var errCircuitOpen = errors.New("meilisearch circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calling Meilisearch after threshold consecutive
+// failures. Once cooldown has passed a single probe request is let through:
+// if it succeeds the breaker closes again, otherwise it stays open for
+// another cooldown. A nil *CircuitBreaker lets every call through.
+//
+// The breaker guards the search calls of MeiliSearcher only. Document,
+// settings, index and task requests go through MeiliClient: they fail over
+// between hosts like searches but neither trip the breaker nor fail fast
+// while it is open.
+type CircuitBreaker struct {
+	cb *gobreaker.TwoStepCircuitBreaker
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{cb: gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        "meilisearch",
+		MaxRequests: 1,
+		Timeout:     cooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= uint32(threshold)
+		},
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			switch to {
+			case gobreaker.StateOpen:
+				slog.Warn("Meilisearch circuit breaker opened", "previous_state", from.String(), "cooldown", cooldown.String())
+			case gobreaker.StateClosed:
+				slog.Info("Meilisearch circuit breaker closed", "previous_state", from.String())
+			}
+		},
+	})}
+}
+
+// allow returns errCircuitOpen when the call should fail fast. Otherwise the
+// caller must pass the outcome of the call to record.
+func (b *CircuitBreaker) allow() (record func(error), err error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	done, err := b.cb.Allow()
+	if err != nil {
+		// Open, or half-open with the probe already in flight
+		return nil, errCircuitOpen
+	}
+	return func(err error) { done(b.healthy(err)) }, nil
+}
+
+// healthy reports whether the outcome of a call shows Meilisearch answering
+func (b *CircuitBreaker) healthy(err error) bool {
+	// The caller gave up before Meilisearch answered, which says nothing
+	// about its health. Only a probe counts it as a failure, so the breaker
+	// stays open rather than closing on no evidence.
+	if errors.Is(err, context.Canceled) {
+		return b.State() != breakerHalfOpen
+	}
+
+	// Meilisearch answered, even if it rejected the request
+	return err == nil || !(isRetryable(err) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// State returns the current breaker state
+func (b *CircuitBreaker) State() breakerState {
+	if b == nil {
+		return breakerClosed
+	}
+
+	switch b.cb.State() {
+	case gobreaker.StateHalfOpen:
+		return breakerHalfOpen
+	case gobreaker.StateOpen:
+		return breakerOpen
+	}
+	return breakerClosed
+}
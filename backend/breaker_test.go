@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// trip fails threshold calls through b so it opens
+func trip(t *testing.T, b *CircuitBreaker, threshold int) {
+	t.Helper()
+	for i := 0; i < threshold; i++ {
+		record, err := b.allow()
+		if err != nil {
+			t.Fatalf("call %d refused before the breaker opened: %v", i+1, err)
+		}
+		record(errors.New("connection refused"))
+	}
+	if b.State() != breakerOpen {
+		t.Fatalf("state after %d failures = %s, want open", threshold, b.State())
+	}
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	unavailable := &MeiliError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		outcomes []error
+		want     breakerState
+	}{
+		{"stays closed on success", []error{nil, nil, nil}, breakerClosed},
+		{"stays closed below the threshold", []error{unavailable, unavailable}, breakerClosed},
+		{"opens at the threshold", []error{unavailable, unavailable, unavailable}, breakerOpen},
+		{"counts consecutive failures only", []error{unavailable, unavailable, nil, unavailable, unavailable}, breakerClosed},
+		{"counts network errors", []error{errors.New("dial tcp: connection refused"), errors.New("EOF"), errors.New("connection reset")}, breakerOpen},
+		{"counts timeouts", []error{context.DeadlineExceeded, context.DeadlineExceeded, context.DeadlineExceeded}, breakerOpen},
+		{"ignores rejected requests", []error{
+			&MeiliError{StatusCode: http.StatusBadRequest},
+			&MeiliError{StatusCode: http.StatusNotFound},
+			&MeiliError{StatusCode: http.StatusBadRequest},
+		}, breakerClosed},
+		{"ignores cancelled calls", []error{context.Canceled, context.Canceled, context.Canceled}, breakerClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(3, time.Minute)
+			for i, outcome := range tt.outcomes {
+				record, err := b.allow()
+				if err != nil {
+					t.Fatalf("call %d refused: %v", i+1, err)
+				}
+				record(outcome)
+			}
+			if got := b.State(); got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerFailsFastWhileOpen(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute)
+	trip(t, b, 2)
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.allow(); !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("allow while open = %v, want errCircuitOpen", err)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe error
+		want  breakerState
+	}{
+		{"successful probe closes", nil, breakerClosed},
+		{"rejected request closes", &MeiliError{StatusCode: http.StatusBadRequest}, breakerClosed},
+		{"failed probe reopens", &MeiliError{StatusCode: http.StatusBadGateway}, breakerOpen},
+		{"timed out probe reopens", context.DeadlineExceeded, breakerOpen},
+		{"cancelled probe reopens", context.Canceled, breakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cooldown := 20 * time.Millisecond
+			b := newCircuitBreaker(2, cooldown)
+			trip(t, b, 2)
+			time.Sleep(cooldown + 10*time.Millisecond)
+
+			if b.State() != breakerHalfOpen {
+				t.Fatalf("state after the cooldown = %s, want half-open", b.State())
+			}
+
+			record, err := b.allow()
+			if err != nil {
+				t.Fatalf("probe refused: %v", err)
+			}
+
+			// Only one probe may be in flight at a time
+			if _, err := b.allow(); !errors.Is(err, errCircuitOpen) {
+				t.Errorf("second call during the probe = %v, want errCircuitOpen", err)
+			}
+
+			record(tt.probe)
+			if got := b.State(); got != tt.want {
+				t.Errorf("state after the probe = %s, want %s", got, tt.want)
+			}
+
+			_, err = b.allow()
+			if open := errors.Is(err, errCircuitOpen); open != (tt.want == breakerOpen) {
+				t.Errorf("allow after the probe = %v, want refused %v", err, tt.want == breakerOpen)
+			}
+		})
+	}
+}
+
+func TestNilCircuitBreaker(t *testing.T) {
+	var b *CircuitBreaker
+	for i := 0; i < 10; i++ {
+		record, err := b.allow()
+		if err != nil {
+			t.Fatalf("nil breaker refused a call: %v", err)
+		}
+		record(errors.New("connection refused"))
+	}
+	if b.State() != breakerClosed {
+		t.Errorf("nil breaker state = %s, want closed", b.State())
+	}
+}
+
+func TestSearcherCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+
+	meili := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"message":"down","code":"internal","type":"internal"}`))
+			return
+		}
+		w.Write([]byte(`{"hits":[{"id":"1","title":"Gopher"}]}`))
+	}))
+	defer meili.Close()
+
+	cooldown := 50 * time.Millisecond
+	searcher := newMeiliSearcher([]string{meili.URL}, "", &http.Client{})
+	searcher.breaker = newCircuitBreaker(2, cooldown)
+	search := func() error {
+		_, err := searcher.Search(context.Background(), "documents", map[string]interface{}{"q": "gopher"})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		var meiliErr *MeiliError
+		if err := search(); !errors.As(err, &meiliErr) || meiliErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("search %d = %v, want a 503 from Meilisearch", i+1, err)
+		}
+	}
+
+	// Open: searches fail fast without reaching Meilisearch
+	if err := search(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("search while open = %v, want errCircuitOpen", err)
+	}
+	if status := meiliErrorStatus(errCircuitOpen); status != http.StatusServiceUnavailable {
+		t.Errorf("status while open = %d, want 503", status)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Meilisearch received %d searches, want 2", calls.Load())
+	}
+
+	// After the cooldown the probe finds Meilisearch back and closes the
+	// breaker
+	down.Store(false)
+	time.Sleep(cooldown + 10*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := search(); err != nil {
+			t.Errorf("search %d after recovery = %v", i+1, err)
+		}
+	}
+	if searcher.breaker.State() != breakerClosed {
+		t.Errorf("state after recovery = %s, want closed", searcher.breaker.State())
+	}
+}
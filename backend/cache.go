@@ -0,0 +1,239 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// Cache stores search responses by search cache key. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the cached response for key. Callers must not modify it.
+	Get(key string) (*SearchResponse, bool)
+	// Set stores response under key
+	Set(key string, response *SearchResponse)
+	// GetStale returns the response stored under key even if it has
+	// expired, as long as it is within the stale period
+	GetStale(key string) (*SearchResponse, bool)
+	// Invalidate drops every entry
+	Invalidate()
+	// Flush drops the entries whose query starts with prefix, every entry
+	// when prefix is empty, and returns how many it dropped
+	Flush(prefix string) (int, error)
+}
+
+// newCache picks the cache backend from the configuration: Redis when
+// REDIS_URL is set, otherwise the in-memory LRU cache. It returns nil when
+// caching is disabled.
+func newCache(config *Config) (Cache, error) {
+	// Expired responses are only worth keeping when they may be served
+	// while Meilisearch is down
+	var staleTTL time.Duration
+	if config.StaleOnError {
+		staleTTL = config.StaleTTL
+	}
+
+	if config.RedisURL != "" {
+		return newRedisCache(config.RedisURL, config.CacheTTL, staleTTL)
+	}
+	if config.CacheSize > 0 {
+		return newQueryCache(config.CacheSize, config.CacheTTL, staleTTL), nil
+	}
+	return nil, nil
+}
+
+const (
+	// taskPollInterval is how often invalidateAfterTasks checks on the
+	// tasks it waits for
+	taskPollInterval = 100 * time.Millisecond
+	// taskWaitTimeout bounds how long invalidateAfterTasks waits for them
+	taskWaitTimeout = 10 * time.Minute
+)
+
+// invalidateAfterTasks drops the cached responses once Meilisearch has
+// processed the given write tasks. Invalidating as soon as a write is
+// enqueued is not enough: searches made before the task finishes would cache
+// the old results again. It waits in the background, leaves the cache alone
+// when every task failed and invalidates anyway when a task cannot be
+// followed.
+func invalidateAfterTasks(client *MeiliClient, cache Cache, taskUIDs ...int64) {
+	if cache == nil || len(taskUIDs) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), taskWaitTimeout)
+		defer cancel()
+
+		changed := false
+		for _, uid := range taskUIDs {
+			task, err := client.WaitForTask(uid, meilisearch.WaitParams{Context: ctx, Interval: taskPollInterval})
+			if err != nil {
+				slog.Warn("Failed to wait for task, invalidating the search cache now", "task_uid", uid, "error", err)
+				changed = true
+				break
+			}
+			if task.Status == meilisearch.TaskStatusSucceeded {
+				changed = true
+			}
+		}
+		if changed {
+			cache.Invalidate()
+		}
+	}()
+}
+
+// QueryCache is an in-memory LRU cache of search responses. Entries expire
+// after ttl, stay available to GetStale for staleTTL more, and the least
+// recently used entry is evicted once size is reached.
+type QueryCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	staleTTL time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key      string
+	response *SearchResponse
+	expires  time.Time
+}
+
+func newQueryCache(size int, ttl, staleTTL time.Duration) *QueryCache {
+	return &QueryCache{
+		size:     size,
+		ttl:      ttl,
+		staleTTL: staleTTL,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached response for key if it has not expired
+func (c *QueryCache) Get(key string) (*SearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	now := time.Now()
+	if now.After(entry.expires) {
+		if now.After(entry.expires.Add(c.staleTTL)) {
+			c.order.Remove(elem)
+			delete(c.items, key)
+		}
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.response, true
+}
+
+// GetStale returns the response for key if it has not been expired for more
+// than staleTTL
+func (c *QueryCache) GetStale(key string) (*SearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires.Add(c.staleTTL)) {
+		return nil, false
+	}
+	return entry.response, true
+}
+
+// Set stores response under key, evicting the least recently used entry when
+// the cache is full
+func (c *QueryCache) Set(key string, response *SearchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.response = response
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, response: response, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Invalidate drops every entry, e.g. after documents were added or deleted
+func (c *QueryCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Flush drops the entries whose query starts with prefix, ignoring case and
+// spacing, or every entry when prefix is empty
+func (c *QueryCache) Flush(prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prefix == "" {
+		flushed := len(c.items)
+		c.order.Init()
+		c.items = make(map[string]*list.Element)
+		return flushed, nil
+	}
+
+	prefix = normalizeCacheQuery(prefix)
+	flushed := 0
+	for key, elem := range c.items {
+		if strings.HasPrefix(normalizeCacheQuery(elem.Value.(*cacheEntry).response.Query), prefix) {
+			c.order.Remove(elem)
+			delete(c.items, key)
+			flushed++
+		}
+	}
+	return flushed, nil
+}
+
+// searchCacheKey identifies a search by its index and normalized parameters
+func searchCacheKey(indexName string, params SearchParams) string {
+	params.Query = normalizeCacheQuery(params.Query)
+	encoded, _ := json.Marshal(params)
+	return indexName + ":" + string(encoded)
+}
+
+// cacheKeyQuery returns the normalized query of a key made by searchCacheKey
+func cacheKeyQuery(key string) string {
+	_, encoded, _ := strings.Cut(key, ":")
+	var params SearchParams
+	json.Unmarshal([]byte(encoded), &params)
+	return params.Query
+}
+
+// normalizeCacheQuery lowercases query and collapses its whitespace, so
+// queries differing only in case or spacing share cache entries
+func normalizeCacheQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
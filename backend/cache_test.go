@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryCache(t *testing.T) {
+	hello := &SearchResponse{Success: true, Query: "hello"}
+	world := &SearchResponse{Success: true, Query: "world"}
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		actions func(cache *QueryCache)
+		key     string
+		wantHit bool
+	}{
+		{"miss", time.Minute, func(cache *QueryCache) {}, "a", false},
+		{"hit", time.Minute, func(cache *QueryCache) { cache.Set("a", hello) }, "a", true},
+		{"expired", time.Millisecond, func(cache *QueryCache) {
+			cache.Set("a", hello)
+			time.Sleep(5 * time.Millisecond)
+		}, "a", false},
+		{"overwritten", time.Minute, func(cache *QueryCache) {
+			cache.Set("a", world)
+			cache.Set("a", hello)
+		}, "a", true},
+		{"least recently used evicted", time.Minute, func(cache *QueryCache) {
+			cache.Set("a", hello)
+			cache.Set("b", world)
+			cache.Set("c", world)
+		}, "a", false},
+		{"recently read kept", time.Minute, func(cache *QueryCache) {
+			cache.Set("a", hello)
+			cache.Set("b", world)
+			cache.Get("a")
+			cache.Set("c", world)
+		}, "a", true},
+		{"invalidated", time.Minute, func(cache *QueryCache) {
+			cache.Set("a", hello)
+			cache.Invalidate()
+		}, "a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newQueryCache(2, tt.ttl, 0)
+			tt.actions(cache)
+			got, ok := cache.Get(tt.key)
+			if ok != tt.wantHit {
+				t.Fatalf("Get(%q) hit = %v, want %v", tt.key, ok, tt.wantHit)
+			}
+			if ok && got != hello {
+				t.Errorf("Get(%q) = %+v, want %+v", tt.key, got, hello)
+			}
+		})
+	}
+}
+
+func TestSearchCacheKey(t *testing.T) {
+	base := SearchParams{Query: "Gopher  Guide", Limit: 10}
+	tests := []struct {
+		name      string
+		index     string
+		params    SearchParams
+		wantEqual bool
+	}{
+		{"same search", "documents", base, true},
+		{"case and spacing", "documents", SearchParams{Query: " gopher guide ", Limit: 10}, true},
+		{"other query", "documents", SearchParams{Query: "gopher", Limit: 10}, false},
+		{"other limit", "documents", SearchParams{Query: "gopher guide", Limit: 20}, false},
+		{"other offset", "documents", SearchParams{Query: "gopher guide", Limit: 10, Offset: 10}, false},
+		{"other filter", "documents", SearchParams{Query: "gopher guide", Limit: 10, Filter: "a = 1"}, false},
+		{"other sort", "documents", SearchParams{Query: "gopher guide", Limit: 10, Sort: []string{"a:asc"}}, false},
+		{"other index", "articles", base, false},
+	}
+
+	want := searchCacheKey("documents", base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchCacheKey(tt.index, tt.params); (got == want) != tt.wantEqual {
+				t.Errorf("key %q vs %q, want equal %v", got, want, tt.wantEqual)
+			}
+		})
+	}
+}
+
+// searchCache searches router for query and returns the IDs found and the
+// X-Cache header
+func searchCache(t *testing.T, router http.Handler, query string) ([]string, string) {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/search?q="+query, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, body %s", w.Code, w.Body)
+	}
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	return resultIDs(response.Results), w.Header().Get("X-Cache")
+}
+
+// eventually fails the test unless condition holds within two seconds
+func eventually(t *testing.T, condition func() bool, format string, args ...interface{}) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatalf(format, args...)
+}
+
+func TestSearchCacheHeaders(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+	router := newDocumentsRouter(meili, testConfig(meili.URL), newQueryCache(10, time.Minute, 0))
+
+	for i, want := range []string{cacheMiss, cacheHit, cacheHit} {
+		if _, got := searchCache(t, router, "gopher"); got != want {
+			t.Errorf("search %d X-Cache = %q, want %q", i+1, got, want)
+		}
+	}
+	w := serve(router, http.MethodGet, "/search?q=GOPHER", "")
+	if got := w.Header().Get("X-Cache"); got != cacheHit {
+		t.Errorf("X-Cache for the same query in capitals = %q, want HIT", got)
+	}
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	if response.Query != "GOPHER" {
+		t.Errorf("query = %q, want the caller's GOPHER rather than the cached one", response.Query)
+	}
+	if n := len(meili.received(http.MethodPost, searchPath)); n != 1 {
+		t.Errorf("Meilisearch received %d searches, want 1", n)
+	}
+}
+
+func TestSearchCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		taskStatus   string
+		wantIDs      []string
+		wantFlushed  bool
+		wantFinalIDs []string
+	}{
+		{"documents added", http.MethodPost, "/documents", `[{"id": "2", "title": "Gopher tricks"}]`, "enqueued", []string{"1"}, true, []string{"1", "2"}},
+		{"document deleted", http.MethodDelete, "/documents/1", "", "enqueued", []string{"1"}, true, []string{}},
+		{"documents deleted", http.MethodDelete, "/documents", `["1"]`, "enqueued", []string{"1"}, true, []string{}},
+		{"failed task", http.MethodPost, "/documents", `[{"id": "2", "title": "Gopher tricks"}]`, "failed", []string{"1"}, false, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			index.add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+			index.taskStatus = tt.taskStatus
+			router := newDocumentsRouter(meili, testConfig(meili.URL), newQueryCache(10, time.Minute, 0))
+			searchCache(t, router, "gopher")
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var task struct {
+				TaskUID int `json:"task_uid"`
+			}
+			decodeJSON(t, w, &task)
+
+			// Until the task is done the cached results are still current
+			ids, cacheStatus := searchCache(t, router, "gopher")
+			if cacheStatus != cacheHit || !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("search while the task runs = %v, %s, want %v, HIT", ids, cacheStatus, tt.wantIDs)
+			}
+
+			if tt.taskStatus == "enqueued" {
+				meili.complete(task.TaskUID)
+			}
+			if tt.wantFlushed {
+				eventually(t, func() bool {
+					_, cacheStatus := searchCache(t, router, "gopher")
+					return cacheStatus == cacheMiss
+				}, "cache still served the search after the task succeeded")
+			} else {
+				time.Sleep(2 * taskPollInterval)
+			}
+
+			ids, cacheStatus = searchCache(t, router, "gopher")
+			if !slices.Equal(ids, tt.wantFinalIDs) {
+				t.Errorf("search after the task = %v, want %v", ids, tt.wantFinalIDs)
+			}
+			if !tt.wantFlushed && cacheStatus != cacheHit {
+				t.Errorf("X-Cache after a failed task = %q, want HIT", cacheStatus)
+			}
+		})
+	}
+}
+
+func TestInvalidateAfterTasks(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []string
+		wantFlushed bool
+	}{
+		{"one task succeeded", []string{"succeeded"}, true},
+		{"every task failed", []string{"failed", "failed"}, false},
+		{"some tasks failed", []string{"failed", "succeeded"}, true},
+		{"unknown task", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveTasks()
+			cache := newQueryCache(10, time.Minute, 0)
+			cache.Set("key", &SearchResponse{Success: true})
+
+			uids := []int64{42}
+			if tt.statuses != nil {
+				uids = nil
+				for _, status := range tt.statuses {
+					uids = append(uids, int64(meili.enqueue("documents", "documentAdditionOrUpdate", status)["taskUid"].(int)))
+				}
+			}
+			invalidateAfterTasks(newMeiliClient(testConfig(meili.URL)), cache, uids...)
+
+			if tt.wantFlushed {
+				eventually(t, func() bool {
+					_, ok := cache.Get("key")
+					return !ok
+				}, "cache was not invalidated")
+				return
+			}
+			eventually(t, func() bool {
+				return len(meili.received(http.MethodGet, fmt.Sprintf("/tasks/%d", uids[len(uids)-1]))) > 0
+			}, "the last task was never checked")
+			time.Sleep(taskPollInterval)
+			if _, ok := cache.Get("key"); !ok {
+				t.Error("cache was invalidated although every task failed")
+			}
+		})
+	}
+}
+
+func TestQueryCacheGetStale(t *testing.T) {
+	hello := &SearchResponse{Success: true, Query: "hello"}
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		staleTTL  time.Duration
+		wait      time.Duration
+		wantFresh bool
+		wantStale bool
+	}{
+		{"fresh", time.Minute, time.Hour, 0, true, true},
+		{"expired but stale", time.Millisecond, time.Hour, 5 * time.Millisecond, false, true},
+		{"past the stale period", time.Millisecond, time.Millisecond, 5 * time.Millisecond, false, false},
+		{"no stale period", time.Millisecond, 0, 5 * time.Millisecond, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newQueryCache(10, tt.ttl, tt.staleTTL)
+			cache.Set("a", hello)
+			time.Sleep(tt.wait)
+
+			// GetStale first: Get drops entries past the stale period
+			stale, ok := cache.GetStale("a")
+			if ok != tt.wantStale || (ok && stale != hello) {
+				t.Errorf("GetStale() = %+v, %v, want stale copy %v", stale, ok, tt.wantStale)
+			}
+			if _, ok := cache.Get("a"); ok != tt.wantFresh {
+				t.Errorf("Get() hit = %v, want %v", ok, tt.wantFresh)
+			}
+			if _, ok := cache.GetStale("missing"); ok {
+				t.Error("GetStale() found a key that was never cached")
+			}
+		})
+	}
+}
+
+// With STALE_ON_ERROR a failing Meilisearch is covered up by the last good
+// response for the same query
+func TestSearchStaleOnError(t *testing.T) {
+	tests := []struct {
+		name         string
+		staleOnError bool
+		staleTTL     time.Duration
+		query        string
+		failure      int
+		wantStatus   int
+		wantCache    string
+	}{
+		{"unavailable", true, time.Hour, "gopher", http.StatusServiceUnavailable, http.StatusOK, cacheStale},
+		{"internal error", true, time.Hour, "gopher", http.StatusInternalServerError, http.StatusOK, cacheStale},
+		{"timeout", true, time.Hour, "gopher", http.StatusGatewayTimeout, http.StatusOK, cacheStale},
+		{"same query in capitals", true, time.Hour, "GOPHER", http.StatusServiceUnavailable, http.StatusOK, cacheStale},
+		{"query never cached", true, time.Hour, "rust", http.StatusServiceUnavailable, http.StatusInternalServerError, cacheMiss},
+		{"past the stale period", true, time.Millisecond, "gopher", http.StatusServiceUnavailable, http.StatusInternalServerError, cacheMiss},
+		{"disabled", false, time.Hour, "gopher", http.StatusServiceUnavailable, http.StatusInternalServerError, cacheMiss},
+		// A search Meilisearch rejects is not an outage
+		{"rejected", true, time.Hour, "gopher", http.StatusBadRequest, http.StatusBadRequest, cacheMiss},
+		{"index not found", true, time.Hour, "gopher", http.StatusNotFound, http.StatusNotFound, cacheMiss},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+			config := testConfig(meili.URL)
+			config.StaleOnError = tt.staleOnError
+			config.StaleTTL = tt.staleTTL
+			config.SearchTimeout = 50 * time.Millisecond
+			cache := newQueryCache(10, time.Millisecond, tt.staleTTL)
+			router := newSearchRouter(meili.searcher(), cache, config)
+
+			if ids, got := searchCache(t, router, "gopher"); got != cacheMiss || !slices.Equal(ids, []string{"1"}) {
+				t.Fatalf("first search = %v, X-Cache %q, want [1] from Meilisearch", ids, got)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			if tt.failure == http.StatusGatewayTimeout {
+				meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+				})
+			} else {
+				meili.handle(http.MethodPost, searchPath, tt.failure, map[string]string{"message": "failed", "code": "failed", "type": "internal"})
+			}
+
+			w := serve(router, http.MethodGet, "/search?q="+tt.query, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.wantCache {
+				t.Errorf("X-Cache = %q, want %q", got, tt.wantCache)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.wantCache == cacheStale {
+				if !response.Success || !slices.Equal(resultIDs(response.Results), []string{"1"}) {
+					t.Errorf("stale response = %+v, want the cached results", response)
+				}
+				if response.Query != tt.query {
+					t.Errorf("query = %q, want the caller's %q", response.Query, tt.query)
+				}
+			} else if response.Success {
+				t.Errorf("response = %+v, want an error", response)
+			}
+		})
+	}
+}
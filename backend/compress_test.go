@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip;q=0.8, br", true},
+		{"br", false},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*, gzip;q=0", false},
+		{"gzip;q=0, *", false},
+		{"identity, *;q=0.5", true},
+		{"x-gzip", false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// gunzip decompresses body, failing the test when it is not gzip
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("body is not valid gzip: %v", err)
+	}
+	return data
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("search results ", 200)
+	router := gin.New()
+	router.Use(gzipMiddleware(1024, "/health"))
+	router.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	router.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "tiny") })
+	router.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	router.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.String(http.StatusOK, large)
+	})
+	router.HEAD("/large", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+		wantBody       string
+	}{
+		{"large body", http.MethodGet, "/large", "gzip, deflate", true, large},
+		{"no Accept-Encoding", http.MethodGet, "/large", "", false, large},
+		{"gzip refused", http.MethodGet, "/large", "gzip;q=0", false, large},
+		{"other encoding only", http.MethodGet, "/large", "br", false, large},
+		{"below the threshold", http.MethodGet, "/small", "gzip", false, "tiny"},
+		{"excluded path", http.MethodGet, "/health", "gzip", false, large},
+		{"already encoded", http.MethodGet, "/encoded", "gzip", false, large},
+		{"HEAD request", http.MethodHead, "/large", "gzip", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.path, "", "Accept-Encoding", tt.acceptEncoding)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+
+			body := w.Body.Bytes()
+			if tt.wantGzip {
+				if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+					t.Fatalf("Content-Encoding = %q, want gzip", got)
+				}
+				if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+					t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+				}
+				body = gunzip(t, body)
+			} else if got := w.Header().Get("Content-Encoding"); got == "gzip" {
+				t.Errorf("Content-Encoding = gzip, want an uncompressed body")
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q..., want %q...", truncateRunes(string(body), 20), truncateRunes(tt.wantBody, 20))
+			}
+		})
+	}
+}
+
+func TestGzipSearchResponsesAndETags(t *testing.T) {
+	var hits []map[string]interface{}
+	for _, id := range strings.Split("abcdefghijklmnopqrst", "") {
+		hits = append(hits, map[string]interface{}{"id": id, "title": "Result " + id, "content": strings.Repeat("text ", 20)})
+	}
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(hits...))
+	config := testConfig(meili.URL)
+
+	router := gin.New()
+	router.Use(gzipMiddleware(config.GzipMinSize))
+	router.GET("/search", searchHandler(meili.searcher(), nil, config))
+
+	plain := serve(router, http.MethodGet, "/search?q=result", "")
+	compressed := serve(router, http.MethodGet, "/search?q=result", "", "Accept-Encoding", "gzip")
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", compressed.Header().Get("Content-Encoding"))
+	}
+
+	var want, got SearchResponse
+	decodeJSON(t, plain, &want)
+	if err := json.Unmarshal(gunzip(t, compressed.Body.Bytes()), &got); err != nil {
+		t.Fatalf("decompressed body is not JSON: %v", err)
+	}
+	want.TookMs, got.TookMs = 0, 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decompressed response differs from the uncompressed one")
+	}
+
+	// The weak ETag is the same for both encodings and still answers
+	// conditional requests with an empty, uncompressed 304
+	etag := compressed.Header().Get("ETag")
+	if etag == "" || etag != plain.Header().Get("ETag") {
+		t.Fatalf("ETag = %q compressed, %q plain, want the same weak ETag", etag, plain.Header().Get("ETag"))
+	}
+	notModified := serve(router, http.MethodGet, "/search?q=result", "", "Accept-Encoding", "gzip", "If-None-Match", etag)
+	if notModified.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", notModified.Code)
+	}
+	if notModified.Body.Len() != 0 || notModified.Header().Get("Content-Encoding") != "" {
+		t.Errorf("304 has body %q and Content-Encoding %q, want neither", notModified.Body, notModified.Header().Get("Content-Encoding"))
+	}
+	if notModified.Header().Get("ETag") != etag {
+		t.Errorf("304 ETag = %q, want %q", notModified.Header().Get("ETag"), etag)
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the application configuration
+type Config struct {
+	MeilisearchURL  string        `yaml:"meilisearch_url"`
+	MeilisearchURLs []string      `yaml:"meilisearch_urls"`
+	MeilisearchKey  string        `yaml:"meilisearch_key"`
+	Port            string        `yaml:"port"`
+	TLSCertFile     string        `yaml:"tls_cert_file"`
+	TLSKeyFile      string        `yaml:"tls_key_file"`
+	IndexName       string        `yaml:"index_name"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	SearchTimeout   time.Duration `yaml:"search_timeout"`
+	MaxSuggestions  int           `yaml:"max_suggestions"`
+	MaxQueryLength  int           `yaml:"max_query_length"`
+	MaxSearchLimit  int           `yaml:"max_search_limit"`
+
+	DefaultSearchLimit int `yaml:"default_search_limit"`
+
+	// MaxContentLength caps the content of search results and raw hits at
+	// this many characters, 0 for no cap
+	MaxContentLength int `yaml:"max_content_length"`
+
+	// Aliases maps names accepted by the index parameter of /search to
+	// index UIDs
+	Aliases map[string]string `yaml:"aliases"`
+
+	// IndexLanguages maps language tags to the index searched for visitors
+	// whose Accept-Language prefers that language
+	IndexLanguages map[string]string `yaml:"index_languages"`
+
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	LogLevel           string   `yaml:"log_level"`
+
+	OTLPEndpoint    string `yaml:"otel_exporter_otlp_endpoint"`
+	OTELServiceName string `yaml:"otel_service_name"`
+
+	RateLimitRPS   float64 `yaml:"rate_limit_rps"`
+	RateLimitBurst int     `yaml:"rate_limit_burst"`
+
+	// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header is believed when identifying clients
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	GzipMinSize int `yaml:"gzip_min_size"`
+
+	CacheSize int           `yaml:"cache_size"`
+	CacheTTL  time.Duration `yaml:"cache_ttl"`
+	RedisURL  string        `yaml:"redis_url"`
+
+	StaleOnError bool          `yaml:"stale_on_error"`
+	StaleTTL     time.Duration `yaml:"stale_ttl"`
+
+	// BlocklistFile names a file of terms, one per line, that queries must
+	// not contain. BlocklistAction is "empty" to answer blocked queries with
+	// no results or "reject" to fail them with a 400.
+	BlocklistFile   string     `yaml:"blocklist_file"`
+	BlocklistAction string     `yaml:"blocklist_action"`
+	Blocklist       *Blocklist `yaml:"-"`
+
+	// WarmQueries lists queries to run at startup to fill the cache: a
+	// comma-separated list or the path of a file with one query per line
+	WarmQueries string `yaml:"warm_queries"`
+
+	APIAuthKey         string `yaml:"api_auth_key"`
+	RequireAuthForRead bool   `yaml:"require_auth_for_read"`
+
+	// LegacyRoutesSunset is the YYYY-MM-DD date after which the unversioned
+	// routes may be removed, announced in their Sunset header
+	LegacyRoutesSunset string `yaml:"legacy_routes_sunset"`
+
+	MeiliMaxRetries     int           `yaml:"meili_max_retries"`
+	MeiliRetryBaseDelay time.Duration `yaml:"meili_retry_base_delay"`
+
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+
+	MeiliTimeout         time.Duration `yaml:"meili_timeout"`
+	MeiliMaxIdleConns    int           `yaml:"meili_max_idle_conns"`
+	MeiliIdleConnTimeout time.Duration `yaml:"meili_idle_conn_timeout"`
+
+	BreakerFailureThreshold int           `yaml:"breaker_failure_threshold"`
+	BreakerCooldown         time.Duration `yaml:"breaker_cooldown"`
+
+	SemanticEmbedder string  `yaml:"semantic_embedder"`
+	SemanticRatio    float64 `yaml:"semantic_ratio"`
+
+	DidYouMeanThreshold int `yaml:"did_you_mean_threshold"`
+
+	// SafeSearch hides the documents whose SafeSearchAttribute is true
+	// unless a search passes safe=false
+	SafeSearch          bool   `yaml:"safe_search"`
+	SafeSearchAttribute string `yaml:"safe_search_attribute"`
+
+	// SearchLocales passes the lang parameter of searches on to Meilisearch
+	// as the query locale, which needs Meilisearch 1.10 or later
+	SearchLocales bool `yaml:"search_locales"`
+
+	IngestBatchSize int      `yaml:"ingest_batch_size"`
+	IngestWorkers   int      `yaml:"ingest_workers"`
+	StripHTMLFields []string `yaml:"strip_html_fields"`
+
+	// MaxBodyBytes caps the request body of the document upload endpoints,
+	// 0 for no limit
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+	CrawlMaxPages   int    `yaml:"crawl_max_pages"`
+	CrawlMaxJobs    int    `yaml:"crawl_max_jobs"`
+	CrawlSameDomain bool   `yaml:"crawl_same_domain"`
+	CrawlUserAgent  string `yaml:"crawl_user_agent"`
+
+	AnalyticsEnabled bool          `yaml:"analytics_enabled"`
+	AnalyticsFile    string        `yaml:"analytics_file"`
+	AnalyticsWindow  time.Duration `yaml:"analytics_window"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		MeilisearchURL:  "http://meilisearch:7700",
+		MeilisearchKey:  "masterKey123",
+		Port:            "8080",
+		IndexName:       "documents",
+		ShutdownTimeout: 10 * time.Second,
+		SearchTimeout:   5 * time.Second,
+		MaxSuggestions:  10,
+		MaxQueryLength:  512,
+		MaxSearchLimit:  100,
+
+		DefaultSearchLimit: 20,
+
+		CORSAllowedOrigins: []string{"*"},
+		LogLevel:           "info",
+
+		OTELServiceName: "search-engine-backend",
+
+		RateLimitRPS:   10,
+		RateLimitBurst: 20,
+
+		GzipMinSize: 1024,
+
+		CacheSize: 1000,
+		CacheTTL:  time.Minute,
+
+		StaleTTL: time.Hour,
+
+		BlocklistAction: "empty",
+
+		SafeSearchAttribute: "nsfw",
+
+		LegacyRoutesSunset: "2027-04-15",
+
+		MeiliMaxRetries:     2,
+		MeiliRetryBaseDelay: 100 * time.Millisecond,
+
+		HealthCheckInterval: 10 * time.Second,
+
+		MeiliTimeout:         30 * time.Second,
+		MeiliMaxIdleConns:    100,
+		MeiliIdleConnTimeout: 90 * time.Second,
+
+		BreakerFailureThreshold: 5,
+		BreakerCooldown:         30 * time.Second,
+
+		SemanticEmbedder: "default",
+		SemanticRatio:    0.5,
+
+		DidYouMeanThreshold: 5,
+
+		IngestBatchSize: 1000,
+		IngestWorkers:   4,
+		MaxBodyBytes:    100 << 20,
+		StripHTMLFields: []string{"title", "content"},
+
+		CrawlMaxPages:   50,
+		CrawlMaxJobs:    2,
+		CrawlSameDomain: true,
+		CrawlUserAgent:  "SearchEngine-Crawler/1.0",
+
+		AnalyticsWindow: 24 * time.Hour,
+	}
+}
+
+// loadConfig builds the configuration from the defaults, then the optional
+// YAML file named by CONFIG_FILE, then environment variables, each layer
+// overriding the previous one
+func loadConfig() (*Config, error) {
+	config := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	config.MeilisearchURL = getEnv("MEILISEARCH_URL", config.MeilisearchURL)
+	config.MeilisearchURLs = getEnvList("MEILISEARCH_URLS", config.MeilisearchURLs)
+	config.MeilisearchKey = getEnv("MEILISEARCH_KEY", config.MeilisearchKey)
+	config.Port = getEnv("PORT", config.Port)
+	config.TLSCertFile = getEnv("TLS_CERT_FILE", config.TLSCertFile)
+	config.TLSKeyFile = getEnv("TLS_KEY_FILE", config.TLSKeyFile)
+	config.IndexName = getEnv("INDEX_NAME", config.IndexName)
+	config.Aliases = getEnvMap("ALIASES", config.Aliases)
+	config.IndexLanguages = getEnvMap("INDEX_LANGUAGES", config.IndexLanguages)
+	config.CORSAllowedOrigins = getEnvList("CORS_ALLOWED_ORIGINS", config.CORSAllowedOrigins)
+	config.LogLevel = getEnv("LOG_LEVEL", config.LogLevel)
+	config.OTLPEndpoint = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", config.OTLPEndpoint)
+	config.OTELServiceName = getEnv("OTEL_SERVICE_NAME", config.OTELServiceName)
+	config.TrustedProxies = getEnvList("TRUSTED_PROXIES", config.TrustedProxies)
+	config.RedisURL = getEnv("REDIS_URL", config.RedisURL)
+	config.BlocklistFile = getEnv("BLOCKLIST_FILE", config.BlocklistFile)
+	config.BlocklistAction = getEnv("BLOCKLIST_ACTION", config.BlocklistAction)
+	config.WarmQueries = getEnv("WARM_QUERIES", config.WarmQueries)
+	config.APIAuthKey = getEnv("API_AUTH_KEY", config.APIAuthKey)
+	config.LegacyRoutesSunset = getEnv("LEGACY_ROUTES_SUNSET", config.LegacyRoutesSunset)
+	config.SemanticEmbedder = getEnv("SEMANTIC_EMBEDDER", config.SemanticEmbedder)
+	config.SafeSearchAttribute = getEnv("SAFE_SEARCH_ATTRIBUTE", config.SafeSearchAttribute)
+	config.StripHTMLFields = getEnvList("STRIP_HTML_FIELDS", config.StripHTMLFields)
+	config.CrawlUserAgent = getEnv("CRAWL_USER_AGENT", config.CrawlUserAgent)
+	config.AnalyticsFile = getEnv("ANALYTICS_FILE", config.AnalyticsFile)
+
+	// Every malformed number, boolean or duration is reported at once
+	if err := errors.Join(
+		getEnvDuration("SHUTDOWN_TIMEOUT", &config.ShutdownTimeout),
+		getEnvDuration("SEARCH_TIMEOUT", &config.SearchTimeout),
+		getEnvInt("MAX_SUGGESTIONS", &config.MaxSuggestions),
+		getEnvInt("MAX_QUERY_LENGTH", &config.MaxQueryLength),
+		getEnvInt("MAX_SEARCH_LIMIT", &config.MaxSearchLimit),
+		getEnvInt("DEFAULT_SEARCH_LIMIT", &config.DefaultSearchLimit),
+		getEnvInt("MAX_CONTENT_LENGTH", &config.MaxContentLength),
+		getEnvFloat("RATE_LIMIT_RPS", &config.RateLimitRPS),
+		getEnvInt("RATE_LIMIT_BURST", &config.RateLimitBurst),
+		getEnvInt("GZIP_MIN_SIZE", &config.GzipMinSize),
+		getEnvInt("CACHE_SIZE", &config.CacheSize),
+		getEnvDuration("CACHE_TTL", &config.CacheTTL),
+		getEnvBool("STALE_ON_ERROR", &config.StaleOnError),
+		getEnvDuration("STALE_TTL", &config.StaleTTL),
+		getEnvBool("REQUIRE_AUTH_FOR_READ", &config.RequireAuthForRead),
+		getEnvInt("MEILI_MAX_RETRIES", &config.MeiliMaxRetries),
+		getEnvDuration("MEILI_RETRY_BASE_DELAY", &config.MeiliRetryBaseDelay),
+		getEnvDuration("HEALTH_CHECK_INTERVAL", &config.HealthCheckInterval),
+		getEnvDuration("MEILI_TIMEOUT", &config.MeiliTimeout),
+		getEnvInt("MEILI_MAX_IDLE_CONNS", &config.MeiliMaxIdleConns),
+		getEnvDuration("MEILI_IDLE_CONN_TIMEOUT", &config.MeiliIdleConnTimeout),
+		getEnvInt("BREAKER_FAILURE_THRESHOLD", &config.BreakerFailureThreshold),
+		getEnvDuration("BREAKER_COOLDOWN", &config.BreakerCooldown),
+		getEnvFloat("SEMANTIC_RATIO", &config.SemanticRatio),
+		getEnvInt("DID_YOU_MEAN_THRESHOLD", &config.DidYouMeanThreshold),
+		getEnvBool("SEARCH_LOCALES", &config.SearchLocales),
+		getEnvBool("SAFE_SEARCH", &config.SafeSearch),
+		getEnvInt("INGEST_BATCH_SIZE", &config.IngestBatchSize),
+		getEnvInt("INGEST_WORKERS", &config.IngestWorkers),
+		getEnvInt64("MAX_BODY_BYTES", &config.MaxBodyBytes),
+		getEnvInt("CRAWL_MAX_PAGES", &config.CrawlMaxPages),
+		getEnvInt("CRAWL_MAX_JOBS", &config.CrawlMaxJobs),
+		getEnvBool("CRAWL_SAME_DOMAIN", &config.CrawlSameDomain),
+		getEnvBool("ANALYTICS_ENABLED", &config.AnalyticsEnabled),
+		getEnvDuration("ANALYTICS_WINDOW", &config.AnalyticsWindow),
+	); err != nil {
+		return nil, err
+	}
+
+	// MEILISEARCH_URLS lists every host in failover order and takes
+	// precedence over MEILISEARCH_URL, which becomes its first entry
+	if len(config.MeilisearchURLs) > 0 {
+		config.MeilisearchURL = config.MeilisearchURLs[0]
+	} else {
+		config.MeilisearchURLs = []string{config.MeilisearchURL}
+	}
+
+	if config.BlocklistFile != "" {
+		blocklist, err := loadBlocklist(config.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Blocklist = blocklist
+	}
+
+	return config, nil
+}
+
+// Validate reports the first configuration value that cannot work
+func (config *Config) Validate() error {
+	// MEILISEARCH_URL is normally the first of MEILISEARCH_URLS, but a
+	// Config not built by loadConfig may set it alone
+	for _, host := range append([]string{config.MeilisearchURL}, config.MeilisearchURLs...) {
+		parsed, err := url.Parse(host)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("MEILISEARCH_URL %q is not a valid URL", host)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("MEILISEARCH_URL %q must use http or https", host)
+		}
+	}
+
+	port, err := strconv.Atoi(config.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("PORT %q must be a number between 1 and 65535", config.Port)
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if strings.TrimSpace(config.IndexName) == "" {
+		return fmt.Errorf("INDEX_NAME must not be empty")
+	}
+	for alias, uid := range config.Aliases {
+		if !indexUIDPattern.MatchString(uid) {
+			return fmt.Errorf("ALIASES entry %q points to invalid index UID %q", alias, uid)
+		}
+	}
+	for tag, uid := range config.IndexLanguages {
+		if _, err := language.Parse(tag); err != nil {
+			return fmt.Errorf("INDEX_LANGUAGES entry %q is not a valid language tag", tag)
+		}
+		if !indexUIDPattern.MatchString(uid) {
+			return fmt.Errorf("INDEX_LANGUAGES entry %q points to invalid index UID %q", tag, uid)
+		}
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must be positive, got %s", config.ShutdownTimeout)
+	}
+	if config.SearchTimeout <= 0 {
+		return fmt.Errorf("SEARCH_TIMEOUT must be positive, got %s", config.SearchTimeout)
+	}
+	if config.MaxSuggestions < 1 {
+		return fmt.Errorf("MAX_SUGGESTIONS must be at least 1, got %d", config.MaxSuggestions)
+	}
+	if config.MaxQueryLength < 1 {
+		return fmt.Errorf("MAX_QUERY_LENGTH must be at least 1, got %d", config.MaxQueryLength)
+	}
+	if config.MaxSearchLimit < 1 {
+		return fmt.Errorf("MAX_SEARCH_LIMIT must be at least 1, got %d", config.MaxSearchLimit)
+	}
+	if config.DefaultSearchLimit < 1 {
+		return fmt.Errorf("DEFAULT_SEARCH_LIMIT must be at least 1, got %d", config.DefaultSearchLimit)
+	}
+	if config.MaxContentLength < 0 {
+		return fmt.Errorf("MAX_CONTENT_LENGTH must not be negative, got %d", config.MaxContentLength)
+	}
+
+	if len(config.CORSAllowedOrigins) == 0 {
+		return fmt.Errorf("CORS_ALLOWED_ORIGINS must list at least one origin or *")
+	}
+	for _, origin := range config.CORSAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("CORS_ALLOWED_ORIGINS entry %q must be * or an http(s) origin", origin)
+		}
+	}
+
+	if _, err := parseLogLevel(config.LogLevel); err != nil {
+		return fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+
+	if config.OTLPEndpoint != "" {
+		parsed, err := url.Parse(config.OTLPEndpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT %q must be an http(s) URL", config.OTLPEndpoint)
+		}
+	}
+
+	if (config.CacheSize > 0 || config.RedisURL != "") && config.CacheTTL <= 0 {
+		return fmt.Errorf("CACHE_TTL must be positive when caching is enabled, got %s", config.CacheTTL)
+	}
+
+	if config.SafeSearch && !attributeNamePattern.MatchString(config.SafeSearchAttribute) {
+		return fmt.Errorf("SAFE_SEARCH_ATTRIBUTE %q is not a valid attribute name", config.SafeSearchAttribute)
+	}
+
+	if config.BlocklistAction != "empty" && config.BlocklistAction != "reject" {
+		return fmt.Errorf("BLOCKLIST_ACTION must be empty or reject, got %q", config.BlocklistAction)
+	}
+
+	if config.StaleOnError && config.StaleTTL <= 0 {
+		return fmt.Errorf("STALE_TTL must be positive when STALE_ON_ERROR is enabled, got %s", config.StaleTTL)
+	}
+
+	if config.RequireAuthForRead && config.APIAuthKey == "" {
+		return fmt.Errorf("REQUIRE_AUTH_FOR_READ needs API_AUTH_KEY to be set")
+	}
+
+	if _, err := config.legacyRoutesSunset(); err != nil {
+		return fmt.Errorf("LEGACY_ROUTES_SUNSET %q must be a date like 2027-04-15", config.LegacyRoutesSunset)
+	}
+
+	if config.RateLimitRPS > 0 && config.RateLimitBurst < 1 {
+		return fmt.Errorf("RATE_LIMIT_BURST must be at least 1 when rate limiting is enabled, got %d", config.RateLimitBurst)
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("TRUSTED_PROXIES entry %q must be an IP address or CIDR range", proxy)
+			}
+		}
+	}
+
+	if config.MeiliMaxRetries < 0 {
+		return fmt.Errorf("MEILI_MAX_RETRIES must not be negative, got %d", config.MeiliMaxRetries)
+	}
+	if config.MeiliRetryBaseDelay < 0 {
+		return fmt.Errorf("MEILI_RETRY_BASE_DELAY must not be negative, got %s", config.MeiliRetryBaseDelay)
+	}
+	if config.HealthCheckInterval <= 0 {
+		return fmt.Errorf("HEALTH_CHECK_INTERVAL must be positive, got %s", config.HealthCheckInterval)
+	}
+	if config.MeiliTimeout <= 0 {
+		return fmt.Errorf("MEILI_TIMEOUT must be positive, got %s", config.MeiliTimeout)
+	}
+	if config.MeiliMaxIdleConns < 1 {
+		return fmt.Errorf("MEILI_MAX_IDLE_CONNS must be at least 1, got %d", config.MeiliMaxIdleConns)
+	}
+	if config.MeiliIdleConnTimeout <= 0 {
+		return fmt.Errorf("MEILI_IDLE_CONN_TIMEOUT must be positive, got %s", config.MeiliIdleConnTimeout)
+	}
+
+	if config.BreakerFailureThreshold > 0 && config.BreakerCooldown <= 0 {
+		return fmt.Errorf("BREAKER_COOLDOWN must be positive when the circuit breaker is enabled, got %s", config.BreakerCooldown)
+	}
+
+	if strings.TrimSpace(config.SemanticEmbedder) == "" {
+		return fmt.Errorf("SEMANTIC_EMBEDDER must not be empty")
+	}
+	if config.SemanticRatio < 0 || config.SemanticRatio > 1 {
+		return fmt.Errorf("SEMANTIC_RATIO must be between 0 and 1, got %g", config.SemanticRatio)
+	}
+
+	if config.IngestBatchSize < 1 {
+		return fmt.Errorf("INGEST_BATCH_SIZE must be at least 1, got %d", config.IngestBatchSize)
+	}
+	if config.IngestWorkers < 1 {
+		return fmt.Errorf("INGEST_WORKERS must be at least 1, got %d", config.IngestWorkers)
+	}
+	if config.MaxBodyBytes < 0 {
+		return fmt.Errorf("MAX_BODY_BYTES must not be negative, got %d", config.MaxBodyBytes)
+	}
+
+	if config.CrawlMaxPages < 1 {
+		return fmt.Errorf("CRAWL_MAX_PAGES must be at least 1, got %d", config.CrawlMaxPages)
+	}
+	if config.CrawlMaxJobs < 1 {
+		return fmt.Errorf("CRAWL_MAX_JOBS must be at least 1, got %d", config.CrawlMaxJobs)
+	}
+
+	if config.AnalyticsWindow <= 0 {
+		return fmt.Errorf("ANALYTICS_WINDOW must be positive, got %s", config.AnalyticsWindow)
+	}
+
+	return nil
+}
+
+// legacyRoutesSunset parses LegacyRoutesSunset, returning the zero time when
+// it is empty
+func (config *Config) legacyRoutesSunset() (time.Time, error) {
+	if config.LegacyRoutesSunset == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", config.LegacyRoutesSunset)
+}
+
+// loadFile overlays the values present in a YAML file onto config
+func (config *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list, e.g. "https://a.com,https://b.com"
+func getEnvList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		return splitList(value)
+	}
+	return defaultValue
+}
+
+// getEnvMap reads comma-separated name=value pairs, e.g.
+// "current=docs_v2,previous=docs_v1"
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed := make(map[string]string)
+	for _, pair := range splitList(value) {
+		name, target, ok := strings.Cut(pair, "=")
+		name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+		if !ok || name == "" || target == "" {
+			slog.Warn("Invalid name=value pair in environment, ignoring it", "key", key, "pair", pair)
+			continue
+		}
+		parsed[name] = target
+	}
+	return parsed
+}
+
+// getEnvBool, getEnvInt, getEnvInt64, getEnvFloat and getEnvDuration parse
+// the variable key into target when it is set, leaving target alone
+// otherwise. A value that does not parse is an error rather than falling back
+// to the default, so a typo cannot go unnoticed.
+func getEnvBool(key string, target *bool) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a boolean", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func getEnvInt(key string, target *int) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s %q is not an integer", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func getEnvInt64(key string, target *int64) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s %q is not an integer", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func getEnvFloat(key string, target *float64) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a number", key, value)
+	}
+	*target = parsed
+	return nil
+}
+
+func getEnvDuration(key string, target *time.Duration) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a duration such as 500ms or 1m", key, value)
+	}
+	*target = duration
+	return nil
+}
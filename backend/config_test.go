@@ -0,0 +1,335 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a YAML file and points CONFIG_FILE at it
+func writeConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	writeConfigFile(t, `
+meilisearch_url: http://search.internal:7700
+index_name: articles
+search_timeout: 2s
+max_search_limit: 50
+cors_allowed_origins:
+  - https://example.com
+aliases:
+  current: articles_v2
+`)
+	t.Setenv("INDEX_NAME", "")
+	t.Setenv("MEILISEARCH_URL", "")
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	if config.MeilisearchURL != "http://search.internal:7700" {
+		t.Errorf("MeilisearchURL = %q", config.MeilisearchURL)
+	}
+	if config.IndexName != "articles" {
+		t.Errorf("IndexName = %q, want articles", config.IndexName)
+	}
+	if config.SearchTimeout != 2*time.Second {
+		t.Errorf("SearchTimeout = %s, want 2s", config.SearchTimeout)
+	}
+	if config.MaxSearchLimit != 50 {
+		t.Errorf("MaxSearchLimit = %d, want 50", config.MaxSearchLimit)
+	}
+	if !slices.Equal(config.CORSAllowedOrigins, []string{"https://example.com"}) {
+		t.Errorf("CORSAllowedOrigins = %v", config.CORSAllowedOrigins)
+	}
+	if config.Aliases["current"] != "articles_v2" {
+		t.Errorf("Aliases = %v", config.Aliases)
+	}
+
+	// Values the file leaves out keep their defaults
+	if config.Port != "8080" || config.DefaultSearchLimit != 20 {
+		t.Errorf("Port, DefaultSearchLimit = %q, %d, want defaults", config.Port, config.DefaultSearchLimit)
+	}
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	writeConfigFile(t, "index_name: articles\nsearch_timeout: 2s\n")
+	t.Setenv("INDEX_NAME", "products")
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if config.IndexName != "products" {
+		t.Errorf("IndexName = %q, want the environment's products", config.IndexName)
+	}
+	if config.SearchTimeout != 2*time.Second {
+		t.Errorf("SearchTimeout = %s, want the file's 2s", config.SearchTimeout)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed YAML", "index_name: [unclosed\n"},
+		{"wrong type", "max_search_limit: lots\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, tt.content)
+			if _, err := loadConfig(); err == nil {
+				t.Error("loadConfig() succeeded, want an error")
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		if _, err := loadConfig(); err == nil {
+			t.Error("loadConfig() succeeded, want an error")
+		}
+	})
+}
+
+func TestLoadConfigEnvErrors(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		wantErr string
+	}{
+		{"MAX_SEARCH_LIMIT", "lots", `MAX_SEARCH_LIMIT "lots" is not an integer`},
+		{"MAX_BODY_BYTES", "10MB", `MAX_BODY_BYTES "10MB" is not an integer`},
+		{"RATE_LIMIT_RPS", "fast", `RATE_LIMIT_RPS "fast" is not a number`},
+		{"STALE_ON_ERROR", "yes please", `STALE_ON_ERROR "yes please" is not a boolean`},
+		{"SEARCH_TIMEOUT", "5", `SEARCH_TIMEOUT "5" is not a duration such as 500ms or 1m`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv(tt.key, tt.value)
+			_, err := loadConfig()
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("every invalid value is reported", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", "")
+		t.Setenv("CACHE_SIZE", "big")
+		t.Setenv("CACHE_TTL", "forever")
+		_, err := loadConfig()
+		if err == nil || !strings.Contains(err.Error(), "CACHE_SIZE") || !strings.Contains(err.Error(), "CACHE_TTL") {
+			t.Errorf("loadConfig() error = %v, want both CACHE_SIZE and CACHE_TTL", err)
+		}
+	})
+}
+
+func TestLoadConfigMeilisearchURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		url      string
+		urls     string
+		wantURL  string
+		wantURLs []string
+	}{
+		{
+			name:     "single URL",
+			url:      "http://a:7700",
+			wantURL:  "http://a:7700",
+			wantURLs: []string{"http://a:7700"},
+		},
+		{
+			name:     "URL list only",
+			urls:     "http://a:7700,http://b:7700",
+			wantURL:  "http://a:7700",
+			wantURLs: []string{"http://a:7700", "http://b:7700"},
+		},
+		{
+			name:     "list takes precedence over the URL",
+			url:      "http://primary:7700",
+			urls:     "http://a:7700,http://b:7700",
+			wantURL:  "http://a:7700",
+			wantURLs: []string{"http://a:7700", "http://b:7700"},
+		},
+		{
+			name:     "list from the file",
+			file:     "meilisearch_urls: [http://a:7700, http://b:7700]\n",
+			wantURL:  "http://a:7700",
+			wantURLs: []string{"http://a:7700", "http://b:7700"},
+		},
+		{
+			name:     "list from the file with a URL from the environment",
+			file:     "meilisearch_urls: [http://a:7700, http://b:7700]\n",
+			url:      "http://primary:7700",
+			wantURL:  "http://a:7700",
+			wantURLs: []string{"http://a:7700", "http://b:7700"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			t.Setenv("MEILISEARCH_URL", tt.url)
+			t.Setenv("MEILISEARCH_URLS", tt.urls)
+
+			config, err := loadConfig()
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if config.MeilisearchURL != tt.wantURL {
+				t.Errorf("MeilisearchURL = %q, want %q", config.MeilisearchURL, tt.wantURL)
+			}
+			if !slices.Equal(config.MeilisearchURLs, tt.wantURLs) {
+				t.Errorf("MeilisearchURLs = %v, want %v", config.MeilisearchURLs, tt.wantURLs)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaultSearchLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    int
+		wantErr bool
+	}{
+		{"unset", "", 20, false},
+		{"set", "35", 35, false},
+		{"above the maximum", "500", 500, false},
+		{"not a number", "lots", 0, true},
+		{"fractional", "7.5", 0, true},
+		{"zero", "0", 0, true},
+		{"negative", "-5", -5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("DEFAULT_SEARCH_LIMIT", tt.env)
+
+			config, err := loadConfig()
+			if err == nil {
+				err = config.Validate()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loading DEFAULT_SEARCH_LIMIT=%q failed with %v, want error %v", tt.env, err, tt.wantErr)
+			}
+			if !tt.wantErr && config.DefaultSearchLimit != tt.want {
+				t.Errorf("DefaultSearchLimit = %d, want %d", config.DefaultSearchLimit, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want map[string]string
+	}{
+		{"unset", "", nil},
+		{"one alias", "current=docs_v2", map[string]string{"current": "docs_v2"}},
+		{"several aliases", "current=docs_v2, previous = docs_v1", map[string]string{"current": "docs_v2", "previous": "docs_v1"}},
+		{"invalid pairs are skipped", "current=docs_v2,broken,=docs_v0,empty=", map[string]string{"current": "docs_v2"}},
+		{"later pairs win", "current=docs_v1,current=docs_v2", map[string]string{"current": "docs_v2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("ALIASES", tt.env)
+
+			config, err := loadConfig()
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if !maps.Equal(config.Aliases, tt.want) {
+				t.Errorf("Aliases = %v, want %v", config.Aliases, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"URL without scheme", func(c *Config) { c.MeilisearchURLs = []string{"meilisearch:7700"} }, `MEILISEARCH_URL "meilisearch:7700" is not a valid URL`},
+		{"URL that does not parse", func(c *Config) { c.MeilisearchURLs = []string{"http://[::1"} }, `MEILISEARCH_URL "http://[::1" is not a valid URL`},
+		{"non-HTTP URL", func(c *Config) { c.MeilisearchURLs = []string{"ftp://meilisearch:7700"} }, `MEILISEARCH_URL "ftp://meilisearch:7700" must use http or https`},
+		{"second URL invalid", func(c *Config) { c.MeilisearchURLs = []string{"http://a:7700", "nope"} }, `MEILISEARCH_URL "nope" is not a valid URL`},
+		{"explicit URL invalid next to the list", func(c *Config) {
+			c.MeilisearchURL, c.MeilisearchURLs = "meilisearch:7700", []string{"http://a:7700"}
+		}, `MEILISEARCH_URL "meilisearch:7700" is not a valid URL`},
+		{"non-numeric port", func(c *Config) { c.Port = "http" }, `PORT "http" must be a number between 1 and 65535`},
+		{"port zero", func(c *Config) { c.Port = "0" }, `PORT "0" must be a number between 1 and 65535`},
+		{"port out of range", func(c *Config) { c.Port = "70000" }, `PORT "70000" must be a number between 1 and 65535`},
+		{"empty index name", func(c *Config) { c.IndexName = "  " }, "INDEX_NAME must not be empty"},
+		{"TLS key without cert", func(c *Config) { c.TLSKeyFile = "key.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE must be set together"},
+		{"TLS cert without key", func(c *Config) { c.TLSCertFile = "cert.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE must be set together"},
+		{"non-positive search timeout", func(c *Config) { c.SearchTimeout = 0 }, "SEARCH_TIMEOUT must be positive, got 0s"},
+		{"non-positive shutdown timeout", func(c *Config) { c.ShutdownTimeout = -time.Second }, "SHUTDOWN_TIMEOUT must be positive, got -1s"},
+		{"no suggestions", func(c *Config) { c.MaxSuggestions = 0 }, "MAX_SUGGESTIONS must be at least 1, got 0"},
+		{"invalid log level", func(c *Config) { c.LogLevel = "loud" }, `LOG_LEVEL: unknown log level "loud"`},
+		{"invalid alias target", func(c *Config) { c.Aliases = map[string]string{"x": "bad uid"} }, `ALIASES entry "x" points to invalid index UID "bad uid"`},
+		{"invalid language tag", func(c *Config) { c.IndexLanguages = map[string]string{"english": "docs_en"} }, `INDEX_LANGUAGES entry "english" is not a valid language tag`},
+		{"invalid language index", func(c *Config) { c.IndexLanguages = map[string]string{"en": "docs en"} }, `INDEX_LANGUAGES entry "en" points to invalid index UID "docs en"`},
+		{"rate limit without burst", func(c *Config) { c.RateLimitBurst = 0 }, "RATE_LIMIT_BURST must be at least 1 when rate limiting is enabled, got 0"},
+		{"trusted proxies", func(c *Config) { c.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16", "::1"} }, ""},
+		{"invalid trusted proxy", func(c *Config) { c.TrustedProxies = []string{"proxy.local"} }, `TRUSTED_PROXIES entry "proxy.local" must be an IP address or CIDR range`},
+		{"read auth without key", func(c *Config) { c.RequireAuthForRead = true }, "REQUIRE_AUTH_FOR_READ needs API_AUTH_KEY to be set"},
+		{"semantic ratio out of range", func(c *Config) { c.SemanticRatio = 1.5 }, "SEMANTIC_RATIO must be between 0 and 1, got 1.5"},
+		{"empty semantic embedder", func(c *Config) { c.SemanticEmbedder = " " }, "SEMANTIC_EMBEDDER must not be empty"},
+		{"non-positive Meilisearch timeout", func(c *Config) { c.MeiliTimeout = 0 }, "MEILI_TIMEOUT must be positive, got 0s"},
+		{"no idle Meilisearch connections", func(c *Config) { c.MeiliMaxIdleConns = 0 }, "MEILI_MAX_IDLE_CONNS must be at least 1, got 0"},
+		{"non-positive idle connection timeout", func(c *Config) { c.MeiliIdleConnTimeout = -time.Second }, "MEILI_IDLE_CONN_TIMEOUT must be positive, got -1s"},
+		{"negative max content length", func(c *Config) { c.MaxContentLength = -1 }, "MAX_CONTENT_LENGTH must not be negative, got -1"},
+		{"negative max body bytes", func(c *Config) { c.MaxBodyBytes = -1 }, "MAX_BODY_BYTES must not be negative, got -1"},
+		{"no ingest workers", func(c *Config) { c.IngestWorkers = 0 }, "INGEST_WORKERS must be at least 1, got 0"},
+		{"invalid safe search attribute", func(c *Config) { c.SafeSearch = true; c.SafeSearchAttribute = "nsfw flag" }, `SAFE_SEARCH_ATTRIBUTE "nsfw flag" is not a valid attribute name`},
+		{"safe search attribute unused when off", func(c *Config) { c.SafeSearchAttribute = "nsfw flag" }, ""},
+		{"zero default search limit", func(c *Config) { c.DefaultSearchLimit = 0 }, "DEFAULT_SEARCH_LIMIT must be at least 1, got 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("http://meilisearch:7700")
+			tt.mutate(config)
+
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
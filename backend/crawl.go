@@ -0,0 +1,731 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxPageSize caps how much of a page the crawler reads
+	maxPageSize = 2 << 20
+	// maxCrawlContent caps the indexed content of a page, in bytes
+	maxCrawlContent = 5000
+	// crawlJobRetention is how long finished jobs stay available for polling
+	crawlJobRetention = time.Hour
+	// maxCrawlRedirects caps the redirects followed for one page
+	maxCrawlRedirects = 10
+	// maxCrawlDelay caps the Crawl-delay honored from robots.txt, so a site
+	// cannot stall a job indefinitely
+	maxCrawlDelay = 30 * time.Second
+)
+
+// CrawlRequest is the JSON body accepted by POST /crawl
+type CrawlRequest struct {
+	URL        string `json:"url"`
+	MaxDepth   int    `json:"max_depth"`
+	MaxPages   int    `json:"max_pages"`
+	SameDomain *bool  `json:"same_domain"`
+}
+
+// CrawlJob tracks one asynchronous crawl
+type CrawlJob struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	URL          string     `json:"url"`
+	PagesCrawled int        `json:"pages_crawled"`
+	PagesIndexed int        `json:"pages_indexed"` // pages sent to Meilisearch
+	TaskUIDs     []int64    `json:"task_uids"`
+	Error        string     `json:"error,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+
+	// index is the index the job writes to; only requests for that index,
+	// i.e. from the same tenant, can see the job
+	index string
+}
+
+// Crawler fetches pages breadth-first from a seed URL and indexes their text.
+// Jobs run in the background, at most CRAWL_MAX_JOBS at a time, and are kept
+// in memory so clients can poll them.
+type Crawler struct {
+	client     *MeiliClient
+	cache      Cache
+	config     *Config
+	httpClient *http.Client
+
+	// allowPrivateAddresses lifts the check that keeps crawls on public
+	// addresses, for tests that crawl a local server
+	allowPrivateAddresses bool
+
+	// ctx is cancelled by Stop to end the running jobs
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*CrawlJob
+	active int
+}
+
+func newCrawler(client *MeiliClient, cache Cache, config *Config) *Crawler {
+	ctx, cancel := context.WithCancel(context.Background())
+	cr := &Crawler{
+		client: client,
+		cache:  cache,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*CrawlJob),
+	}
+
+	// Every connection, whether for a page, a redirect or robots.txt, is
+	// checked once its address is resolved. A proxy would connect on the
+	// crawler's behalf, out of reach of the check, so none is used.
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: cr.dialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	cr.httpClient = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	return cr
+}
+
+// errPrivateAddress refuses a crawl of an address that is not public
+var errPrivateAddress = errors.New("crawling non-public addresses is not allowed")
+
+// dialControl refuses connections to loopback, private, link-local,
+// unspecified and multicast addresses, so crawls cannot reach the backend's
+// own network. It sees the resolved address, so a public host name pointing
+// at a private address is refused too.
+func (cr *Crawler) dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !cr.publicAddress(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, host)
+	}
+	return nil
+}
+
+// publicAddress reports whether the crawler may connect to ip
+func (cr *Crawler) publicAddress(ip net.IP) bool {
+	if cr.allowPrivateAddresses {
+		return true
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// publicURL rejects URLs whose host is a non-public IP address up front.
+// Host names are only checked by dialControl once they are resolved.
+func (cr *Crawler) publicURL(u *url.URL) error {
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !cr.publicAddress(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, u.Hostname())
+	}
+	return nil
+}
+
+// Stop cancels the running jobs and waits until each has recorded its
+// outcome. Pages fetched before the cancellation are still indexed.
+func (cr *Crawler) Stop() {
+	cr.cancel()
+	cr.running.Wait()
+}
+
+// startHandler validates the crawl request and starts the crawl, returning
+// the job ID to poll at GET /crawl/:id
+func (cr *Crawler) startHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body CrawlRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+
+		seed, err := url.Parse(body.URL)
+		if err != nil || (seed.Scheme != "http" && seed.Scheme != "https") || seed.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Field 'url' must be an absolute http(s) URL",
+			})
+			return
+		}
+		seed.Fragment = ""
+		if err := cr.publicURL(seed); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Field 'url' must point to a public address",
+			})
+			return
+		}
+
+		if body.MaxDepth < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Field 'max_depth' must not be negative",
+			})
+			return
+		}
+		if body.MaxPages <= 0 || body.MaxPages > cr.config.CrawlMaxPages {
+			body.MaxPages = cr.config.CrawlMaxPages
+		}
+		sameDomain := cr.config.CrawlSameDomain
+		if body.SameDomain != nil {
+			sameDomain = *body.SameDomain
+		}
+
+		job := &CrawlJob{
+			ID:        newUUID(),
+			Status:    "running",
+			URL:       seed.String(),
+			TaskUIDs:  []int64{},
+			StartedAt: time.Now().UTC(),
+			index:     indexFor(c, cr.config),
+		}
+
+		cr.mu.Lock()
+		if cr.ctx.Err() != nil {
+			cr.mu.Unlock()
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "The server is shutting down",
+			})
+			return
+		}
+		if cr.active >= cr.config.CrawlMaxJobs {
+			cr.mu.Unlock()
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": fmt.Sprintf("%d crawls are already running, retry once one has finished", cr.active),
+			})
+			return
+		}
+		cr.pruneJobs()
+		cr.jobs[job.ID] = job
+		cr.active++
+		cr.running.Add(1)
+		cr.mu.Unlock()
+
+		go func() {
+			defer cr.running.Done()
+			cr.run(job, cr.client.Index(job.index), seed, body.MaxDepth, body.MaxPages, sameDomain)
+		}()
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id": job.ID,
+			"status": job.Status,
+		})
+	}
+}
+
+// statusHandler reports the progress of a crawl job. Jobs of other tenants
+// are not found.
+func (cr *Crawler) statusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cr.mu.Lock()
+		job, ok := cr.jobs[c.Param("id")]
+		ok = ok && job.index == indexFor(c, cr.config)
+		var snapshot CrawlJob
+		if ok {
+			snapshot = *job
+			snapshot.TaskUIDs = append([]int64{}, job.TaskUIDs...)
+		}
+		cr.mu.Unlock()
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Crawl job not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, snapshot)
+	}
+}
+
+// pruneJobs forgets jobs that finished more than crawlJobRetention ago. The
+// caller must hold cr.mu.
+func (cr *Crawler) pruneJobs() {
+	for id, job := range cr.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > crawlJobRetention {
+			delete(cr.jobs, id)
+		}
+	}
+}
+
+type crawlTarget struct {
+	url   *url.URL
+	depth int
+}
+
+// run crawls breadth-first from seed, following links up to maxDepth hops
+// away and fetching at most maxPages pages. Redirects are held to the same
+// domain and robots.txt rules as links.
+func (cr *Crawler) run(job *CrawlJob, index *MeiliIndex, seed *url.URL, maxDepth, maxPages int, sameDomain bool) {
+	ctx := cr.ctx
+	batcher := newDocumentBatcher(index, cr.config.IngestBatchSize, cr.config.IngestWorkers, "")
+	robots := make(map[string]*robotsRules)
+	rulesFor := func(u *url.URL) *robotsRules {
+		rules, ok := robots[u.Host]
+		if !ok {
+			rules = cr.fetchRobots(ctx, u)
+			robots[u.Host] = rules
+		}
+		return rules
+	}
+
+	httpClient := *cr.httpClient
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxCrawlRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxCrawlRedirects)
+		}
+		if sameDomain && req.URL.Host != seed.Host {
+			return fmt.Errorf("redirect to %s leaves %s", req.URL.Host, seed.Host)
+		}
+		if err := cr.publicURL(req.URL); err != nil {
+			return fmt.Errorf("redirect to %s refused: %w", req.URL, err)
+		}
+		if !rulesFor(req.URL).allowed(req.URL.RequestURI()) {
+			return fmt.Errorf("redirect to %s is disallowed by robots.txt", req.URL)
+		}
+		return nil
+	}
+
+	// visited holds every URL queued so far, fetched the final URLs of the
+	// pages fetched, which redirects can reach ahead of their queued links
+	visited := map[string]bool{seed.String(): true}
+	fetched := make(map[string]bool)
+	lastFetch := make(map[string]time.Time)
+	queue := []crawlTarget{{url: seed, depth: 0}}
+	crawled := 0
+
+	for len(queue) > 0 && crawled < maxPages && ctx.Err() == nil {
+		target := queue[0]
+		queue = queue[1:]
+		if fetched[target.url.String()] {
+			continue
+		}
+
+		rules := rulesFor(target.url)
+		if !rules.allowed(target.url.RequestURI()) {
+			continue
+		}
+
+		// Wait out the host's Crawl-delay since the previous request
+		if wait := time.Until(lastFetch[target.url.Host].Add(rules.crawlDelay())); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+		}
+		lastFetch[target.url.Host] = time.Now()
+
+		page, err := cr.fetchPage(ctx, &httpClient, target.url)
+		crawled++
+		cr.update(job, func() { job.PagesCrawled = crawled })
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Crawl fetch failed", "job_id", job.ID, "url", target.url.String(), "error", err)
+			}
+			continue
+		}
+		if fetched[page.url.String()] {
+			continue
+		}
+		fetched[page.url.String()] = true
+		visited[page.url.String()] = true
+
+		if page.content != "" {
+			if err := batcher.add(page.document()); err != nil {
+				cr.finish(job, batcher, err)
+				return
+			}
+			indexed, taskUIDs, _ := batcher.progress()
+			cr.update(job, func() {
+				job.PagesIndexed = indexed
+				job.TaskUIDs = taskUIDs
+			})
+		}
+
+		if target.depth >= maxDepth {
+			continue
+		}
+		for _, link := range page.links {
+			next, err := page.url.Parse(link)
+			if err != nil || (next.Scheme != "http" && next.Scheme != "https") {
+				continue
+			}
+			next.Fragment = ""
+			if sameDomain && next.Host != seed.Host {
+				continue
+			}
+			if visited[next.String()] {
+				continue
+			}
+			visited[next.String()] = true
+			queue = append(queue, crawlTarget{url: next, depth: target.depth + 1})
+		}
+	}
+
+	batcher.flush()
+	cr.finish(job, batcher, ctx.Err())
+}
+
+// update applies fn to job under the crawler lock
+func (cr *Crawler) update(job *CrawlJob, fn func()) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	fn()
+}
+
+// finish waits for the batches still being sent and records the outcome of a
+// crawl, failed with err or the error of a failed batch, or cancelled when
+// err is context.Canceled
+func (cr *Crawler) finish(job *CrawlJob, batcher *documentBatcher, err error) {
+	if batchErr := batcher.wait(); err == nil {
+		err = batchErr
+	}
+	indexed, taskUIDs, _ := batcher.progress()
+	invalidateAfterTasks(cr.client, cr.cache, taskUIDs...)
+
+	cancelled := errors.Is(err, context.Canceled)
+	cr.update(job, func() {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.PagesIndexed = indexed
+		job.TaskUIDs = taskUIDs
+		switch {
+		case cancelled:
+			job.Status = "cancelled"
+			job.Error = "The crawl was cancelled by a server shutdown"
+		case err != nil:
+			job.Status = "failed"
+			job.Error = err.Error()
+		default:
+			job.Status = "succeeded"
+		}
+		cr.active--
+	})
+
+	if cancelled {
+		slog.Warn("Crawl cancelled", "job_id", job.ID, "url", job.URL, "pages_indexed", indexed)
+		return
+	}
+	if err != nil {
+		slog.Error("Crawl failed", "job_id", job.ID, "url", job.URL, "error", err)
+		return
+	}
+	slog.Info("Crawl finished", "job_id", job.ID, "url", job.URL, "pages_crawled", job.PagesCrawled, "pages_indexed", job.PagesIndexed)
+}
+
+// crawledPage is the text and outgoing links extracted from an HTML page
+type crawledPage struct {
+	// url is where the page was found, after redirects
+	url     *url.URL
+	title   string
+	content string
+	links   []string
+}
+
+// document turns the page into the document shape the crawler service uses.
+// The ID is derived from the URL so recrawling a page replaces it.
+func (p *crawledPage) document() map[string]interface{} {
+	pageURL := p.url
+	urlHash := sha256.Sum256([]byte(pageURL.String()))
+	contentHash := sha256.Sum256([]byte(p.content))
+
+	title := p.title
+	if title == "" {
+		title = pageURL.Host
+	}
+
+	return map[string]interface{}{
+		"id":           hex.EncodeToString(urlHash[:16]),
+		"title":        title,
+		"content":      p.content,
+		"url":          pageURL.String(),
+		"timestamp":    strconv.FormatInt(time.Now().Unix(), 10),
+		"word_count":   len(strings.Fields(p.content)),
+		"content_hash": hex.EncodeToString(contentHash[:]),
+	}
+}
+
+// fetchPage downloads and parses an HTML page with httpClient
+func (cr *Crawler) fetchPage(ctx context.Context, httpClient *http.Client, pageURL *url.URL) (*crawledPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cr.config.CrawlUserAgent)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	if contentType := res.Header.Get("Content-Type"); !strings.Contains(strings.ToLower(contentType), "text/html") {
+		return nil, fmt.Errorf("skipping non-HTML content %q", contentType)
+	}
+
+	doc, err := html.Parse(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	page := parsePage(doc)
+	page.url = res.Request.URL
+	return page, nil
+}
+
+// parsePage extracts the title, visible text and link targets of a page,
+// leaving out scripts, styles and page chrome such as navigation
+func parsePage(doc *html.Node) *crawledPage {
+	page := &crawledPage{}
+	var text strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "noscript", "nav", "header", "footer":
+				return
+			case "title":
+				if page.title == "" && n.FirstChild != nil {
+					page.title = collapseWhitespace(n.FirstChild.Data)
+				}
+				return
+			case "a":
+				for _, attr := range n.Attr {
+					if attr.Key == "href" && attr.Val != "" {
+						page.links = append(page.links, attr.Val)
+					}
+				}
+			}
+		}
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+			text.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	page.content = truncateUTF8(collapseWhitespace(text.String()), maxCrawlContent)
+	return page
+}
+
+// collapseWhitespace trims s and replaces every run of whitespace with a
+// single space
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// robotsRules holds the Disallow/Allow rules and the Crawl-delay that
+// apply to the crawler from a site's robots.txt. A nil *robotsRules allows
+// everything.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+	delay    time.Duration
+}
+
+// crawlDelay returns the time to leave between two requests to the site
+func (r *robotsRules) crawlDelay() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.delay
+}
+
+// allowed reports whether path, which includes the query string, may be
+// crawled. The longest matching rule wins, with Allow winning ties, as in
+// RFC 9309.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	longestAllow, longestDisallow := -1, -1
+	for _, rule := range r.allow {
+		if robotsMatch(rule, path) && len(rule) > longestAllow {
+			longestAllow = len(rule)
+		}
+	}
+	for _, rule := range r.disallow {
+		if robotsMatch(rule, path) && len(rule) > longestDisallow {
+			longestDisallow = len(rule)
+		}
+	}
+	return longestDisallow < 0 || longestAllow >= longestDisallow
+}
+
+// robotsMatch reports whether path matches a robots.txt rule. Rules match
+// path prefixes, where * stands for any run of characters and a trailing $
+// anchors the rule at the end of the path.
+func robotsMatch(rule, path string) bool {
+	anchored := strings.HasSuffix(rule, "$")
+	rule = strings.TrimSuffix(rule, "$")
+
+	parts := strings.Split(rule, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+
+	// Matching each middle part as early as possible leaves the most room
+	// for the parts after it
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
+
+// fetchRobots loads robots.txt for the host of pageURL. A missing or
+// unreadable robots.txt allows everything.
+func (cr *Crawler) fetchRobots(ctx context.Context, pageURL *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", cr.config.CrawlUserAgent)
+
+	res, err := cr.httpClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(res.Body, maxPageSize), cr.config.CrawlUserAgent)
+}
+
+// parseRobots reads the rules of the group for userAgent, falling back to the
+// "*" group when no group names the crawler
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexByte(agent, '/'); i >= 0 {
+		agent = agent[:i]
+	}
+
+	var specific, wildcard robotsRules
+	var hasSpecific bool
+	var current []*robotsRules
+	inAgentLines := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if !inAgentLines {
+				current = nil
+			}
+			inAgentLines = true
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				current = append(current, &wildcard)
+			case name != "" && strings.Contains(agent, name):
+				hasSpecific = true
+				current = append(current, &specific)
+			}
+		case "allow", "disallow":
+			inAgentLines = false
+			if value == "" {
+				continue
+			}
+			for _, rules := range current {
+				if key == "allow" {
+					rules.allow = append(rules.allow, value)
+				} else {
+					rules.disallow = append(rules.disallow, value)
+				}
+			}
+		case "crawl-delay":
+			inAgentLines = false
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			delay := maxCrawlDelay
+			if seconds < maxCrawlDelay.Seconds() {
+				delay = time.Duration(seconds * float64(time.Second))
+			}
+			for _, rules := range current {
+				rules.delay = delay
+			}
+		default:
+			inAgentLines = false
+		}
+	}
+
+	if hasSpecific {
+		return &specific
+	}
+	return &wildcard
+}
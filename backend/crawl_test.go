@@ -0,0 +1,680 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testSite is a local website for the crawler. It records the pages it
+// serves, leaving out robots.txt.
+type testSite struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	times    []time.Time
+}
+
+// newTestSite serves routes keyed by request URI, path plus query, and
+// answers 404 to anything else
+func newTestSite(t *testing.T, routes map[string]http.HandlerFunc) *testSite {
+	t.Helper()
+	site := &testSite{}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			site.mu.Lock()
+			site.requests = append(site.requests, r.URL.RequestURI())
+			site.times = append(site.times, time.Now())
+			site.mu.Unlock()
+		}
+		if handler, ok := routes[r.URL.RequestURI()]; ok {
+			handler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// fetched returns the request URIs of the pages served so far, sorted
+func (s *testSite) fetched() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fetched := append([]string{}, s.requests...)
+	slices.Sort(fetched)
+	return fetched
+}
+
+// htmlPage serves an HTML page titled title that links to links
+func htmlPage(title string, links ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		fmt.Fprintf(&body, "<html><head><title>%s</title></head><body><p>Welcome to %s</p>", title, title)
+		for _, link := range links {
+			fmt.Fprintf(&body, `<a href="%s">%s</a>`, link, link)
+		}
+		body.WriteString("</body></html>")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body.String()))
+	}
+}
+
+// robotsTxt serves content as robots.txt
+func robotsTxt(content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(content))
+	}
+}
+
+// redirectTo redirects to target, which is sent as is
+func redirectTo(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusFound)
+	}
+}
+
+// newCrawlRouter mounts the crawl endpoints in front of meili. The crawler
+// is stopped when the test ends.
+func newCrawlRouter(t *testing.T, meili *fakeMeili, config *Config) (*gin.Engine, *Crawler) {
+	crawler := newCrawler(newMeiliClient(config), nil, config)
+	// Test sites listen on loopback
+	crawler.allowPrivateAddresses = true
+	t.Cleanup(crawler.Stop)
+
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.POST("/crawl", crawler.startHandler())
+	router.GET("/crawl/:id", crawler.statusHandler())
+	return router, crawler
+}
+
+// startCrawl posts body to /crawl and returns the job ID
+func startCrawl(t *testing.T, router http.Handler, body string, headers ...string) string {
+	t.Helper()
+	w := serve(router, http.MethodPost, "/crawl", body, headers...)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("crawl status = %d, body %s", w.Code, w.Body)
+	}
+	var started struct {
+		JobID string `json:"job_id"`
+	}
+	decodeJSON(t, w, &started)
+	return started.JobID
+}
+
+// waitForCrawl polls the job until it is no longer running
+func waitForCrawl(t *testing.T, router http.Handler, id string, headers ...string) CrawlJob {
+	t.Helper()
+	var job CrawlJob
+	eventually(t, func() bool {
+		w := serve(router, http.MethodGet, "/crawl/"+id, "", headers...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("job status = %d, body %s", w.Code, w.Body)
+		}
+		decodeJSON(t, w, &job)
+		return job.Status != "running"
+	}, "crawl %s is still running", id)
+	return job
+}
+
+// indexedPaths returns the sorted request URIs of the pages in index
+func indexedPaths(index *memoryIndex) []string {
+	var paths []string
+	for _, doc := range index.documents() {
+		if u, err := url.Parse(getString(doc, "url")); err == nil {
+			paths = append(paths, u.RequestURI())
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestCrawl(t *testing.T) {
+	tests := []struct {
+		name        string
+		routes      map[string]http.HandlerFunc
+		options     string
+		wantFetched []string
+		wantIndexed []string
+		wantOther   bool
+	}{
+		{
+			name: "follows links up to max_depth",
+			routes: map[string]http.HandlerFunc{
+				"/":  htmlPage("Home", "/a", "#top"),
+				"/a": htmlPage("A", "/b", "/"),
+				"/b": htmlPage("B"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/a"},
+			wantIndexed: []string{"/", "/a"},
+		},
+		{
+			name: "stops at max_pages",
+			routes: map[string]http.HandlerFunc{
+				"/":  htmlPage("Home", "/a", "/b", "/c"),
+				"/a": htmlPage("A"),
+				"/b": htmlPage("B"),
+				"/c": htmlPage("C"),
+			},
+			options:     `"max_depth": 1, "max_pages": 2`,
+			wantFetched: []string{"/", "/a"},
+			wantIndexed: []string{"/", "/a"},
+		},
+		{
+			name: "skips pages that fail or are not HTML",
+			routes: map[string]http.HandlerFunc{
+				"/":  htmlPage("Home", "/missing", "/data.txt", "/a"),
+				"/a": htmlPage("A"),
+				"/data.txt": func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/plain")
+					w.Write([]byte("plain text"))
+				},
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/a", "/data.txt", "/missing"},
+			wantIndexed: []string{"/", "/a"},
+		},
+		{
+			name: "robots.txt disallows paths",
+			routes: map[string]http.HandlerFunc{
+				"/robots.txt": robotsTxt("User-agent: *\nDisallow: /private\n"),
+				"/":           htmlPage("Home", "/private/a", "/public"),
+				"/private/a":  htmlPage("Private"),
+				"/public":     htmlPage("Public"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/public"},
+			wantIndexed: []string{"/", "/public"},
+		},
+		{
+			name: "robots.txt rules match the query string",
+			routes: map[string]http.HandlerFunc{
+				"/robots.txt":    robotsTxt("User-agent: *\nDisallow: /list?sort=\n"),
+				"/":              htmlPage("Home", "/list?page=2", "/list?sort=asc"),
+				"/list?page=2":   htmlPage("Page 2"),
+				"/list?sort=asc": htmlPage("Sorted"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/list?page=2"},
+			wantIndexed: []string{"/", "/list?page=2"},
+		},
+		{
+			name: "redirects are followed within the site",
+			routes: map[string]http.HandlerFunc{
+				"/":    htmlPage("Home", "/old"),
+				"/old": redirectTo("/new"),
+				"/new": htmlPage("New", "sibling"),
+				// Relative links resolve against the redirect target
+				"/sibling": htmlPage("Sibling"),
+			},
+			options:     `"max_depth": 2`,
+			wantFetched: []string{"/", "/new", "/old", "/sibling"},
+			wantIndexed: []string{"/", "/new", "/sibling"},
+		},
+		{
+			name: "redirects to disallowed paths are not followed",
+			routes: map[string]http.HandlerFunc{
+				"/robots.txt":   robotsTxt("User-agent: *\nDisallow: /private\n"),
+				"/":             htmlPage("Home", "/go"),
+				"/go":           redirectTo("/private/page"),
+				"/private/page": htmlPage("Private"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/go"},
+			wantIndexed: []string{"/"},
+		},
+		{
+			name: "redirects off the site are not followed",
+			routes: map[string]http.HandlerFunc{
+				"/":    htmlPage("Home", "/out"),
+				"/out": redirectTo("{other}/landing"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/", "/out"},
+			wantIndexed: []string{"/"},
+		},
+		{
+			name: "links off the site are not followed",
+			routes: map[string]http.HandlerFunc{
+				"/": htmlPage("Home", "{other}/landing"),
+			},
+			options:     `"max_depth": 1`,
+			wantFetched: []string{"/"},
+			wantIndexed: []string{"/"},
+		},
+		{
+			name: "same_domain false follows other sites",
+			routes: map[string]http.HandlerFunc{
+				"/":    htmlPage("Home", "/out", "{other}/landing"),
+				"/out": redirectTo("{other}/landing"),
+			},
+			options:     `"max_depth": 1, "same_domain": false`,
+			wantFetched: []string{"/", "/out"},
+			wantIndexed: []string{"/", "/landing"},
+			wantOther:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := newTestSite(t, map[string]http.HandlerFunc{"/landing": htmlPage("Landing")})
+			routes := make(map[string]http.HandlerFunc, len(tt.routes))
+			for path, handler := range tt.routes {
+				routes[path] = handler
+			}
+			// Point {other} links and redirects at the other site
+			for path, handler := range tt.routes {
+				handler := handler
+				routes[path] = func(w http.ResponseWriter, r *http.Request) {
+					rec := httptest.NewRecorder()
+					handler(rec, r)
+					for key, values := range rec.Header() {
+						for _, value := range values {
+							w.Header().Add(key, strings.ReplaceAll(value, "{other}", other.URL))
+						}
+					}
+					w.WriteHeader(rec.Code)
+					w.Write([]byte(strings.ReplaceAll(rec.Body.String(), "{other}", other.URL)))
+				}
+			}
+			site := newTestSite(t, routes)
+
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+
+			id := startCrawl(t, router, fmt.Sprintf(`{"url": %q, %s}`, site.URL+"/", tt.options))
+			job := waitForCrawl(t, router, id)
+			if job.Status != "succeeded" {
+				t.Fatalf("job = %+v, want succeeded", job)
+			}
+
+			if got := site.fetched(); !reflect.DeepEqual(got, tt.wantFetched) {
+				t.Errorf("fetched %v, want %v", got, tt.wantFetched)
+			}
+			// The other site is fetched at most once, even when a redirect and
+			// a link both lead there
+			if fetchedOther := len(other.fetched()); fetchedOther > 1 || (fetchedOther == 1) != tt.wantOther {
+				t.Errorf("fetched the other site %d times, want it fetched: %v", fetchedOther, tt.wantOther)
+			}
+
+			if got := indexedPaths(index); !reflect.DeepEqual(got, tt.wantIndexed) {
+				t.Errorf("indexed %v, want %v", got, tt.wantIndexed)
+			}
+			if job.PagesIndexed != len(index.documents()) || job.PagesCrawled < job.PagesIndexed {
+				t.Errorf("pages crawled, indexed = %d, %d, want %d indexed", job.PagesCrawled, job.PagesIndexed, len(index.documents()))
+			}
+		})
+	}
+}
+
+func TestCrawlDocuments(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title> Gopher  news </title><script>var x = 1;</script></head>
+<body><nav>Menu</nav><h1>Latest</h1><p>Gophers   love <b>Go</b>.</p><footer>Copyright</footer></body></html>`))
+		},
+		"/untitled": htmlPage(""),
+	})
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+
+	waitForCrawl(t, router, startCrawl(t, router, fmt.Sprintf(`{"url": %q}`, site.URL+"/")))
+	docs := index.documents()
+	if len(docs) != 1 {
+		t.Fatalf("indexed %d documents, want 1", len(docs))
+	}
+	doc := docs[0]
+	if doc["title"] != "Gopher news" || doc["content"] != "Latest Gophers love Go ." || doc["url"] != site.URL+"/" {
+		t.Errorf("document = %v, want the title, visible text and URL of the page", doc)
+	}
+	if doc["word_count"] != float64(5) {
+		t.Errorf("word_count = %v, want 5", doc["word_count"])
+	}
+
+	// Recrawling replaces the page instead of adding a second copy
+	waitForCrawl(t, router, startCrawl(t, router, fmt.Sprintf(`{"url": %q}`, site.URL+"/")))
+	if n := len(index.documents()); n != 1 {
+		t.Errorf("indexed %d documents after recrawling, want 1", n)
+	}
+
+	// A page without a title is named after its host
+	waitForCrawl(t, router, startCrawl(t, router, fmt.Sprintf(`{"url": %q}`, site.URL+"/untitled")))
+	host := strings.TrimPrefix(site.URL, "http://")
+	if !slices.ContainsFunc(index.documents(), func(doc map[string]interface{}) bool { return doc["title"] == host }) {
+		t.Errorf("no document titled %q in %v", host, index.documents())
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	delay := 100 * time.Millisecond
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/robots.txt": robotsTxt("User-agent: *\nCrawl-delay: 0.1\n"),
+		"/":           htmlPage("Home", "/a", "/b"),
+		"/a":          htmlPage("A"),
+		"/b":          htmlPage("B"),
+	})
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+
+	waitForCrawl(t, router, startCrawl(t, router, fmt.Sprintf(`{"url": %q, "max_depth": 1}`, site.URL+"/")))
+
+	site.mu.Lock()
+	defer site.mu.Unlock()
+	if len(site.times) != 3 {
+		t.Fatalf("fetched %d pages, want 3", len(site.times))
+	}
+	for i := 1; i < len(site.times); i++ {
+		if gap := site.times[i].Sub(site.times[i-1]); gap < delay-5*time.Millisecond {
+			t.Errorf("request %d came %s after the previous one, want at least %s", i+1, gap, delay)
+		}
+	}
+}
+
+// blockingSite serves a page that only answers once release is closed or
+// the request is cancelled
+func blockingSite(t *testing.T) (site *testSite, release func()) {
+	released := make(chan struct{})
+	site = newTestSite(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-released:
+				htmlPage("Slow")(w, r)
+			case <-r.Context().Done():
+			}
+		},
+	})
+	var once sync.Once
+	release = func() { once.Do(func() { close(released) }) }
+	t.Cleanup(release)
+	return site, release
+}
+
+func TestCrawlJobLimit(t *testing.T) {
+	site, release := blockingSite(t)
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	config := testConfig(meili.URL)
+	config.CrawlMaxJobs = 1
+	router, _ := newCrawlRouter(t, meili, config)
+	body := fmt.Sprintf(`{"url": %q}`, site.URL+"/")
+
+	first := startCrawl(t, router, body)
+	if w := serve(router, http.MethodPost, "/crawl", body); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second crawl status = %d, want 429, body %s", w.Code, w.Body)
+	}
+
+	release()
+	if job := waitForCrawl(t, router, first); job.Status != "succeeded" {
+		t.Fatalf("first job = %+v, want succeeded", job)
+	}
+	waitForCrawl(t, router, startCrawl(t, router, body))
+}
+
+func TestCrawlerStopCancelsJobs(t *testing.T) {
+	site, _ := blockingSite(t)
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	router, crawler := newCrawlRouter(t, meili, testConfig(meili.URL))
+	body := fmt.Sprintf(`{"url": %q}`, site.URL+"/")
+
+	id := startCrawl(t, router, body)
+	eventually(t, func() bool { return len(site.fetched()) == 1 }, "the crawl never fetched the seed")
+
+	stopped := make(chan struct{})
+	go func() {
+		crawler.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	job := waitForCrawl(t, router, id)
+	if job.Status != "cancelled" || job.FinishedAt == nil {
+		t.Errorf("job = %+v, want cancelled", job)
+	}
+	if w := serve(router, http.MethodPost, "/crawl", body); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("crawl after Stop status = %d, want 503", w.Code)
+	}
+}
+
+func TestCrawlJobsAreScopedToTheTenant(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{"/": htmlPage("Home")})
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	tenantIndex := meili.serveIndex("documents_acme")
+	router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+
+	id := startCrawl(t, router, fmt.Sprintf(`{"url": %q}`, site.URL+"/"), tenantHeader, "acme")
+	waitForCrawl(t, router, id, tenantHeader, "acme")
+
+	for _, headers := range [][]string{nil, {tenantHeader, "globex"}} {
+		if w := serve(router, http.MethodGet, "/crawl/"+id, "", headers...); w.Code != http.StatusNotFound {
+			t.Errorf("job status with headers %v = %d, want 404", headers, w.Code)
+		}
+	}
+	if len(tenantIndex.documents()) != 1 || len(index.documents()) != 0 {
+		t.Errorf("tenant, default index hold %d, %d documents, want 1, 0", len(tenantIndex.documents()), len(index.documents()))
+	}
+}
+
+func TestCrawlRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"malformed body", `{"url":`, "Invalid request body"},
+		{"missing url", `{}`, "Field 'url' must be an absolute http(s) URL"},
+		{"relative url", `{"url": "/docs"}`, "Field 'url' must be an absolute http(s) URL"},
+		{"other scheme", `{"url": "ftp://example.com/"}`, "Field 'url' must be an absolute http(s) URL"},
+		{"negative depth", `{"url": "https://example.com/", "max_depth": -1}`, "Field 'max_depth' must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodPost, "/crawl", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+		})
+	}
+
+	meili := newFakeMeili(t)
+	router, _ := newCrawlRouter(t, meili, testConfig(meili.URL))
+	if w := serve(router, http.MethodGet, "/crawl/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", w.Code)
+	}
+}
+
+func TestCrawlRefusesPrivateAddresses(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{"/": htmlPage("Home")})
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	router, crawler := newCrawlRouter(t, meili, testConfig(meili.URL))
+	crawler.allowPrivateAddresses = false
+
+	w := serve(router, http.MethodPost, "/crawl", fmt.Sprintf(`{"url": %q}`, site.URL+"/"))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "public address") {
+		t.Errorf("crawl of %s = %d, body %s, want a 400", site.URL, w.Code, w.Body)
+	}
+
+	// A host name is only refused once it resolves to a loopback address
+	localURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1) + "/"
+	job := waitForCrawl(t, router, startCrawl(t, router, fmt.Sprintf(`{"url": %q}`, localURL)))
+	if fetched := site.fetched(); len(fetched) != 0 || job.PagesIndexed != 0 || len(index.documents()) != 0 {
+		t.Errorf("crawl of %s fetched %v and indexed %d pages, want nothing", localURL, fetched, job.PagesIndexed)
+	}
+}
+
+func TestCrawlerDialControl(t *testing.T) {
+	crawler := newCrawler(nil, nil, defaultConfig())
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:80", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"127.0.0.1:8080", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:443", false},
+		{"[fd00::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := crawler.dialControl("tcp", tt.address, nil)
+			if tt.allowed && err != nil {
+				t.Errorf("dialControl() = %v, want the address allowed", err)
+			}
+			if !tt.allowed && !errors.Is(err, errPrivateAddress) {
+				t.Errorf("dialControl() = %v, want errPrivateAddress", err)
+			}
+		})
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name       string
+		robots     string
+		allowed    []string
+		disallowed []string
+		wantDelay  time.Duration
+	}{
+		{
+			name:       "wildcard group",
+			robots:     "User-agent: *\nDisallow: /admin\nAllow: /admin/public\n",
+			allowed:    []string{"/", "/docs", "/admin/public/page"},
+			disallowed: []string{"/admin", "/admin/users"},
+		},
+		{
+			name:       "specific group wins over the wildcard",
+			robots:     "User-agent: *\nDisallow: /\n\nUser-agent: SearchEngine-Crawler\nDisallow: /private\n",
+			allowed:    []string{"/", "/docs"},
+			disallowed: []string{"/private"},
+		},
+		{
+			name:    "other crawlers' groups are ignored",
+			robots:  "User-agent: OtherBot\nDisallow: /\n",
+			allowed: []string{"/", "/docs"},
+		},
+		{
+			name:       "consecutive user agents share a group",
+			robots:     "User-agent: OtherBot\nUser-agent: SearchEngine-Crawler\nDisallow: /shared\n",
+			allowed:    []string{"/"},
+			disallowed: []string{"/shared"},
+		},
+		{
+			name:       "query strings",
+			robots:     "User-agent: *\nDisallow: /search?\nAllow: /search?q=\n",
+			allowed:    []string{"/search", "/search?q=go"},
+			disallowed: []string{"/search?page=2"},
+		},
+		{
+			name:       "wildcards",
+			robots:     "User-agent: *\nDisallow: /*.pdf$\nDisallow: /*?session=\nDisallow: /private*/drafts\n",
+			allowed:    []string{"/", "/guide.pdf.html", "/guide?page=2", "/cart?page=1&session=42", "/private/docs"},
+			disallowed: []string{"/guide.pdf", "/docs/guide.pdf", "/cart?session=42", "/a/b?session=42&x=1", "/private/drafts", "/private-2024/drafts/1"},
+		},
+		{
+			name:       "end anchor without wildcard",
+			robots:     "User-agent: *\nDisallow: /$\n",
+			allowed:    []string{"/docs", "/?q=go"},
+			disallowed: []string{"/"},
+		},
+		{
+			name:       "longest match with wildcards",
+			robots:     "User-agent: *\nDisallow: /docs/*\nAllow: /docs/*.html$\n",
+			allowed:    []string{"/docs/guide.html", "/docs"},
+			disallowed: []string{"/docs/guide.pdf", "/docs/guide.html?print=1"},
+		},
+		{
+			name:    "comments and empty disallow",
+			robots:  "# robots\nUser-agent: * # everyone\nDisallow:\n",
+			allowed: []string{"/", "/anything"},
+		},
+		{
+			name:      "crawl delay",
+			robots:    "User-agent: *\nCrawl-delay: 1.5\n",
+			allowed:   []string{"/"},
+			wantDelay: 1500 * time.Millisecond,
+		},
+		{
+			name:      "crawl delay is capped",
+			robots:    "User-agent: *\nCrawl-delay: 86400\n",
+			wantDelay: maxCrawlDelay,
+		},
+		{
+			name:   "invalid crawl delay is ignored",
+			robots: "User-agent: *\nCrawl-delay: soon\n",
+		},
+		{
+			name:      "crawl delay of another group",
+			robots:    "User-agent: OtherBot\nCrawl-delay: 10\n\nUser-agent: *\nCrawl-delay: 2\n",
+			wantDelay: 2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), "SearchEngine-Crawler/1.0")
+			for _, path := range tt.allowed {
+				if !rules.allowed(path) {
+					t.Errorf("allowed(%q) = false, want true", path)
+				}
+			}
+			for _, path := range tt.disallowed {
+				if rules.allowed(path) {
+					t.Errorf("allowed(%q) = true, want false", path)
+				}
+			}
+			if got := rules.crawlDelay(); got != tt.wantDelay {
+				t.Errorf("crawlDelay() = %s, want %s", got, tt.wantDelay)
+			}
+		})
+	}
+
+	var none *robotsRules
+	if !none.allowed("/anything") || none.crawlDelay() != 0 {
+		t.Errorf("nil rules must allow everything without delay")
+	}
+}
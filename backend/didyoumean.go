@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// maxSuggestWords caps the number of query words looked up for a
+	// suggestion, since each costs one Meilisearch request
+	maxSuggestWords = 5
+	// maxSuggestDistance is the largest edit distance a correction may have
+	maxSuggestDistance = 2
+)
+
+// didYouMean suggests a corrected spelling of query built from words that
+// occur in the index. Each query word is searched for on its own, so
+// Meilisearch's typo tolerance finds documents containing the intended word;
+// the closest word it matched in those documents replaces the query word.
+// It returns "" when no word needs correcting.
+func didYouMean(ctx context.Context, searcher *MeiliSearcher, indexName, query string) string {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 || len(words) > maxSuggestWords {
+		return ""
+	}
+
+	changed := false
+	for i, word := range words {
+		candidates, err := indexedWords(ctx, searcher, indexName, word)
+		if err != nil {
+			return ""
+		}
+		if correction := closestWord(word, candidates); correction != "" && correction != word {
+			words[i] = correction
+			changed = true
+		}
+	}
+
+	if !changed {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// indexedWords returns how often each word Meilisearch matched for word
+// occurs in the top documents, lowercased
+func indexedWords(ctx context.Context, searcher *MeiliSearcher, indexName, word string) (map[string]int, error) {
+	res, err := searcher.Search(ctx, indexName, map[string]interface{}{
+		"q":                    word,
+		"limit":                10,
+		"attributesToRetrieve": []string{"title", "content"},
+		"showMatchesPosition":  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, hit := range res.Hits {
+		positions, ok := hit["_matchesPosition"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for attribute, matches := range toMatchesPosition(positions) {
+			text := getString(hit, attribute)
+			for _, match := range matches {
+				if match.Start < 0 || match.Length <= 0 || match.Start+match.Length > len(text) {
+					continue
+				}
+				matched := strings.ToLower(text[match.Start : match.Start+match.Length])
+				if matched != "" && !strings.ContainsAny(matched, " \t\n") {
+					counts[matched]++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// closestWord picks the candidate with the smallest edit distance to word,
+// preferring the more frequent one on ties. It returns word itself when it is
+// a candidate, and "" when nothing is within maxSuggestDistance.
+func closestWord(word string, candidates map[string]int) string {
+	if _, ok := candidates[word]; ok {
+		return word
+	}
+
+	best, bestDistance, bestCount := "", maxSuggestDistance+1, 0
+	for candidate, count := range candidates {
+		distance := editDistance(word, candidate)
+		if distance < bestDistance || (distance == bestDistance && count > bestCount) ||
+			(distance == bestDistance && count == bestCount && candidate < best) {
+			best, bestDistance, bestCount = candidate, distance, count
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
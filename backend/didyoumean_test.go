@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// letterRun splits the fake index's text into words
+var letterRun = regexp.MustCompile(`\p{L}+`)
+
+// typoIndex answers searches like Meilisearch with typo tolerance: a
+// document matches when each query word is within two edits of one of its
+// words, and _matchesPosition points at those words
+func typoIndex(docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query               string `json:"q"`
+			ShowMatchesPosition bool   `json:"showMatchesPosition"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		words := strings.Fields(strings.ToLower(request.Query))
+
+		var hits []map[string]interface{}
+		for _, doc := range docs {
+			positions := map[string]interface{}{}
+			found := make(map[string]bool)
+			for _, attribute := range []string{"title", "content"} {
+				text := getString(doc, attribute)
+				var matches []interface{}
+				for _, loc := range letterRun.FindAllStringIndex(text, -1) {
+					indexed := strings.ToLower(text[loc[0]:loc[1]])
+					for _, word := range words {
+						if editDistance(word, indexed) <= 2 {
+							found[word] = true
+							matches = append(matches, map[string]interface{}{"start": loc[0], "length": loc[1] - loc[0]})
+							break
+						}
+					}
+				}
+				if matches != nil {
+					positions[attribute] = matches
+				}
+			}
+			if len(found) < len(words) {
+				continue
+			}
+
+			hit := map[string]interface{}{}
+			for k, v := range doc {
+				hit[k] = v
+			}
+			if request.ShowMatchesPosition {
+				hit["_matchesPosition"] = positions
+			}
+			hits = append(hits, hit)
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+	}
+}
+
+// tutorialDocs mention "gophers" more often than "gopher"
+var tutorialDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher tutorial", "content": "A tutorial for gophers."},
+	{"id": "2", "title": "Gophers at work", "content": "What gophers build."},
+	{"id": "3", "title": "Search engines", "content": "Indexing and ranking."},
+}
+
+func TestSearchDidYouMean(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		threshold    int
+		want         string
+		wantSearches int
+	}{
+		{"misspelled word", "gohpers", 5, "gophers", 2},
+		{"misspelled words", "gopher tutorail", 5, "gopher tutorial", 3},
+		{"lowercased", "Tutorail", 5, "tutorial", 2},
+		{"ties go to the more frequent word", "gopherz", 5, "gophers", 2},
+		{"correct spelling", "tutorial", 5, "", 2},
+		{"nothing close", "xylophone", 5, "", 2},
+		{"enough results", "gohpers", 1, "", 1},
+		{"too many words", "a b c d e f", 5, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, typoIndex(tutorialDocs...))
+			config := testConfig(meili.URL)
+			config.DidYouMeanThreshold = tt.threshold
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, http.MethodGet, "/search?suggest=true&q="+strings.ReplaceAll(tt.query, " ", "+"), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Suggestion != tt.want {
+				t.Errorf("suggestion = %q, want %q", response.Suggestion, tt.want)
+			}
+			if got := len(meili.received(http.MethodPost, searchPath)); got != tt.wantSearches {
+				t.Errorf("Meilisearch received %d searches, want %d", got, tt.wantSearches)
+			}
+		})
+	}
+}
+
+func TestSearchDidYouMeanIsOptIn(t *testing.T) {
+	for _, target := range []string{"/search?q=gohpers", "/search?q=gohpers&suggest=false"} {
+		meili := newFakeMeili(t)
+		meili.handleFunc(http.MethodPost, searchPath, typoIndex(tutorialDocs...))
+		router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+		w := serve(router, http.MethodGet, target, "")
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		if response.Suggestion != "" || strings.Contains(w.Body.String(), `"suggestion"`) {
+			t.Errorf("%s: suggestion = %q, want none", target, response.Suggestion)
+		}
+		if got := len(meili.received(http.MethodPost, searchPath)); got != 1 {
+			t.Errorf("%s: Meilisearch received %d searches, want 1", target, got)
+		}
+	}
+
+	meili := newFakeMeili(t)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+	if w := serve(router, http.MethodGet, "/search?q=go&suggest=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid suggest status = %d, want 400", w.Code)
+	}
+}
+
+func TestClosestWord(t *testing.T) {
+	tests := []struct {
+		name       string
+		word       string
+		candidates map[string]int
+		want       string
+	}{
+		{"exact match", "gopher", map[string]int{"gopher": 1, "gophers": 9}, "gopher"},
+		{"smallest distance", "gopehr", map[string]int{"gopher": 1, "gophers": 9}, "gopher"},
+		{"more frequent on ties", "gophex", map[string]int{"gophea": 1, "gophers": 1, "gopheb": 3}, "gopheb"},
+		{"alphabetical on full ties", "gophex", map[string]int{"gopheb": 2, "gophea": 2}, "gophea"},
+		{"too far", "gopher", map[string]int{"badger": 5}, ""},
+		{"no candidates", "gopher", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closestWord(tt.word, tt.candidates); got != tt.want {
+				t.Errorf("closestWord(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "go", 2},
+		{"go", "", 2},
+		{"gopher", "gopher", 0},
+		{"gopher", "gophers", 1},
+		{"gopher", "goper", 1},
+		{"gopher", "gofher", 1},
+		{"gohper", "gopher", 2},
+		{"kitten", "sitting", 3},
+		{"été", "ete", 2},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// addDocumentsHandler indexes a JSON array of documents and returns the
+// Meilisearch task UID so clients can track indexing. When the primary_key
+// query parameter is given, every document must have that field and it is
+// passed on to Meilisearch; otherwise Meilisearch infers the key.
+func addDocumentsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stripHTML, ok := parseStripHTML(c)
+		if !ok {
+			return
+		}
+
+		var documents []map[string]interface{}
+		if err := c.ShouldBindJSON(&documents); err != nil {
+			c.JSON(bodyErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Invalid request body, expected a JSON array of documents: %v", err),
+			})
+			return
+		}
+
+		if len(documents) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one document is required",
+			})
+			return
+		}
+
+		primaryKey := c.Query("primary_key")
+		for i, doc := range documents {
+			if primaryKey != "" && doc[primaryKey] == nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Document at position %d is missing the %q field", i, primaryKey),
+				})
+				return
+			}
+			if stripHTML {
+				stripHTMLFields(doc, config.StripHTMLFields)
+			}
+		}
+
+		var key []string
+		if primaryKey != "" {
+			key = append(key, primaryKey)
+		}
+		task, err := client.Index(indexFor(c, config)).AddDocuments(documents, key...)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to add documents: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+			"count":    len(documents),
+		})
+	}
+}
+
+// getDocumentHandler returns a single document by ID, limited to the
+// comma-separated fields query parameter when given
+func getDocumentHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var document map[string]interface{}
+		query := &meilisearch.DocumentQuery{Fields: splitList(c.Query("fields"))}
+		if err := client.Index(indexFor(c, config)).GetDocument(id, query, &document); err != nil {
+			status := meiliErrorStatus(err)
+			if status == http.StatusNotFound {
+				c.JSON(status, gin.H{
+					"error": fmt.Sprintf("Document %q not found", id),
+				})
+				return
+			}
+			c.JSON(status, gin.H{
+				"error": fmt.Sprintf("Failed to get document: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, document)
+	}
+}
+
+// deleteDocumentHandler removes a single document by ID
+func deleteDocumentHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		task, err := client.Index(indexFor(c, config)).DeleteDocument(id)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to delete document: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// deleteDocumentsHandler removes every document whose ID is listed in the
+// JSON array request body
+func deleteDocumentsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var raw []json.RawMessage
+		if err := c.ShouldBindJSON(&raw); err != nil {
+			c.JSON(bodyErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Invalid request body, expected a JSON array of document IDs: %v", err),
+			})
+			return
+		}
+		ids, err := documentIDs(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body, expected a JSON array of document IDs: %v", err),
+			})
+			return
+		}
+
+		if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one document ID is required",
+			})
+			return
+		}
+
+		task, err := client.Index(indexFor(c, config)).DeleteDocuments(ids)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to delete documents: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+			"count":    len(ids),
+		})
+	}
+}
+
+// documentIDs converts the IDs of a DELETE /documents body to strings.
+// Meilisearch IDs are strings or unsigned integers, and integers are kept as
+// written so large ones do not lose precision.
+func documentIDs(raw []json.RawMessage) ([]string, error) {
+	ids := make([]string, 0, len(raw))
+	for _, value := range raw {
+		var id string
+		if err := json.Unmarshal(value, &id); err == nil {
+			ids = append(ids, id)
+			continue
+		}
+		if _, err := strconv.ParseUint(string(value), 10, 64); err != nil {
+			return nil, fmt.Errorf("document ID %s is neither a string nor an unsigned integer", value)
+		}
+		ids = append(ids, string(value))
+	}
+	return ids, nil
+}
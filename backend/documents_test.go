@@ -0,0 +1,376 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newDocumentsRouter mounts the document, task and search endpoints in front
+// of meili with an in-memory cache
+func newDocumentsRouter(meili *fakeMeili, config *Config, cache Cache) *gin.Engine {
+	client := newMeiliClient(config)
+	searcher := meili.searcher()
+
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/search", searchHandler(searcher, cache, config))
+	router.GET("/documents/:id", getDocumentHandler(client, config))
+	router.POST("/documents", addDocumentsHandler(client, cache, config))
+	router.DELETE("/documents", deleteDocumentsHandler(client, cache, config))
+	router.DELETE("/documents/:id", deleteDocumentHandler(client, cache, config))
+	router.GET("/tasks/:uid", getTaskHandler(client))
+	return router
+}
+
+// searchIDs searches router for query and returns the IDs found
+func searchIDs(t *testing.T, router http.Handler, query string) []string {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/search?q="+query, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, body %s", w.Code, w.Body)
+	}
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	return resultIDs(response.Results)
+}
+
+func TestAddDocuments(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantCount  int
+		wantFound  int
+	}{
+		{
+			name:       "documents with ids",
+			target:     "/documents",
+			body:       `[{"id": "1", "title": "Gopher guide"}, {"id": 2, "title": "Gopher tricks"}]`,
+			wantStatus: http.StatusAccepted,
+			wantCount:  2,
+			wantFound:  2,
+		},
+		{
+			name:       "custom primary key",
+			target:     "/documents?primary_key=sku",
+			body:       `[{"sku": "g-1", "title": "Gopher plush"}]`,
+			wantStatus: http.StatusAccepted,
+			wantCount:  1,
+			wantFound:  1,
+		},
+		{
+			name:       "document without id",
+			target:     "/documents?primary_key=id",
+			body:       `[{"id": "1", "title": "Gopher guide"}, {"title": "Gopher tricks"}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty array",
+			target:     "/documents",
+			body:       `[]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not an array",
+			target:     "/documents",
+			body:       `{"id": "1"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, http.MethodPost, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var response struct {
+				TaskUID *int64 `json:"task_uid"`
+				Count   int    `json:"count"`
+				Error   string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if tt.wantStatus == http.StatusAccepted {
+				if response.TaskUID == nil || response.Count != tt.wantCount {
+					t.Errorf("task_uid, count = %v, %d, want a task and %d", response.TaskUID, response.Count, tt.wantCount)
+				}
+			} else {
+				if response.Error == "" {
+					t.Error("error message is empty")
+				}
+				if len(meili.received(http.MethodPost, "/indexes/documents/documents")) != 0 {
+					t.Error("rejected batch reached Meilisearch")
+				}
+			}
+
+			if got := searchIDs(t, router, "gopher"); len(got) != tt.wantFound {
+				t.Errorf("search found %d documents, want %d", len(got), tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsStripHTML(t *testing.T) {
+	const html = "<p>hello <b>world</b></p>"
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		fields      []string
+		want        map[string]interface{}
+	}{
+		{
+			name:   "stripped",
+			target: "/documents?strip_html=true",
+			body:   `[{"id": "1", "title": "<h1>Greeting</h1>", "content": "` + html + `", "raw": "` + html + `"}]`,
+			want:   map[string]interface{}{"id": "1", "title": "Greeting", "content": "hello world", "raw": html},
+		},
+		{
+			name:   "kept without strip_html",
+			target: "/documents",
+			body:   `[{"id": "1", "content": "` + html + `"}]`,
+			want:   map[string]interface{}{"id": "1", "content": html},
+		},
+		{
+			name:   "strip_html false",
+			target: "/documents?strip_html=false",
+			body:   `[{"id": "1", "content": "` + html + `"}]`,
+			want:   map[string]interface{}{"id": "1", "content": html},
+		},
+		{
+			name:   "configured fields only",
+			target: "/documents?strip_html=1",
+			body:   `[{"id": "1", "content": "` + html + `", "body": "` + html + `"}]`,
+			fields: []string{"body"},
+			want:   map[string]interface{}{"id": "1", "content": html, "body": "hello world"},
+		},
+		{
+			name:   "non-string fields left alone",
+			target: "/documents?strip_html=true",
+			body:   `[{"id": "1", "content": ["<b>tag</b>"]}]`,
+			want:   map[string]interface{}{"id": "1", "content": []interface{}{"<b>tag</b>"}},
+		},
+		{
+			name:        "NDJSON",
+			target:      "/documents/ndjson?strip_html=true",
+			contentType: "application/x-ndjson",
+			body:        `{"id": "1", "content": "` + html + `"}` + "\n",
+			want:        map[string]interface{}{"id": "1", "content": "hello world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			if tt.fields != nil {
+				config.StripHTMLFields = tt.fields
+			}
+			router := newDocumentsRouter(meili, config, nil)
+			router.POST("/documents/ndjson", addDocumentsNDJSONHandler(newMeiliClient(config), nil, config))
+
+			var headers []string
+			if tt.contentType != "" {
+				headers = []string{"Content-Type", tt.contentType}
+			}
+			if w := serve(router, http.MethodPost, tt.target, tt.body, headers...); w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := index.documents(); len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("documents = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	meili := newFakeMeili(t)
+	router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+	if w := serve(router, http.MethodPost, "/documents?strip_html=maybe", `[{"id": "1"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid strip_html status = %d, want 400", w.Code)
+	}
+}
+
+func TestDeleteDocuments(t *testing.T) {
+	const seed = `[{"id": "1", "title": "Gopher one"}, {"id": "2", "title": "Gopher two"}, {"id": "3", "title": "Gopher three"}]`
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"single document", http.MethodDelete, "/documents/2", "", http.StatusAccepted, []string{"1", "3"}},
+		{"unknown document", http.MethodDelete, "/documents/9", "", http.StatusAccepted, []string{"1", "2", "3"}},
+		{"batch", http.MethodDelete, "/documents", `["1", "3"]`, http.StatusAccepted, []string{"2"}},
+		{"empty batch", http.MethodDelete, "/documents", `[]`, http.StatusBadRequest, []string{"1", "2", "3"}},
+		{"invalid batch", http.MethodDelete, "/documents", `{"id": "1"}`, http.StatusBadRequest, []string{"1", "2", "3"}},
+		{"numeric IDs", http.MethodDelete, "/documents", `[1, "3"]`, http.StatusAccepted, []string{"2"}},
+		{"fractional ID", http.MethodDelete, "/documents", `[1.5]`, http.StatusBadRequest, []string{"1", "2", "3"}},
+		{"negative ID", http.MethodDelete, "/documents", `[-1]`, http.StatusBadRequest, []string{"1", "2", "3"}},
+		{"boolean ID", http.MethodDelete, "/documents", `[true]`, http.StatusBadRequest, []string{"1", "2", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+			if w := serve(router, http.MethodPost, "/documents", seed); w.Code != http.StatusAccepted {
+				t.Fatalf("seeding failed with status %d, body %s", w.Code, w.Body)
+			}
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := searchIDs(t, router, "gopher"); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("search found %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestDeleteDocumentsBodyLimit(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	config := testConfig(meili.URL)
+	config.MaxBodyBytes = 16
+	router := newAPIRouter(meili, config)
+
+	if w := serve(router, http.MethodDelete, "/documents", `["1", "2"]`); w.Code != http.StatusAccepted {
+		t.Errorf("status = %d under the limit, want 202, body %s", w.Code, w.Body)
+	}
+	w := serve(router, http.MethodDelete, "/documents", `["1", "2", "3", "4"]`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d over the limit, want 413, body %s", w.Code, w.Body)
+	}
+	if n := len(meili.received(http.MethodPost, "/indexes/documents/documents/delete-batch")); n != 1 {
+		t.Errorf("Meilisearch received %d deletions, want only the one under the limit", n)
+	}
+}
+
+func TestDeleteDocumentsSurfacesMeilisearchErrors(t *testing.T) {
+	meili := newFakeMeili(t)
+	router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+	// No index is served, so Meilisearch answers 404
+	for _, target := range []string{"/documents/1", "/documents"} {
+		w := serve(router, http.MethodDelete, target, `["1"]`)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s status = %d, want 404, body %s", target, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGetDocument(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(
+		map[string]interface{}{"id": "1", "title": "Gopher guide", "content": "All about gophers", "author": "Ada"},
+	)
+	router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   map[string]interface{}
+	}{
+		{
+			name:       "existing document",
+			target:     "/documents/1",
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"id": "1", "title": "Gopher guide", "content": "All about gophers", "author": "Ada"},
+		},
+		{
+			name:       "selected fields",
+			target:     "/documents/1?fields=id,author",
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"id": "1", "author": "Ada"},
+		},
+		{
+			name:       "missing document",
+			target:     "/documents/404",
+			wantStatus: http.StatusNotFound,
+			wantBody:   map[string]interface{}{"error": `Document "404" not found`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var body map[string]interface{}
+			decodeJSON(t, w, &body)
+			if !reflect.DeepEqual(body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", body, tt.wantBody)
+			}
+		})
+	}
+
+	if got := meili.last(t, http.MethodGet, "/indexes/documents/documents/1").Query; got != "fields=id%2Cauthor" && got != "fields=id,author" {
+		t.Errorf("fields query = %q, want fields=id,author", got)
+	}
+}
+
+// Documents keyed by another field are indexed under it and can be fetched
+// by its value
+func TestAddDocumentsPrimaryKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		body      string
+		wantQuery string
+		fetch     string
+	}{
+		{"inferred id", "/documents", `[{"id": "gopher-guide", "title": "Gopher guide"}]`, "", "gopher-guide"},
+		{"slug", "/documents?primary_key=slug", `[{"slug": "gopher-guide", "title": "Gopher guide"}]`, "primaryKey=slug", "gopher-guide"},
+		{"slug alongside an id", "/documents?primary_key=slug", `[{"slug": "gopher-guide", "id": "1", "title": "Gopher guide"}]`, "primaryKey=slug", "gopher-guide"},
+		{"explicit id", "/documents?primary_key=id", `[{"id": "gopher-guide", "title": "Gopher guide"}]`, "primaryKey=id", "gopher-guide"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+			if w := serve(router, http.MethodPost, tt.target, tt.body); w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			additions := meili.received(http.MethodPost, "/indexes/documents/documents")
+			if len(additions) != 1 {
+				t.Fatalf("Meilisearch received %d additions, want 1", len(additions))
+			}
+			if additions[0].Query != tt.wantQuery {
+				t.Errorf("addition query = %q, want %q", additions[0].Query, tt.wantQuery)
+			}
+
+			eventually(t, func() bool { _, ok := index.get(tt.fetch); return ok }, "document %q was not indexed", tt.fetch)
+			w := serve(router, http.MethodGet, "/documents/"+tt.fetch, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("fetch status = %d, body %s", w.Code, w.Body)
+			}
+			var doc map[string]interface{}
+			decodeJSON(t, w, &doc)
+			if doc["title"] != "Gopher guide" {
+				t.Errorf("fetched document = %v, want the Gopher guide", doc)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes returned in SearchResponse.ErrorCode so clients can tell error
+// types apart without parsing the message
+const (
+	// errCodeInvalidBody: the JSON request body could not be decoded
+	errCodeInvalidBody = "invalid_body"
+	// errCodeMissingQuery: no search query was given
+	errCodeMissingQuery = "missing_query"
+	// errCodeInvalidQuery: the search query is too long or otherwise unusable
+	errCodeInvalidQuery = "invalid_query"
+	// errCodeInvalidParameter: a parameter other than the query is malformed
+	errCodeInvalidParameter = "invalid_parameter"
+	// errCodeInvalidFilter: Meilisearch rejected the filter expression
+	errCodeInvalidFilter = "invalid_filter"
+	// errCodeInvalidSort: Meilisearch rejected the sort expression
+	errCodeInvalidSort = "invalid_sort"
+	// errCodeInvalidDistinct: the distinct attribute is not filterable
+	errCodeInvalidDistinct = "invalid_distinct"
+	// errCodeInvalidSearchOn: a search_on attribute is not searchable
+	errCodeInvalidSearchOn = "invalid_search_on"
+	// errCodeInvalidRequest: Meilisearch rejected the search for another reason
+	errCodeInvalidRequest = "invalid_request"
+	// errCodeBlockedQuery: the query contains a term of BLOCKLIST_FILE
+	errCodeBlockedQuery = "blocked_query"
+	// errCodeNotFound: the requested document does not exist
+	errCodeNotFound = "not_found"
+	// errCodeRateLimited: the client exceeded the rate limit
+	errCodeRateLimited = "rate_limited"
+	// errCodeTimeout: the search did not finish within SEARCH_TIMEOUT
+	errCodeTimeout = "timeout"
+	// errCodeMeiliUnavailable: Meilisearch is down and the circuit breaker is open
+	errCodeMeiliUnavailable = "meili_unavailable"
+	// errCodeSearchFailed: Meilisearch failed in an unexpected way
+	errCodeSearchFailed = "search_failed"
+	// errCodeInternal: the backend itself failed
+	errCodeInternal = "internal_error"
+)
+
+// apiError is an error carrying one of the errCode constants
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func newAPIError(code, format string, args ...interface{}) error {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// errorCode returns the code carried by err, or fallback when it has none
+func errorCode(err error, fallback string) string {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.code
+	}
+	return fallback
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"api error", newAPIError(errCodeMissingQuery, "no query"), errCodeMissingQuery},
+		{"wrapped api error", fmt.Errorf("parsing: %w", newAPIError(errCodeInvalidSearchOn, "bad")), errCodeInvalidSearchOn},
+		{"plain error", errors.New("boom"), errCodeInvalidParameter},
+		{"nil", nil, errCodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err, errCodeInvalidParameter); got != tt.want {
+				t.Errorf("errorCode(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// meiliRejects answers every search with a 400 carrying the Meilisearch
+// error code
+func meiliRejects(code string) func(*fakeMeili) {
+	return func(meili *fakeMeili) {
+		meili.handle(http.MethodPost, searchPath, http.StatusBadRequest, map[string]string{"message": "rejected: " + code, "code": code, "type": "invalid_request"})
+	}
+}
+
+// Every error path sets its code alongside a human-readable message
+func TestSearchErrorCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		meili      func(*fakeMeili)
+		configure  func(*Config, *MeiliSearcher)
+		wantStatus int
+		wantCode   string
+		wantError  string
+	}{
+		{
+			name: "malformed body", method: http.MethodPost, target: "/search", body: `{"query":`,
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidBody, wantError: "Invalid request body",
+		},
+		{
+			name: "missing query", method: http.MethodGet, target: "/search",
+			wantStatus: http.StatusBadRequest, wantCode: errCodeMissingQuery, wantError: "Query parameter 'q' is required",
+		},
+		{
+			name: "missing query in body", method: http.MethodPost, target: "/search", body: `{"limit":5}`,
+			wantStatus: http.StatusBadRequest, wantCode: errCodeMissingQuery, wantError: "Field 'query' is required",
+		},
+		{
+			name: "query too long", method: http.MethodGet, target: "/search?q=" + strings.Repeat("a", 20),
+			configure:  func(c *Config, _ *MeiliSearcher) { c.MaxQueryLength = 10 },
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidQuery, wantError: "Query",
+		},
+		{
+			name: "bad parameter", method: http.MethodGet, target: "/search?q=gopher&page=0",
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidParameter, wantError: "Query parameter 'page' must be a positive integer",
+		},
+		{
+			name: "bad parameter in body", method: http.MethodPost, target: "/search", body: `{"query":"gopher","matching_strategy":"some"}`,
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidParameter, wantError: "Field 'matching_strategy'",
+		},
+		{
+			name: "blocked query", method: http.MethodGet, target: "/search?q=forbidden+gopher",
+			configure: func(c *Config, _ *MeiliSearcher) {
+				c.Blocklist = &Blocklist{terms: [][]string{{"forbidden"}}}
+				c.BlocklistAction = "reject"
+			},
+			wantStatus: http.StatusBadRequest, wantCode: errCodeBlockedQuery,
+		},
+		{
+			name: "invalid filter", method: http.MethodGet, target: "/search?q=gopher&filter=" + url.QueryEscape("unknown = 1"),
+			meili:      meiliRejects("invalid_search_filter"),
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidFilter, wantError: "Invalid filter: rejected",
+		},
+		{
+			name: "invalid sort", method: http.MethodGet, target: "/search?q=gopher&sort=unknown:asc",
+			meili:      meiliRejects("invalid_search_sort"),
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidSort, wantError: "Invalid sort: rejected",
+		},
+		{
+			name: "invalid distinct", method: http.MethodGet, target: "/search?q=gopher&distinct=unknown",
+			meili:      meiliRejects("invalid_search_distinct"),
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidDistinct, wantError: "Invalid distinct attribute",
+		},
+		{
+			name: "invalid search_on", method: http.MethodGet, target: "/search?q=gopher&search_on=unknown",
+			meili:      meiliRejects("invalid_search_attributes_to_search_on"),
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidSearchOn, wantError: "Invalid search_on attribute",
+		},
+		{
+			name: "other rejection", method: http.MethodGet, target: "/search?q=gopher",
+			meili:      meiliRejects("invalid_search_q"),
+			wantStatus: http.StatusBadRequest, wantCode: errCodeInvalidRequest, wantError: "Invalid search request: rejected",
+		},
+		{
+			name: "timeout", method: http.MethodGet, target: "/search?q=gopher",
+			meili: func(meili *fakeMeili) {
+				meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+					<-r.Context().Done()
+				})
+			},
+			configure:  func(c *Config, _ *MeiliSearcher) { c.SearchTimeout = 20 * time.Millisecond },
+			wantStatus: http.StatusGatewayTimeout, wantCode: errCodeTimeout, wantError: "Search timed out after 20ms",
+		},
+		{
+			name: "circuit open", method: http.MethodGet, target: "/search?q=gopher",
+			configure: func(_ *Config, searcher *MeiliSearcher) {
+				searcher.breaker = newCircuitBreaker(1, time.Hour)
+				record, _ := searcher.breaker.allow()
+				record(context.DeadlineExceeded)
+			},
+			wantStatus: http.StatusServiceUnavailable, wantCode: errCodeMeiliUnavailable, wantError: "Search is temporarily unavailable",
+		},
+		{
+			name: "Meilisearch failure", method: http.MethodGet, target: "/search?q=gopher",
+			meili: func(meili *fakeMeili) {
+				meili.handle(http.MethodPost, searchPath, http.StatusInternalServerError, map[string]string{"message": "down", "code": "internal", "type": "internal"})
+			},
+			wantStatus: http.StatusInternalServerError, wantCode: errCodeSearchFailed, wantError: "Search failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			if tt.meili != nil {
+				tt.meili(meili)
+			} else {
+				meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			}
+			searcher := meili.searcher()
+			config := testConfig(meili.URL)
+			if tt.configure != nil {
+				tt.configure(config, searcher)
+			}
+			router := newSearchRouter(searcher, nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Success || response.ErrorCode != tt.wantCode {
+				t.Errorf("success, error_code = %v, %q, want false, %q", response.Success, response.ErrorCode, tt.wantCode)
+			}
+			if response.Error == "" || !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want a message starting %q", response.Error, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchCSVHeader is the header row of CSV search exports
+var searchCSVHeader = []string{"id", "title", "url", "score"}
+
+// writeSearchCSV writes the results of response as a CSV attachment, one row
+// per result. Rows are flushed to the client as they are written instead of
+// building the whole file in memory.
+func writeSearchCSV(c *gin.Context, status int, response *SearchResponse) {
+	results := response.Results
+	if response.Hits != nil {
+		results = toSearchResults(response.Hits)
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="search-results.csv"`)
+	c.Status(status)
+
+	w := csv.NewWriter(c.Writer)
+	write := func(record []string) bool {
+		if err := w.Write(record); err != nil {
+			slog.Warn("Failed to write CSV export", "error", err)
+			return false
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return true
+	}
+
+	if !write(searchCSVHeader) {
+		return
+	}
+	for _, result := range results {
+		if !write([]string{result.ID, result.Title, result.URL, strconv.FormatFloat(result.Score, 'f', -1, 64)}) {
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportDocs are the hits the fake Meilisearch answers export searches with
+var exportDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher guide", "url": "https://example.com/guide", "_rankingScore": 0.9},
+	{"id": "2", "title": `Tips, "tricks" and more`, "url": "https://example.com/tips?a=1,2", "_rankingScore": 0.5},
+	{"id": "3", "title": "Line\nbreaks", "_rankingScore": 0.25},
+}
+
+func TestSearchCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		hits   []map[string]interface{}
+		want   [][]string
+	}{
+		{
+			name:   "results",
+			target: "/search?q=gopher&format=csv",
+			hits:   exportDocs,
+			want: [][]string{
+				{"id", "title", "url", "score"},
+				{"1", "Gopher guide", "https://example.com/guide", "0.9"},
+				{"2", `Tips, "tricks" and more`, "https://example.com/tips?a=1,2", "0.5"},
+				{"3", "Line\nbreaks", "", "0.25"},
+			},
+		},
+		{
+			name:   "raw hits",
+			target: "/search?q=gopher&format=csv&raw=true",
+			hits:   exportDocs[:1],
+			want: [][]string{
+				{"id", "title", "url", "score"},
+				{"1", "Gopher guide", "https://example.com/guide", "0.9"},
+			},
+		},
+		{
+			name:   "no results",
+			target: "/search?q=badger&format=csv",
+			want:   [][]string{{"id", "title", "url", "score"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(tt.hits...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/csv", got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="search-results.csv"` {
+				t.Errorf("Content-Disposition = %q, want an attachment", got)
+			}
+
+			rows, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("body is not CSV: %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+// Only successful GET searches are exported; anything else stays JSON
+func TestSearchCSVFallsBackToJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"error", http.MethodGet, "/search?format=csv", "", http.StatusBadRequest},
+		{"POST", http.MethodPost, "/search?format=csv", `{"query":"gopher"}`, http.StatusOK},
+		{"unknown format", http.MethodGet, "/search?q=gopher&format=xlsx", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(exportDocs...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != "" {
+				t.Errorf("Content-Disposition = %q, want none", got)
+			}
+		})
+	}
+}
+
+// flushRecorder counts the flushes of a response
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+// Each row reaches the client as soon as it is written
+func TestSearchCSVStreamsRows(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(exportDocs...))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=gopher&format=csv", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if want := len(exportDocs) + 1; w.flushes < want {
+		t.Errorf("flushed %d times, want once per row (%d)", w.flushes, want)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedSnippetLength is the length in words of the content snippet of a feed
+// item
+const feedSnippetLength = 50
+
+// RSS is an RSS 2.0 document
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel describes the feed and holds its items
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []RSSItem `xml:"item"`
+}
+
+// RSSItem is one document of the feed
+type RSSItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	Description string   `xml:"description"`
+	GUID        *RSSGUID `xml:"guid,omitempty"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+}
+
+// RSSGUID identifies an item; IsPermaLink is false when it is not a URL
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// feedHandler serves GET /feed.rss, an RSS 2.0 feed of the documents matching
+// q (or of every document when q is empty), newest first by date_field
+func feedHandler(searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := normalizeQuery(c.Query("q"), config.MaxQueryLength)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil {
+			limit = 0
+		}
+
+		dateField := c.DefaultQuery("date_field", "date")
+		if !attributeNamePattern.MatchString(dateField) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid date_field %q", dateField),
+			})
+			return
+		}
+
+		status, response, _ := executeSearch(c.Request.Context(), searcher, cache, config, indexFor(c, config), SearchParams{
+			Query:            query,
+			Limit:            clampLimit(limit, config.DefaultSearchLimit, config.MaxSearchLimit),
+			Filter:           withSafeSearch(c.Query("filter"), true, config),
+			Sort:             []string{dateField + ":desc"},
+			DisableHighlight: true,
+			CropLength:       feedSnippetLength,
+			MatchingStrategy: "last",
+			Raw:              true,
+		})
+		if !response.Success {
+			c.JSON(status, gin.H{"error": response.Error})
+			return
+		}
+
+		title := "Latest documents"
+		if query != "" {
+			title = fmt.Sprintf("Search results for %q", query)
+		}
+		feed := RSS{
+			Version: "2.0",
+			Channel: RSSChannel{
+				Title:       title,
+				Link:        requestURL(c),
+				Description: title,
+				Items:       make([]RSSItem, 0, len(response.Hits)),
+			},
+		}
+		for _, hit := range response.Hits {
+			feed.Channel.Items = append(feed.Channel.Items, feedItem(hit, dateField))
+		}
+
+		body, err := xml.Marshal(feed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to render feed: %v", err),
+			})
+			return
+		}
+		c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), body...))
+	}
+}
+
+// feedItem turns a raw Meilisearch hit into a feed item, using the cropped
+// content as description and date field as publication date
+func feedItem(hit map[string]interface{}, dateField string) RSSItem {
+	item := RSSItem{
+		Title:       getString(hit, "title"),
+		Link:        getString(hit, "url"),
+		Description: getString(hit, "content"),
+	}
+	if formatted, ok := hit["_formatted"].(map[string]interface{}); ok {
+		if content := getString(formatted, "content"); content != "" {
+			item.Description = content
+		}
+	}
+
+	if item.Link != "" {
+		item.GUID = &RSSGUID{Value: item.Link, IsPermaLink: true}
+	} else if id := getString(hit, "id"); id != "" {
+		item.GUID = &RSSGUID{Value: id}
+	}
+
+	if seconds, err := parseTimestamp(getString(hit, dateField)); err == nil {
+		item.PubDate = time.Unix(seconds, 0).UTC().Format(time.RFC1123Z)
+	}
+	return item
+}
+
+// requestURL returns the absolute URL of the request
+func requestURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.RequestURI()
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newFeedRouter mounts GET /feed.rss in front of meili
+func newFeedRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/feed.rss", feedHandler(meili.searcher(), nil, config))
+	return router
+}
+
+// feedDocs are the hits the fake Meilisearch answers feed searches with
+var feedDocs = []map[string]interface{}{
+	{
+		"id": "2", "title": "Gopher tricks", "url": "https://example.com/tricks", "date": "2026-04-02T10:00:00Z",
+		"content":    "A long article about gopher tricks",
+		"_formatted": map[string]interface{}{"content": "…about gopher tricks"},
+	},
+	{"id": "1", "title": "Gopher <guide> & more", "url": "https://example.com/guide?a=1&b=2", "date": 1775037600, "content": "Guide content"},
+	{"id": "0", "title": "Untitled notes", "content": "Notes without a link or date"},
+}
+
+func TestFeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		wantTitle string
+		wantQuery string
+		wantSort  []interface{}
+		wantLimit float64
+	}{
+		{"matching documents", "/feed.rss?q=gopher", `Search results for "gopher"`, "gopher", []interface{}{"date:desc"}, 20},
+		{"recent documents", "/feed.rss", "Latest documents", "", []interface{}{"date:desc"}, 20},
+		{"other date field", "/feed.rss?q=gopher&date_field=published_at", `Search results for "gopher"`, "gopher", []interface{}{"published_at:desc"}, 20},
+		{"limited", "/feed.rss?limit=5", "Latest documents", "", []interface{}{"date:desc"}, 5},
+		{"limit above the maximum", "/feed.rss?limit=5000", "Latest documents", "", []interface{}{"date:desc"}, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(feedDocs...))
+			router := newFeedRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/rss+xml; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want application/rss+xml", got)
+			}
+			if !strings.HasPrefix(w.Body.String(), xml.Header) {
+				t.Errorf("feed does not start with the XML declaration: %s", w.Body)
+			}
+
+			var feed RSS
+			if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("feed is not well-formed XML: %v\n%s", err, w.Body)
+			}
+			if feed.Version != "2.0" || feed.Channel.Title != tt.wantTitle || feed.Channel.Link != "http://example.com"+tt.target {
+				t.Errorf("feed version, title, link = %q, %q, %q", feed.Version, feed.Channel.Title, feed.Channel.Link)
+			}
+			if len(feed.Channel.Items) != len(feedDocs) {
+				t.Fatalf("feed has %d items, want %d", len(feed.Channel.Items), len(feedDocs))
+			}
+
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			request := searches[0].JSON(t)
+			if request["q"] != tt.wantQuery || !reflect.DeepEqual(request["sort"], tt.wantSort) || request["limit"] != tt.wantLimit {
+				t.Errorf("search q, sort, limit = %v, %v, %v, want %q, %v, %v", request["q"], request["sort"], request["limit"], tt.wantQuery, tt.wantSort, tt.wantLimit)
+			}
+			if request["cropLength"] != float64(feedSnippetLength) {
+				t.Errorf("cropLength = %v, want %d", request["cropLength"], feedSnippetLength)
+			}
+		})
+	}
+}
+
+func TestFeedItems(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(feedDocs...))
+	router := newFeedRouter(meili, testConfig(meili.URL))
+
+	w := serve(router, http.MethodGet, "/feed.rss?q=gopher", "")
+	var feed RSS
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not well-formed XML: %v\n%s", err, w.Body)
+	}
+
+	want := []RSSItem{
+		{
+			Title:       "Gopher tricks",
+			Link:        "https://example.com/tricks",
+			Description: "…about gopher tricks",
+			GUID:        &RSSGUID{Value: "https://example.com/tricks", IsPermaLink: true},
+			PubDate:     "Thu, 02 Apr 2026 10:00:00 +0000",
+		},
+		{
+			Title:       "Gopher <guide> & more",
+			Link:        "https://example.com/guide?a=1&b=2",
+			Description: "Guide content",
+			GUID:        &RSSGUID{Value: "https://example.com/guide?a=1&b=2", IsPermaLink: true},
+			PubDate:     "Wed, 01 Apr 2026 10:00:00 +0000",
+		},
+		{
+			Title:       "Untitled notes",
+			Description: "Notes without a link or date",
+			GUID:        &RSSGUID{Value: "0"},
+		},
+	}
+	if !reflect.DeepEqual(feed.Channel.Items, want) {
+		t.Errorf("items = %+v, want %+v", feed.Channel.Items, want)
+	}
+	// Markup in documents is escaped rather than breaking the feed
+	if !strings.Contains(w.Body.String(), "Gopher &lt;guide&gt; &amp; more") {
+		t.Errorf("feed does not escape the title: %s", w.Body)
+	}
+}
+
+func TestFeedIsEmptyWithoutMatches(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+	router := newFeedRouter(meili, testConfig(meili.URL))
+
+	w := serve(router, http.MethodGet, "/feed.rss?q=badger", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var feed RSS
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not well-formed XML: %v\n%s", err, w.Body)
+	}
+	if len(feed.Channel.Items) != 0 || feed.Channel.Title != `Search results for "badger"` {
+		t.Errorf("feed = %+v, want an empty channel", feed.Channel)
+	}
+}
+
+func TestFeedErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		meiliDown  bool
+		wantStatus int
+		wantError  string
+	}{
+		{"invalid date field", "/feed.rss?date_field=" + "bad%20field", false, http.StatusBadRequest, `Invalid date_field "bad field"`},
+		{"query too long", "/feed.rss?q=" + strings.Repeat("a", 600), false, http.StatusBadRequest, "Query"},
+		{"search failed", "/feed.rss?q=gopher", true, http.StatusInternalServerError, "Search failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			if tt.meiliDown {
+				meili.handle(http.MethodPost, searchPath, http.StatusInternalServerError, map[string]string{"message": "down", "code": "internal", "type": "internal"})
+			} else {
+				meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(feedDocs...))
+			}
+			router := newFeedRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); (n != 0) != tt.meiliDown {
+				t.Errorf("Meilisearch received %d searches", n)
+			}
+		})
+	}
+}
+
+func TestFeedItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		hit       map[string]interface{}
+		dateField string
+		want      RSSItem
+	}{
+		{
+			name:      "link and RFC 3339 date",
+			hit:       map[string]interface{}{"id": "1", "title": "Gopher", "url": "https://example.com/1", "content": "Text", "date": "2026-04-15T08:30:00Z"},
+			dateField: "date",
+			want:      RSSItem{Title: "Gopher", Link: "https://example.com/1", Description: "Text", GUID: &RSSGUID{Value: "https://example.com/1", IsPermaLink: true}, PubDate: "Wed, 15 Apr 2026 08:30:00 +0000"},
+		},
+		{
+			name:      "Unix timestamp in another field",
+			hit:       map[string]interface{}{"id": "1", "title": "Gopher", "published": float64(0)},
+			dateField: "published",
+			want:      RSSItem{Title: "Gopher", GUID: &RSSGUID{Value: "1"}, PubDate: "Thu, 01 Jan 1970 00:00:00 +0000"},
+		},
+		{
+			name:      "cropped content",
+			hit:       map[string]interface{}{"id": "1", "content": "Full text", "_formatted": map[string]interface{}{"content": "…text"}},
+			dateField: "date",
+			want:      RSSItem{Description: "…text", GUID: &RSSGUID{Value: "1"}},
+		},
+		{
+			name:      "unparseable date",
+			hit:       map[string]interface{}{"id": "1", "date": "yesterday"},
+			dateField: "date",
+			want:      RSSItem{GUID: &RSSGUID{Value: "1"}},
+		},
+		{
+			name:      "no identity",
+			hit:       map[string]interface{}{"title": "Gopher"},
+			dateField: "date",
+			want:      RSSItem{Title: "Gopher"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedItem(tt.hit, tt.dateField); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feedItem() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The feed always hides the documents SAFE_SEARCH marks unsafe
+func TestFeedAppliesSafeSearch(t *testing.T) {
+	tests := []struct {
+		name       string
+		safeSearch bool
+		target     string
+		wantFilter interface{}
+	}{
+		{"disabled", false, "/feed.rss?q=gopher", nil},
+		{"disabled with a filter", false, "/feed.rss?q=gopher&filter=lang%20%3D%20en", "lang = en"},
+		{"enabled", true, "/feed.rss?q=gopher", "nsfw != true"},
+		{"enabled with a filter", true, "/feed.rss?q=gopher&filter=lang%20%3D%20en", "(lang = en) AND nsfw != true"},
+		{"cannot be turned off", true, "/feed.rss?q=gopher&safe=false", "nsfw != true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			config := testConfig(meili.URL)
+			config.SafeSearch = tt.safeSearch
+			router := newFeedRouter(meili, config)
+
+			if w := serve(router, http.MethodGet, tt.target, ""); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			if filter := searches[0].JSON(t)["filter"]; filter != tt.wantFilter {
+				t.Errorf("filter = %v, want %v", filter, tt.wantFilter)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withGeo restricts filter to the documents whose _geo point lies within
+// radius meters of lat, lng, and returns the sort rule ordering hits by
+// distance from that point. A zero radius sorts by distance without
+// filtering. lat and lng are both nil when the search is not a geo search.
+func withGeo(filter string, lat, lng *float64, radius float64) (string, string, error) {
+	if lat == nil && lng == nil {
+		if radius != 0 {
+			return "", "", fmt.Errorf("'radius' requires 'lat' and 'lng'")
+		}
+		return filter, "", nil
+	}
+	if lat == nil || lng == nil {
+		return "", "", fmt.Errorf("'lat' and 'lng' must be given together")
+	}
+	if *lat < -90 || *lat > 90 {
+		return "", "", fmt.Errorf("'lat' must be between -90 and 90, got %s", formatCoordinate(*lat))
+	}
+	if *lng < -180 || *lng > 180 {
+		return "", "", fmt.Errorf("'lng' must be between -180 and 180, got %s", formatCoordinate(*lng))
+	}
+	if radius < 0 {
+		return "", "", fmt.Errorf("'radius' must be a positive number of meters, got %s", formatCoordinate(radius))
+	}
+
+	point := formatCoordinate(*lat) + ", " + formatCoordinate(*lng)
+	sort := "_geoPoint(" + point + "):asc"
+	if radius == 0 {
+		return filter, sort, nil
+	}
+
+	geoFilter := "_geoRadius(" + point + ", " + formatCoordinate(radius) + ")"
+	if filter == "" {
+		return geoFilter, sort, nil
+	}
+	return "(" + filter + ") AND " + geoFilter, sort, nil
+}
+
+// geoQuery reads the lat, lng and radius query parameters of a geo search
+func geoQuery(c *gin.Context) (*float64, *float64, float64, error) {
+	lat, err := parseCoordinate("lat", c.Query("lat"))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	lng, err := parseCoordinate("lng", c.Query("lng"))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	radius, err := parseCoordinate("radius", c.Query("radius"))
+	if err != nil || radius == nil {
+		return lat, lng, 0, err
+	}
+	return lat, lng, *radius, nil
+}
+
+// parseCoordinate reads the optional float query parameter name, returning
+// nil when it is absent
+func parseCoordinate(name, value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Query parameter '%s' must be a number", name)
+	}
+	return &parsed, nil
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
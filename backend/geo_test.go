@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithGeo(t *testing.T) {
+	lat, lng := 48.8566, 2.3522
+	latOutOfRange, lngOutOfRange := 91.0, 181.0
+	tests := []struct {
+		name       string
+		filter     string
+		lat, lng   *float64
+		radius     float64
+		wantFilter string
+		wantSort   string
+		wantErr    string
+	}{
+		{"not a geo search", "category = bakery", nil, nil, 0, "category = bakery", "", ""},
+		{"sort by distance", "", &lat, &lng, 0, "", "_geoPoint(48.8566, 2.3522):asc", ""},
+		{"within a radius", "", &lat, &lng, 1500, "_geoRadius(48.8566, 2.3522, 1500)", "_geoPoint(48.8566, 2.3522):asc", ""},
+		{"radius and filter", "category = bakery", &lat, &lng, 1500.5, "(category = bakery) AND _geoRadius(48.8566, 2.3522, 1500.5)", "_geoPoint(48.8566, 2.3522):asc", ""},
+		{"radius without a point", "", nil, nil, 1500, "", "", "'radius' requires 'lat' and 'lng'"},
+		{"lat without lng", "", &lat, nil, 0, "", "", "'lat' and 'lng' must be given together"},
+		{"lng without lat", "", nil, &lng, 0, "", "", "'lat' and 'lng' must be given together"},
+		{"lat out of range", "", &latOutOfRange, &lng, 0, "", "", "'lat' must be between -90 and 90, got 91"},
+		{"lng out of range", "", &lat, &lngOutOfRange, 0, "", "", "'lng' must be between -180 and 180, got 181"},
+		{"negative radius", "", &lat, &lng, -1, "", "", "'radius' must be a positive number of meters, got -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, sort, err := withGeo(tt.filter, tt.lat, tt.lng, tt.radius)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("withGeo() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || filter != tt.wantFilter || sort != tt.wantSort {
+				t.Errorf("withGeo() = %q, %q, %v, want %q, %q", filter, sort, err, tt.wantFilter, tt.wantSort)
+			}
+		})
+	}
+}
+
+// geoDocs are places in and around Paris, plus one without a location.
+// From the center of Paris, Notre-Dame is about 0.5 km away, the Louvre
+// 1.2 km, the Eiffel Tower 4.2 km and Versailles 17 km.
+var geoDocs = []map[string]interface{}{
+	{"id": "versailles", "title": "Versailles bakery", "category": "bakery", "_geo": map[string]interface{}{"lat": 48.8049, "lng": 2.1204}},
+	{"id": "eiffel", "title": "Eiffel bakery", "category": "bakery", "_geo": map[string]interface{}{"lat": 48.8584, "lng": 2.2945}},
+	{"id": "online", "title": "Online bakery", "category": "bakery"},
+	{"id": "louvre", "title": "Louvre cafe", "category": "cafe", "_geo": map[string]interface{}{"lat": 48.8606, "lng": 2.3376}},
+	{"id": "notre-dame", "title": "Notre-Dame bakery", "category": "bakery", "_geo": map[string]interface{}{"lat": 48.853, "lng": 2.3499}},
+}
+
+func TestSearchGeo(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantIDs    []string
+		wantFilter interface{}
+		wantSort   []interface{}
+	}{
+		{
+			name:       "within 2 km",
+			method:     http.MethodGet,
+			target:     "/search?browse=true&lat=48.8566&lng=2.3522&radius=2000",
+			wantIDs:    []string{"notre-dame", "louvre"},
+			wantFilter: "_geoRadius(48.8566, 2.3522, 2000)",
+			wantSort:   []interface{}{"_geoPoint(48.8566, 2.3522):asc"},
+		},
+		{
+			name:       "within 5 km",
+			method:     http.MethodGet,
+			target:     "/search?browse=true&lat=48.8566&lng=2.3522&radius=5000",
+			wantIDs:    []string{"notre-dame", "louvre", "eiffel"},
+			wantFilter: "_geoRadius(48.8566, 2.3522, 5000)",
+			wantSort:   []interface{}{"_geoPoint(48.8566, 2.3522):asc"},
+		},
+		{
+			name:     "sorted by distance without a radius",
+			method:   http.MethodGet,
+			target:   "/search?browse=true&lat=48.8566&lng=2.3522",
+			wantIDs:  []string{"notre-dame", "louvre", "eiffel", "versailles", "online"},
+			wantSort: []interface{}{"_geoPoint(48.8566, 2.3522):asc"},
+		},
+		{
+			name:       "with a query and a filter",
+			method:     http.MethodGet,
+			target:     "/search?q=bakery&filter=category%20%3D%20bakery&lat=48.8566&lng=2.3522&radius=5000",
+			wantIDs:    []string{"notre-dame", "eiffel"},
+			wantFilter: "(category = bakery) AND _geoRadius(48.8566, 2.3522, 5000)",
+			wantSort:   []interface{}{"_geoPoint(48.8566, 2.3522):asc"},
+		},
+		{
+			name:       "POST",
+			method:     http.MethodPost,
+			target:     "/search",
+			body:       `{"browse":true,"lat":48.8566,"lng":2.3522,"radius":2000}`,
+			wantIDs:    []string{"notre-dame", "louvre"},
+			wantFilter: "_geoRadius(48.8566, 2.3522, 2000)",
+			wantSort:   []interface{}{"_geoPoint(48.8566, 2.3522):asc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			index.add(geoDocs...)
+			index.settings["filterableAttributes"] = []interface{}{"_geo", "category"}
+			index.settings["sortableAttributes"] = []interface{}{"_geo"}
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			request := searches[0].JSON(t)
+			if request["filter"] != tt.wantFilter {
+				t.Errorf("filter = %v, want %v", request["filter"], tt.wantFilter)
+			}
+			if sort, _ := request["sort"].([]interface{}); !slices.Equal(sort, tt.wantSort) {
+				t.Errorf("sort = %v, want %v", request["sort"], tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestSearchGeoErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		filterable []interface{}
+		sortable   []interface{}
+		wantCode   string
+		wantError  string
+	}{
+		{"lat not a number", http.MethodGet, "/search?browse=true&lat=north&lng=2.35", "", nil, nil, errCodeInvalidParameter, "Query parameter 'lat' must be a number"},
+		{"radius not a number", http.MethodGet, "/search?browse=true&lat=48.85&lng=2.35&radius=far", "", nil, nil, errCodeInvalidParameter, "Query parameter 'radius' must be a number"},
+		{"lat without lng", http.MethodGet, "/search?browse=true&lat=48.85", "", nil, nil, errCodeInvalidParameter, "'lat' and 'lng' must be given together"},
+		{"radius without a point", http.MethodGet, "/search?browse=true&radius=100", "", nil, nil, errCodeInvalidParameter, "'radius' requires 'lat' and 'lng'"},
+		{"lng out of range", http.MethodGet, "/search?browse=true&lat=48.85&lng=200", "", nil, nil, errCodeInvalidParameter, "'lng' must be between -180 and 180, got 200"},
+		{"negative radius in the body", http.MethodPost, "/search", `{"browse":true,"lat":48.85,"lng":2.35,"radius":-5}`, nil, nil, errCodeInvalidParameter, "'radius' must be a positive number of meters, got -5"},
+		{"_geo not filterable", http.MethodGet, "/search?browse=true&lat=48.85&lng=2.35&radius=100", "", nil, []interface{}{"_geo"}, errCodeInvalidFilter, "Invalid filter"},
+		{"_geo not sortable", http.MethodGet, "/search?browse=true&lat=48.85&lng=2.35", "", []interface{}{"_geo"}, nil, errCodeInvalidSort, "Invalid sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			index.add(geoDocs...)
+			index.settings["filterableAttributes"] = tt.filterable
+			index.settings["sortableAttributes"] = tt.sortable
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantCode || !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q (%s), want %q (%s)", response.Error, response.ErrorCode, tt.wantError, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// indexUIDPattern matches the index UIDs Meilisearch accepts
+var indexUIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,400}$`)
+
+// statsHandler reports the document count, indexing state and field
+// distribution of the index
+func statsHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		indexName := indexFor(c, config)
+		stats, err := client.Index(indexName).GetStats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to get stats: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"index_name":         indexName,
+			"document_count":     stats.NumberOfDocuments,
+			"is_indexing":        stats.IsIndexing,
+			"field_distribution": stats.FieldDistribution,
+		})
+	}
+}
+
+// IndexInfo describes one index in the GET /indexes response
+type IndexInfo struct {
+	UID           string `json:"uid"`
+	PrimaryKey    string `json:"primary_key,omitempty"`
+	DocumentCount int64  `json:"document_count"`
+}
+
+// listIndexesHandler lists indexes page by page with their document counts
+func listIndexesHandler(client *MeiliClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+		if err != nil || limit < 1 {
+			limit = 20
+		}
+		offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		indexes, err := client.GetIndexes(&meilisearch.IndexesQuery{Limit: limit, Offset: offset})
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to list indexes: %v", err),
+			})
+			return
+		}
+
+		// Document counts come from the global stats, one call for all indexes
+		stats, err := client.GetStats()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get stats: %v", err),
+			})
+			return
+		}
+
+		results := make([]IndexInfo, 0, len(indexes.Results))
+		for _, index := range indexes.Results {
+			results = append(results, IndexInfo{
+				UID:           index.UID,
+				PrimaryKey:    index.PrimaryKey,
+				DocumentCount: stats.Indexes[index.UID].NumberOfDocuments,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"indexes": results,
+			"total":   indexes.Total,
+			"limit":   indexes.Limit,
+			"offset":  indexes.Offset,
+		})
+	}
+}
+
+// CreateIndexRequest is the JSON body accepted by POST /index
+type CreateIndexRequest struct {
+	UID        string `json:"uid"`
+	PrimaryKey string `json:"primaryKey"`
+}
+
+// createIndexHandler creates an index, optionally with a primary key given
+// as primaryKey in the body or the primary_key query parameter. Without one
+// Meilisearch infers it from the first documents added.
+func createIndexHandler(client *MeiliClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body CreateIndexRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+
+		if !indexUIDPattern.MatchString(body.UID) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Field 'uid' must be 1-400 letters, digits, dashes or underscores",
+			})
+			return
+		}
+
+		if primaryKey := c.Query("primary_key"); primaryKey != "" {
+			if body.PrimaryKey != "" && body.PrimaryKey != primaryKey {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Query parameter 'primary_key' and field 'primaryKey' disagree",
+				})
+				return
+			}
+			body.PrimaryKey = primaryKey
+		}
+
+		task, err := client.CreateIndex(&meilisearch.IndexConfig{
+			Uid:        body.UID,
+			PrimaryKey: body.PrimaryKey,
+		})
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to create index: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// deleteIndexHandler deletes an index together with its documents and
+// settings. Cached searches of the index are dropped once it is gone.
+func deleteIndexHandler(client *MeiliClient, cache Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.Param("uid")
+		if !indexUIDPattern.MatchString(uid) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Index UID must be 1-400 letters, digits, dashes or underscores",
+			})
+			return
+		}
+
+		task, err := client.DeleteIndex(uid)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to delete index: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// SwapIndexesRequest is the JSON body accepted by POST /index/swap
+type SwapIndexesRequest struct {
+	Indexes []string `json:"indexes"`
+}
+
+// swapIndexesHandler exchanges the documents and settings of two indexes, so
+// a new index can be built next to the live one and then swapped in at once
+func swapIndexesHandler(client *MeiliClient, cache Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body SwapIndexesRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+
+		if len(body.Indexes) != 2 || body.Indexes[0] == body.Indexes[1] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Field 'indexes' must list two different index UIDs",
+			})
+			return
+		}
+		for _, uid := range body.Indexes {
+			if !indexUIDPattern.MatchString(uid) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Index UIDs must be 1-400 letters, digits, dashes or underscores",
+				})
+				return
+			}
+			if _, err := client.GetIndex(uid); err != nil {
+				status := meiliErrorStatus(err)
+				if status == http.StatusNotFound {
+					c.JSON(status, gin.H{
+						"error": fmt.Sprintf("Index %q not found", uid),
+					})
+					return
+				}
+				c.JSON(status, gin.H{
+					"error": fmt.Sprintf("Failed to get index: %v", err),
+				})
+				return
+			}
+		}
+
+		task, err := client.SwapIndexes([]meilisearch.SwapIndexesParams{{Indexes: body.Indexes}})
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to swap indexes: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// resetIndexHandler deletes every document in the index while keeping its
+// settings, for wiping an index before a full reindex
+func resetIndexHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, err := client.Index(indexFor(c, config)).DeleteAllDocuments()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to reset index: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// documentCount returns the document count GET /stats reports
+func documentCount(t *testing.T, router http.Handler, headers ...string) int {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/stats", "", headers...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats status = %d, body %s", w.Code, w.Body)
+	}
+	var stats struct {
+		DocumentCount int `json:"document_count"`
+	}
+	decodeJSON(t, w, &stats)
+	return stats.DocumentCount
+}
+
+func TestResetIndex(t *testing.T) {
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	index.taskStatus = "enqueued"
+	config := testConfig(meili.URL)
+	config.APIAuthKey = "secret"
+	router := newAPIRouter(meili, config)
+	auth := []string{"Authorization", "Bearer secret"}
+
+	index.add(numberedDocs(5)...)
+	if n := documentCount(t, router); n != 5 {
+		t.Fatalf("document count before the reset = %d, want 5", n)
+	}
+
+	if w := serve(router, http.MethodPost, "/index/reset", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("reset without the API key status = %d, want 401", w.Code)
+	}
+
+	w := serve(router, http.MethodPost, "/index/reset", "", auth...)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("reset status = %d, body %s", w.Code, w.Body)
+	}
+	var submitted struct {
+		TaskUID int    `json:"task_uid"`
+		Status  string `json:"status"`
+	}
+	decodeJSON(t, w, &submitted)
+	if submitted.Status != "enqueued" {
+		t.Errorf("status = %q, want enqueued", submitted.Status)
+	}
+
+	// The documents stay until Meilisearch processes the task
+	if n := documentCount(t, router); n != 5 {
+		t.Errorf("document count before the task ran = %d, want 5", n)
+	}
+	meili.complete(submitted.TaskUID)
+
+	w = serve(router, http.MethodGet, fmt.Sprintf("/tasks/%d", submitted.TaskUID), "")
+	var task struct {
+		Status string `json:"status"`
+		Type   string `json:"type"`
+	}
+	decodeJSON(t, w, &task)
+	if task.Status != "succeeded" || task.Type != "documentDeletion" {
+		t.Errorf("task = %+v, want a succeeded documentDeletion", task)
+	}
+	if n := documentCount(t, router); n != 0 {
+		t.Errorf("document count after the reset = %d, want 0", n)
+	}
+}
+
+func TestResetIndexIsScopedToTheTenant(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(numberedDocs(3)...)
+	meili.serveIndex("documents_acme").add(numberedDocs(2)...)
+	config := testConfig(meili.URL)
+	router := newAPIRouter(meili, config)
+
+	if w := serve(router, http.MethodPost, "/index/reset", "", tenantHeader, "acme"); w.Code != http.StatusAccepted {
+		t.Fatalf("reset status = %d, body %s", w.Code, w.Body)
+	}
+	if n := documentCount(t, router, tenantHeader, "acme"); n != 0 {
+		t.Errorf("tenant document count after the reset = %d, want 0", n)
+	}
+	if n := documentCount(t, router); n != 3 {
+		t.Errorf("default index document count after the tenant reset = %d, want 3", n)
+	}
+}
+
+// newIndexesRouter mounts the index management, search and task endpoints in
+// front of meili
+func newIndexesRouter(meili *fakeMeili, config *Config, cache Cache) *gin.Engine {
+	client := newMeiliClient(config)
+
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/search", indexParam(config), searchHandler(meili.searcher(), cache, config))
+	router.GET("/indexes", listIndexesHandler(client))
+	router.POST("/index", createIndexHandler(client))
+	router.DELETE("/index/:uid", deleteIndexHandler(client, cache))
+	router.POST("/index/swap", swapIndexesHandler(client, cache))
+	router.GET("/tasks/:uid", getTaskHandler(client))
+	return router
+}
+
+// listedIndexes returns the indexes GET /indexes lists
+func listedIndexes(t *testing.T, router http.Handler) []IndexInfo {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/indexes", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body %s", w.Code, w.Body)
+	}
+	var list struct {
+		Indexes []IndexInfo `json:"indexes"`
+	}
+	decodeJSON(t, w, &list)
+	return list.Indexes
+}
+
+// taskStatus returns the status GET /tasks/:uid reports for the task a write
+// endpoint answered with
+func taskStatus(t *testing.T, router http.Handler, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var submitted struct {
+		TaskUID int64 `json:"task_uid"`
+	}
+	decodeJSON(t, w, &submitted)
+	w = serve(router, http.MethodGet, fmt.Sprintf("/tasks/%d", submitted.TaskUID), "")
+	var task struct {
+		Status string `json:"status"`
+	}
+	decodeJSON(t, w, &task)
+	return task.Status
+}
+
+func TestIndexLifecycle(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndexManagement()
+	meili.serveIndex("documents").add(numberedDocs(2)...)
+	router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+	w := serve(router, http.MethodPost, "/index", `{"uid": "products", "primaryKey": "sku"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create status = %d, body %s", w.Code, w.Body)
+	}
+	if status := taskStatus(t, router, w); status != "succeeded" {
+		t.Errorf("creation task status = %q, want succeeded", status)
+	}
+
+	want := []IndexInfo{{UID: "documents", DocumentCount: 2}, {UID: "products", PrimaryKey: "sku"}}
+	if got := listedIndexes(t, router); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexes after creation = %+v, want %+v", got, want)
+	}
+
+	// Creating it again fails once Meilisearch processes the task
+	w = serve(router, http.MethodPost, "/index?primary_key=sku", `{"uid": "products"}`)
+	if status := taskStatus(t, router, w); status != "failed" {
+		t.Errorf("duplicate creation task status = %q, want failed", status)
+	}
+
+	w = serve(router, http.MethodDelete, "/index/products", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("delete status = %d, body %s", w.Code, w.Body)
+	}
+	if status := taskStatus(t, router, w); status != "succeeded" {
+		t.Errorf("deletion task status = %q, want succeeded", status)
+	}
+
+	want = []IndexInfo{{UID: "documents", DocumentCount: 2}}
+	if got := listedIndexes(t, router); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexes after deletion = %+v, want %+v", got, want)
+	}
+	if w := serve(router, http.MethodGet, "/search?q=doc&index=products", ""); w.Code == http.StatusOK {
+		t.Errorf("search of the deleted index succeeded: %s", w.Body)
+	}
+}
+
+func TestIndexManagementRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"invalid uid", http.MethodPost, "/index", `{"uid": "my index"}`},
+		{"missing uid", http.MethodPost, "/index", `{"primaryKey": "id"}`},
+		{"uid too long", http.MethodPost, "/index", fmt.Sprintf(`{"uid": %q}`, strings.Repeat("a", 401))},
+		{"malformed body", http.MethodPost, "/index", `{"uid":`},
+		{"conflicting primary keys", http.MethodPost, "/index?primary_key=id", `{"uid": "products", "primaryKey": "sku"}`},
+		{"invalid uid to delete", http.MethodDelete, "/index/bad.name", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndexManagement()
+			router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			if n := len(meili.received(http.MethodPost, "/indexes")) + len(meili.received(http.MethodDelete, "/indexes/bad.name")); n != 0 {
+				t.Errorf("Meilisearch received %d index requests", n)
+			}
+		})
+	}
+}
+
+func TestDeleteIndexInvalidatesCache(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndexManagement()
+	meili.serveIndex("documents").add(numberedDocs(2)...)
+	cache := newQueryCache(100, time.Minute, 0)
+	router := newIndexesRouter(meili, testConfig(meili.URL), cache)
+
+	if _, xcache := searchCache(t, router, "doc"); xcache != "MISS" {
+		t.Fatalf("first search X-Cache = %s, want MISS", xcache)
+	}
+	if _, xcache := searchCache(t, router, "doc"); xcache != "HIT" {
+		t.Fatalf("second search X-Cache = %s, want HIT", xcache)
+	}
+
+	if w := serve(router, http.MethodDelete, "/index/documents", ""); w.Code != http.StatusAccepted {
+		t.Fatalf("delete status = %d, body %s", w.Code, w.Body)
+	}
+	eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.items) == 0
+	}, "cache still holds searches of the deleted index")
+}
+
+func TestListIndexes(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndexManagement()
+	meili.serveIndex("articles").add(numberedDocs(3)...)
+	meili.serveIndex("documents").add(numberedDocs(5)...)
+	meili.serveIndex("products").primaryKey = "sku"
+	router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+	articles := IndexInfo{UID: "articles", DocumentCount: 3}
+	documents := IndexInfo{UID: "documents", DocumentCount: 5}
+	products := IndexInfo{UID: "products", PrimaryKey: "sku"}
+
+	tests := []struct {
+		name       string
+		target     string
+		wantQuery  string
+		wantLimit  int
+		wantOffset int
+		want       []IndexInfo
+	}{
+		{"all indexes", "/indexes", "limit=20", 20, 0, []IndexInfo{articles, documents, products}},
+		{"first page", "/indexes?limit=2", "limit=2", 2, 0, []IndexInfo{articles, documents}},
+		{"second page", "/indexes?limit=2&offset=2", "limit=2&offset=2", 2, 2, []IndexInfo{products}},
+		{"past the end", "/indexes?offset=10", "limit=20&offset=10", 20, 10, []IndexInfo{}},
+		{"invalid values fall back to the defaults", "/indexes?limit=0&offset=-1", "limit=20", 20, 0, []IndexInfo{articles, documents, products}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := meili.last(t, http.MethodGet, "/indexes").Query; got != tt.wantQuery {
+				t.Errorf("Meilisearch query = %q, want %q", got, tt.wantQuery)
+			}
+
+			var list struct {
+				Indexes []IndexInfo `json:"indexes"`
+				Total   int         `json:"total"`
+				Limit   int         `json:"limit"`
+				Offset  int         `json:"offset"`
+			}
+			decodeJSON(t, w, &list)
+			if !reflect.DeepEqual(list.Indexes, tt.want) {
+				t.Errorf("indexes = %+v, want %+v", list.Indexes, tt.want)
+			}
+			if list.Total != 3 || list.Limit != tt.wantLimit || list.Offset != tt.wantOffset {
+				t.Errorf("total, limit, offset = %d, %d, %d, want 3, %d, %d", list.Total, list.Limit, list.Offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestListIndexesSurfacesMeilisearchErrors(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodGet, "/indexes", http.StatusUnauthorized, map[string]string{
+		"message": "The provided API key is invalid.",
+		"code":    "invalid_api_key",
+		"type":    "auth",
+	})
+	router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+	w := serve(router, http.MethodGet, "/indexes", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401, body %s", w.Code, w.Body)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		docs      []map[string]interface{}
+		wantCount int
+		want      map[string]int
+	}{
+		{"empty index", nil, 0, map[string]int{}},
+		{
+			name: "varying fields",
+			docs: []map[string]interface{}{
+				{"id": "1", "title": "Go", "content": "Gophers", "url": "https://go.dev"},
+				{"id": "2", "title": "Gin", "content": "Web framework"},
+				{"id": "3", "title": "Draft", "author": "Ada"},
+			},
+			wantCount: 3,
+			want:      map[string]int{"id": 3, "title": 3, "content": 2, "url": 1, "author": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(tt.docs...)
+			config := testConfig(meili.URL)
+			router := gin.New()
+			router.GET("/stats", statsHandler(newMeiliClient(config), config))
+
+			w := serve(router, http.MethodGet, "/stats", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var stats struct {
+				IndexName         string         `json:"index_name"`
+				DocumentCount     int            `json:"document_count"`
+				IsIndexing        bool           `json:"is_indexing"`
+				FieldDistribution map[string]int `json:"field_distribution"`
+			}
+			decodeJSON(t, w, &stats)
+			if stats.IndexName != "documents" || stats.DocumentCount != tt.wantCount || stats.IsIndexing {
+				t.Errorf("stats = %+v, want %d documents in documents, not indexing", stats, tt.wantCount)
+			}
+			if !reflect.DeepEqual(stats.FieldDistribution, tt.want) {
+				t.Errorf("field_distribution = %v, want %v", stats.FieldDistribution, tt.want)
+			}
+		})
+	}
+}
+
+// searchTitles returns the titles GET /search finds for query in index
+func searchTitles(t *testing.T, router http.Handler, query, index string) []string {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/search?q="+query+"&index="+index, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, body %s", w.Code, w.Body)
+	}
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	titles := make([]string, len(response.Results))
+	for i, result := range response.Results {
+		titles[i] = result.Title
+	}
+	return titles
+}
+
+func TestSwapIndexes(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndexManagement()
+	meili.serveIndex("documents").add(map[string]interface{}{"id": "1", "title": "Old gopher"})
+	router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+	// Build the new index next to the live one
+	w := serve(router, http.MethodPost, "/index", `{"uid": "documents_new", "primaryKey": "id"}`)
+	if status := taskStatus(t, router, w); status != "succeeded" {
+		t.Fatalf("creation task status = %q, want succeeded", status)
+	}
+	meili.indexes["documents_new"].add(
+		map[string]interface{}{"id": "1", "title": "New gopher"},
+		map[string]interface{}{"id": "2", "title": "Another new gopher"},
+	)
+	if got := searchTitles(t, router, "gopher", "documents"); !reflect.DeepEqual(got, []string{"Old gopher"}) {
+		t.Fatalf("live index before the swap = %v, want the old data", got)
+	}
+
+	w = serve(router, http.MethodPost, "/index/swap", `{"indexes": ["documents", "documents_new"]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("swap status = %d, body %s", w.Code, w.Body)
+	}
+	if status := taskStatus(t, router, w); status != "succeeded" {
+		t.Errorf("swap task status = %q, want succeeded", status)
+	}
+
+	tests := []struct {
+		index string
+		want  []string
+	}{
+		{"documents", []string{"New gopher", "Another new gopher"}},
+		{"documents_new", []string{"Old gopher"}},
+	}
+	for _, tt := range tests {
+		if got := searchTitles(t, router, "gopher", tt.index); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s after the swap = %v, want %v", tt.index, got, tt.want)
+		}
+	}
+
+	swaps := meili.received(http.MethodPost, "/swap-indexes")
+	if len(swaps) != 1 || !strings.Contains(string(swaps[0].Body), `"indexes":["documents","documents_new"]`) {
+		t.Errorf("Meilisearch received swaps %v, want one of documents and documents_new", swaps)
+	}
+}
+
+func TestSwapIndexesInvalidatesCache(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndexManagement()
+	meili.serveIndex("documents").add(map[string]interface{}{"id": "old", "title": "Gopher"})
+	meili.serveIndex("documents_new").add(map[string]interface{}{"id": "new", "title": "Gopher"})
+	cache := newQueryCache(100, time.Minute, 0)
+	router := newIndexesRouter(meili, testConfig(meili.URL), cache)
+
+	searchCache(t, router, "gopher")
+	if ids, xcache := searchCache(t, router, "gopher"); xcache != "HIT" || !reflect.DeepEqual(ids, []string{"old"}) {
+		t.Fatalf("second search = %v %s, want the old document from the cache", ids, xcache)
+	}
+
+	if w := serve(router, http.MethodPost, "/index/swap", `{"indexes": ["documents_new", "documents"]}`); w.Code != http.StatusAccepted {
+		t.Fatalf("swap status = %d, body %s", w.Code, w.Body)
+	}
+	eventually(t, func() bool {
+		ids, _ := searchCache(t, router, "gopher")
+		return reflect.DeepEqual(ids, []string{"new"})
+	}, "searches still return the swapped out index from the cache")
+}
+
+func TestSwapIndexesRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"malformed body", `{"indexes":`, http.StatusBadRequest, "Invalid request body"},
+		{"no indexes", `{}`, http.StatusBadRequest, "Field 'indexes' must list two different index UIDs"},
+		{"one index", `{"indexes": ["documents"]}`, http.StatusBadRequest, "Field 'indexes' must list two different index UIDs"},
+		{"three indexes", `{"indexes": ["documents", "documents_new", "other"]}`, http.StatusBadRequest, "Field 'indexes' must list two different index UIDs"},
+		{"same index twice", `{"indexes": ["documents", "documents"]}`, http.StatusBadRequest, "Field 'indexes' must list two different index UIDs"},
+		{"invalid uid", `{"indexes": ["documents", "bad.name"]}`, http.StatusBadRequest, "Index UIDs must be"},
+		{"missing index", `{"indexes": ["documents", "missing"]}`, http.StatusNotFound, `Index "missing" not found`},
+		{"missing first index", `{"indexes": ["missing", "documents"]}`, http.StatusNotFound, `Index "missing" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndexManagement()
+			meili.serveIndex("documents")
+			meili.serveIndex("documents_new")
+			router := newIndexesRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, http.MethodPost, "/index/swap", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPost, "/swap-indexes")); n != 0 {
+				t.Errorf("Meilisearch received %d swaps, want none", n)
+			}
+		})
+	}
+}
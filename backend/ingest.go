@@ -0,0 +1,444 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// documentBatcher collects streamed documents and sends them to Meilisearch
+// in batches of size, so large uploads never sit in memory all at once. Up
+// to workers batches are prepared (HTML stripped, JSON encoded) and sent at
+// the same time, so batches may be enqueued out of upload order. Meilisearch
+// applies tasks in task UID order, which is what decides the version kept of
+// a document repeated in different batches. add blocks while all workers are
+// busy, so at most workers+1 batches are held.
+type documentBatcher struct {
+	index      *MeiliIndex
+	size       int
+	primaryKey string
+
+	// stripFields lists the fields converted from HTML to text before a
+	// batch is sent
+	stripFields []string
+
+	batch   []map[string]interface{}
+	count   int
+	batches int
+
+	jobs   chan documentBatch
+	wg     sync.WaitGroup
+	closed bool
+
+	// Outcome of the batches sent so far, in the order they finished
+	mu      sync.Mutex
+	indexed int
+	tasks   []batchTask
+	errs    []BatchError
+}
+
+// batchTask is the Meilisearch task of an accepted batch
+type batchTask struct {
+	batch   int
+	taskUID int64
+}
+
+// documentBatch is a batch handed to the workers, numbered from 1
+type documentBatch struct {
+	number    int
+	documents []map[string]interface{}
+}
+
+// BatchError reports a batch of an upload that Meilisearch did not accept
+type BatchError struct {
+	Batch     int    `json:"batch"`
+	Documents int    `json:"documents"`
+	Error     string `json:"error"`
+
+	err error
+}
+
+func newDocumentBatcher(index *MeiliIndex, size, workers int, primaryKey string) *documentBatcher {
+	b := &documentBatcher{
+		index:      index,
+		size:       size,
+		primaryKey: primaryKey,
+		batch:      make([]map[string]interface{}, 0, size),
+		jobs:       make(chan documentBatch),
+	}
+	for i := 0; i < workers; i++ {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for batch := range b.jobs {
+				b.send(batch)
+			}
+		}()
+	}
+	return b
+}
+
+// add queues doc, handing the batch to a worker once it is full. It fails
+// with the error of the first failed batch once one has failed.
+func (b *documentBatcher) add(doc map[string]interface{}) error {
+	if err := b.err(); err != nil {
+		return err
+	}
+
+	b.batch = append(b.batch, doc)
+	b.count++
+	if len(b.batch) >= b.size {
+		b.flush()
+	}
+	return nil
+}
+
+// flush hands the queued documents, if any, to a worker
+func (b *documentBatcher) flush() {
+	if len(b.batch) == 0 || b.closed {
+		return
+	}
+
+	b.batches++
+	b.jobs <- documentBatch{number: b.batches, documents: b.batch}
+	b.batch = make([]map[string]interface{}, 0, b.size)
+}
+
+// wait stops the workers once the batches handed to them are sent and
+// returns the error of the first failed batch. Documents not yet flushed are
+// dropped. It may be called more than once.
+func (b *documentBatcher) wait() error {
+	if !b.closed {
+		b.closed = true
+		close(b.jobs)
+	}
+	b.wg.Wait()
+	return b.err()
+}
+
+// send prepares batch and enqueues it in Meilisearch
+func (b *documentBatcher) send(batch documentBatch) {
+	var primaryKey []string
+	if b.primaryKey != "" {
+		primaryKey = append(primaryKey, b.primaryKey)
+	}
+	for _, doc := range batch.documents {
+		stripHTMLFields(doc, b.stripFields)
+	}
+	// A []byte body is sent as is, so the client does not encode it again
+	body, err := json.Marshal(batch.documents)
+
+	var task *meilisearch.TaskInfo
+	if err == nil {
+		task, err = b.index.AddDocuments(body, primaryKey...)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.errs = append(b.errs, BatchError{
+			Batch:     batch.number,
+			Documents: len(batch.documents),
+			Error:     err.Error(),
+			err:       err,
+		})
+		return
+	}
+	b.indexed += len(batch.documents)
+	b.tasks = append(b.tasks, batchTask{batch: batch.number, taskUID: task.TaskUID})
+}
+
+func (b *documentBatcher) err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return b.errs[0].err
+}
+
+// progress returns the number of documents in accepted batches, their task
+// UIDs and the failed batches, both in upload order
+func (b *documentBatcher) progress() (int, []int64, []BatchError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tasks := slices.Clone(b.tasks)
+	slices.SortFunc(tasks, func(x, y batchTask) int { return x.batch - y.batch })
+	taskUIDs := make([]int64, len(tasks))
+	for i, task := range tasks {
+		taskUIDs[i] = task.taskUID
+	}
+	errs := slices.Clone(b.errs)
+	slices.SortFunc(errs, func(x, y BatchError) int { return x.Batch - y.Batch })
+	return b.indexed, taskUIDs, errs
+}
+
+// addDocumentsNDJSONHandler indexes newline-delimited JSON documents read
+// straight from the request body, one Meilisearch task per batch. The
+// primary_key query parameter is checked and passed on like for POST
+// /documents.
+func addDocumentsNDJSONHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stripHTML, ok := parseStripHTML(c)
+		if !ok {
+			return
+		}
+
+		primaryKey := c.Query("primary_key")
+		batcher := newDocumentBatcher(client.Index(indexFor(c, config)), config.IngestBatchSize, config.IngestWorkers, primaryKey)
+		if stripHTML {
+			batcher.stripFields = config.StripHTMLFields
+		}
+		decoder := json.NewDecoder(c.Request.Body)
+
+		for position := 0; ; position++ {
+			var doc map[string]interface{}
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				ingestError(c, client, cache, batcher, bodyErrorStatus(err),
+					fmt.Sprintf("Invalid JSON document at position %d: %v", position, err))
+				return
+			}
+			if primaryKey != "" && doc[primaryKey] == nil {
+				ingestError(c, client, cache, batcher, http.StatusBadRequest,
+					fmt.Sprintf("Document at position %d is missing the %q field", position, primaryKey))
+				return
+			}
+
+			if err := batcher.add(doc); err != nil {
+				ingestError(c, client, cache, batcher, meiliErrorStatus(err),
+					fmt.Sprintf("Failed to add documents: %v", err))
+				return
+			}
+		}
+
+		batcher.flush()
+		if err := batcher.wait(); err != nil {
+			ingestError(c, client, cache, batcher, meiliErrorStatus(err),
+				fmt.Sprintf("Failed to add documents: %v", err))
+			return
+		}
+
+		if batcher.count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one document is required",
+			})
+			return
+		}
+
+		_, taskUIDs, _ := batcher.progress()
+		invalidateAfterTasks(client, cache, taskUIDs...)
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uids": taskUIDs,
+			"count":     batcher.count,
+		})
+	}
+}
+
+// addDocumentsCSVHandler indexes a text/csv body whose header row names the
+// fields of every following row. When the primary_key query parameter is
+// given, the header must have that column and no row may leave it empty.
+func addDocumentsCSVHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.ContentType() != "text/csv" {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": "Content-Type must be text/csv",
+			})
+			return
+		}
+
+		stripHTML, ok := parseStripHTML(c)
+		if !ok {
+			return
+		}
+
+		reader := csv.NewReader(c.Request.Body)
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if err != nil {
+			c.JSON(bodyErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Invalid CSV header row: %v", err),
+			})
+			return
+		}
+		header = append([]string(nil), header...)
+
+		primaryKey := c.Query("primary_key")
+		if primaryKey != "" && !slices.Contains(header, primaryKey) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("CSV header has no %q column", primaryKey),
+			})
+			return
+		}
+
+		batcher := newDocumentBatcher(client.Index(indexFor(c, config)), config.IngestBatchSize, config.IngestWorkers, primaryKey)
+		if stripHTML {
+			batcher.stripFields = config.StripHTMLFields
+		}
+
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				ingestError(c, client, cache, batcher, bodyErrorStatus(err), fmt.Sprintf("Invalid CSV: %v", err))
+				return
+			}
+
+			doc := make(map[string]interface{}, len(header))
+			for i, column := range header {
+				doc[column] = record[i]
+			}
+			if primaryKey != "" && doc[primaryKey] == "" {
+				line, _ := reader.FieldPos(0)
+				ingestError(c, client, cache, batcher, http.StatusBadRequest,
+					fmt.Sprintf("Row on line %d has an empty %q column", line, primaryKey))
+				return
+			}
+
+			if err := batcher.add(doc); err != nil {
+				ingestError(c, client, cache, batcher, meiliErrorStatus(err),
+					fmt.Sprintf("Failed to add documents: %v", err))
+				return
+			}
+		}
+
+		batcher.flush()
+		if err := batcher.wait(); err != nil {
+			ingestError(c, client, cache, batcher, meiliErrorStatus(err),
+				fmt.Sprintf("Failed to add documents: %v", err))
+			return
+		}
+
+		if batcher.count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one document is required",
+			})
+			return
+		}
+
+		_, taskUIDs, _ := batcher.progress()
+		invalidateAfterTasks(client, cache, taskUIDs...)
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uids": taskUIDs,
+			"count":     batcher.count,
+		})
+	}
+}
+
+// ingestError reports a failed upload along with the tasks of the batches
+// that were already sent, since those documents are still indexed
+func ingestError(c *gin.Context, client *MeiliClient, cache Cache, batcher *documentBatcher, status int, message string) {
+	batcher.wait()
+	_, taskUIDs, batchErrors := batcher.progress()
+	invalidateAfterTasks(client, cache, taskUIDs...)
+
+	response := gin.H{
+		"error":     message,
+		"task_uids": taskUIDs,
+	}
+	if len(batchErrors) > 0 {
+		response["batch_errors"] = batchErrors
+	}
+	c.JSON(status, response)
+}
+
+// parseStripHTML reads the strip_html query parameter of the indexing
+// endpoints, answering 400 and returning ok=false when it is not a boolean
+func parseStripHTML(c *gin.Context) (strip bool, ok bool) {
+	value := c.Query("strip_html")
+	if value == "" {
+		return false, true
+	}
+
+	strip, err := strconv.ParseBool(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Query parameter 'strip_html' must be true or false",
+		})
+		return false, false
+	}
+	return strip, true
+}
+
+// stripHTMLFields replaces the string values of fields in doc with their
+// text content
+func stripHTMLFields(doc map[string]interface{}, fields []string) {
+	for _, field := range fields {
+		if value, ok := doc[field].(string); ok {
+			doc[field] = htmlToText(value)
+		}
+	}
+}
+
+// blockElements are the elements whose boundaries separate words
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"td": true, "th": true, "tr": true, "ul": true,
+}
+
+// htmlToText returns the text of an HTML fragment with entities decoded,
+// scripts and styles dropped and whitespace collapsed
+func htmlToText(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return collapseWhitespace(s)
+	}
+
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			text.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			text.WriteByte(' ')
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	return collapseWhitespace(text.String())
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const documentsPath = "/indexes/documents/documents"
+
+// newIngestRouter mounts the streaming ingestion endpoints and search in
+// front of meili
+func newIngestRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	client := newMeiliClient(config)
+
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/search", searchHandler(meili.searcher(), nil, config))
+	router.POST("/documents/ndjson", addDocumentsNDJSONHandler(client, nil, config))
+	router.POST("/documents/csv", addDocumentsCSVHandler(client, nil, config))
+	return router
+}
+
+// ndjsonLines returns n NDJSON documents with ids 0 to n-1
+func ndjsonLines(n int) string {
+	return ndjsonRange(0, n)
+}
+
+// ndjsonRange returns NDJSON documents with ids from to to-1
+func ndjsonRange(from, to int) string {
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		fmt.Fprintf(&b, "{\"id\": \"%d\", \"title\": \"Doc %d\"}\n", i, i)
+	}
+	return b.String()
+}
+
+// ingestResponse is the body of the ingestion endpoints
+type ingestResponse struct {
+	TaskUIDs    []int64      `json:"task_uids"`
+	Count       int          `json:"count"`
+	Error       string       `json:"error"`
+	BatchErrors []BatchError `json:"batch_errors"`
+}
+
+func TestAddDocumentsNDJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		body      string
+		batchSize int
+		wantCount int
+		wantTasks int
+	}{
+		{"single batch", "/documents/ndjson", ndjsonLines(3), 100, 3, 1},
+		{"several thousand lines", "/documents/ndjson", ndjsonLines(5000), 1000, 5000, 5},
+		{"partial last batch", "/documents/ndjson", ndjsonLines(2500), 1000, 2500, 3},
+		{"blank lines and no trailing newline", "/documents/ndjson", "\n{\"id\": \"a\"}\n\n{\"id\": \"b\"}", 10, 2, 1},
+		{"custom primary key", "/documents/ndjson?primary_key=sku", "{\"sku\": \"a\"}\n{\"sku\": \"b\"}\n", 10, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			config.IngestBatchSize = tt.batchSize
+			router := newIngestRouter(meili, config)
+
+			w := serve(router, http.MethodPost, tt.target, tt.body)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response ingestResponse
+			decodeJSON(t, w, &response)
+			if response.Count != tt.wantCount || len(response.TaskUIDs) != tt.wantTasks {
+				t.Errorf("count, tasks = %d, %d, want %d, %d", response.Count, len(response.TaskUIDs), tt.wantCount, tt.wantTasks)
+			}
+			if n := len(index.documents()); n != tt.wantCount {
+				t.Errorf("index holds %d documents, want %d", n, tt.wantCount)
+			}
+			for _, request := range meili.received(http.MethodPost, documentsPath) {
+				var batch []interface{}
+				if err := json.Unmarshal(request.Body, &batch); err != nil || len(batch) > tt.batchSize {
+					t.Errorf("batch of %d documents, want at most %d", len(batch), tt.batchSize)
+				}
+			}
+		})
+	}
+}
+
+func TestAddDocumentsNDJSONStreams(t *testing.T) {
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	config := testConfig(meili.URL)
+	config.IngestBatchSize = 100
+	router := newIngestRouter(meili, config)
+
+	body, writer := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/documents/ndjson", body)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(w, req)
+	}()
+
+	// The first batches reach Meilisearch while the upload is still going
+	io.WriteString(writer, ndjsonLines(250))
+	eventually(t, func() bool { return len(index.documents()) >= 200 }, "no batch was indexed before the upload finished")
+	select {
+	case <-done:
+		t.Fatal("handler finished before the upload did")
+	default:
+	}
+
+	io.WriteString(writer, ndjsonRange(250, 300))
+	writer.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not finish after the upload")
+	}
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if n := len(index.documents()); n != 300 {
+		t.Errorf("index holds %d documents, want 300", n)
+	}
+}
+
+func TestAddDocumentsNDJSONErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantError  string
+		wantTasks  int
+	}{
+		{"empty body", "/documents/ndjson", "", http.StatusBadRequest, "At least one document is required", 0},
+		{"invalid JSON", "/documents/ndjson", "{\"id\": \"1\"}\n{oops}\n", http.StatusBadRequest, "Invalid JSON document at position 1", 0},
+		{"missing id", "/documents/ndjson?primary_key=id", "{\"id\": \"1\"}\n{\"title\": \"no id\"}\n", http.StatusBadRequest, `Document at position 1 is missing the "id" field`, 0},
+		{"missing custom key", "/documents/ndjson?primary_key=sku", "{\"id\": \"1\"}\n", http.StatusBadRequest, `Document at position 0 is missing the "sku" field`, 0},
+		{"error after sent batches", "/documents/ndjson", ndjsonLines(25) + "{oops}\n", http.StatusBadRequest, "Invalid JSON document at position 25", 2},
+		{"invalid strip_html", "/documents/ndjson?strip_html=maybe", ndjsonLines(1), http.StatusBadRequest, "Query parameter 'strip_html' must be true or false", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			config.IngestBatchSize = 10
+			router := newIngestRouter(meili, config)
+
+			w := serve(router, http.MethodPost, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response ingestResponse
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want it to start with %q", response.Error, tt.wantError)
+			}
+			if len(response.TaskUIDs) != tt.wantTasks {
+				t.Errorf("task_uids = %v, want %d tasks", response.TaskUIDs, tt.wantTasks)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsNDJSONReportsFailedBatches(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveTasks()
+	calls := 0
+	meili.handleFunc(http.MethodPost, documentsPath, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			writeFakeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"message": "The provided payload reached the size limit.",
+				"code":    "payload_too_large",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		writeFakeJSON(w, http.StatusAccepted, meili.enqueue("documents", "documentAdditionOrUpdate", "succeeded"))
+	})
+	config := testConfig(meili.URL)
+	config.IngestBatchSize = 10
+	config.IngestWorkers = 1
+	router := newIngestRouter(meili, config)
+
+	w := serve(router, http.MethodPost, "/documents/ndjson", ndjsonLines(30))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413, body %s", w.Code, w.Body)
+	}
+	var response ingestResponse
+	decodeJSON(t, w, &response)
+	wantErrors := []BatchError{{Batch: 2, Documents: 10}}
+	for i := range response.BatchErrors {
+		response.BatchErrors[i].Error = ""
+	}
+	if !reflect.DeepEqual(response.BatchErrors, wantErrors) {
+		t.Errorf("batch_errors = %+v, want %+v", response.BatchErrors, wantErrors)
+	}
+	if len(response.TaskUIDs) == 0 {
+		t.Errorf("task_uids is empty, want the task of the accepted first batch")
+	}
+}
+
+func TestAddDocumentsCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantDocs []map[string]interface{}
+		search   string
+		wantIDs  []string
+	}{
+		{
+			name:   "header names the fields",
+			target: "/documents/csv",
+			body:   "id,title,content\n1,Gopher guide,All about gophers\n2,Gin tricks,Routing and middleware\n",
+			wantDocs: []map[string]interface{}{
+				{"id": "1", "title": "Gopher guide", "content": "All about gophers"},
+				{"id": "2", "title": "Gin tricks", "content": "Routing and middleware"},
+			},
+			search:  "gophers",
+			wantIDs: []string{"1"},
+		},
+		{
+			name:     "quoted fields",
+			target:   "/documents/csv",
+			body:     "id,title\n1,\"Commas, quotes \"\"and\"\" lines\"\n",
+			wantDocs: []map[string]interface{}{{"id": "1", "title": `Commas, quotes "and" lines`}},
+			search:   "quotes",
+			wantIDs:  []string{"1"},
+		},
+		{
+			name:     "custom primary key",
+			target:   "/documents/csv?primary_key=sku",
+			body:     "sku,title\ng-1,Gopher plush\n",
+			wantDocs: []map[string]interface{}{{"sku": "g-1", "title": "Gopher plush"}},
+		},
+		{
+			name:     "HTML stripped",
+			target:   "/documents/csv?strip_html=true",
+			body:     "id,title,content\n1,Intro,<p>Hello <b>gophers</b></p>\n",
+			wantDocs: []map[string]interface{}{{"id": "1", "title": "Intro", "content": "Hello gophers"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			router := newIngestRouter(meili, config)
+
+			w := serve(router, http.MethodPost, tt.target, tt.body, "Content-Type", "text/csv")
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response ingestResponse
+			decodeJSON(t, w, &response)
+			if response.Count != len(tt.wantDocs) || len(response.TaskUIDs) != 1 {
+				t.Errorf("count, tasks = %d, %v, want %d in one task", response.Count, response.TaskUIDs, len(tt.wantDocs))
+			}
+			if got := index.documents(); !reflect.DeepEqual(got, tt.wantDocs) {
+				t.Errorf("documents = %v, want %v", got, tt.wantDocs)
+			}
+			if tt.search != "" {
+				if got := searchIDs(t, router, tt.search); !reflect.DeepEqual(got, tt.wantIDs) {
+					t.Errorf("search %q = %v, want %v", tt.search, got, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+// An explicit primary_key, "id" included, is passed on to Meilisearch for
+// every batch; without one Meilisearch infers the key
+func TestIngestPrimaryKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantQuery   string
+	}{
+		{"NDJSON inferred", "/documents/ndjson", "application/x-ndjson", "{\"id\": \"1\"}\n", ""},
+		{"NDJSON explicit id", "/documents/ndjson?primary_key=id", "application/x-ndjson", "{\"id\": \"1\"}\n", "primaryKey=id"},
+		{"NDJSON without an id", "/documents/ndjson", "application/x-ndjson", "{\"sku\": \"g-1\"}\n", ""},
+		{"CSV inferred", "/documents/csv", "text/csv", "id\n1\n", ""},
+		{"CSV explicit id", "/documents/csv?primary_key=id", "text/csv", "id\n1\n", "primaryKey=id"},
+		{"CSV custom key", "/documents/csv?primary_key=sku", "text/csv", "sku\ng-1\n", "primaryKey=sku"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newIngestRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodPost, tt.target, tt.body, "Content-Type", tt.contentType)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			additions := meili.received(http.MethodPost, documentsPath)
+			if len(additions) != 1 {
+				t.Fatalf("Meilisearch received %d additions, want 1", len(additions))
+			}
+			if additions[0].Query != tt.wantQuery {
+				t.Errorf("addition query = %q, want %q", additions[0].Query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsCSVErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{"wrong content type", "/documents/csv", "application/json", "id\n1\n", http.StatusUnsupportedMediaType, "Content-Type must be text/csv"},
+		{"empty body", "/documents/csv", "text/csv", "", http.StatusBadRequest, "Invalid CSV header row"},
+		{"header only", "/documents/csv", "text/csv", "id,title\n", http.StatusBadRequest, "At least one document is required"},
+		{"no id column", "/documents/csv?primary_key=id", "text/csv", "title\nGopher\n", http.StatusBadRequest, `CSV header has no "id" column`},
+		{"no custom key column", "/documents/csv?primary_key=sku", "text/csv", "id\n1\n", http.StatusBadRequest, `CSV header has no "sku" column`},
+		{"empty id", "/documents/csv?primary_key=id", "text/csv", "id,title\n1,A\n,B\n", http.StatusBadRequest, `Row on line 3 has an empty "id" column`},
+		{"wrong field count", "/documents/csv", "text/csv", "id,title\n1,A,extra\n", http.StatusBadRequest, "Invalid CSV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newIngestRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodPost, tt.target, tt.body, "Content-Type", tt.contentType)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response ingestResponse
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want it to start with %q", response.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"inline tags", "<p>hello <b>world</b></p>", "hello world"},
+		{"plain text", "no markup here", "no markup here"},
+		{"whitespace collapsed", "  line one\n\n\tline   two  ", "line one line two"},
+		{"block elements separate words", "<h1>Title</h1><p>First</p><ul><li>one</li><li>two</li></ul>", "Title First one two"},
+		{"line breaks separate words", "first<br>second", "first second"},
+		{"inline elements join words", "go<em>pher</em>", "gopher"},
+		{"entities decoded", "Fish &amp; chips &lt;3 &eacute;t&eacute;", "Fish & chips <3 été"},
+		{"scripts and styles dropped", "<style>p { color: red }</style><p>Visible</p><script>alert(1)</script>", "Visible"},
+		{"comments dropped", "before<!-- hidden -->after", "beforeafter"},
+		{"unclosed tags", "<div><p>open <b>bold", "open bold"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlToText(tt.html); got != tt.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+// versionedLines returns NDJSON holding document "doc" once per batch of
+// batchSize lines, as version 1 to batches, padded with other documents
+func versionedLines(batches, batchSize int) string {
+	var b strings.Builder
+	for batch := 1; batch <= batches; batch++ {
+		fmt.Fprintf(&b, "{\"id\": \"doc\", \"title\": \"Version %d\"}\n", batch)
+		b.WriteString(ndjsonRange(batch*batchSize, batch*batchSize+batchSize-1))
+	}
+	return b.String()
+}
+
+// Up to workers batches are enqueued at the same time. task_uids still lists
+// the tasks in upload order, and the version of a document repeated across
+// batches that wins is the one with the highest task UID.
+func TestDocumentBatcherSendsConcurrently(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		batches int
+	}{
+		{"one worker", 1, 5},
+		{"several workers", 4, 12},
+		{"more workers than batches", 16, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			var mu sync.Mutex
+			var inFlight, maxInFlight, requests int
+			// enqueued holds the first title of each batch in task UID order
+			var enqueued []string
+			meili.handleFunc(http.MethodPost, documentsPath, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var docs []map[string]interface{}
+				json.Unmarshal(body, &docs)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				mu.Lock()
+				requests++
+				// Earlier batches are slower to enqueue, so later ones
+				// overtake them
+				delay := time.Duration(tt.batches-requests+1) * 5 * time.Millisecond
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+
+				time.Sleep(delay)
+
+				mu.Lock()
+				defer mu.Unlock()
+				index.addDocuments(w, r)
+				enqueued = append(enqueued, getString(docs[0], "title"))
+				inFlight--
+			})
+			config := testConfig(meili.URL)
+			config.IngestBatchSize = 10
+			config.IngestWorkers = tt.workers
+			router := newIngestRouter(meili, config)
+
+			w := serve(router, http.MethodPost, "/documents/ndjson", versionedLines(tt.batches, 10))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response ingestResponse
+			decodeJSON(t, w, &response)
+			if response.Count != tt.batches*10 || len(response.TaskUIDs) != tt.batches {
+				t.Fatalf("count = %d, task_uids = %v, want %d documents in %d tasks", response.Count, response.TaskUIDs, tt.batches*10, tt.batches)
+			}
+
+			byUID := slices.Clone(response.TaskUIDs)
+			slices.Sort(byUID)
+			for batch, taskUID := range response.TaskUIDs {
+				want := fmt.Sprintf("Version %d", batch+1)
+				if got := enqueued[slices.Index(byUID, taskUID)]; got != want {
+					t.Errorf("task_uids[%d] is the task of the batch starting with %q, want %q", batch, got, want)
+				}
+			}
+			if doc, _ := index.get("doc"); doc["title"] != enqueued[len(enqueued)-1] {
+				t.Errorf("doc title = %v, want %q from the last task", doc["title"], enqueued[len(enqueued)-1])
+			}
+
+			limit := min(tt.workers, tt.batches)
+			if tt.workers == 1 && maxInFlight != 1 {
+				t.Errorf("%d batches were enqueued at the same time, want 1", maxInFlight)
+			}
+			if tt.workers > 1 && (maxInFlight <= 1 || maxInFlight > limit) {
+				t.Errorf("%d batches were enqueued at the same time, want 2 to %d", maxInFlight, limit)
+			}
+		})
+	}
+}
+
+// While Meilisearch is busy, add blocks once every worker holds a batch, so
+// at most workers+1 batches sit in memory
+func TestDocumentBatcherBackpressure(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   int
+		batchSize int
+	}{
+		{"one worker", 1, 1},
+		{"several workers", 3, 1},
+		{"larger batches", 2, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			release := make(chan struct{})
+			var releaseOnce sync.Once
+			releaseMeili := func() { releaseOnce.Do(func() { close(release) }) }
+			t.Cleanup(releaseMeili)
+			meili.handleFunc(http.MethodPost, documentsPath, func(w http.ResponseWriter, r *http.Request) {
+				<-release
+				index.addDocuments(w, r)
+			})
+			config := testConfig(meili.URL)
+			batcher := newDocumentBatcher(newMeiliClient(config).Index("documents"), tt.batchSize, tt.workers, "")
+
+			const total = 100
+			var added atomic.Int64
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < total; i++ {
+					batcher.add(map[string]interface{}{"id": strconv.Itoa(i)})
+					added.Add(1)
+				}
+				batcher.flush()
+				batcher.wait()
+			}()
+
+			// Each worker holds a batch, and the add completing the next
+			// batch blocks
+			held := int64((tt.workers+1)*tt.batchSize - 1)
+			eventually(t, func() bool { return added.Load() == held }, "added %d documents, want %d", added.Load(), held)
+			time.Sleep(20 * time.Millisecond)
+			if n := added.Load(); n != held {
+				t.Errorf("added %d documents while Meilisearch was busy, want %d", n, held)
+			}
+
+			releaseMeili()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("upload did not finish once Meilisearch caught up")
+			}
+			indexed, taskUIDs, errs := batcher.progress()
+			if indexed != total || len(taskUIDs) != (total+tt.batchSize-1)/tt.batchSize || len(errs) != 0 {
+				t.Errorf("progress = %d, %d tasks, %v, want %d documents", indexed, len(taskUIDs), errs, total)
+			}
+			if n := len(index.documents()); n != total {
+				t.Errorf("index holds %d documents, want %d", n, total)
+			}
+		})
+	}
+}
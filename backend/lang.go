@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// supportedLanguages maps the ISO 639-1 codes accepted by the lang parameter
+// to the ISO 639-3 locales Meilisearch tokenizes queries with
+var supportedLanguages = map[string]string{
+	"ar": "ara",
+	"da": "dan",
+	"de": "deu",
+	"el": "ell",
+	"en": "eng",
+	"es": "spa",
+	"fi": "fin",
+	"fr": "fra",
+	"he": "heb",
+	"hi": "hin",
+	"it": "ita",
+	"ja": "jpn",
+	"ko": "kor",
+	"nl": "nld",
+	"no": "nor",
+	"pl": "pol",
+	"pt": "por",
+	"ru": "rus",
+	"sv": "swe",
+	"th": "tha",
+	"tr": "tur",
+	"uk": "ukr",
+	"zh": "cmn",
+}
+
+// withLanguage restricts filter to the documents whose lang attribute is
+// lang, an ISO 639-1 code. An empty lang leaves filter unchanged.
+func withLanguage(filter, lang string) (string, error) {
+	if lang == "" {
+		return filter, nil
+	}
+	if _, ok := supportedLanguages[lang]; !ok {
+		return "", fmt.Errorf("Unsupported language %q, expected one of %s", lang, strings.Join(sortedKeys(supportedLanguages), ", "))
+	}
+
+	langFilter := fmt.Sprintf("lang = %q", lang)
+	if filter == "" {
+		return langFilter, nil
+	}
+	return "(" + filter + ") AND " + langFilter, nil
+}
+
+// searchLocales returns the Meilisearch locales to search lang with, or nil
+// when SEARCH_LOCALES is off or no language was requested
+func searchLocales(config *Config, lang string) []string {
+	locale, ok := supportedLanguages[lang]
+	if !config.SearchLocales || !ok {
+		return nil
+	}
+	return []string{locale}
+}
+
+// languageIndexKey holds the index languageIndex matched, until the search
+// handler knows whether the search names a language itself
+const languageIndexKey = "language_index"
+
+// languageIndex picks the index of a search from the Accept-Language header,
+// using the INDEX_LANGUAGES index of the best-matching language and the
+// configured index when none matches. Searches that name an index, a tenant
+// or a lang parameter are left alone; a lang field in a POST body is only
+// known once the handler has read it, so useLanguageIndex applies the match.
+func languageIndex(config *Config) gin.HandlerFunc {
+	if len(config.IndexLanguages) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	tags := make([]language.Tag, 0, len(config.IndexLanguages))
+	indexes := make([]string, 0, len(config.IndexLanguages))
+	for _, tag := range sortedKeys(config.IndexLanguages) {
+		tags = append(tags, language.MustParse(tag))
+		indexes = append(indexes, config.IndexLanguages[tag])
+	}
+	matcher := language.NewMatcher(tags)
+
+	return func(c *gin.Context) {
+		if c.GetString(indexNameKey) != "" || c.Query("lang") != "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		accepted, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+		if err != nil || len(accepted) == 0 {
+			c.Next()
+			return
+		}
+		if _, i, confidence := matcher.Match(accepted...); confidence != language.No {
+			c.Set(languageIndexKey, indexes[i])
+		}
+		c.Next()
+	}
+}
+
+// useLanguageIndex searches the index languageIndex matched from
+// Accept-Language, unless the search asks for lang itself
+func useLanguageIndex(c *gin.Context, lang string) {
+	if uid := c.GetString(languageIndexKey); uid != "" && lang == "" {
+		c.Set(indexNameKey, uid)
+	}
+}
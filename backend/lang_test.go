@@ -0,0 +1,244 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithLanguage(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		lang    string
+		want    string
+		wantErr string
+	}{
+		{"no language", "", "", "", ""},
+		{"no language keeps the filter", "category = go", "", "category = go", ""},
+		{"language", "", "fr", `lang = "fr"`, ""},
+		{"language and filter", "category = go", "fr", `(category = go) AND lang = "fr"`, ""},
+		{"unsupported language", "", "xx", "", `Unsupported language "xx", expected one of ar, da, de`},
+		{"codes are lowercase", "", "FR", "", `Unsupported language "FR"`},
+		{"locales are not codes", "", "fra", "", `Unsupported language "fra"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withLanguage(tt.filter, tt.lang)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("withLanguage(%q, %q) error = %v, want %q", tt.filter, tt.lang, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("withLanguage(%q, %q) = %q, %v, want %q", tt.filter, tt.lang, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLocales(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		lang    string
+		want    []string
+	}{
+		{"disabled", false, "fr", nil},
+		{"no language", true, "", nil},
+		{"French", true, "fr", []string{"fra"}},
+		{"Chinese", true, "zh", []string{"cmn"}},
+		{"unsupported language", true, "xx", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("http://127.0.0.1:7700")
+			config.SearchLocales = tt.enabled
+			if got := searchLocales(config, tt.lang); !slices.Equal(got, tt.want) {
+				t.Errorf("searchLocales(%q) = %q, want %q", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
+
+// langDocs are guides in English and French
+var langDocs = []map[string]interface{}{
+	{"id": "en-1", "title": "Gopher guide", "lang": "en"},
+	{"id": "fr-1", "title": "Gopher guide en français", "lang": "fr"},
+	{"id": "en-2", "title": "Gopher tips", "lang": "en"},
+	{"id": "fr-2", "title": "Gopher astuces", "lang": "fr", "category": "tips"},
+}
+
+func TestSearchLanguage(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"French", http.MethodGet, "/search?q=gopher&lang=fr", "", http.StatusOK, []string{"fr-1", "fr-2"}},
+		{"English", http.MethodGet, "/search?q=gopher&lang=en", "", http.StatusOK, []string{"en-1", "en-2"}},
+		{"every language", http.MethodGet, "/search?q=gopher", "", http.StatusOK, []string{"en-1", "fr-1", "en-2", "fr-2"}},
+		{"combined with a filter", http.MethodGet, "/search?q=gopher&lang=fr&filter=category%20%3D%20tips", "", http.StatusOK, []string{"fr-2"}},
+		{"no documents in the language", http.MethodGet, "/search?q=gopher&lang=de", "", http.StatusOK, []string{}},
+		{"POST body", http.MethodPost, "/search", `{"query":"gopher","lang":"fr"}`, http.StatusOK, []string{"fr-1", "fr-2"}},
+		{"unsupported language", http.MethodGet, "/search?q=gopher&lang=xx", "", http.StatusBadRequest, nil},
+		{"unsupported language in the body", http.MethodPost, "/search", `{"query":"gopher","lang":"klingon"}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(langDocs...)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.wantStatus != http.StatusOK {
+				if response.ErrorCode != errCodeInvalidParameter || !strings.HasPrefix(response.Error, "Unsupported language") {
+					t.Errorf("error = %q (%s), want an unsupported language error", response.Error, response.ErrorCode)
+				}
+				if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+					t.Errorf("Meilisearch received %d searches, want none", n)
+				}
+				return
+			}
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// With SEARCH_LOCALES the language also picks the tokenizer
+func TestSearchLanguageLocales(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		method      string
+		target      string
+		body        string
+		wantLocales interface{}
+	}{
+		{"disabled", false, http.MethodGet, "/search?q=gopher&lang=fr", "", nil},
+		{"GET", true, http.MethodGet, "/search?q=gopher&lang=fr", "", []interface{}{"fra"}},
+		{"POST", true, http.MethodPost, "/search", `{"query":"gopher","lang":"ja"}`, []interface{}{"jpn"}},
+		{"no language", true, http.MethodGet, "/search?q=gopher", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(langDocs...)
+			config := testConfig(meili.URL)
+			config.SearchLocales = tt.enabled
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			if w := serve(router, tt.method, tt.target, tt.body); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			if got := searches[0].JSON(t)["locales"]; !reflect.DeepEqual(got, tt.wantLocales) {
+				t.Errorf("locales = %v, want %v", got, tt.wantLocales)
+			}
+		})
+	}
+}
+
+func TestLanguageIndex(t *testing.T) {
+	languages := map[string]string{"en": "docs_en", "fr": "docs_fr", "pt-BR": "docs_pt"}
+	tests := []struct {
+		name           string
+		languages      map[string]string
+		acceptLanguage string
+		target         string
+		wantIndex      string
+	}{
+		{"no header", languages, "", "/search?q=gopher", "documents"},
+		{"exact match", languages, "fr", "/search?q=gopher", "docs_fr"},
+		{"regional variant", languages, "fr-CA", "/search?q=gopher", "docs_fr"},
+		{"region of the configured tag", languages, "pt-BR", "/search?q=gopher", "docs_pt"},
+		{"first preference wins", languages, "fr, en;q=0.8", "/search?q=gopher", "docs_fr"},
+		{"quality order", languages, "en;q=0.5, fr;q=0.9", "/search?q=gopher", "docs_fr"},
+		{"unmatched preference skipped", languages, "de, en;q=0.7", "/search?q=gopher", "docs_en"},
+		{"no match falls back", languages, "de", "/search?q=gopher", "documents"},
+		{"malformed header falls back", languages, "fr;q=x;;", "/search?q=gopher", "documents"},
+		{"index parameter wins", languages, "fr", "/search?q=gopher&index=docs_en", "docs_en"},
+		{"lang parameter wins", languages, "fr", "/search?q=gopher&lang=en", "documents"},
+		{"routing disabled", nil, "fr", "/search?q=gopher", "documents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			for _, index := range []string{"documents", "docs_en", "docs_fr", "docs_pt"} {
+				meili.serveIndex(index)
+			}
+			config := testConfig(meili.URL)
+			config.IndexLanguages = tt.languages
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, http.MethodGet, tt.target, "", "Accept-Language", tt.acceptLanguage)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if n := len(meili.received(http.MethodPost, "/indexes/"+tt.wantIndex+"/search")); n != 1 {
+				t.Errorf("%s received %d searches, want 1", tt.wantIndex, n)
+			}
+			routed := tt.languages != nil && !strings.Contains(tt.target, "index=") && !strings.Contains(tt.target, "lang=")
+			if vary := slices.Contains(w.Header().Values("Vary"), "Accept-Language"); vary != routed {
+				t.Errorf("Vary: Accept-Language set = %v, want %v", vary, routed)
+			}
+		})
+	}
+}
+
+// The lang field of a POST /search body overrides Accept-Language routing
+// the way the lang parameter does for GET /search
+func TestLanguageIndexPostBody(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		target         string
+		body           string
+		wantIndex      string
+	}{
+		{"routed by header", "fr", "/search", `{"query": "gopher"}`, "docs_fr"},
+		{"lang field wins", "fr", "/search", `{"query": "gopher", "lang": "en"}`, "documents"},
+		{"index parameter wins", "fr", "/search?index=docs_en", `{"query": "gopher"}`, "docs_en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			for _, index := range []string{"documents", "docs_en", "docs_fr"} {
+				meili.serveIndex(index)
+			}
+			config := testConfig(meili.URL)
+			config.IndexLanguages = map[string]string{"en": "docs_en", "fr": "docs_fr"}
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, http.MethodPost, tt.target, tt.body, "Content-Type", "application/json", "Accept-Language", tt.acceptLanguage)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if n := len(meili.received(http.MethodPost, "/indexes/"+tt.wantIndex+"/search")); n != 1 {
+				t.Errorf("%s received %d searches, want 1", tt.wantIndex, n)
+			}
+		})
+	}
+}
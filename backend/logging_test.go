@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLoggerSearchFields(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(
+		map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"},
+	))
+	config := testConfig(meili.URL)
+
+	tests := []struct {
+		name        string
+		target      string
+		wantStatus  float64
+		wantLevel   string
+		wantQuery   interface{}
+		wantResults interface{}
+	}{
+		{"successful search", "/search?q=gophers", 200, "INFO", "gophers", 2.0},
+		{"rejected search", "/search", 400, "INFO", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			router := gin.New()
+			router.Use(requestID(), requestLogger(newLogger(&logs, slog.LevelInfo)))
+			router.GET("/search", searchHandler(meili.searcher(), nil, config))
+
+			serve(router, http.MethodGet, tt.target, "", "X-Request-ID", "req-1")
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("log line %q is not JSON: %v", logs.String(), err)
+			}
+			want := map[string]interface{}{
+				"msg":        "request",
+				"level":      tt.wantLevel,
+				"method":     "GET",
+				"path":       "/search",
+				"status":     tt.wantStatus,
+				"request_id": "req-1",
+				"query":      tt.wantQuery,
+				"results":    tt.wantResults,
+			}
+			for key, value := range want {
+				if line[key] != value {
+					t.Errorf("%s = %v, want %v", key, line[key], value)
+				}
+			}
+			if _, ok := line["latency_ms"].(float64); !ok {
+				t.Errorf("latency_ms = %v, want a number", line["latency_ms"])
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v, error: %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoggerLevelFiltersOutput(t *testing.T) {
+	var logs bytes.Buffer
+	logger := newLogger(&logs, slog.LevelWarn)
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	if bytes.Contains(logs.Bytes(), []byte("hidden")) || !bytes.Contains(logs.Bytes(), []byte("shown")) {
+		t.Errorf("logs = %q, want only the warning", logs.String())
+	}
+}
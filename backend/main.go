@@ -1,212 +1,253 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/meilisearch/meilisearch-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-// SearchResult represents a search result document
-type SearchResult struct {
-	ID      string  `json:"id"`
-	Title   string  `json:"title"`
-	Content string  `json:"content"`
-	URL     string  `json:"url"`
-	Score   float64 `json:"score"`
-}
+func main() {
+	slog.SetDefault(newLogger(os.Stdout, slog.LevelInfo))
 
-// SearchResponse represents the API response
-type SearchResponse struct {
-	Success bool           `json:"success"`
-	Results []SearchResult `json:"results,omitempty"`
-	Error   string         `json:"error,omitempty"`
-	Query   string         `json:"query,omitempty"`
-	Total   int            `json:"total,omitempty"`
-}
+	config, err := loadConfig()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if err := config.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
 
-// Config holds the application configuration
-type Config struct {
-	MeilisearchURL string
-	MeilisearchKey string
-	Port           string
-	IndexName      string
-}
+	level, _ := parseLogLevel(config.LogLevel)
+	logger := newLogger(os.Stdout, level)
+	slog.SetDefault(logger)
 
-func loadConfig() *Config {
-	return &Config{
-		MeilisearchURL: getEnv("MEILISEARCH_URL", "http://meilisearch:7700"),
-		MeilisearchKey: getEnv("MEILISEARCH_KEY", "masterKey123"),
-		Port:           getEnv("PORT", "8080"),
-		IndexName:      getEnv("INDEX_NAME", "documents"),
-	}
-}
+	// Initialize the Meilisearch clients, shared by every handler
+	client := newMeiliClient(config)
+	searcher := newMeiliSearcher(config.MeilisearchURLs, config.MeilisearchKey, newMeiliHTTPClient(config))
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	// Fail searches fast while Meilisearch is down, disabled when
+	// BREAKER_FAILURE_THRESHOLD <= 0
+	if config.BreakerFailureThreshold > 0 {
+		searcher.breaker = newCircuitBreaker(config.BreakerFailureThreshold, config.BreakerCooldown)
 	}
-	return defaultValue
-}
-
-func main() {
-	config := loadConfig()
 
-	// Initialize Meilisearch client
-	client := meilisearch.NewClient(meilisearch.ClientConfig{
-		Host:   config.MeilisearchURL,
-		APIKey: config.MeilisearchKey,
+	// Test connection to Meilisearch, retrying through transient failures
+	err = withRetry(context.Background(), config.MeiliMaxRetries, config.MeiliRetryBaseDelay, func() error {
+		return testMeilisearchConnection(client)
 	})
-
-	// Test connection to Meilisearch
-	if err := testMeilisearchConnection(client); err != nil {
-		log.Printf("Warning: Could not connect to Meilisearch: %v", err)
+	if err != nil {
+		slog.Warn("Could not connect to Meilisearch", "error", err)
 	} else {
-		log.Println("Successfully connected to Meilisearch")
+		slog.Info("Successfully connected to Meilisearch")
 	}
 
-	// Initialize Gin router
-	router := gin.Default()
+	// Keep checking the connection in the background for the readiness probe;
+	// any reachable host will do since searches fail over between them
+	monitor := newConnectionMonitor(func() error {
+		return searcher.Health(context.Background())
+	}, config.HealthCheckInterval, err == nil)
+	go monitor.run()
 
-	// CORS middleware
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"*"},
-		AllowCredentials: true,
-	}))
-
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":      "healthy",
-			"service":     "search-engine-backend",
-			"meilisearch": config.MeilisearchURL,
-		})
-	})
+	metrics := newMetrics(searcher.breaker)
 
-	// Search endpoint
-	router.GET("/search", func(c *gin.Context) {
-		query := c.Query("q")
-		if query == "" {
-			c.JSON(http.StatusBadRequest, SearchResponse{
-				Success: false,
-				Error:   "Query parameter 'q' is required",
-			})
-			return
-		}
+	// Query result cache: Redis when REDIS_URL is set, otherwise in-memory
+	cache, err := newCache(config)
+	if err != nil {
+		fatal("Invalid cache configuration", err)
+	}
+
+	// Queries to pre-populate the cache with once the server is up
+	warmQueries, err := loadWarmQueries(config.WarmQueries)
+	if err != nil {
+		fatal("Invalid cache configuration", err)
+	}
+
+	// Per-IP rate limiting for searches, disabled when RATE_LIMIT_RPS <= 0
+	var limiter *RateLimiter
+	if config.RateLimitRPS > 0 {
+		limiter = newRateLimiter(config.RateLimitRPS, config.RateLimitBurst)
+		go limiter.evictLoop(time.Minute)
+	}
 
-		// Parse limit parameter
-		limitStr := c.DefaultQuery("limit", "20")
-		limit, err := strconv.Atoi(limitStr)
+	// OpenTelemetry tracing, exported over OTLP/HTTP when an endpoint is set
+	var tracerProvider *sdktrace.TracerProvider
+	if config.OTLPEndpoint != "" {
+		tracerProvider, err = newTracerProvider(config.OTLPEndpoint, config.OTELServiceName)
 		if err != nil {
-			limit = 20
+			fatal("Invalid tracing configuration", err)
 		}
+	}
 
-		// Perform search
-		results, err := performSearch(client, config.IndexName, query, limit)
+	// Search analytics, disabled unless ANALYTICS_ENABLED is set
+	var analytics *Analytics
+	if config.AnalyticsEnabled {
+		analytics, err = newAnalytics(config.AnalyticsWindow, config.AnalyticsFile)
 		if err != nil {
-			log.Printf("Search error: %v", err)
-			c.JSON(http.StatusInternalServerError, SearchResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Search failed: %v", err),
-				Query:   query,
-			})
-			return
+			fatal("Invalid analytics configuration", err)
 		}
+	}
 
-		c.JSON(http.StatusOK, SearchResponse{
-			Success: true,
-			Results: results,
-			Query:   query,
-			Total:   len(results),
-		})
-	})
+	// Initialize Gin router
+	router := gin.New()
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	router.Use(requestID(), requestLogger(logger), recovery())
+	router.Use(tracing(tracerProvider, config.OTELServiceName)...)
 
-	// Index stats endpoint
-	router.GET("/stats", func(c *gin.Context) {
-		index := client.Index(config.IndexName)
-		stats, err := index.GetStats()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to get stats: %v", err),
-			})
-			return
-		}
+	// CORS middleware
+	router.Use(cors.New(corsConfig(config.CORSAllowedOrigins)))
 
-		c.JSON(http.StatusOK, gin.H{
-			"index_name":     config.IndexName,
-			"document_count": stats.NumberOfDocuments,
-			"is_indexing":    stats.IsIndexing,
-		})
-	})
+	// Gzip compression, skipping probes and the Prometheus scrape endpoint
+	router.Use(gzipMiddleware(config.GzipMinSize, "/health", "/ready", "/metrics"))
 
-	log.Printf("Starting server on port %s", config.Port)
-	log.Fatal(router.Run(":" + config.Port))
-}
+	// Per-tenant index selection via X-Tenant-ID
+	router.Use(tenantIndex(config))
 
-func testMeilisearchConnection(client *meilisearch.Client) error {
-	_, err := client.Health()
-	return err
-}
+	// Liveness probe: only proves the process is serving requests
+	router.GET("/health", healthHandler(config))
 
-func performSearch(client *meilisearch.Client, indexName, query string, limit int) ([]SearchResult, error) {
-	index := client.Index(indexName)
-
-	// Search request
-	searchRes, err := index.Search(query, &meilisearch.SearchRequest{
-		Limit:                    int64(limit),
-		AttributesToHighlight:    []string{"title", "content"},
-		HighlightPreTag:          "<mark>",
-		HighlightPostTag:         "</mark>",
-		AttributesToCrop:         []string{"content"},
-		CropLength:               200,
-		ShowMatchesPosition:      true,
-		AttributesToRetrieve:     []string{"*"},
-	})
+	router.GET("/version", versionHandler)
+
+	// Readiness probe: fails while the connection monitor cannot reach
+	// Meilisearch
+	router.GET("/ready", readyHandler(monitor, searcher, config))
+
+	// Prometheus metrics endpoint
+	router.GET("/metrics", metrics.handler())
+
+	crawler := newCrawler(client, cache, config)
+	api := &API{
+		client:   client,
+		searcher: searcher,
+		cache:    cache,
+		config:   config,
+		metrics:  metrics,
+		limiter:  limiter,
+		crawler:  crawler,
+
+		analytics: analytics,
+	}
+	api.mount(router)
 
+	server := &http.Server{
+		Addr:    ":" + config.Port,
+		Handler: router,
+	}
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		return nil, err
+		fatal("Server error", err)
 	}
 
-	var results []SearchResult
-	for i, hit := range searchRes.Hits {
-		hitBytes, err := json.Marshal(hit)
-		if err != nil {
-			continue
-		}
+	if cache != nil && len(warmQueries) > 0 {
+		go warmCache(searcher, cache, config, warmQueries)
+	}
 
-		var doc map[string]interface{}
-		if err := json.Unmarshal(hitBytes, &doc); err != nil {
-			continue
-		}
+	// Serve until SIGINT/SIGTERM, then let in-flight requests finish
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	if err := runServer(server, listener, config, quit); err != nil {
+		fatal("Server error", err)
+	}
 
-		result := SearchResult{
-			ID:      getString(doc, "id"),
-			Title:   getString(doc, "title"),
-			Content: getString(doc, "content"),
-			URL:     getString(doc, "url"),
-			Score:   float64(len(searchRes.Hits) - i), // Simple scoring based on position
+	// Crawls would otherwise keep fetching pages after the server stopped
+	crawler.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
 		}
+	}
+	analytics.Close()
+	monitor.Stop()
+	slog.Info("Server stopped")
+}
 
-		results = append(results, result)
+// healthHandler serves the liveness probe, which succeeds as long as the
+// process answers
+func healthHandler(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := buildInfo()
+		c.JSON(http.StatusOK, gin.H{
+			"status":      "healthy",
+			"service":     "search-engine-backend",
+			"meilisearch": config.MeilisearchURL,
+			"version":     info.Version,
+			"commit":      info.Commit,
+			"build_date":  info.BuildDate,
+			"go_version":  info.GoVersion,
+		})
 	}
+}
 
-	return results, nil
+// readyHandler serves the readiness probe, which fails with 503 while the
+// connection monitor cannot reach Meilisearch
+func readyHandler(monitor *ConnectionMonitor, searcher *MeiliSearcher, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !monitor.Connected() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":      "unavailable",
+				"service":     "search-engine-backend",
+				"meilisearch": config.MeilisearchURL,
+				"hosts":       searcher.HostHealth(),
+				"error":       "Meilisearch unreachable",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":      "ready",
+			"service":     "search-engine-backend",
+			"meilisearch": config.MeilisearchURL,
+			"hosts":       searcher.HostHealth(),
+		})
+	}
 }
 
-func getString(m map[string]interface{}, key string) string {
-	if val, ok := m[key]; ok {
-		if str, ok := val.(string); ok {
-			return str
+// runServer serves on listener until a signal arrives on quit, then shuts
+// the server down, giving in-flight requests SHUTDOWN_TIMEOUT to finish
+func runServer(server *http.Server, listener net.Listener, config *Config, quit <-chan os.Signal) error {
+	errs := make(chan error, 1)
+	go func() {
+		if config.TLSCertFile != "" {
+			slog.Info("Starting server", "port", config.Port, "tls", true)
+			errs <- server.ServeTLS(listener, config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			slog.Info("Starting server", "port", config.Port, "tls", false)
+			errs <- server.Serve(listener)
 		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-quit:
+		slog.Info("Shutting down server", "signal", sig.String(), "timeout", config.ShutdownTimeout.String())
 	}
-	return ""
-} 
\ No newline at end of file
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// fatal logs err and exits, like log.Fatal for the structured logger
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func testMeilisearchConnection(client *MeiliClient) error {
+	_, err := client.Health()
+	return err
+}
@@ -0,0 +1,1314 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	redis.SetLogger(discardRedisLogger{})
+	os.Exit(m.Run())
+}
+
+// fakeMeili is a stand-in Meilisearch server answering "METHOD /path" routes
+// registered by the test and recording every request it receives. A route
+// ending in * matches every path with that prefix. Requests to unregistered
+// routes get a Meilisearch-style 404.
+type fakeMeili struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	routes   map[string]http.HandlerFunc
+	requests []fakeRequest
+	tasks    []map[string]interface{}
+	// pending holds the changes of enqueued tasks, applied by complete
+	pending map[int]func()
+	// indexes holds the in-memory indexes by UID
+	indexes map[string]*memoryIndex
+}
+
+// fakeRequest is a request received by a fakeMeili
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the request body into a generic map
+func (r fakeRequest) JSON(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		t.Fatalf("request body %q is not a JSON object: %v", r.Body, err)
+	}
+	return body
+}
+
+func newFakeMeili(t *testing.T) *fakeMeili {
+	t.Helper()
+	f := &fakeMeili{routes: make(map[string]http.HandlerFunc)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeMeili) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fakeRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	handler, ok := f.route(r.Method + " " + r.URL.Path)
+	f.mu.Unlock()
+
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{
+			"message": "not found",
+			"code":    "not_found",
+			"type":    "invalid_request",
+		})
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	handler(w, r)
+}
+
+// route returns the handler for key, preferring an exact route over the
+// longest matching prefix route
+func (f *fakeMeili) route(key string) (http.HandlerFunc, bool) {
+	if handler, ok := f.routes[key]; ok {
+		return handler, true
+	}
+	var handler http.HandlerFunc
+	longest := 0
+	for route, h := range f.routes {
+		prefix, ok := strings.CutSuffix(route, "*")
+		if ok && strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			handler, longest = h, len(prefix)
+		}
+	}
+	return handler, handler != nil
+}
+
+// handle answers method and path with status and body encoded as JSON
+func (f *fakeMeili) handle(method, path string, status int, body interface{}) {
+	f.handleFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		writeFakeJSON(w, status, body)
+	})
+}
+
+// handleFunc answers method and path with handler
+func (f *fakeMeili) handleFunc(method, path string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[method+" "+path] = handler
+}
+
+// received returns the requests sent to method and path, oldest first
+func (f *fakeMeili) received(method, path string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []fakeRequest
+	for _, r := range f.requests {
+		if r.Method == method && r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// last returns the latest request sent to method and path, failing the test
+// when there was none
+func (f *fakeMeili) last(t *testing.T, method, path string) fakeRequest {
+	t.Helper()
+	requests := f.received(method, path)
+	if len(requests) == 0 {
+		t.Fatalf("no %s %s request reached Meilisearch", method, path)
+	}
+	return requests[len(requests)-1]
+}
+
+// searcher returns a MeiliSearcher talking to the fake server
+func (f *fakeMeili) searcher() *MeiliSearcher {
+	return newMeiliSearcher([]string{f.URL}, "test-key", f.Client())
+}
+
+// enqueue records a task of taskType on indexUID that has already
+// finished with status, and returns its task info
+func (f *fakeMeili) enqueue(indexUID, taskType, status string) map[string]interface{} {
+	return f.enqueueFunc(indexUID, taskType, status, nil)
+}
+
+// enqueueFunc records a task like enqueue that makes its change by calling
+// apply: right away when status is "succeeded", once the test calls complete
+// when it is "enqueued", and never when the task failed
+func (f *fakeMeili) enqueueFunc(indexUID, taskType, status string, apply func()) map[string]interface{} {
+	if status == "succeeded" && apply != nil {
+		apply()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	uid := len(f.tasks)
+	if status == "enqueued" && apply != nil {
+		if f.pending == nil {
+			f.pending = make(map[int]func())
+		}
+		f.pending[uid] = apply
+	}
+	task := map[string]interface{}{
+		"uid":        uid,
+		"indexUid":   indexUID,
+		"status":     status,
+		"type":       taskType,
+		"duration":   "PT0.001S",
+		"enqueuedAt": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if status == "failed" {
+		task["error"] = map[string]string{
+			"message": "The task failed.",
+			"code":    "internal",
+			"type":    "internal",
+		}
+	}
+	f.tasks = append(f.tasks, task)
+
+	return map[string]interface{}{
+		"taskUid":    uid,
+		"indexUid":   indexUID,
+		"status":     "enqueued",
+		"type":       taskType,
+		"enqueuedAt": task["enqueuedAt"],
+	}
+}
+
+// complete makes the enqueued task uid succeed and applies its change
+func (f *fakeMeili) complete(uid int) {
+	f.mu.Lock()
+	f.tasks[uid]["status"] = "succeeded"
+	apply := f.pending[uid]
+	delete(f.pending, uid)
+	f.mu.Unlock()
+
+	if apply != nil {
+		apply()
+	}
+}
+
+// serveTasks answers GET /tasks/:uid with the tasks enqueued so far
+func (f *fakeMeili) serveTasks() {
+	f.handleFunc(http.MethodGet, "/tasks/*", func(w http.ResponseWriter, r *http.Request) {
+		uid, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/tasks/"))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err != nil || uid < 0 || uid >= len(f.tasks) {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{
+				"message": "Task not found.",
+				"code":    "task_not_found",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, f.tasks[uid])
+	})
+}
+
+// memoryIndex is an in-memory Meilisearch index served by a fakeMeili.
+// Writes are enqueued as tasks that finish with taskStatus; searches match the
+// documents whose title or content contains every query word, honoring the
+// searchable attributes, ranking rules, synonyms, stop words and typo
+// tolerance settings.
+type memoryIndex struct {
+	meili      *fakeMeili
+	uid        string
+	primaryKey string
+
+	mu       sync.Mutex
+	ids      []string
+	docs     map[string]map[string]interface{}
+	settings map[string]interface{}
+
+	// taskStatus is the status write tasks finish with, "succeeded" unless
+	// a test wants them to fail, or "enqueued" to finish them with
+	// fakeMeili.complete
+	taskStatus string
+
+	// estimate turns the number of matches into the estimatedTotalHits of
+	// searches paginated by offset and limit; nil reports the exact number
+	estimate func(total int) int
+}
+
+// serveIndex serves an empty in-memory index uid along with the task
+// endpoint
+func (f *fakeMeili) serveIndex(uid string) *memoryIndex {
+	index := &memoryIndex{
+		meili:      f,
+		uid:        uid,
+		docs:       make(map[string]map[string]interface{}),
+		settings:   make(map[string]interface{}),
+		taskStatus: "succeeded",
+	}
+	base := "/indexes/" + uid
+
+	f.mu.Lock()
+	if f.indexes == nil {
+		f.indexes = make(map[string]*memoryIndex)
+	}
+	f.indexes[uid] = index
+	f.mu.Unlock()
+
+	f.serveTasks()
+	f.handleFunc(http.MethodPost, base+"/documents", index.addDocuments)
+	f.handleFunc(http.MethodPut, base+"/documents", index.addDocuments)
+	f.handleFunc(http.MethodDelete, base+"/documents", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeJSON(w, http.StatusAccepted, index.task("documentDeletion", func() {
+			index.mu.Lock()
+			index.ids, index.docs = nil, make(map[string]map[string]interface{})
+			index.mu.Unlock()
+		}))
+	})
+	f.handleFunc(http.MethodPost, base+"/documents/delete-batch", func(w http.ResponseWriter, r *http.Request) {
+		var ids []string
+		json.NewDecoder(r.Body).Decode(&ids)
+		writeFakeJSON(w, http.StatusAccepted, index.task("documentDeletion", func() { index.delete(ids...) }))
+	})
+	f.handleFunc(http.MethodDelete, base+"/documents/*", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, base+"/documents/")
+		writeFakeJSON(w, http.StatusAccepted, index.task("documentDeletion", func() { index.delete(id) }))
+	})
+	f.handleFunc(http.MethodGet, base+"/documents/*", func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := index.get(strings.TrimPrefix(r.URL.Path, base+"/documents/"))
+		if !ok {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{
+				"message": "Document not found.",
+				"code":    "document_not_found",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		if fields := r.URL.Query().Get("fields"); fields != "" {
+			doc = retrieve([]map[string]interface{}{doc}, strings.Split(fields, ","))[0]
+		}
+		writeFakeJSON(w, http.StatusOK, doc)
+	})
+	f.handleFunc(http.MethodPost, base+"/search", index.search)
+	f.handleFunc(http.MethodGet, base+"/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeJSON(w, http.StatusOK, index.stats())
+	})
+	f.handleFunc(http.MethodGet, base+"/settings", index.getSettings)
+	f.handleFunc(http.MethodPatch, base+"/settings", index.updateSettings)
+	f.handleFunc(http.MethodDelete, base+"/settings", index.updateSettings)
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		handler := index.updateSettings
+		if method == http.MethodGet {
+			handler = index.getSettings
+		}
+		f.handleFunc(method, base+"/settings/*", handler)
+	}
+	return index
+}
+
+// serveIndexManagement answers the index listing, lookup, creation, deletion
+// and swap endpoints and the global stats for the indexes served by
+// serveIndex.
+// Creating an index serves a new empty memoryIndex once the task succeeds;
+// deleting one stops serving it.
+func (f *fakeMeili) serveIndexManagement() {
+	f.serveTasks()
+	f.handleFunc(http.MethodGet, "/indexes", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset := 20, 0
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+			limit = n
+		}
+		if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+			offset = n
+		}
+
+		indexes := f.indexList()
+		results := []map[string]interface{}{}
+		for _, index := range indexes[min(offset, len(indexes)):min(offset+limit, len(indexes))] {
+			results = append(results, map[string]interface{}{
+				"uid":        index.uid,
+				"primaryKey": index.primaryKey,
+				"createdAt":  "2024-01-01T00:00:00Z",
+				"updatedAt":  "2024-01-01T00:00:00Z",
+			})
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+			"offset":  offset,
+			"limit":   limit,
+			"total":   len(indexes),
+		})
+	})
+	f.handleFunc(http.MethodPost, "/indexes", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			UID        string `json:"uid"`
+			PrimaryKey string `json:"primaryKey"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		f.mu.Lock()
+		_, exists := f.indexes[body.UID]
+		f.mu.Unlock()
+		status := "succeeded"
+		if exists {
+			status = "failed"
+		}
+		writeFakeJSON(w, http.StatusAccepted, f.enqueueFunc(body.UID, "indexCreation", status, func() {
+			f.serveIndex(body.UID).primaryKey = body.PrimaryKey
+		}))
+	})
+	f.handleFunc(http.MethodDelete, "/indexes/*", func(w http.ResponseWriter, r *http.Request) {
+		uid := strings.TrimPrefix(r.URL.Path, "/indexes/")
+		f.mu.Lock()
+		_, exists := f.indexes[uid]
+		f.mu.Unlock()
+		status := "succeeded"
+		if !exists {
+			status = "failed"
+		}
+		writeFakeJSON(w, http.StatusAccepted, f.enqueueFunc(uid, "indexDeletion", status, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.indexes, uid)
+			for route := range f.routes {
+				if _, path, _ := strings.Cut(route, " "); strings.HasPrefix(path, "/indexes/"+uid+"/") {
+					delete(f.routes, route)
+				}
+			}
+		}))
+	})
+	f.handleFunc(http.MethodGet, "/indexes/*", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		index, exists := f.indexes[strings.TrimPrefix(r.URL.Path, "/indexes/")]
+		f.mu.Unlock()
+		if !exists {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{
+				"message": "Index not found.",
+				"code":    "index_not_found",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"uid":        index.uid,
+			"primaryKey": index.primaryKey,
+			"createdAt":  "2024-01-01T00:00:00Z",
+			"updatedAt":  "2024-01-01T00:00:00Z",
+		})
+	})
+	f.handleFunc(http.MethodPost, "/swap-indexes", func(w http.ResponseWriter, r *http.Request) {
+		var swaps []struct {
+			Indexes []string `json:"indexes"`
+		}
+		json.NewDecoder(r.Body).Decode(&swaps)
+		if len(swaps) != 1 || len(swaps[0].Indexes) != 2 {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid swap.", "code": "invalid_swap_indexes", "type": "invalid_request"})
+			return
+		}
+
+		f.mu.Lock()
+		a, aExists := f.indexes[swaps[0].Indexes[0]]
+		b, bExists := f.indexes[swaps[0].Indexes[1]]
+		f.mu.Unlock()
+		status := "succeeded"
+		if !aExists || !bExists {
+			status = "failed"
+		}
+		writeFakeJSON(w, http.StatusAccepted, f.enqueueFunc("", "indexSwap", status, func() { a.swap(b) }))
+	})
+	f.handleFunc(http.MethodGet, "/stats", func(w http.ResponseWriter, r *http.Request) {
+		stats := map[string]interface{}{}
+		for _, index := range f.indexList() {
+			stats[index.uid] = index.stats()
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"databaseSize": 0,
+			"lastUpdate":   "2024-01-01T00:00:00Z",
+			"indexes":      stats,
+		})
+	})
+}
+
+// indexList returns the served indexes ordered by UID
+func (f *fakeMeili) indexList() []*memoryIndex {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	indexes := make([]*memoryIndex, 0, len(f.indexes))
+	for _, index := range f.indexes {
+		indexes = append(indexes, index)
+	}
+	slices.SortFunc(indexes, func(a, b *memoryIndex) int { return strings.Compare(a.uid, b.uid) })
+	return indexes
+}
+
+// swap exchanges the documents and settings of index and other, keeping
+// their UIDs, as Meilisearch swaps indexes
+func (index *memoryIndex) swap(other *memoryIndex) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	index.primaryKey, other.primaryKey = other.primaryKey, index.primaryKey
+	index.ids, other.ids = other.ids, index.ids
+	index.docs, other.docs = other.docs, index.docs
+	index.settings, other.settings = other.settings, index.settings
+}
+
+// stats returns the index stats the way Meilisearch reports them
+func (index *memoryIndex) stats() map[string]interface{} {
+	fields := map[string]int{}
+	docs := index.documents()
+	for _, doc := range docs {
+		for field := range doc {
+			fields[field]++
+		}
+	}
+	return map[string]interface{}{
+		"numberOfDocuments": len(docs),
+		"isIndexing":        false,
+		"fieldDistribution": fields,
+	}
+}
+
+// settingName turns the last segment of a settings path, e.g. stop-words,
+// into the name of the setting, e.g. stopWords. It is empty for the
+// settings root.
+func settingName(path string) string {
+	_, segment, ok := strings.Cut(path, "/settings/")
+	if !ok {
+		return ""
+	}
+	words := strings.Split(segment, "-")
+	for i := 1; i < len(words); i++ {
+		words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+	}
+	return strings.Join(words, "")
+}
+
+// meiliDefaultSettings returns the settings of a new Meilisearch index
+func meiliDefaultSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"displayedAttributes":  []interface{}{"*"},
+		"searchableAttributes": []interface{}{"*"},
+		"filterableAttributes": []interface{}{},
+		"sortableAttributes":   []interface{}{},
+		"rankingRules":         []interface{}{"words", "typo", "proximity", "attribute", "sort", "exactness"},
+		"stopWords":            []interface{}{},
+		"synonyms":             map[string]interface{}{},
+		"distinctAttribute":    nil,
+		"typoTolerance": map[string]interface{}{
+			"enabled":             true,
+			"minWordSizeForTypos": map[string]interface{}{"oneTypo": float64(5), "twoTypos": float64(9)},
+			"disableOnWords":      []interface{}{},
+			"disableOnAttributes": []interface{}{},
+		},
+		"faceting":   map[string]interface{}{"maxValuesPerFacet": float64(100)},
+		"pagination": map[string]interface{}{"maxTotalHits": float64(1000)},
+	}
+}
+
+// getSettings answers with the settings set on the index, and the
+// Meilisearch defaults for the others
+func (index *memoryIndex) getSettings(w http.ResponseWriter, r *http.Request) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	settings := meiliDefaultSettings()
+	for name, value := range index.settings {
+		settings[name] = value
+	}
+	if name := settingName(r.URL.Path); name != "" {
+		writeFakeJSON(w, http.StatusOK, settings[name])
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, settings)
+}
+
+// updateSettings replaces a setting on PUT, merges objects into it on PATCH
+// and resets it on DELETE
+func (index *memoryIndex) updateSettings(w http.ResponseWriter, r *http.Request) {
+	var value interface{}
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+				"code":    "bad_request",
+				"type":    "invalid_request",
+			})
+			return
+		}
+	}
+
+	writeFakeJSON(w, http.StatusAccepted, index.task("settingsUpdate", func() {
+		index.mu.Lock()
+		defer index.mu.Unlock()
+		updates := map[string]interface{}{settingName(r.URL.Path): value}
+		if name := settingName(r.URL.Path); name == "" {
+			updates, _ = value.(map[string]interface{})
+			if r.Method == http.MethodDelete {
+				index.settings = make(map[string]interface{})
+			}
+		}
+		for name, value := range updates {
+			current, _ := index.settings[name].(map[string]interface{})
+			patch, isObject := value.(map[string]interface{})
+			switch {
+			case r.Method == http.MethodDelete || value == nil:
+				delete(index.settings, name)
+			case r.Method == http.MethodPatch && isObject && current != nil:
+				for key, field := range patch {
+					current[key] = field
+				}
+			default:
+				index.settings[name] = value
+			}
+		}
+	}))
+}
+
+// matches reports whether text contains word, one of its synonyms or, with
+// typo tolerance on, a word of at least five letters one typo away from it.
+// It is called with index.mu held.
+func (index *memoryIndex) matches(text, word string) bool {
+	candidates := []string{word}
+	if synonyms, ok := index.settings["synonyms"].(map[string]interface{}); ok {
+		for _, synonym := range toStrings(synonyms[word]) {
+			candidates = append(candidates, strings.ToLower(synonym))
+		}
+	}
+	for _, candidate := range candidates {
+		if strings.Contains(text, candidate) {
+			return true
+		}
+	}
+
+	typo, _ := index.settings["typoTolerance"].(map[string]interface{})
+	if enabled, ok := typo["enabled"].(bool); (ok && !enabled) || len(word) < 5 {
+		return false
+	}
+	for _, textWord := range strings.Fields(text) {
+		if withinOneEdit(textWord, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// toStrings converts a decoded JSON array of strings
+func toStrings(value interface{}) []string {
+	items, _ := value.([]interface{})
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// withinOneEdit reports whether a and b differ by at most one inserted,
+// deleted or substituted letter
+func withinOneEdit(a, b string) bool {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	if len(a)-len(b) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(b) && a[i] == b[i] {
+		i++
+	}
+	if len(a) == len(b) {
+		return a[i+min(1, len(a)-i):] == b[i+min(1, len(b)-i):]
+	}
+	return a[i+1:] == b[i:]
+}
+
+// task enqueues a task of taskType that makes its change by calling apply
+func (index *memoryIndex) task(taskType string, apply func()) map[string]interface{} {
+	index.mu.Lock()
+	status := index.taskStatus
+	index.mu.Unlock()
+	return index.meili.enqueueFunc(index.uid, taskType, status, apply)
+}
+
+func (index *memoryIndex) addDocuments(w http.ResponseWriter, r *http.Request) {
+	var docs []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&docs); err != nil {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+			"code":    "malformed_payload",
+			"type":    "invalid_request",
+		})
+		return
+	}
+	primaryKey := r.URL.Query().Get("primaryKey")
+	if primaryKey == "" {
+		primaryKey = "id"
+	}
+
+	writeFakeJSON(w, http.StatusAccepted, index.task("documentAdditionOrUpdate", func() {
+		index.mu.Lock()
+		defer index.mu.Unlock()
+		for _, doc := range docs {
+			id := getString(doc, primaryKey)
+			if _, ok := index.docs[id]; !ok {
+				index.ids = append(index.ids, id)
+			}
+			index.docs[id] = doc
+		}
+	}))
+}
+
+// add indexes docs directly, without going through a task
+func (index *memoryIndex) add(docs ...map[string]interface{}) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for _, doc := range docs {
+		id := getString(doc, "id")
+		if _, ok := index.docs[id]; !ok {
+			index.ids = append(index.ids, id)
+		}
+		index.docs[id] = doc
+	}
+}
+
+func (index *memoryIndex) delete(ids ...string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for _, id := range ids {
+		delete(index.docs, id)
+		index.ids = slices.DeleteFunc(index.ids, func(existing string) bool { return existing == id })
+	}
+}
+
+func (index *memoryIndex) get(id string) (map[string]interface{}, bool) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	doc, ok := index.docs[id]
+	return doc, ok
+}
+
+// documents returns the indexed documents in insertion order
+func (index *memoryIndex) documents() []map[string]interface{} {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	docs := make([]map[string]interface{}, 0, len(index.ids))
+	for _, id := range index.ids {
+		docs = append(docs, index.docs[id])
+	}
+	return docs
+}
+
+func (index *memoryIndex) search(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query            string   `json:"q"`
+		Offset           int      `json:"offset"`
+		Limit            int      `json:"limit"`
+		MatchingStrategy string   `json:"matchingStrategy"`
+		Filter           string   `json:"filter"`
+		Page             int      `json:"page"`
+		HitsPerPage      int      `json:"hitsPerPage"`
+		Sort             []string `json:"sort"`
+		SearchOn         []string `json:"attributesToSearchOn"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	// Geo searches need _geo to be filterable, or sortable to sort by it
+	index.mu.Lock()
+	filterable := toStrings(index.settings["filterableAttributes"])
+	sortable := toStrings(index.settings["sortableAttributes"])
+	searchable := toStrings(index.settings["searchableAttributes"])
+	index.mu.Unlock()
+	var geoPoint []float64
+	for _, rule := range request.Sort {
+		if args, ok := strings.CutPrefix(rule, "_geoPoint("); ok {
+			geoPoint = parseNumbers(strings.TrimSuffix(args, "):asc"))
+		}
+	}
+	if strings.Contains(request.Filter, "_geoRadius(") && !slices.Contains(filterable, "_geo") {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": "Attribute `_geo` is not filterable.",
+			"code":    "invalid_search_filter",
+			"type":    "invalid_request",
+		})
+		return
+	}
+	if geoPoint != nil && !slices.Contains(sortable, "_geo") {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+			"message": "Attribute `_geo` is not sortable.",
+			"code":    "invalid_search_sort",
+			"type":    "invalid_request",
+		})
+		return
+	}
+
+	// attributesToSearchOn must name searchable attributes
+	for _, attribute := range request.SearchOn {
+		if len(searchable) > 0 && !slices.Contains(searchable, "*") && !slices.Contains(searchable, attribute) {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("Attribute `%s` is not searchable.", attribute),
+				"code":    "invalid_search_attributes_to_search_on",
+				"type":    "invalid_request",
+			})
+			return
+		}
+	}
+
+	docs := slices.DeleteFunc(index.documents(), func(doc map[string]interface{}) bool {
+		return !matchesFilter(doc, request.Filter)
+	})
+
+	index.mu.Lock()
+	stopWords := toStrings(index.settings["stopWords"])
+	// -word is Meilisearch's negative operator, leaving out the documents
+	// that contain the word
+	var words, negated []string
+	for _, word := range strings.Fields(strings.ToLower(request.Query)) {
+		if len(word) > 1 && word[0] == '-' {
+			negated = append(negated, word[1:])
+		} else if !slices.Contains(stopWords, word) {
+			words = append(words, word)
+		}
+	}
+	// Documents matching every word come first. The "last" strategy then
+	// adds the documents that match once words are dropped from the end of
+	// the query, down to the first word alone.
+	minWords := len(words)
+	if request.MatchingStrategy == "last" && minWords > 1 {
+		minWords = 1
+	}
+	// With searchable attributes set, only they are searched, and documents
+	// matching in an earlier attribute rank first
+	attributes := toStrings(index.settings["searchableAttributes"])
+	if len(attributes) == 0 || slices.Contains(attributes, "*") {
+		attributes = []string{"title", "content"}
+	}
+	if len(request.SearchOn) > 0 {
+		attributes = request.SearchOn
+	}
+	// Of the ranking rules, the attribute rule and custom field:asc and
+	// field:desc rules order the documents matching as many words, in turn
+	rules := toStrings(index.settings["rankingRules"])
+	if len(rules) == 0 {
+		rules = []string{"attribute"}
+	}
+	var matches []map[string]interface{}
+	matched := make(map[interface{}]bool)
+	for n := len(words); n >= minWords; n-- {
+		var level []map[string]interface{}
+		rank := make(map[interface{}]int)
+		for _, doc := range docs {
+			var texts []string
+			for _, attribute := range attributes {
+				texts = append(texts, strings.ToLower(getString(doc, attribute)))
+			}
+			text := strings.Join(texts, " ")
+			if slices.ContainsFunc(strings.Fields(text), func(word string) bool { return slices.Contains(negated, word) }) {
+				continue
+			}
+			if !matched[doc["id"]] && !slices.ContainsFunc(words[:n], func(word string) bool { return !index.matches(text, word) }) {
+				matched[doc["id"]] = true
+				rank[doc["id"]] = slices.IndexFunc(texts, func(text string) bool {
+					return slices.ContainsFunc(words[:n], func(word string) bool { return index.matches(text, word) })
+				})
+				level = append(level, doc)
+			}
+		}
+		slices.SortStableFunc(level, func(a, b map[string]interface{}) int {
+			for _, rule := range rules {
+				field, order, custom := strings.Cut(rule, ":")
+				n := 0
+				switch {
+				case rule == "attribute":
+					n = rank[a["id"]] - rank[b["id"]]
+				case custom:
+					n = compareValues(a[field], b[field])
+					if order == "desc" {
+						n = -n
+					}
+				}
+				if n != 0 {
+					return n
+				}
+			}
+			return 0
+		})
+		matches = append(matches, level...)
+	}
+	estimate := index.estimate
+	index.mu.Unlock()
+
+	// Sorting by _geoPoint orders hits by distance, which Meilisearch
+	// reports as _geoDistance
+	if len(geoPoint) == 2 {
+		distances := make(map[interface{}]float64, len(matches))
+		for i, doc := range matches {
+			distance, ok := geoDistance(doc, geoPoint[0], geoPoint[1])
+			if !ok {
+				// Documents without a _geo point come last
+				distances[doc["id"]] = math.Inf(1)
+				continue
+			}
+			distances[doc["id"]] = distance
+			matches[i] = maps.Clone(doc)
+			matches[i]["_geoDistance"] = math.Round(distance)
+		}
+		slices.SortStableFunc(matches, func(a, b map[string]interface{}) int {
+			return cmp.Compare(distances[a["id"]], distances[b["id"]])
+		})
+	}
+
+	// Searches paginated by page and hitsPerPage count every match exactly
+	if request.HitsPerPage > 0 {
+		request.Offset = (max(request.Page, 1) - 1) * request.HitsPerPage
+		request.Limit = request.HitsPerPage
+	}
+	hits := []map[string]interface{}{}
+	if request.Offset < len(matches) {
+		hits = matches[request.Offset:min(request.Offset+request.Limit, len(matches))]
+	}
+	response := map[string]interface{}{
+		"hits":             hits,
+		"processingTimeMs": 1,
+	}
+	if request.HitsPerPage > 0 {
+		response["page"] = max(request.Page, 1)
+		response["hitsPerPage"] = request.HitsPerPage
+		response["totalHits"] = len(matches)
+		response["totalPages"] = (len(matches) + request.HitsPerPage - 1) / request.HitsPerPage
+	} else if estimate != nil {
+		response["estimatedTotalHits"] = estimate(len(matches))
+	} else {
+		response["estimatedTotalHits"] = len(matches)
+	}
+	writeFakeJSON(w, http.StatusOK, response)
+}
+
+// compareValues orders two document values for a custom ranking rule,
+// numbers numerically and anything else as text
+func compareValues(a, b interface{}) int {
+	number := func(v interface{}) (float64, bool) {
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case int:
+			return float64(n), true
+		}
+		return 0, false
+	}
+	x, xNumber := number(a)
+	y, yNumber := number(b)
+	if xNumber && yNumber {
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// searchHits wraps hits into a Meilisearch search response
+func searchHits(hits ...map[string]interface{}) map[string]interface{} {
+	if hits == nil {
+		hits = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"hits":               hits,
+		"estimatedTotalHits": len(hits),
+		"processingTimeMs":   1,
+	}
+}
+
+// testConfig returns the default configuration pointed at a Meilisearch at
+// url, without retries so failures surface immediately
+func testConfig(url string) *Config {
+	config := defaultConfig()
+	config.MeilisearchURL = url
+	config.MeilisearchURLs = []string{url}
+	config.MeiliMaxRetries = 0
+	config.MeiliRetryBaseDelay = time.Millisecond
+	config.MeiliTimeout = 5 * time.Second
+	return config
+}
+
+// serve sends a request through handler and returns the recorded response.
+// headers are name/value pairs.
+func serve(handler http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON decodes a recorded JSON response into out
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatalf("response %q is not valid JSON: %v", w.Body.String(), err)
+	}
+}
+
+func TestRunServerDrainsInFlightRequests(t *testing.T) {
+	tests := []struct {
+		name            string
+		shutdownTimeout time.Duration
+		handlerDelay    time.Duration
+		wantErr         error
+		wantStatus      int
+	}{
+		{"request finishes in time", time.Second, 50 * time.Millisecond, nil, http.StatusOK},
+		{"request outlives the timeout", 20 * time.Millisecond, 500 * time.Millisecond, context.DeadlineExceeded, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(tt.handlerDelay)
+				w.WriteHeader(http.StatusOK)
+			})}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := testConfig("http://127.0.0.1:7700")
+			config.ShutdownTimeout = tt.shutdownTimeout
+
+			quit := make(chan os.Signal, 1)
+			done := make(chan error, 1)
+			go func() { done <- runServer(server, listener, config, quit) }()
+
+			statuses := make(chan int, 1)
+			go func() {
+				res, err := http.Get("http://" + listener.Addr().String())
+				if err != nil {
+					statuses <- 0
+					return
+				}
+				res.Body.Close()
+				statuses <- res.StatusCode
+			}()
+
+			<-started
+			quit <- syscall.SIGTERM
+
+			if err := <-done; !errors.Is(err, tt.wantErr) {
+				t.Errorf("runServer() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantStatus != 0 {
+				if status := <-statuses; status != tt.wantStatus {
+					t.Errorf("in-flight request status = %d, want %d", status, tt.wantStatus)
+				}
+			}
+			if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+				t.Error("server still accepts requests after shutdown")
+			}
+		})
+	}
+}
+
+// unreachableURL returns the URL of a server that has already shut down
+func unreachableURL(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func TestReadyReflectsMeilisearchConnectivity(t *testing.T) {
+	tests := []struct {
+		name       string
+		healthy    bool
+		wantStatus int
+		wantState  string
+	}{
+		{"healthy Meilisearch", true, http.StatusOK, "ready"},
+		{"unreachable Meilisearch", false, http.StatusServiceUnavailable, "unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodGet, "/health", http.StatusOK, map[string]string{"status": "available"})
+			url := meili.URL
+			if !tt.healthy {
+				url = unreachableURL(t)
+			}
+			config := testConfig(url)
+			searcher := newMeiliSearcher(config.MeilisearchURLs, "", http.DefaultClient)
+
+			check := func() error { return searcher.Health(context.Background()) }
+			monitor := newConnectionMonitor(check, time.Hour, !tt.healthy)
+			monitor.update(check())
+
+			router := gin.New()
+			router.GET("/ready", readyHandler(monitor, searcher, config))
+			w := serve(router, http.MethodGet, "/ready", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var response struct {
+				Status string          `json:"status"`
+				Hosts  map[string]bool `json:"hosts"`
+				Error  string          `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if response.Status != tt.wantState {
+				t.Errorf("status = %q, want %q", response.Status, tt.wantState)
+			}
+			if response.Hosts[url] != tt.healthy {
+				t.Errorf("hosts = %v, want %s healthy: %v", response.Hosts, url, tt.healthy)
+			}
+			if (response.Error != "") == tt.healthy {
+				t.Errorf("error = %q", response.Error)
+			}
+		})
+	}
+}
+
+func TestHealthIsLiveness(t *testing.T) {
+	for _, healthy := range []bool{true, false} {
+		url := "http://127.0.0.1:7700"
+		if !healthy {
+			url = unreachableURL(t)
+		}
+		router := gin.New()
+		router.GET("/health", healthHandler(testConfig(url)))
+
+		w := serve(router, http.MethodGet, "/health", "")
+		if w.Code != http.StatusOK {
+			t.Errorf("Meilisearch healthy=%v: status = %d, want 200", healthy, w.Code)
+		}
+		var response map[string]interface{}
+		decodeJSON(t, w, &response)
+		if response["status"] != "healthy" || response["version"] == nil {
+			t.Errorf("Meilisearch healthy=%v: body = %v", healthy, response)
+		}
+	}
+}
+
+func TestReadyUntilMeilisearchAnswers(t *testing.T) {
+	var up atomic.Bool
+	monitor := newConnectionMonitor(func() error {
+		if !up.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, 5*time.Millisecond, false)
+	go monitor.run()
+	defer monitor.Stop()
+
+	config := testConfig("http://127.0.0.1:7700")
+	router := gin.New()
+	router.GET("/ready", readyHandler(monitor, newMeiliSearcher(config.MeilisearchURLs, "", http.DefaultClient), config))
+
+	if w := serve(router, http.MethodGet, "/ready", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before Meilisearch is up = %d, want 503", w.Code)
+	}
+
+	up.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for serve(router, http.MethodGet, "/ready", "").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("/ready did not turn ready once Meilisearch answered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newAPIRouter mounts every API endpoint the way main does, under /v1 and as
+// deprecated unversioned aliases, in front of meili and without a cache
+func newAPIRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	return mountAPI(newTestAPI(meili, config))
+}
+
+// newTestAPI wires the API to meili without a cache, rate limiter or
+// analytics, which tests add as needed
+func newTestAPI(meili *fakeMeili, config *Config) *API {
+	client := newMeiliClient(config)
+	return &API{
+		client:   client,
+		searcher: meili.searcher(),
+		config:   config,
+		metrics:  newMetrics(nil),
+		crawler:  newCrawler(client, nil, config),
+	}
+}
+
+// mountAPI mounts api on a router as main does
+func mountAPI(api *API) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(api.config))
+	api.mount(router)
+	return router
+}
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to a
+// temporary directory and returns their paths and a pool trusting it
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "search-engine-backend test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestRunServerTLS(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t)
+
+	router := gin.New()
+	router.GET("/health", healthHandler(testConfig("http://127.0.0.1:7700")))
+	server := &http.Server{Handler: router}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testConfig("http://127.0.0.1:7700")
+	config.TLSCertFile, config.TLSKeyFile = certFile, keyFile
+
+	quit := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- runServer(server, listener, config, quit) }()
+
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	res, err := client.Get("https://" + listener.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.TLS == nil {
+		t.Errorf("HTTPS status = %d, TLS = %v, want 200 over TLS", res.StatusCode, res.TLS != nil)
+	}
+
+	// Plain HTTP is refused rather than served
+	if res, err := http.Get("http://" + listener.Addr().String() + "/health"); err == nil {
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request was served")
+		}
+	}
+
+	quit <- syscall.SIGTERM
+	if err := <-done; err != nil {
+		t.Errorf("runServer() = %v, want nil", err)
+	}
+}
+
+func TestRunServerTLSWithMissingCertificate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testConfig("http://127.0.0.1:7700")
+	config.TLSCertFile = filepath.Join(t.TempDir(), "missing.pem")
+	config.TLSKeyFile = filepath.Join(t.TempDir(), "missing-key.pem")
+
+	done := make(chan error, 1)
+	go func() { done <- runServer(&http.Server{}, listener, config, make(chan os.Signal)) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("runServer() = nil, want the certificate error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer did not fail on a missing certificate")
+	}
+}
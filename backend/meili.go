@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// MeiliSearcher sends requests straight to the Meilisearch REST API. The
+// pinned meilisearch-go release does not know about newer search parameters
+// such as showRankingScore and cannot send some settings (e.g. disabling typo
+// tolerance), so those requests are built here while the rest of the backend
+// keeps using the official client.
+type MeiliSearcher struct {
+	hosts      []*meiliHost
+	apiKey     string
+	httpClient *http.Client
+
+	// breaker guards search calls, but not the typo-tolerance settings;
+	// nil disables it
+	breaker *CircuitBreaker
+}
+
+// MeiliSearchResponse is the part of a Meilisearch search response the
+// backend consumes
+type MeiliSearchResponse struct {
+	Hits               []map[string]interface{} `json:"hits"`
+	EstimatedTotalHits int64                    `json:"estimatedTotalHits"`
+	ProcessingTimeMs   int64                    `json:"processingTimeMs"`
+	Query              string                   `json:"query"`
+
+	// TotalHits and TotalPages are exact counts, only returned for searches
+	// paginated with page and hitsPerPage
+	TotalHits  int64 `json:"totalHits"`
+	TotalPages int64 `json:"totalPages"`
+
+	FacetDistribution map[string]map[string]int64 `json:"facetDistribution"`
+}
+
+// MeiliError is returned when Meilisearch answers with a non-2xx status
+type MeiliError struct {
+	StatusCode int
+	Message    string `json:"message"`
+	Code       string `json:"code"`
+	Type       string `json:"type"`
+}
+
+func (e *MeiliError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("meilisearch returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("meilisearch returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+func newMeiliSearcher(hosts []string, apiKey string, httpClient *http.Client) *MeiliSearcher {
+	s := &MeiliSearcher{
+		apiKey:     apiKey,
+		httpClient: httpClient,
+	}
+	for _, host := range hosts {
+		s.hosts = append(s.hosts, &meiliHost{url: strings.TrimRight(host, "/")})
+	}
+	return s
+}
+
+// hostRetryAfter is how long a host that could not be reached is skipped
+// before requests try it again
+const hostRetryAfter = 30 * time.Second
+
+// meiliHost is one Meilisearch node of a failover group
+type meiliHost struct {
+	url string
+
+	// client is the official client for the host, only set for the hosts
+	// of a MeiliClient
+	client *meilisearch.Client
+
+	// downSince is when the host last failed to connect, in Unix
+	// nanoseconds; 0 while it is healthy
+	downSince atomic.Int64
+}
+
+// healthy reports whether requests should go to the host: it is up, or it
+// has been down long enough to be worth another try
+func (h *meiliHost) healthy(now time.Time) bool {
+	since := h.downSince.Load()
+	return since == 0 || now.Sub(time.Unix(0, since)) >= hostRetryAfter
+}
+
+// markDown records a connection failure, logging when the host goes down
+func (h *meiliHost) markDown(err error) {
+	if h.downSince.Swap(time.Now().UnixNano()) == 0 {
+		slog.Warn("Meilisearch host unreachable, failing over", "host", h.url, "error", err)
+	}
+}
+
+// markUp records a successful connection, logging when the host recovers
+func (h *meiliHost) markUp() {
+	if h.downSince.Swap(0) != 0 {
+		slog.Info("Meilisearch host reachable again", "host", h.url)
+	}
+}
+
+// Health checks that at least one host answers /health
+func (s *MeiliSearcher) Health(ctx context.Context) error {
+	var status struct {
+		Status string `json:"status"`
+	}
+	return s.do(ctx, http.MethodGet, "/health", nil, &status)
+}
+
+// HostHealth reports for every host whether it was reachable last time
+func (s *MeiliSearcher) HostHealth() map[string]bool {
+	health := make(map[string]bool, len(s.hosts))
+	for _, host := range s.hosts {
+		health[host.url] = host.downSince.Load() == 0
+	}
+	return health
+}
+
+// candidateHosts orders hosts to try for a request: healthy hosts in
+// configured order, then the ones that recently failed as a last resort
+func candidateHosts(hosts []*meiliHost) []*meiliHost {
+	now := time.Now()
+	candidates := make([]*meiliHost, 0, len(hosts))
+	for _, host := range hosts {
+		if host.healthy(now) {
+			candidates = append(candidates, host)
+		}
+	}
+	for _, host := range hosts {
+		if !host.healthy(now) {
+			candidates = append(candidates, host)
+		}
+	}
+	return candidates
+}
+
+// newMeiliHTTPClient creates the HTTP client of the MeiliSearcher, keeping up
+// to MEILI_MAX_IDLE_CONNS idle connections to Meilisearch open for reuse and
+// limiting each request to MEILI_TIMEOUT
+func newMeiliHTTPClient(config *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = config.MeiliMaxIdleConns
+	transport.MaxIdleConnsPerHost = config.MeiliMaxIdleConns
+	transport.IdleConnTimeout = config.MeiliIdleConnTimeout
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.MeiliTimeout,
+	}
+}
+
+// Search posts params as the body of /indexes/{indexName}/search
+func (s *MeiliSearcher) Search(ctx context.Context, indexName string, params map[string]interface{}) (*MeiliSearchResponse, error) {
+	record, err := s.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp MeiliSearchResponse
+	err = s.do(ctx, http.MethodPost, "/indexes/"+indexName+"/search", params, &resp)
+	record(err)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Similar returns the documents closest to the document params["id"]
+// according to an embedder, via /indexes/{indexName}/similar
+func (s *MeiliSearcher) Similar(ctx context.Context, indexName string, params map[string]interface{}) (*MeiliSearchResponse, error) {
+	record, err := s.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp MeiliSearchResponse
+	err = s.do(ctx, http.MethodPost, "/indexes/"+indexName+"/similar", params, &resp)
+	record(err)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// MultiSearch runs several searches in one /multi-search request. Each query
+// must carry its own indexUid. Meilisearch fails the whole request when any
+// single query is invalid.
+func (s *MeiliSearcher) MultiSearch(ctx context.Context, queries []map[string]interface{}) ([]MeiliSearchResponse, error) {
+	record, err := s.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Results []MeiliSearchResponse `json:"results"`
+	}
+	body := map[string]interface{}{"queries": queries}
+	err = s.do(ctx, http.MethodPost, "/multi-search", body, &resp)
+	record(err)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// TypoToleranceSettings mirrors meilisearch.TypoTolerance with pointer fields
+// so that false, zero and empty values are sent instead of dropped
+type TypoToleranceSettings struct {
+	Enabled             *bool                `json:"enabled,omitempty"`
+	MinWordSizeForTypos *MinWordSizeForTypos `json:"minWordSizeForTypos,omitempty"`
+	DisableOnWords      *[]string            `json:"disableOnWords,omitempty"`
+	DisableOnAttributes *[]string            `json:"disableOnAttributes,omitempty"`
+}
+
+// MinWordSizeForTypos sets the word length from which one or two typos are
+// accepted
+type MinWordSizeForTypos struct {
+	OneTypo  *int64 `json:"oneTypo,omitempty"`
+	TwoTypos *int64 `json:"twoTypos,omitempty"`
+}
+
+// GetTypoTolerance returns the typo-tolerance settings of an index
+func (s *MeiliSearcher) GetTypoTolerance(ctx context.Context, indexName string) (*TypoToleranceSettings, error) {
+	var settings TypoToleranceSettings
+	if err := s.do(ctx, http.MethodGet, "/indexes/"+indexName+"/settings/typo-tolerance", nil, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdateTypoTolerance partially updates the typo-tolerance settings of an index
+func (s *MeiliSearcher) UpdateTypoTolerance(ctx context.Context, indexName string, settings *TypoToleranceSettings) (*meilisearch.TaskInfo, error) {
+	var task meilisearch.TaskInfo
+	if err := s.do(ctx, http.MethodPatch, "/indexes/"+indexName+"/settings/typo-tolerance", settings, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// do sends a request with body encoded as JSON (none when body is nil) and
+// decodes the response into out. When a host cannot be reached the request
+// fails over to the next one.
+func (s *MeiliSearcher) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	var err error
+	for _, host := range candidateHosts(s.hosts) {
+		err = s.doHost(ctx, host.url, method, path, payload, out)
+		var connErr *hostError
+		if errors.As(err, &connErr) {
+			host.markDown(connErr.err)
+			continue
+		}
+		if ctx.Err() == nil {
+			host.markUp()
+		}
+		return err
+	}
+	return err
+}
+
+// hostError wraps an error that kept a request from reaching a host
+type hostError struct {
+	err error
+}
+
+func (e *hostError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hostError) Unwrap() error {
+	return e.err
+}
+
+// doHost sends one request to host, returning a *hostError when the host
+// could not be reached
+func (s *MeiliSearcher) doHost(ctx context.Context, host, method, path string, payload []byte, out interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, host+path, reader)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	injectTraceparent(ctx, req.Header)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		// Cancellation is the caller's doing, not the host's
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &hostError{err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		meiliErr := &MeiliError{StatusCode: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(meiliErr); err != nil {
+			meiliErr.Message = http.StatusText(res.StatusCode)
+		}
+		return meiliErr
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// meiliErrorStatus maps an error from the Meilisearch client to the HTTP status
+// the backend should answer with, passing 4xx responses through unchanged
+func meiliErrorStatus(err error) int {
+	if errors.Is(err, errCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	var clientErr *meilisearch.Error
+	if errors.As(err, &clientErr) && clientErr.StatusCode >= 400 && clientErr.StatusCode < 500 {
+		return clientErr.StatusCode
+	}
+	var meiliErr *MeiliError
+	if errors.As(err, &meiliErr) && meiliErr.StatusCode >= 400 && meiliErr.StatusCode < 500 {
+		return meiliErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
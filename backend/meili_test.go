@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewMeiliHTTPClient(t *testing.T) {
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		maxIdleConns    int
+		idleConnTimeout time.Duration
+	}{
+		{"defaults", 30 * time.Second, 100, 90 * time.Second},
+		{"tuned", 2 * time.Second, 8, 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MeiliTimeout = tt.timeout
+			config.MeiliMaxIdleConns = tt.maxIdleConns
+			config.MeiliIdleConnTimeout = tt.idleConnTimeout
+
+			client := newMeiliHTTPClient(config)
+			if client.Timeout != tt.timeout {
+				t.Errorf("Timeout = %s, want %s", client.Timeout, tt.timeout)
+			}
+			transport, ok := client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("Transport = %T, want *http.Transport", client.Transport)
+			}
+			if transport == http.DefaultTransport {
+				t.Error("client shares http.DefaultTransport")
+			}
+			if transport.MaxIdleConns != tt.maxIdleConns || transport.MaxIdleConnsPerHost != tt.maxIdleConns {
+				t.Errorf("MaxIdleConns, MaxIdleConnsPerHost = %d, %d, want %d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, tt.maxIdleConns)
+			}
+			if transport.IdleConnTimeout != tt.idleConnTimeout {
+				t.Errorf("IdleConnTimeout = %s, want %s", transport.IdleConnTimeout, tt.idleConnTimeout)
+			}
+		})
+	}
+}
+
+// slowMeili returns a fake Meilisearch whose every answer to method and
+// path is delayed by delay
+func slowMeili(t *testing.T, method, path string, delay time.Duration) *fakeMeili {
+	meili := newFakeMeili(t)
+	release := make(chan struct{})
+	// Registered after the server's cleanup so it runs first and lets
+	// blocked handlers return before the server closes
+	t.Cleanup(func() { close(release) })
+	meili.handleFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-release:
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits())
+	})
+	return meili
+}
+
+// MEILI_TIMEOUT bounds searches sent through the MeiliSearcher
+func TestMeiliHTTPClientTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"answer within the timeout", 0, 2 * time.Second, false},
+		{"slow answer", 2 * time.Second, 50 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := slowMeili(t, http.MethodPost, searchPath, tt.delay)
+			config := testConfig(meili.URL)
+			config.MeiliTimeout = tt.timeout
+			searcher := newMeiliSearcher(config.MeilisearchURLs, config.MeilisearchKey, newMeiliHTTPClient(config))
+
+			start := time.Now()
+			_, err := searcher.Search(context.Background(), "documents", map[string]interface{}{"q": "gopher"})
+			elapsed := time.Since(start)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Search() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && elapsed >= tt.delay {
+				t.Errorf("Search() gave up after %s, want about %s", elapsed, tt.timeout)
+			}
+		})
+	}
+}
+
+// MEILI_TIMEOUT also bounds requests sent through the official client
+func TestMeiliClientTimeout(t *testing.T) {
+	const statsPath = "/indexes/documents/stats"
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"answer within the timeout", 0, 2 * time.Second, false},
+		{"slow answer", 2 * time.Second, 50 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := slowMeili(t, http.MethodGet, statsPath, tt.delay)
+			config := testConfig(meili.URL)
+			config.MeiliTimeout = tt.timeout
+			client := newMeiliClient(config)
+
+			start := time.Now()
+			_, err := client.Index("documents").GetStats()
+			elapsed := time.Since(start)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetStats() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && elapsed >= tt.delay {
+				t.Errorf("GetStats() gave up after %s, want about %s", elapsed, tt.timeout)
+			}
+		})
+	}
+}
+
+// Searches reuse idle connections instead of dialing Meilisearch each time
+func TestMeiliHTTPClientReusesConnections(t *testing.T) {
+	tests := []struct {
+		name       string
+		concurrent bool
+		searches   int
+		maxConns   int
+	}{
+		{"sequential", false, 10, 1},
+		{"concurrent", true, 10, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			var mu sync.Mutex
+			conns := make(map[string]bool)
+			meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				conns[r.RemoteAddr] = true
+				mu.Unlock()
+				writeFakeJSON(w, http.StatusOK, searchHits())
+			})
+			config := testConfig(meili.URL)
+			searcher := newMeiliSearcher(config.MeilisearchURLs, config.MeilisearchKey, newMeiliHTTPClient(config))
+
+			search := func() {
+				if _, err := searcher.Search(context.Background(), "documents", map[string]interface{}{"q": "gopher"}); err != nil {
+					t.Errorf("Search() error = %v", err)
+				}
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < tt.searches; i++ {
+				if !tt.concurrent {
+					search()
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					search()
+				}()
+			}
+			wg.Wait()
+			// A second round only uses the connections already open
+			mu.Lock()
+			before := len(conns)
+			mu.Unlock()
+			for i := 0; i < tt.searches; i++ {
+				search()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(conns) > tt.maxConns {
+				t.Errorf("searches opened %d connections, want at most %d", len(conns), tt.maxConns)
+			}
+			if len(conns) != before {
+				t.Errorf("sequential searches opened %d new connections, want none", len(conns)-before)
+			}
+		})
+	}
+}
+
+// failoverHost is a host of a failover test: a fake Meilisearch answering
+// searches with status, or an address nothing listens on
+type failoverHost struct {
+	down   bool
+	status int
+}
+
+func TestMeiliSearcherFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		hosts        []failoverHost
+		wantErr      bool
+		wantSearches []int
+		wantHealth   []bool
+	}{
+		{"first host up", []failoverHost{{status: http.StatusOK}, {status: http.StatusOK}}, false, []int{1, 0}, []bool{true, true}},
+		{"first host down", []failoverHost{{down: true}, {status: http.StatusOK}}, false, []int{0, 1}, []bool{false, true}},
+		{"first two hosts down", []failoverHost{{down: true}, {down: true}, {status: http.StatusOK}}, false, []int{0, 0, 1}, []bool{false, false, true}},
+		{"all hosts down", []failoverHost{{down: true}, {down: true}}, true, []int{0, 0}, []bool{false, false}},
+		// An error answer comes from a reachable host, so it is not retried
+		{"first host errors", []failoverHost{{status: http.StatusInternalServerError}, {status: http.StatusOK}}, true, []int{1, 0}, []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var urls []string
+			var fakes []*fakeMeili
+			for _, host := range tt.hosts {
+				if host.down {
+					urls = append(urls, unreachableURL(t))
+					fakes = append(fakes, nil)
+					continue
+				}
+				meili := newFakeMeili(t)
+				if host.status == http.StatusOK {
+					meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(map[string]interface{}{"id": "1"}))
+				} else {
+					meili.handle(http.MethodPost, searchPath, host.status, map[string]string{"message": "boom", "code": "internal", "type": "internal"})
+				}
+				urls = append(urls, meili.URL)
+				fakes = append(fakes, meili)
+			}
+			searcher := newMeiliSearcher(urls, "test-key", http.DefaultClient)
+
+			resp, err := searcher.Search(context.Background(), "documents", map[string]interface{}{"q": "gopher"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Search() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(resp.Hits) != 1 {
+				t.Errorf("Search() returned %d hits, want 1", len(resp.Hits))
+			}
+			for i, meili := range fakes {
+				if meili == nil {
+					continue
+				}
+				if n := len(meili.received(http.MethodPost, searchPath)); n != tt.wantSearches[i] {
+					t.Errorf("host %d received %d searches, want %d", i, n, tt.wantSearches[i])
+				}
+			}
+			health := searcher.HostHealth()
+			for i, url := range urls {
+				if health[url] != tt.wantHealth[i] {
+					t.Errorf("host %d healthy = %v, want %v", i, health[url], tt.wantHealth[i])
+				}
+			}
+		})
+	}
+}
+
+// A host that failed is skipped until hostRetryAfter has passed, then tried
+// first again once it answers
+func TestMeiliSearcherRetriesDownHosts(t *testing.T) {
+	tests := []struct {
+		name          string
+		downFor       time.Duration
+		wantPrimary   int
+		wantSecondary int
+		wantHealthy   bool
+	}{
+		{"recently down", time.Second, 0, 1, false},
+		{"down long enough to retry", hostRetryAfter, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, secondary := newFakeMeili(t), newFakeMeili(t)
+			for _, meili := range []*fakeMeili{primary, secondary} {
+				meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			}
+			searcher := newMeiliSearcher([]string{primary.URL, secondary.URL}, "test-key", http.DefaultClient)
+			searcher.hosts[0].downSince.Store(time.Now().Add(-tt.downFor).UnixNano())
+
+			if _, err := searcher.Search(context.Background(), "documents", map[string]interface{}{"q": "gopher"}); err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if n := len(primary.received(http.MethodPost, searchPath)); n != tt.wantPrimary {
+				t.Errorf("primary received %d searches, want %d", n, tt.wantPrimary)
+			}
+			if n := len(secondary.received(http.MethodPost, searchPath)); n != tt.wantSecondary {
+				t.Errorf("secondary received %d searches, want %d", n, tt.wantSecondary)
+			}
+			if got := searcher.HostHealth()[primary.URL]; got != tt.wantHealthy {
+				t.Errorf("primary healthy = %v, want %v", got, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+// Requests through the official client fail over between hosts like searches
+func TestMeiliClientFailover(t *testing.T) {
+	const statsPath = "/indexes/documents/stats"
+	tests := []struct {
+		name      string
+		hosts     []failoverHost
+		wantErr   bool
+		wantStats []int
+	}{
+		{"first host up", []failoverHost{{status: http.StatusOK}, {status: http.StatusOK}}, false, []int{1, 0}},
+		{"first host down", []failoverHost{{down: true}, {status: http.StatusOK}}, false, []int{0, 1}},
+		{"all hosts down", []failoverHost{{down: true}, {down: true}}, true, []int{0, 0}},
+		// An error answer comes from a reachable host, so it is not retried
+		{"first host errors", []failoverHost{{status: http.StatusNotFound}, {status: http.StatusOK}}, true, []int{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("")
+			config.MeilisearchURLs = nil
+			var fakes []*fakeMeili
+			for _, host := range tt.hosts {
+				if host.down {
+					config.MeilisearchURLs = append(config.MeilisearchURLs, unreachableURL(t))
+					fakes = append(fakes, nil)
+					continue
+				}
+				meili := newFakeMeili(t)
+				if host.status == http.StatusOK {
+					meili.handle(http.MethodGet, statsPath, http.StatusOK, map[string]interface{}{"numberOfDocuments": 3})
+				} else {
+					meili.handle(http.MethodGet, statsPath, host.status, map[string]string{"message": "missing", "code": "index_not_found", "type": "invalid_request"})
+				}
+				config.MeilisearchURLs = append(config.MeilisearchURLs, meili.URL)
+				fakes = append(fakes, meili)
+			}
+			config.MeilisearchURL = config.MeilisearchURLs[0]
+			client := newMeiliClient(config)
+
+			stats, err := client.Index("documents").GetStats()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetStats() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && stats.NumberOfDocuments != 3 {
+				t.Errorf("GetStats() returned %d documents, want 3", stats.NumberOfDocuments)
+			}
+			for i, meili := range fakes {
+				if meili == nil {
+					continue
+				}
+				if n := len(meili.received(http.MethodGet, statsPath)); n != tt.wantStats[i] {
+					t.Errorf("host %d received %d stats requests, want %d", i, n, tt.wantStats[i])
+				}
+			}
+		})
+	}
+}
+
+// Searches through the API keep working while the first host is down
+func TestSearchFailsOverToSecondHost(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+	config := testConfig(meili.URL)
+	config.MeilisearchURLs = []string{unreachableURL(t), meili.URL}
+	searcher := newMeiliSearcher(config.MeilisearchURLs, config.MeilisearchKey, newMeiliHTTPClient(config))
+	router := newSearchRouter(searcher, nil, config)
+
+	for i := 0; i < 2; i++ {
+		w := serve(router, http.MethodGet, "/search?q=gopher", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %d: status = %d, body %s", i, w.Code, w.Body)
+		}
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		if ids := resultIDs(response.Results); len(ids) != 1 || ids[0] != "1" {
+			t.Errorf("search %d: results = %v, want [1]", i, ids)
+		}
+	}
+}
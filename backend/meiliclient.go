@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/meilisearch/meilisearch-go"
+	"github.com/valyala/fasthttp"
+)
+
+// MeiliClient sends document, settings, index and task requests through the
+// official client, failing over between the MEILISEARCH_URLS hosts the way
+// MeiliSearcher does for searches: a request that cannot reach a host is
+// retried on the next one, and the host is skipped for hostRetryAfter.
+//
+// Its methods mirror the ones of meilisearch.Client the backend uses.
+type MeiliClient struct {
+	hosts []*meiliHost
+}
+
+// MeiliIndex mirrors meilisearch.Index for a MeiliClient
+type MeiliIndex struct {
+	client *MeiliClient
+	uid    string
+}
+
+// newMeiliClient creates an official Meilisearch client per host. Each keeps
+// a pool of connections and is safe for concurrent use, so one MeiliClient is
+// shared by every handler. Each request is limited to MEILI_TIMEOUT.
+func newMeiliClient(config *Config) *MeiliClient {
+	m := &MeiliClient{}
+	for _, host := range config.MeilisearchURLs {
+		host = strings.TrimRight(host, "/")
+		m.hosts = append(m.hosts, &meiliHost{
+			url: host,
+			client: meilisearch.NewFastHTTPCustomClient(meilisearch.ClientConfig{
+				Host:    host,
+				APIKey:  config.MeilisearchKey,
+				Timeout: config.MeiliTimeout,
+			}, &fasthttp.Client{
+				Name:                "meilisearch-client",
+				ConnPoolStrategy:    fasthttp.LIFO,
+				MaxIdleConnDuration: config.MeiliIdleConnTimeout,
+			}),
+		})
+	}
+	return m
+}
+
+// failover calls fn with the client of each candidate host in turn until one
+// can be reached. Answers from Meilisearch, errors included, end the
+// failover; so does a timeout, as the host may have acted on the request.
+func failover[T any](m *MeiliClient, fn func(client *meilisearch.Client) (T, error)) (T, error) {
+	var result T
+	var err error
+	for _, host := range candidateHosts(m.hosts) {
+		result, err = fn(host.client)
+		var clientErr *meilisearch.Error
+		if errors.As(err, &clientErr) && clientErr.ErrCode == meilisearch.MeilisearchCommunicationError {
+			host.markDown(err)
+			continue
+		}
+		host.markUp()
+		return result, err
+	}
+	return result, err
+}
+
+func (m *MeiliClient) Index(uid string) *MeiliIndex {
+	return &MeiliIndex{client: m, uid: uid}
+}
+
+func (m *MeiliClient) Health() (*meilisearch.Health, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.Health, error) { return c.Health() })
+}
+
+func (m *MeiliClient) GetStats() (*meilisearch.Stats, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.Stats, error) { return c.GetStats() })
+}
+
+func (m *MeiliClient) GetTask(taskUID int64) (*meilisearch.Task, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.Task, error) { return c.GetTask(taskUID) })
+}
+
+func (m *MeiliClient) WaitForTask(taskUID int64, options ...meilisearch.WaitParams) (*meilisearch.Task, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.Task, error) { return c.WaitForTask(taskUID, options...) })
+}
+
+func (m *MeiliClient) GetIndex(uid string) (*meilisearch.Index, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.Index, error) { return c.GetIndex(uid) })
+}
+
+func (m *MeiliClient) GetIndexes(param *meilisearch.IndexesQuery) (*meilisearch.IndexesResults, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.IndexesResults, error) { return c.GetIndexes(param) })
+}
+
+func (m *MeiliClient) CreateIndex(config *meilisearch.IndexConfig) (*meilisearch.TaskInfo, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) { return c.CreateIndex(config) })
+}
+
+func (m *MeiliClient) DeleteIndex(uid string) (*meilisearch.TaskInfo, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) { return c.DeleteIndex(uid) })
+}
+
+func (m *MeiliClient) SwapIndexes(param []meilisearch.SwapIndexesParams) (*meilisearch.TaskInfo, error) {
+	return failover(m, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) { return c.SwapIndexes(param) })
+}
+
+func (i *MeiliIndex) GetStats() (*meilisearch.StatsIndex, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.StatsIndex, error) { return c.Index(i.uid).GetStats() })
+}
+
+func (i *MeiliIndex) GetDocument(identifier string, request *meilisearch.DocumentQuery, documentPtr interface{}) error {
+	_, err := failover(i.client, func(c *meilisearch.Client) (struct{}, error) {
+		return struct{}{}, c.Index(i.uid).GetDocument(identifier, request, documentPtr)
+	})
+	return err
+}
+
+func (i *MeiliIndex) AddDocuments(documentsPtr interface{}, primaryKey ...string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).AddDocuments(documentsPtr, primaryKey...)
+	})
+}
+
+func (i *MeiliIndex) DeleteDocument(identifier string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).DeleteDocument(identifier)
+	})
+}
+
+func (i *MeiliIndex) DeleteDocuments(identifiers []string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).DeleteDocuments(identifiers)
+	})
+}
+
+func (i *MeiliIndex) DeleteAllDocuments() (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) { return c.Index(i.uid).DeleteAllDocuments() })
+}
+
+func (i *MeiliIndex) GetSettings() (*meilisearch.Settings, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.Settings, error) { return c.Index(i.uid).GetSettings() })
+}
+
+func (i *MeiliIndex) UpdateSettings(request *meilisearch.Settings) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).UpdateSettings(request)
+	})
+}
+
+func (i *MeiliIndex) ResetSettings() (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) { return c.Index(i.uid).ResetSettings() })
+}
+
+func (i *MeiliIndex) GetSynonyms() (*map[string][]string, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*map[string][]string, error) { return c.Index(i.uid).GetSynonyms() })
+}
+
+func (i *MeiliIndex) UpdateSynonyms(request *map[string][]string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).UpdateSynonyms(request)
+	})
+}
+
+func (i *MeiliIndex) GetStopWords() (*[]string, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*[]string, error) { return c.Index(i.uid).GetStopWords() })
+}
+
+func (i *MeiliIndex) UpdateStopWords(request *[]string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).UpdateStopWords(request)
+	})
+}
+
+func (i *MeiliIndex) GetSearchableAttributes() (*[]string, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*[]string, error) { return c.Index(i.uid).GetSearchableAttributes() })
+}
+
+func (i *MeiliIndex) UpdateSearchableAttributes(request *[]string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).UpdateSearchableAttributes(request)
+	})
+}
+
+func (i *MeiliIndex) GetRankingRules() (*[]string, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*[]string, error) { return c.Index(i.uid).GetRankingRules() })
+}
+
+func (i *MeiliIndex) UpdateRankingRules(request *[]string) (*meilisearch.TaskInfo, error) {
+	return failover(i.client, func(c *meilisearch.Client) (*meilisearch.TaskInfo, error) {
+		return c.Index(i.uid).UpdateRankingRules(request)
+	})
+}
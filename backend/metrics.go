@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics collects search counters and latency histograms, labeled by
+// endpoint and status code, in its own Prometheus registry
+type Metrics struct {
+	registry     *prometheus.Registry
+	searches     *prometheus.CounterVec
+	searchErrors *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+}
+
+// newMetrics registers the search metrics. When breaker is not nil its state
+// is exported as a gauge as well.
+func newMetrics(breaker *CircuitBreaker) *Metrics {
+	labels := []string{"endpoint", "status"}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		searches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "search_requests_total",
+			Help: "Total number of search requests.",
+		}, labels),
+		searchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "search_errors_total",
+			Help: "Total number of search requests that failed with a server error.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "search_request_duration_seconds",
+			Help:    "Search request latency by endpoint and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+	}
+	m.registry.MustRegister(m.searches, m.searchErrors, m.latency)
+
+	if breaker != nil {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "meilisearch_circuit_breaker_state",
+			Help: "State of the Meilisearch circuit breaker (0 closed, 1 half-open, 2 open).",
+		}, func() float64 {
+			return float64(breaker.State())
+		}))
+	}
+	return m
+}
+
+// instrument records the outcome and latency of every request to endpoint
+func (m *Metrics) instrument(endpoint string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		m.observe(endpoint, c.Writer.Status(), time.Since(start))
+	}
+}
+
+func (m *Metrics) observe(endpoint string, code int, elapsed time.Duration) {
+	status := strconv.Itoa(code)
+	m.searches.WithLabelValues(endpoint, status).Inc()
+	if code >= http.StatusInternalServerError {
+		m.searchErrors.WithLabelValues(endpoint, status).Inc()
+	}
+	m.latency.WithLabelValues(endpoint, status).Observe(elapsed.Seconds())
+}
+
+// handler serves the collected metrics for Prometheus to scrape
+func (m *Metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsCountSearches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metrics := newMetrics(nil)
+
+	router := gin.New()
+	router.GET("/search", metrics.instrument("/search"), func(c *gin.Context) {
+		code, _ := strconv.Atoi(c.Query("status"))
+		c.Status(code)
+	})
+	router.GET("/metrics", metrics.handler())
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		return w.Body.String()
+	}
+	for _, status := range []string{"200", "200", "400", "500"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?status="+status, nil))
+	}
+
+	body := scrape()
+	tests := []string{
+		`search_requests_total{endpoint="/search",status="200"} 2`,
+		`search_requests_total{endpoint="/search",status="400"} 1`,
+		`search_requests_total{endpoint="/search",status="500"} 1`,
+		`search_errors_total{endpoint="/search",status="500"} 1`,
+		`search_request_duration_seconds_count{endpoint="/search",status="200"} 2`,
+		`search_request_duration_seconds_bucket{endpoint="/search",status="200",le="+Inf"} 2`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("scrape is missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `search_errors_total{endpoint="/search",status="400"}`) {
+		t.Error("client errors are counted as search errors")
+	}
+}
+
+func TestMetricsBreakerState(t *testing.T) {
+	tests := []struct {
+		name    string
+		breaker *CircuitBreaker
+		want    string
+	}{
+		{"closed breaker", newCircuitBreaker(5, time.Minute), "meilisearch_circuit_breaker_state 0\n"},
+		{"no breaker", nil, ""},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.GET("/metrics", newMetrics(tt.breaker).handler())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		exported := strings.Contains(w.Body.String(), "meilisearch_circuit_breaker_state")
+		if tt.want == "" && exported {
+			t.Errorf("%s: breaker state exported:\n%s", tt.name, w.Body.String())
+		}
+		if tt.want != "" && !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: scrape is missing %q:\n%s", tt.name, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// corsAllowHeaders are the request headers the API reads
+var corsAllowHeaders = []string{
+	"Origin", "Content-Type", "Accept", "Accept-Language", "Authorization",
+	"If-None-Match", requestIDHeader, tenantHeader, "traceparent", "tracestate",
+}
+
+// corsExposeHeaders are the response headers the API sets for clients
+var corsExposeHeaders = []string{
+	requestIDHeader, "X-Cache", "ETag", "Link", "X-Total-Count", "Retry-After",
+	"Deprecation", "Sunset", "Content-Disposition",
+}
+
+// corsConfig builds the CORS settings for the allowed origins. Browsers reject
+// credentialed requests answered with a wildcard origin, so credentials are
+// only enabled when specific origins are listed. Headers are listed
+// explicitly because browsers do not expand * for credentialed requests.
+func corsConfig(origins []string) cors.Config {
+	config := cors.Config{
+		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:  corsAllowHeaders,
+		ExposeHeaders: corsExposeHeaders,
+	}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+			return config
+		}
+	}
+
+	config.AllowOrigins = origins
+	config.AllowCredentials = true
+	return config
+}
+
+// requestID propagates the caller's X-Request-ID, or generates one, so client
+// requests can be matched with server log lines
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newUUID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requireAuth rejects requests without an "Authorization: Bearer <key>" header
+// matching key. An empty key disables the check.
+func requireAuth(key string) gin.HandlerFunc {
+	if key == "" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing or invalid API key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// limitBody caps the request body at limit bytes, answering 413 up front
+// when Content-Length already exceeds it. Handlers see a *http.MaxBytesError
+// when they read past the limit; see bodyErrorStatus. A limit of 0 disables
+// the check.
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Request body must be at most %d bytes", limit),
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// bodyErrorStatus returns the status for a failure to read or decode the
+// request body: 413 when it exceeded the limitBody limit, 400 otherwise
+func bodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// recovery turns a panic in a handler into a logged error and a JSON 500 in
+// the same shape as other error responses, keeping the server up
+func recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// net/http uses this panic to abort a response on purpose
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			slog.Error("Panic while handling request",
+				"request_id", c.GetString(requestIDKey),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"panic", fmt.Sprint(rec),
+				"stack", string(debug.Stack()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, SearchResponse{
+				Success:   false,
+				Error:     "internal error",
+				ErrorCode: errCodeInternal,
+			})
+		}()
+		c.Next()
+	}
+}
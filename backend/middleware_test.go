@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		wantAllOrigins  bool
+		wantOrigins     []string
+		wantCredentials bool
+	}{
+		{"wildcard", []string{"*"}, true, nil, false},
+		{"wildcard among origins", []string{"https://a.example", "*"}, true, nil, false},
+		{"explicit origins", []string{"https://a.example", "https://b.example"}, false, []string{"https://a.example", "https://b.example"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := corsConfig(tt.origins)
+			if config.AllowAllOrigins != tt.wantAllOrigins {
+				t.Errorf("AllowAllOrigins = %v, want %v", config.AllowAllOrigins, tt.wantAllOrigins)
+			}
+			if !slices.Equal(config.AllowOrigins, tt.wantOrigins) {
+				t.Errorf("AllowOrigins = %v, want %v", config.AllowOrigins, tt.wantOrigins)
+			}
+			if config.AllowCredentials != tt.wantCredentials {
+				t.Errorf("AllowCredentials = %v, want %v", config.AllowCredentials, tt.wantCredentials)
+			}
+			if slices.Contains(config.AllowHeaders, "*") || slices.Contains(config.ExposeHeaders, "*") {
+				t.Errorf("headers use a wildcard: allow %v, expose %v", config.AllowHeaders, config.ExposeHeaders)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("cors.Config.Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestCORSCredentialedRequests(t *testing.T) {
+	router := gin.New()
+	router.Use(cors.New(corsConfig([]string{"https://app.example"})))
+	router.GET("/search", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.OPTIONS("/search", func(c *gin.Context) {})
+
+	t.Run("preflight", func(t *testing.T) {
+		w := serve(router, http.MethodOptions, "/search", "",
+			"Origin", "https://app.example",
+			"Access-Control-Request-Method", "GET",
+			"Access-Control-Request-Headers", "authorization,x-tenant-id,x-request-id,if-none-match")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+		}
+		allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers"))
+		for _, header := range []string{"authorization", "x-tenant-id", "x-request-id", "if-none-match"} {
+			if !strings.Contains(allowed, header) {
+				t.Errorf("Access-Control-Allow-Headers %q is missing %s", allowed, header)
+			}
+		}
+	})
+
+	t.Run("exposed headers", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/search", "", "Origin", "https://app.example")
+		exposed := strings.ToLower(w.Header().Get("Access-Control-Expose-Headers"))
+		for _, header := range []string{"x-request-id", "x-cache", "etag", "link", "x-total-count"} {
+			if !strings.Contains(exposed, header) {
+				t.Errorf("Access-Control-Expose-Headers %q is missing %s", exposed, header)
+			}
+		}
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/search", "", "Origin", "https://evil.example")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", w.Code)
+		}
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		name     string
+		header   string
+		wantKept bool
+		wantUUID bool
+	}{
+		{"generated when absent", "", false, true},
+		{"supplied ID preserved", "client-chosen-id", true, false},
+		{"overlong ID replaced", strings.Repeat("x", 129), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			router := gin.New()
+			router.Use(requestID())
+			router.GET("/", func(c *gin.Context) { seen = c.GetString(requestIDKey) })
+
+			var headers []string
+			if tt.header != "" {
+				headers = []string{requestIDHeader, tt.header}
+			}
+			w := serve(router, http.MethodGet, "/", "", headers...)
+
+			got := w.Header().Get(requestIDHeader)
+			if got == "" {
+				t.Fatal("response has no X-Request-ID")
+			}
+			if got != seen {
+				t.Errorf("context ID %q differs from the header %q", seen, got)
+			}
+			if tt.wantKept && got != tt.header {
+				t.Errorf("X-Request-ID = %q, want %q", got, tt.header)
+			}
+			if tt.wantUUID && !uuidPattern.MatchString(got) {
+				t.Errorf("X-Request-ID = %q, want a version 4 UUID", got)
+			}
+		})
+	}
+}
+
+func TestRequestIDInLogs(t *testing.T) {
+	var logs bytes.Buffer
+	router := gin.New()
+	router.Use(requestID(), requestLogger(newLogger(&logs, slog.LevelInfo)))
+	router.GET("/", func(c *gin.Context) {})
+
+	w := serve(router, http.MethodGet, "/", "")
+	var line map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", logs.String(), err)
+	}
+	if line["request_id"] != w.Header().Get(requestIDHeader) {
+		t.Errorf("logged request_id = %v, want %q", line["request_id"], w.Header().Get(requestIDHeader))
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		authorization string
+		wantStatus    int
+	}{
+		{"disabled", "", "", http.StatusOK},
+		{"missing key", "secret", "", http.StatusUnauthorized},
+		{"wrong key", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"key prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"bare key", "secret", "secret", http.StatusUnauthorized},
+		{"correct key", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", requireAuth(tt.key), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := serve(router, http.MethodGet, "/", "", "Authorization", tt.authorization)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthenticatedRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		target string
+		body   string
+		write  bool
+	}{
+		{http.MethodGet, "/search?q=gopher", "", false},
+		{http.MethodGet, "/documents/1", "", false},
+		{http.MethodGet, "/settings", "", false},
+		{http.MethodPost, "/documents", `[{"id": "1"}]`, true},
+		{http.MethodDelete, "/documents/1", "", true},
+		{http.MethodDelete, "/documents", `["1"]`, true},
+		{http.MethodPut, "/settings", `{"stopWords": ["the"]}`, true},
+		{http.MethodPost, "/index/reset", "", true},
+		{http.MethodPost, "/admin/flush-cache", "", true},
+	}
+	modes := []struct {
+		name         string
+		requireRead  bool
+		header       string
+		wantRejected func(write bool) bool
+	}{
+		{"no key", false, "", func(write bool) bool { return write }},
+		{"wrong key", false, "Bearer wrong", func(write bool) bool { return write }},
+		{"correct key", false, "Bearer secret", func(bool) bool { return false }},
+		{"reads require auth", true, "", func(bool) bool { return true }},
+		{"reads require auth, correct key", true, "Bearer secret", func(bool) bool { return false }},
+	}
+
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			config.APIAuthKey = "secret"
+			config.RequireAuthForRead = mode.requireRead
+			router := newAPIRouter(meili, config)
+
+			for _, route := range routes {
+				w := serve(router, route.method, route.target, route.body, "Authorization", mode.header)
+				if rejected := w.Code == http.StatusUnauthorized; rejected != mode.wantRejected(route.write) {
+					t.Errorf("%s %s status = %d, want rejected %v", route.method, route.target, w.Code, mode.wantRejected(route.write))
+				}
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		panic     interface{}
+		wantPanic string
+	}{
+		{"string", "boom", "boom"},
+		{"error", errors.New("nil map write"), "nil map write"},
+		{"runtime error", nil, "runtime error: index out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(newLogger(&logs, slog.LevelInfo))
+			t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+			router := gin.New()
+			router.Use(requestID(), recovery())
+			router.GET("/panic", func(c *gin.Context) {
+				if tt.panic == nil {
+					var hits []int
+					_ = hits[3]
+				}
+				panic(tt.panic)
+			})
+			router.GET("/ok", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+
+			w := serve(router, http.MethodGet, "/panic", "", requestIDHeader, "req-7")
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			var response map[string]interface{}
+			decodeJSON(t, w, &response)
+			if response["success"] != false || response["error"] != "internal error" || response["error_code"] != errCodeInternal {
+				t.Errorf("response = %v, want the SearchResponse error shape", response)
+			}
+			if strings.Contains(w.Body.String(), tt.wantPanic) {
+				t.Errorf("response %s leaks the panic", w.Body)
+			}
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("log %q is not one JSON line: %v", logs.String(), err)
+			}
+			if line["request_id"] != "req-7" || line["path"] != "/panic" {
+				t.Errorf("log = %v, want the request ID and path", line)
+			}
+			if panicked, _ := line["panic"].(string); !strings.Contains(panicked, tt.wantPanic) {
+				t.Errorf("logged panic = %q, want %q", panicked, tt.wantPanic)
+			}
+			if stack, _ := line["stack"].(string); !strings.Contains(stack, "goroutine") {
+				t.Errorf("logged stack = %q, want a stack trace", stack)
+			}
+
+			// The server keeps serving
+			if w := serve(router, http.MethodGet, "/ok", ""); w.Code != http.StatusOK {
+				t.Errorf("status after the panic = %d, want 200", w.Code)
+			}
+		})
+	}
+}
+
+func TestRecoveryRepanicsAbortHandler(t *testing.T) {
+	router := gin.New()
+	router.Use(recovery())
+	router.GET("/abort", func(c *gin.Context) { panic(http.ErrAbortHandler) })
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on to net/http", rec)
+		}
+	}()
+	serve(router, http.MethodGet, "/abort", "")
+	t.Error("the abort panic was swallowed")
+}
+
+// sizedUpload returns a body of exactly size bytes holding one document in
+// the format of the upload endpoint at path
+func sizedUpload(path string, size int) string {
+	prefix, suffix := `[{"id":"1","title":"`, `"}]`
+	switch path {
+	case "/documents/ndjson":
+		prefix, suffix = `{"id":"1","title":"`, "\"}\n"
+	case "/documents/csv":
+		prefix, suffix = "id,title\n1,", "\n"
+	}
+	return prefix + strings.Repeat("a", size-len(prefix)-len(suffix)) + suffix
+}
+
+func TestLimitBody(t *testing.T) {
+	const limit = 256
+	tests := []struct {
+		name       string
+		limit      int64
+		path       string
+		size       int
+		chunked    bool
+		wantStatus int
+	}{
+		{"JSON at the limit", limit, "/documents", limit, false, http.StatusAccepted},
+		{"JSON over the limit", limit, "/documents", limit + 1, false, http.StatusRequestEntityTooLarge},
+		{"chunked JSON at the limit", limit, "/documents", limit, true, http.StatusAccepted},
+		{"chunked JSON over the limit", limit, "/documents", limit + 1, true, http.StatusRequestEntityTooLarge},
+		{"NDJSON at the limit", limit, "/documents/ndjson", limit, false, http.StatusAccepted},
+		{"NDJSON over the limit", limit, "/documents/ndjson", limit + 1, false, http.StatusRequestEntityTooLarge},
+		{"chunked NDJSON over the limit", limit, "/documents/ndjson", limit + 1, true, http.StatusRequestEntityTooLarge},
+		{"CSV at the limit", limit, "/documents/csv", limit, false, http.StatusAccepted},
+		{"CSV over the limit", limit, "/documents/csv", limit + 1, false, http.StatusRequestEntityTooLarge},
+		{"chunked CSV over the limit", limit, "/documents/csv", limit + 1, true, http.StatusRequestEntityTooLarge},
+		{"no limit", 0, "/documents", 10 * limit, true, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			config := testConfig(meili.URL)
+			config.MaxBodyBytes = tt.limit
+			router := newAPIRouter(meili, config)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(sizedUpload(tt.path, tt.size)))
+			if tt.path == "/documents/csv" {
+				req.Header.Set("Content-Type", "text/csv")
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusAccepted {
+				return
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if response.Error == "" {
+				t.Error("413 response has no error message")
+			}
+			if !tt.chunked && len(meili.received(http.MethodPost, documentsPath)) != 0 {
+				t.Error("a body over the declared limit reached Meilisearch")
+			}
+		})
+	}
+}
+
+func TestBodyErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"body too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge},
+		{"wrapped", fmt.Errorf("decoding: %w", &http.MaxBytesError{Limit: 10}), http.StatusRequestEntityTooLarge},
+		{"invalid body", errors.New("unexpected EOF"), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bodyErrorStatus(tt.err); got != tt.want {
+				t.Errorf("bodyErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
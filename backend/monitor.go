@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionMonitor checks Meilisearch health in the background and keeps
+// the result in a flag the readiness probe reads, logging only when the
+// connection goes down or comes back
+type ConnectionMonitor struct {
+	check    func() error
+	interval time.Duration
+
+	connected atomic.Bool
+	done      chan struct{}
+}
+
+// newConnectionMonitor creates a monitor that runs check every interval,
+// starting in the given state
+func newConnectionMonitor(check func() error, interval time.Duration, connected bool) *ConnectionMonitor {
+	m := &ConnectionMonitor{
+		check:    check,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	m.connected.Store(connected)
+	return m
+}
+
+// Connected reports whether the last health check succeeded
+func (m *ConnectionMonitor) Connected() bool {
+	return m.connected.Load()
+}
+
+// run checks the connection every interval until Stop
+func (m *ConnectionMonitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.update(m.check())
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// update records the result of a health check, logging state transitions
+func (m *ConnectionMonitor) update(err error) {
+	connected := err == nil
+	if m.connected.Swap(connected) == connected {
+		return
+	}
+	if connected {
+		slog.Info("Connection to Meilisearch restored")
+	} else {
+		slog.Warn("Lost connection to Meilisearch", "error", err)
+	}
+}
+
+// Stop ends the background checks
+func (m *ConnectionMonitor) Stop() {
+	close(m.done)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that the monitor goroutine and the test can
+// share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// messages returns the msg of every JSON log line written so far
+func (b *syncBuffer) messages(t *testing.T) []string {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []string
+	for _, line := range bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry struct {
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		messages = append(messages, entry.Msg)
+	}
+	return messages
+}
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	logs := &syncBuffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(newLogger(logs, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	return logs
+}
+
+const (
+	lostMessage     = "Lost connection to Meilisearch"
+	restoredMessage = "Connection to Meilisearch restored"
+)
+
+func TestConnectionMonitorTransitions(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name          string
+		connected     bool
+		checks        []error
+		wantConnected []bool
+		wantLogs      []string
+	}{
+		{"stays healthy", true, []error{nil, nil}, []bool{true, true}, nil},
+		{"stays down", false, []error{down, down}, []bool{false, false}, nil},
+		{"goes down once", true, []error{down, down, down}, []bool{false, false, false}, []string{lostMessage}},
+		{"recovers", false, []error{nil, nil}, []bool{true, true}, []string{restoredMessage}},
+		{
+			name:          "flaps",
+			connected:     true,
+			checks:        []error{down, nil, nil, down, nil},
+			wantConnected: []bool{false, true, true, false, true},
+			wantLogs:      []string{lostMessage, restoredMessage, lostMessage, restoredMessage},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			monitor := newConnectionMonitor(func() error { return nil }, time.Hour, tt.connected)
+			if monitor.Connected() != tt.connected {
+				t.Fatalf("Connected() = %v before any check, want %v", monitor.Connected(), tt.connected)
+			}
+
+			for i, err := range tt.checks {
+				monitor.update(err)
+				if got := monitor.Connected(); got != tt.wantConnected[i] {
+					t.Errorf("Connected() after check %d (%v) = %v, want %v", i, err, got, tt.wantConnected[i])
+				}
+			}
+			if got := logs.messages(t); !reflect.DeepEqual(got, tt.wantLogs) {
+				t.Errorf("logs = %q, want %q", got, tt.wantLogs)
+			}
+		})
+	}
+}
+
+// The background checks follow a Meilisearch that goes down and comes back
+func TestConnectionMonitorFollowsMeilisearch(t *testing.T) {
+	logs := captureLogs(t)
+	var healthy atomic.Bool
+	healthy.Store(true)
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			writeFakeJSON(w, http.StatusServiceUnavailable, map[string]string{"message": "down", "code": "internal", "type": "internal"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]string{"status": "available"})
+	})
+	searcher := meili.searcher()
+
+	monitor := newConnectionMonitor(func() error {
+		return searcher.Health(context.Background())
+	}, 5*time.Millisecond, true)
+	go monitor.run()
+	defer monitor.Stop()
+
+	steps := []struct {
+		healthy  bool
+		wantLogs []string
+	}{
+		{false, []string{lostMessage}},
+		{true, []string{lostMessage, restoredMessage}},
+		{false, []string{lostMessage, restoredMessage, lostMessage}},
+	}
+	for _, step := range steps {
+		healthy.Store(step.healthy)
+		eventually(t, func() bool { return monitor.Connected() == step.healthy }, "Connected() did not turn %v", step.healthy)
+		// Further checks in the same state are not logged again
+		checks := len(meili.received(http.MethodGet, "/health"))
+		eventually(t, func() bool { return len(meili.received(http.MethodGet, "/health")) >= checks+3 }, "monitor stopped checking")
+		if got := logs.messages(t); !reflect.DeepEqual(got, step.wantLogs) {
+			t.Errorf("logs after Meilisearch healthy=%v = %q, want %q", step.healthy, got, step.wantLogs)
+		}
+	}
+}
+
+func TestConnectionMonitorStop(t *testing.T) {
+	var checks atomic.Int64
+	monitor := newConnectionMonitor(func() error {
+		checks.Add(1)
+		return nil
+	}, time.Millisecond, true)
+	stopped := make(chan struct{})
+	go func() {
+		monitor.run()
+		close(stopped)
+	}()
+
+	eventually(t, func() bool { return checks.Load() > 0 }, "monitor never checked the connection")
+	monitor.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("run() did not return after Stop()")
+	}
+	after := checks.Load()
+	time.Sleep(10 * time.Millisecond)
+	if n := checks.Load(); n != after {
+		t.Errorf("monitor checked %d more times after Stop()", n-after)
+	}
+}
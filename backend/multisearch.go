@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MultiSearchQuery is one entry of a POST /multi-search request
+type MultiSearchQuery struct {
+	Index string `json:"index"`
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// IndexSearchResult holds the outcome of one query of a multi-search,
+// labeled with the index it ran against
+type IndexSearchResult struct {
+	Index   string         `json:"index"`
+	Query   string         `json:"query"`
+	Success bool           `json:"success"`
+	Results []SearchResult `json:"results,omitempty"`
+	Total   int            `json:"total,omitempty"`
+	Count   int            `json:"count,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// multiSearchHandler searches several indexes in one call and returns the
+// results grouped by index. Each index is resolved like the index parameter
+// of /search and, with an X-Tenant-ID header, scoped to the tenant's copy of
+// it. A failing query only fails its own entry.
+func multiSearchHandler(searcher *MeiliSearcher, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var queries []MultiSearchQuery
+		if err := c.ShouldBindJSON(&queries); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Invalid request body, expected a JSON array of queries: %v", err),
+			})
+			return
+		}
+
+		if len(queries) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "At least one query is required",
+			})
+			return
+		}
+
+		tenant := c.GetHeader(tenantHeader)
+		requests := make([]map[string]interface{}, len(queries))
+		uids := make([]string, len(queries))
+		for i, query := range queries {
+			if strings.TrimSpace(query.Index) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   fmt.Sprintf("Query at position %d is missing an 'index'", i),
+				})
+				return
+			}
+			uid, ok := resolveIndex(config, query.Index, tenant)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   fmt.Sprintf("Query at position %d has an invalid 'index', expected an alias or 1-400 letters, digits, dashes or underscores", i),
+				})
+				return
+			}
+			uids[i] = uid
+			queries[i].Limit = clampLimit(query.Limit, config.DefaultSearchLimit, config.MaxSearchLimit)
+
+			requests[i] = buildSearchRequest(SearchParams{Query: query.Query, Limit: queries[i].Limit})
+			requests[i]["indexUid"] = uid
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), config.SearchTimeout)
+		defer cancel()
+
+		results := make([]IndexSearchResult, len(queries))
+		responses, err := searcher.MultiSearch(ctx, requests)
+		if err != nil {
+			// Meilisearch rejects the whole batch when one query fails, so
+			// retry each query on its own to find out which ones succeed
+			slog.Warn("Multi-search failed, retrying queries individually", "error", err)
+			for i, query := range queries {
+				results[i] = IndexSearchResult{Index: query.Index, Query: query.Query}
+				res, err := searcher.Search(ctx, uids[i], requests[i])
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				results[i].fill(res)
+			}
+		} else {
+			for i, query := range queries {
+				results[i] = IndexSearchResult{Index: query.Index, Query: query.Query}
+				if i < len(responses) {
+					results[i].fill(&responses[i])
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"results": results,
+		})
+	}
+}
+
+func (r *IndexSearchResult) fill(res *MeiliSearchResponse) {
+	r.Success = true
+	r.Results = toSearchResults(res.Hits)
+	r.Total = int(res.EstimatedTotalHits)
+	r.Count = len(r.Results)
+}
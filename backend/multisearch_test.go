@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveIndexes answers searches of every index in indexes from its documents,
+// and multi-searches the way Meilisearch does: the whole batch fails when one
+// query targets an unknown index
+func serveIndexes(meili *fakeMeili, indexes map[string][]map[string]interface{}) {
+	for uid, docs := range indexes {
+		meili.handleFunc(http.MethodPost, "/indexes/"+uid+"/search", seededIndex(docs))
+	}
+	meili.handleFunc(http.MethodPost, "/multi-search", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Queries []map[string]interface{} `json:"queries"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error(), "code": "bad_request"})
+			return
+		}
+
+		results := []json.RawMessage{}
+		for _, query := range request.Queries {
+			uid, _ := query["indexUid"].(string)
+			docs, ok := indexes[uid]
+			if !ok {
+				writeFakeJSON(w, http.StatusNotFound, map[string]string{
+					"message": "Index `" + uid + "` not found.",
+					"code":    "index_not_found",
+					"type":    "invalid_request",
+				})
+				return
+			}
+			body, _ := json.Marshal(query)
+			recorder := httptest.NewRecorder()
+			seededIndex(docs)(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+			results = append(results, recorder.Body.Bytes())
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	})
+}
+
+// multiSearchResponse is the body of a POST /multi-search response
+type multiSearchResponse struct {
+	Success bool                `json:"success"`
+	Results []IndexSearchResult `json:"results"`
+	Error   string              `json:"error"`
+}
+
+func newMultiSearchRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.POST("/multi-search", multiSearchHandler(meili.searcher(), config))
+	return router
+}
+
+func TestMultiSearch(t *testing.T) {
+	indexes := map[string][]map[string]interface{}{
+		"articles":      {{"id": "a1", "title": "Gopher news"}, {"id": "a2", "title": "Gopher history"}},
+		"products":      {{"id": "p1", "title": "Gopher plush"}},
+		"articles_acme": {{"id": "acme-a1", "title": "Acme gopher news"}},
+		"products_acme": {{"id": "acme-p1", "title": "Acme gopher plush"}},
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		headers   []string
+		wantUIDs  []string
+		wantIDs   [][]string
+		wantError []bool
+	}{
+		{
+			name:     "two indexes",
+			body:     `[{"index": "articles", "query": "gopher"}, {"index": "products", "query": "gopher"}]`,
+			wantUIDs: []string{"articles", "products"},
+			wantIDs:  [][]string{{"a1", "a2"}, {"p1"}},
+		},
+		{
+			name:     "alias",
+			body:     `[{"index": "news", "query": "gopher", "limit": 1}]`,
+			wantUIDs: []string{"articles"},
+			wantIDs:  [][]string{{"a1"}},
+		},
+		{
+			name:     "tenant indexes",
+			body:     `[{"index": "articles", "query": "gopher"}, {"index": "news", "query": "gopher"}, {"index": "products", "query": "gopher"}]`,
+			headers:  []string{tenantHeader, "acme"},
+			wantUIDs: []string{"articles_acme", "articles_acme", "products_acme"},
+			wantIDs:  [][]string{{"acme-a1"}, {"acme-a1"}, {"acme-p1"}},
+		},
+		{
+			name:      "partial failure",
+			body:      `[{"index": "articles", "query": "gopher"}, {"index": "missing", "query": "gopher"}]`,
+			wantUIDs:  []string{"articles", "missing"},
+			wantIDs:   [][]string{{"a1", "a2"}, nil},
+			wantError: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			serveIndexes(meili, indexes)
+			config := testConfig(meili.URL)
+			config.Aliases = map[string]string{"news": "articles"}
+
+			w := serve(newMultiSearchRouter(meili, config), http.MethodPost, "/multi-search", tt.body, tt.headers...)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			var sentUIDs []string
+			for _, query := range meili.last(t, http.MethodPost, "/multi-search").JSON(t)["queries"].([]interface{}) {
+				sentUIDs = append(sentUIDs, query.(map[string]interface{})["indexUid"].(string))
+			}
+			if !slices.Equal(sentUIDs, tt.wantUIDs) {
+				t.Errorf("indexes searched = %v, want %v", sentUIDs, tt.wantUIDs)
+			}
+
+			var response multiSearchResponse
+			decodeJSON(t, w, &response)
+			if len(response.Results) != len(tt.wantIDs) {
+				t.Fatalf("got %d result groups, want %d", len(response.Results), len(tt.wantIDs))
+			}
+			var queries []MultiSearchQuery
+			json.Unmarshal([]byte(tt.body), &queries)
+			for i, group := range response.Results {
+				if group.Index != queries[i].Index {
+					t.Errorf("group %d index = %q, want %q", i, group.Index, queries[i].Index)
+				}
+				failed := tt.wantError != nil && tt.wantError[i]
+				if group.Success == failed || (group.Error != "") != failed {
+					t.Errorf("group %d success, error = %v, %q, want failure %v", i, group.Success, group.Error, failed)
+				}
+				if got := resultIDs(group.Results); !failed && !slices.Equal(got, tt.wantIDs[i]) {
+					t.Errorf("group %d ids = %v, want %v", i, got, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMultiSearchRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		headers []string
+	}{
+		{"not an array", `{"index": "articles"}`, nil},
+		{"no queries", `[]`, nil},
+		{"missing index", `[{"query": "gopher"}]`, nil},
+		{"invalid index", `[{"index": "articles", "query": "a"}, {"index": "../keys", "query": "a"}]`, nil},
+		{"invalid tenant index", `[{"index": "docs/x", "query": "a"}]`, []string{tenantHeader, "acme"}},
+		{"invalid tenant", `[{"index": "articles", "query": "a"}]`, []string{tenantHeader, "a_b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			serveIndexes(meili, nil)
+
+			w := serve(newMultiSearchRouter(meili, testConfig(meili.URL)), http.MethodPost, "/multi-search", tt.body, tt.headers...)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			if n := len(meili.received(http.MethodPost, "/multi-search")); n != 0 {
+				t.Errorf("Meilisearch received %d multi-searches, want none", n)
+			}
+		})
+	}
+}
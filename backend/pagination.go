@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageBounds returns the offset and limit of the 1-based page of perPage
+// hits, with perPage clamped like limit
+func pageBounds(page, perPage int, config *Config) (int, int) {
+	limit := clampLimit(perPage, config.DefaultSearchLimit, config.MaxSearchLimit)
+	return (page - 1) * limit, limit
+}
+
+// totalPages returns the number of pages of perPage hits needed for total
+func totalPages(total, perPage int) int {
+	if perPage <= 0 {
+		return 0
+	}
+	return (total + perPage - 1) / perPage
+}
+
+// setPaginationHeaders reports the total number of hits in X-Total-Count and,
+// for GET requests, links to the previous and next pages in a Link header.
+// prev is omitted on the first page and next once the last hit is reached.
+func setPaginationHeaders(c *gin.Context, response *SearchResponse) {
+	c.Header("X-Total-Count", strconv.Itoa(response.Total))
+
+	if c.Request.Method != http.MethodGet || response.Limit <= 0 {
+		return
+	}
+
+	var links []string
+	if response.Page > 0 {
+		if response.Page > 1 {
+			links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageNumberURL(c, response.Page-1)))
+		}
+		if response.Page < response.TotalPages {
+			links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageNumberURL(c, response.Page+1)))
+		}
+	} else {
+		if response.Offset > 0 {
+			prev := max(response.Offset-response.Limit, 0)
+			links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(c, prev, response.Limit)))
+		}
+		if response.Offset+response.Limit < response.Total {
+			links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(c, response.Offset+response.Limit, response.Limit)))
+		}
+	}
+	if len(links) > 0 {
+		// Add rather than set, so the deprecated aliases keep their
+		// successor-version link
+		c.Writer.Header().Add("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL returns the request URL with offset and limit replaced
+func pageURL(c *gin.Context, offset, limit int) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// pageNumberURL returns the request URL with page replaced
+func pageNumberURL(c *gin.Context, page int) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
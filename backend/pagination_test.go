@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// seedGophers serves an index holding n documents that match "gopher"
+func seedGophers(meili *fakeMeili, n int) {
+	index := meili.serveIndex("documents")
+	for i := 0; i < n; i++ {
+		index.add(map[string]interface{}{"id": fmt.Sprint(i), "title": fmt.Sprintf("Gopher %d", i)})
+	}
+}
+
+func TestPaginationHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		wantTotal string
+		wantLink  string
+	}{
+		{"first page", "/search?q=gopher&limit=10", "25", `</search?limit=10&offset=10&q=gopher>; rel="next"`},
+		{"explicit first page", "/search?q=gopher&offset=0&limit=10", "25", `</search?limit=10&offset=10&q=gopher>; rel="next"`},
+		{"middle page", "/search?q=gopher&offset=10&limit=10", "25", `</search?limit=10&offset=0&q=gopher>; rel="prev", </search?limit=10&offset=20&q=gopher>; rel="next"`},
+		{"last page", "/search?q=gopher&offset=20&limit=10", "25", `</search?limit=10&offset=10&q=gopher>; rel="prev"`},
+		{"unaligned offset", "/search?q=gopher&offset=5&limit=10", "25", `</search?limit=10&offset=0&q=gopher>; rel="prev", </search?limit=10&offset=15&q=gopher>; rel="next"`},
+		{"past the end", "/search?q=gopher&offset=30&limit=10", "25", `</search?limit=10&offset=20&q=gopher>; rel="prev"`},
+		{"single page", "/search?q=gopher&limit=50", "25", ""},
+		{"no results", "/search?q=badger&limit=10", "0", ""},
+		{"other parameters kept", "/search?q=gopher&limit=10&sort=title%3Aasc", "25", `</search?limit=10&offset=10&q=gopher&sort=title%3Aasc>; rel="next"`},
+		{"first numbered page", "/search?q=gopher&per_page=10", "25", `</search?page=2&per_page=10&q=gopher>; rel="next"`},
+		{"middle numbered page", "/search?q=gopher&page=2&per_page=10", "25", `</search?page=1&per_page=10&q=gopher>; rel="prev", </search?page=3&per_page=10&q=gopher>; rel="next"`},
+		{"last numbered page", "/search?q=gopher&page=3&per_page=10", "25", `</search?page=2&per_page=10&q=gopher>; rel="prev"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 25)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != tt.wantTotal {
+				t.Errorf("X-Total-Count = %q, want %q", got, tt.wantTotal)
+			}
+			if got := w.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("Link = %q, want %q", got, tt.wantLink)
+			}
+		})
+	}
+}
+
+// The links lead through every result exactly once
+func TestPaginationLinksWalkTheResults(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 23)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	seen := make(map[string]bool)
+	target := "/search?q=gopher&limit=5"
+	for pages := 0; target != ""; pages++ {
+		if pages > 10 {
+			t.Fatal("the next links never end")
+		}
+		w := serve(router, http.MethodGet, target, "")
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		for _, id := range resultIDs(response.Results) {
+			if seen[id] {
+				t.Errorf("result %s is on two pages", id)
+			}
+			seen[id] = true
+		}
+
+		target = ""
+		for _, link := range parseLinkHeader(w.Header().Get("Link")) {
+			if link.rel == "next" {
+				target = link.url
+			}
+		}
+	}
+	if len(seen) != 23 {
+		t.Errorf("walked %d results, want 23", len(seen))
+	}
+}
+
+func TestPaginationHeadersOnPOST(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 25)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	w := serve(router, http.MethodPost, "/search", `{"query":"gopher","limit":10}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "25" {
+		t.Errorf("X-Total-Count = %q, want 25", got)
+	}
+	// A POST body cannot be linked to
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("Link = %q, want none", got)
+	}
+}
+
+type link struct {
+	url string
+	rel string
+}
+
+// parseLinkHeader splits a Link header of `<url>; rel="x"` entries
+func parseLinkHeader(header string) []link {
+	var links []link
+	for _, entry := range splitList(header) {
+		target, params, ok := strings.Cut(entry, ";")
+		if !ok {
+			continue
+		}
+		links = append(links, link{
+			url: strings.Trim(target, "<>"),
+			rel: strings.Trim(strings.TrimPrefix(strings.TrimSpace(params), "rel="), `"`),
+		})
+	}
+	return links
+}
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		page       int
+		perPage    int
+		wantOffset int
+		wantLimit  int
+	}{
+		{"first page", 1, 10, 0, 10},
+		{"third page", 3, 10, 20, 10},
+		{"default page size", 2, 0, 20, 20},
+		{"page size above the maximum", 2, 500, 100, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("http://127.0.0.1:7700")
+			offset, limit := pageBounds(tt.page, tt.perPage, config)
+			if offset != tt.wantOffset || limit != tt.wantLimit {
+				t.Errorf("pageBounds(%d, %d) = %d, %d, want %d, %d", tt.page, tt.perPage, offset, limit, tt.wantOffset, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestTotalPages(t *testing.T) {
+	tests := []struct {
+		total, perPage, want int
+	}{
+		{0, 10, 0},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{25, 10, 3},
+		{25, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := totalPages(tt.total, tt.perPage); got != tt.want {
+			t.Errorf("totalPages(%d, %d) = %d, want %d", tt.total, tt.perPage, got, tt.want)
+		}
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantIDs        []string
+		wantPage       int
+		wantPerPage    int
+		wantTotalPages int
+		wantOffset     int
+	}{
+		{"first page", http.MethodGet, "/search?q=gopher&page=1&per_page=10", "", gopherIDs(0, 10), 1, 10, 3, 0},
+		{"page defaults to the first", http.MethodGet, "/search?q=gopher&per_page=10", "", gopherIDs(0, 10), 1, 10, 3, 0},
+		{"per_page defaults to the default limit", http.MethodGet, "/search?q=gopher&page=2", "", gopherIDs(20, 25), 2, 20, 2, 20},
+		{"last page", http.MethodGet, "/search?q=gopher&page=3&per_page=10", "", gopherIDs(20, 25), 3, 10, 3, 20},
+		{"past the last page", http.MethodGet, "/search?q=gopher&page=4&per_page=10", "", nil, 4, 10, 3, 30},
+		{"POST", http.MethodPost, "/search", `{"query":"gopher","page":2,"per_page":10}`, gopherIDs(10, 20), 2, 10, 3, 10},
+		{"offset and limit leave pages out", http.MethodGet, "/search?q=gopher&offset=10&limit=10", "", gopherIDs(10, 20), 0, 0, 0, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 25)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+			if response.Page != tt.wantPage || response.PerPage != tt.wantPerPage || response.TotalPages != tt.wantTotalPages {
+				t.Errorf("page, per_page, total_pages = %d, %d, %d, want %d, %d, %d",
+					response.Page, response.PerPage, response.TotalPages, tt.wantPage, tt.wantPerPage, tt.wantTotalPages)
+			}
+			if response.Offset != tt.wantOffset || response.Total != 25 {
+				t.Errorf("offset, total = %d, %d, want %d, 25", response.Offset, response.Total, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestSearchPagesRejectsBadParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantError string
+	}{
+		{"page zero", http.MethodGet, "/search?q=gopher&page=0", "", "Query parameter 'page' must be a positive integer"},
+		{"negative page", http.MethodGet, "/search?q=gopher&page=-1&per_page=10", "", "Query parameter 'page' must be a positive integer"},
+		{"page not a number", http.MethodGet, "/search?q=gopher&page=two", "", "Query parameter 'page' must be a positive integer"},
+		{"page and offset", http.MethodGet, "/search?q=gopher&page=2&offset=10", "", "Use either page/per_page or offset/limit, not both"},
+		{"per_page and limit", http.MethodGet, "/search?q=gopher&per_page=10&limit=10", "", "Use either page/per_page or offset/limit, not both"},
+		{"negative page in the body", http.MethodPost, "/search", `{"query":"gopher","page":-1}`, "Field 'page' must be a positive integer"},
+		{"per_page and limit in the body", http.MethodPost, "/search", `{"query":"gopher","per_page":10,"limit":10}`, "Use either page/per_page or offset/limit, not both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 25)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Error != tt.wantError || response.ErrorCode != errCodeInvalidParameter {
+				t.Errorf("error = %q (%s), want %q", response.Error, response.ErrorCode, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+				t.Errorf("Meilisearch received %d searches, want none", n)
+			}
+		})
+	}
+}
+
+// gopherIDs returns the ids of the gophers seedGophers indexes from first up to
+// but not including last
+func gopherIDs(first, last int) []string {
+	var ids []string
+	for i := first; i < last; i++ {
+		ids = append(ids, fmt.Sprint(i))
+	}
+	return ids
+}
+
+// exhaustive=true trades Meilisearch's estimated total for an exact count,
+// paginating by page and hitsPerPage
+func TestSearchExhaustive(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantRequest    map[string]interface{}
+		wantIDs        []string
+		wantTotal      int
+		wantTotalHits  int
+		wantTotalPages int
+	}{
+		{
+			name:        "estimated",
+			method:      http.MethodGet,
+			target:      "/search?q=gopher&limit=10",
+			wantRequest: map[string]interface{}{"limit": float64(10), "offset": float64(0)},
+			wantIDs:     gopherIDs(0, 10),
+			wantTotal:   100,
+		},
+		{
+			name:           "exhaustive",
+			method:         http.MethodGet,
+			target:         "/search?q=gopher&limit=10&exhaustive=true",
+			wantRequest:    map[string]interface{}{"hitsPerPage": float64(10), "page": float64(1)},
+			wantIDs:        gopherIDs(0, 10),
+			wantTotal:      25,
+			wantTotalHits:  25,
+			wantTotalPages: 3,
+		},
+		{
+			name:           "exhaustive with an offset",
+			method:         http.MethodGet,
+			target:         "/search?q=gopher&limit=10&offset=20&exhaustive=true",
+			wantRequest:    map[string]interface{}{"hitsPerPage": float64(10), "page": float64(3)},
+			wantIDs:        gopherIDs(20, 25),
+			wantTotal:      25,
+			wantTotalHits:  25,
+			wantTotalPages: 3,
+		},
+		{
+			name:           "exhaustive numbered pages",
+			method:         http.MethodGet,
+			target:         "/search?q=gopher&page=2&per_page=10&exhaustive=true",
+			wantRequest:    map[string]interface{}{"hitsPerPage": float64(10), "page": float64(2)},
+			wantIDs:        gopherIDs(10, 20),
+			wantTotal:      25,
+			wantTotalHits:  25,
+			wantTotalPages: 3,
+		},
+		{
+			name:           "POST",
+			method:         http.MethodPost,
+			target:         "/search",
+			body:           `{"query":"gopher","limit":20,"exhaustive":true}`,
+			wantRequest:    map[string]interface{}{"hitsPerPage": float64(20), "page": float64(1)},
+			wantIDs:        gopherIDs(0, 20),
+			wantTotal:      25,
+			wantTotalHits:  25,
+			wantTotalPages: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 25)
+			// Meilisearch only estimates the total of offset/limit searches
+			meili.indexes["documents"].estimate = func(total int) int { return (total/100 + 1) * 100 }
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+			if response.Total != tt.wantTotal || response.TotalHits != tt.wantTotalHits || response.TotalPages != tt.wantTotalPages {
+				t.Errorf("total, total_hits, total_pages = %d, %d, %d, want %d, %d, %d",
+					response.Total, response.TotalHits, response.TotalPages, tt.wantTotal, tt.wantTotalHits, tt.wantTotalPages)
+			}
+
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			request := searches[0].JSON(t)
+			for _, key := range []string{"limit", "offset", "hitsPerPage", "page"} {
+				if request[key] != tt.wantRequest[key] {
+					t.Errorf("search %s = %v, want %v", key, request[key], tt.wantRequest[key])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchExhaustiveRejectsBadParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantError string
+	}{
+		{"not a boolean", http.MethodGet, "/search?q=gopher&exhaustive=maybe", "", "Query parameter 'exhaustive' must be true or false"},
+		{"unaligned offset", http.MethodGet, "/search?q=gopher&limit=10&offset=5&exhaustive=true", "", "Query parameter 'offset' must be a multiple of 'limit' when exhaustive=true, or use page/per_page"},
+		{"unaligned offset in the body", http.MethodPost, "/search", `{"query":"gopher","limit":10,"offset":5,"exhaustive":true}`, "Field 'offset' must be a multiple of 'limit' when 'exhaustive' is set, or use page/per_page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 25)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Error != tt.wantError || response.ErrorCode != errCodeInvalidParameter {
+				t.Errorf("error = %q (%s), want %q", response.Error, response.ErrorCode, tt.wantError)
+			}
+		})
+	}
+}
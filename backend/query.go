@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// parseQuery splits the -term exclusions off query and returns the rest of
+// the query, with "quoted phrases" kept verbatim. Excluded terms are
+// lowercased; a "-" inside a phrase or on its own is left alone.
+func parseQuery(query string) (string, []string) {
+	var kept, excluded []string
+	inPhrase := false
+	for _, token := range strings.Split(query, " ") {
+		if token == "" {
+			continue
+		}
+		if !inPhrase && len(token) > 1 && token[0] == '-' && token[1] != '"' {
+			excluded = append(excluded, strings.ToLower(token[1:]))
+		} else {
+			kept = append(kept, token)
+		}
+		if strings.Count(token, `"`)%2 == 1 {
+			inPhrase = !inPhrase
+		}
+	}
+	return strings.Join(kept, " "), excluded
+}
+
+// onlyExclusions reports whether query has -term exclusions but nothing to
+// search for, which Meilisearch would treat as a placeholder search
+func onlyExclusions(query string) bool {
+	kept, excluded := parseQuery(query)
+	return kept == "" && len(excluded) > 0
+}
+
+// meiliQuery returns query as Meilisearch gets it: the exclusions follow the
+// rest of the query as its negative operator, so Meilisearch leaves out the
+// documents containing them before paginating and counting hits
+func meiliQuery(query string) string {
+	kept, excluded := parseQuery(query)
+	terms := make([]string, 0, len(excluded)+1)
+	if kept != "" {
+		terms = append(terms, kept)
+	}
+	for _, term := range excluded {
+		terms = append(terms, "-"+term)
+	}
+	return strings.Join(terms, " ")
+}
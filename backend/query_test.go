@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantKept     string
+		wantExcluded []string
+	}{
+		{"plain words", "python guide", "python guide", nil},
+		{"exclusion", "python -snake", "python", []string{"snake"}},
+		{"exclusions are lowercased", "python -Snake -PIT", "python", []string{"snake", "pit"}},
+		{"phrase kept verbatim", `"Exact Phrase" guide`, `"Exact Phrase" guide`, nil},
+		{"dash inside a phrase", `"python -snake" guide`, `"python -snake" guide`, nil},
+		{"phrase and exclusion", `"exact phrase" -snake`, `"exact phrase"`, []string{"snake"}},
+		{"excluded phrase left alone", `python -"monty python"`, `python -"monty python"`, nil},
+		{"lone dash", "python - guide", "python - guide", nil},
+		{"hyphenated word", "python e-mail", "python e-mail", nil},
+		{"only exclusions", "-snake -pit", "", []string{"snake", "pit"}},
+		{"empty", "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, excluded := parseQuery(tt.query)
+			if kept != tt.wantKept || !slices.Equal(excluded, tt.wantExcluded) {
+				t.Errorf("parseQuery(%q) = %q, %q, want %q, %q", tt.query, kept, excluded, tt.wantKept, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestMeiliQuery(t *testing.T) {
+	tests := []struct {
+		query              string
+		want               string
+		wantOnlyExclusions bool
+	}{
+		{"python guide", "python guide", false},
+		{"-Snake python", "python -snake", false},
+		{`"exact phrase" -snake guide`, `"exact phrase" guide -snake`, false},
+		{`"python -snake"`, `"python -snake"`, false},
+		{"-snake", "-snake", true},
+		{"-", "-", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := meiliQuery(tt.query); got != tt.want {
+				t.Errorf("meiliQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+			if got := onlyExclusions(tt.query); got != tt.wantOnlyExclusions {
+				t.Errorf("onlyExclusions(%q) = %v, want %v", tt.query, got, tt.wantOnlyExclusions)
+			}
+		})
+	}
+}
+
+// snakeDocs are about Python, some of them about the snake
+var snakeDocs = []map[string]interface{}{
+	{"id": "1", "title": "Python guide", "content": "Learn the language"},
+	{"id": "2", "title": "Python", "content": "A large snake"},
+	{"id": "3", "title": "Python tips", "content": "Write better code"},
+	{"id": "4", "title": "Ball python care", "content": "Feeding your snake"},
+	{"id": "5", "title": "Python exact phrase", "content": "Tools"},
+}
+
+func TestSearchExclusions(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantQuery  string
+		wantIDs    []string
+		wantTotal  int
+	}{
+		{"exclusion", http.MethodGet, "/search?q=python%20-snake", "", http.StatusOK, "python -snake", []string{"1", "3", "5"}, 3},
+		{"pages stay full", http.MethodGet, "/search?q=python%20-snake&limit=2", "", http.StatusOK, "python -snake", []string{"1", "3"}, 3},
+		{"next page", http.MethodGet, "/search?q=python%20-snake&limit=2&offset=2", "", http.StatusOK, "python -snake", []string{"5"}, 3},
+		{"exclusion outside the retrieved attributes", http.MethodGet, "/search?q=python%20-snake&attributes=id", "", http.StatusOK, "python -snake", []string{"1", "3", "5"}, 3},
+		{"several exclusions", http.MethodGet, "/search?q=python%20-snake%20-Tools", "", http.StatusOK, "python -snake -tools", []string{"1", "3"}, 2},
+		{"phrase preserved", http.MethodGet, "/search?q=%22exact%20phrase%22", "", http.StatusOK, `"exact phrase"`, nil, 0},
+		{"POST", http.MethodPost, "/search", `{"query":"python -snake"}`, http.StatusOK, "python -snake", []string{"1", "3", "5"}, 3},
+		{"browsing with exclusions", http.MethodGet, "/search?q=-snake&browse=true", "", http.StatusOK, "-snake", []string{"1", "3", "5"}, 3},
+		{"only exclusions", http.MethodGet, "/search?q=-snake", "", http.StatusBadRequest, "", nil, 0},
+		{"only exclusions in the body", http.MethodPost, "/search", `{"query":"-snake -pit"}`, http.StatusBadRequest, "", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(snakeDocs...)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			searches := meili.received(http.MethodPost, searchPath)
+
+			if tt.wantStatus != http.StatusOK {
+				if response.ErrorCode != errCodeMissingQuery {
+					t.Errorf("error code = %q, want %q", response.ErrorCode, errCodeMissingQuery)
+				}
+				if len(searches) != 0 {
+					t.Errorf("Meilisearch received %d searches, want none", len(searches))
+				}
+				return
+			}
+			if len(searches) != 1 {
+				t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+			}
+			if q := searches[0].JSON(t)["q"]; q != tt.wantQuery {
+				t.Errorf("Meilisearch query = %q, want %q", q, tt.wantQuery)
+			}
+			if tt.wantIDs == nil {
+				return
+			}
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+			if response.Total != tt.wantTotal || response.Count != len(tt.wantIDs) {
+				t.Errorf("total, count = %d, %d, want %d, %d", response.Total, response.Count, tt.wantTotal, len(tt.wantIDs))
+			}
+		})
+	}
+}
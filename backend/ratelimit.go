@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter is a per-client token bucket limiter. Each client key gets a
+// bucket holding up to burst tokens that refills at rate tokens per second.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+}
+
+// clientLimiter is the bucket of one client and when the client was last seen
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate.Limit(rps),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// allow takes a token from key's bucket. When the bucket is empty it reports
+// how long the client has to wait for the next token.
+func (l *RateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.rate, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		// Rejected requests must not use up future tokens
+		reservation.CancelAt(now)
+		return false, wait
+	}
+	return true, 0
+}
+
+// evictStale drops clients that have been idle long enough for their bucket
+// to be full again, since a fresh bucket behaves identically
+func (l *RateLimiter) evictStale(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	refill := time.Duration(float64(l.burst) / float64(l.rate) * float64(time.Second))
+	for key, client := range l.clients {
+		if now.Sub(client.lastSeen) > refill {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// evictLoop periodically removes idle clients so the map does not grow with
+// every client ever seen
+func (l *RateLimiter) evictLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.evictStale(now)
+	}
+}
+
+// middleware rejects requests over the limit with 429 and a Retry-After
+// header. Clients are told apart by c.ClientIP, which only trusts
+// X-Forwarded-For from TRUSTED_PROXIES. A nil limiter lets every request
+// through.
+func (l *RateLimiter) middleware() gin.HandlerFunc {
+	if l == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		ok, wait := l.allow(c.ClientIP(), time.Now())
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, SearchResponse{
+				Success:   false,
+				Error:     "Rate limit exceeded, try again later",
+				ErrorCode: errCodeRateLimited,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		at       time.Duration
+		key      string
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{"first burst token", 0, "a", true, 0},
+		{"second burst token", 0, "a", true, 0},
+		{"burst used up", 0, "a", false, 500 * time.Millisecond},
+		{"rejection does not use tokens", 0, "a", false, 500 * time.Millisecond},
+		{"other client unaffected", 0, "b", true, 0},
+		{"partly refilled", 250 * time.Millisecond, "a", false, 250 * time.Millisecond},
+		{"refilled", 500 * time.Millisecond, "a", true, 0},
+		{"empty again", 500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+	}
+
+	limiter := newRateLimiter(2, 2)
+	for _, tt := range tests {
+		ok, wait := limiter.allow(tt.key, start.Add(tt.at))
+		if ok != tt.wantOK || wait != tt.wantWait {
+			t.Errorf("%s: allow() = %v, %s, want %v, %s", tt.name, ok, wait, tt.wantOK, tt.wantWait)
+		}
+	}
+}
+
+func TestRateLimiterEvictsIdleClients(t *testing.T) {
+	start := time.Now()
+	limiter := newRateLimiter(10, 20)
+	limiter.allow("idle", start)
+	limiter.allow("active", start.Add(time.Second))
+
+	// A bucket of 20 refills at 10/s within 2s
+	limiter.evictStale(start.Add(2500 * time.Millisecond))
+
+	if _, ok := limiter.clients["idle"]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := limiter.clients["active"]; !ok {
+		t.Error("active client was evicted")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := newRateLimiter(1, 2)
+	router := gin.New()
+	router.SetTrustedProxies(nil)
+	router.GET("/search", limiter.middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(remoteAddr string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, w.Code)
+		}
+	}
+
+	w := request("10.0.0.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status over the limit = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	var response SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.ErrorCode != errCodeRateLimited {
+		t.Errorf("error_code = %q, want %q", response.ErrorCode, errCodeRateLimited)
+	}
+
+	// X-Forwarded-For is ignored without trusted proxies, so it cannot be
+	// used to get a fresh bucket
+	if w := request("10.0.0.1:1234", "X-Forwarded-For", "203.0.113.9"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For status = %d, want 429", w.Code)
+	}
+	if w := request("10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+
+	// The bucket refills at one token per second
+	time.Sleep(1100 * time.Millisecond)
+	if w := request("10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("status after the window = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimiterTrustedProxy(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	router := gin.New()
+	router.SetTrustedProxies([]string{"10.0.0.0/8"})
+	router.GET("/search", limiter.middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		forwardedFor string
+		wantStatus   int
+	}{
+		{"203.0.113.1", http.StatusOK},
+		{"203.0.113.1", http.StatusTooManyRequests},
+		{"203.0.113.2", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.RemoteAddr = "10.1.2.3:4567"
+		req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("client %s status = %d, want %d", tt.forwardedFor, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var limiter *RateLimiter
+	router := gin.New()
+	router.GET("/search", limiter.middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 50; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, w.Code)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache stores serialized search responses in Redis so that every
+// backend instance shares one cache
+type RedisCache struct {
+	client   *redis.Client
+	ttl      time.Duration
+	staleTTL time.Duration
+}
+
+const (
+	// redisKeyPrefix namespaces the search cache keys so Invalidate only
+	// removes entries written by this backend
+	redisKeyPrefix = "search-cache:"
+	// redisFreshPrefix holds the entries Get reads, redisStalePrefix the
+	// longer-lived copies GetStale reads
+	redisFreshPrefix = redisKeyPrefix + "fresh:"
+	redisStalePrefix = redisKeyPrefix + "stale:"
+	// redisScanCount is how many keys Flush asks SCAN for and unlinks at once
+	redisScanCount = 500
+)
+
+// newRedisCache parses a redis://[user:password@]host:port[/db] URL. No
+// connection is made until the cache is first used.
+func newRedisCache(rawURL string, ttl, staleTTL time.Duration) (*RedisCache, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL %q must look like redis://host:port/db: %v", rawURL, err)
+	}
+	options.DialTimeout = 2 * time.Second
+	options.ReadTimeout = 2 * time.Second
+	options.WriteTimeout = 2 * time.Second
+	options.PoolSize = 8
+	// A cache miss is cheaper than waiting out retries while Redis is down
+	options.MaxRetries = -1
+	options.DialerRetries = 1
+
+	return &RedisCache{
+		client:   redis.NewClient(options),
+		ttl:      ttl,
+		staleTTL: staleTTL,
+	}, nil
+}
+
+// Get returns the cached response for key. Redis errors are logged and
+// treated as a miss so a cache outage never fails a search.
+func (r *RedisCache) Get(key string) (*SearchResponse, bool) {
+	return r.get(redisKey(redisFreshPrefix, key))
+}
+
+// GetStale returns the copy of the response for key that is kept for
+// CACHE_TTL plus the stale period
+func (r *RedisCache) GetStale(key string) (*SearchResponse, bool) {
+	if r.staleTTL <= 0 {
+		return nil, false
+	}
+	return r.get(redisKey(redisStalePrefix, key))
+}
+
+func (r *RedisCache) get(redisKey string) (*SearchResponse, bool) {
+	data, err := r.client.Get(context.Background(), redisKey).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.Warn("Redis cache get failed", "error", err)
+		}
+		return nil, false
+	}
+
+	var response SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		slog.Warn("Redis cache entry is corrupt", "error", err)
+		return nil, false
+	}
+	return &response, true
+}
+
+// Set stores response under key with the cache TTL
+func (r *RedisCache) Set(key string, response *SearchResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	if err := r.client.Set(ctx, redisKey(redisFreshPrefix, key), data, redisTTL(r.ttl)).Err(); err != nil {
+		slog.Warn("Redis cache set failed", "error", err)
+	}
+
+	// Redis drops the entry when it expires, so a second copy outlives it
+	// for GetStale
+	if r.staleTTL > 0 {
+		if err := r.client.Set(ctx, redisKey(redisStalePrefix, key), data, redisTTL(r.ttl+r.staleTTL)).Err(); err != nil {
+			slog.Warn("Redis cache set failed", "error", err)
+		}
+	}
+}
+
+// Invalidate deletes every search cache entry
+func (r *RedisCache) Invalidate() {
+	if _, err := r.Flush(""); err != nil {
+		slog.Warn("Redis cache invalidation failed", "error", err)
+	}
+}
+
+// Flush deletes the entries whose query starts with prefix, ignoring case and
+// spacing, or every entry when prefix is empty. Keys start with the
+// normalized query, so SCAN finds the entries without reading them, and
+// UNLINK frees them without blocking Redis.
+func (r *RedisCache) Flush(prefix string) (int, error) {
+	ctx := context.Background()
+	pattern := escapeRedisPattern(normalizeCacheQuery(prefix)) + "*"
+
+	flushed := 0
+	for _, keyPrefix := range []string{redisFreshPrefix, redisStalePrefix} {
+		keys := make([]string, 0, redisScanCount)
+		unlink := func() error {
+			if len(keys) == 0 {
+				return nil
+			}
+			removed, err := r.client.Unlink(ctx, keys...).Result()
+			// The stale copy of an entry is not counted separately
+			if keyPrefix == redisFreshPrefix {
+				flushed += int(removed)
+			}
+			keys = keys[:0]
+			return err
+		}
+
+		iter := r.client.Scan(ctx, 0, keyPrefix+pattern, redisScanCount).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+			if len(keys) == redisScanCount {
+				if err := unlink(); err != nil {
+					return flushed, err
+				}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return flushed, err
+		}
+		if err := unlink(); err != nil {
+			return flushed, err
+		}
+	}
+	return flushed, nil
+}
+
+// redisKey turns a search cache key into <prefix><normalized query>:<hash>.
+// The hash keeps keys of long filters short and the query lets Flush match
+// entries by query prefix.
+func redisKey(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + cacheKeyQuery(key) + ":" + hex.EncodeToString(sum[:])
+}
+
+// redisTTL rounds ttl up to the 1ms minimum Redis accepts, since PX 0 is
+// rejected and go-redis would store a zero TTL without any expiry
+func redisTTL(ttl time.Duration) time.Duration {
+	return max(ttl, time.Millisecond)
+}
+
+// escapeRedisPattern escapes the characters SCAN MATCH treats as wildcards
+func escapeRedisPattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// withRetry calls fn until it succeeds, returns an error that is not worth
+// retrying, or has been retried maxRetries times. The wait before retry n is
+// baseDelay*2^(n-1) plus up to the same amount of random jitter, and is cut
+// short when ctx is done.
+func withRetry(ctx context.Context, maxRetries int, baseDelay time.Duration, fn func() error) error {
+	err := fn()
+	for attempt := 1; attempt <= maxRetries && err != nil && isRetryable(err); attempt++ {
+		delay := baseDelay << (attempt - 1)
+		if delay > 0 {
+			delay += time.Duration(rand.Int63n(int64(delay)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		err = fn()
+	}
+	return err
+}
+
+// isRetryable reports whether err looks transient: a network failure or a 5xx
+// from Meilisearch. Requests Meilisearch rejects with a 4xx, cancelled or
+// timed-out contexts and calls refused by the circuit breaker are not retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errCircuitOpen) {
+		return false
+	}
+
+	var meiliErr *MeiliError
+	if errors.As(err, &meiliErr) {
+		return meiliErr.StatusCode >= 500
+	}
+
+	var clientErr *meilisearch.Error
+	if errors.As(err, &clientErr) {
+		switch clientErr.ErrCode {
+		case meilisearch.MeilisearchCommunicationError, meilisearch.MeilisearchTimeoutError:
+			return true
+		}
+		return clientErr.StatusCode >= 500
+	}
+
+	// Anything else comes from the HTTP transport, e.g. a refused connection
+	return true
+}
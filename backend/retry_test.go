@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", errors.New("dial tcp: connection refused"), true},
+		{"server error", &MeiliError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"wrapped server error", fmt.Errorf("search: %w", &MeiliError{StatusCode: http.StatusBadGateway}), true},
+		{"client error", &MeiliError{StatusCode: http.StatusBadRequest, Code: "invalid_search_filter"}, false},
+		{"not found", &MeiliError{StatusCode: http.StatusNotFound}, false},
+		{"official client communication error", &meilisearch.Error{ErrCode: meilisearch.MeilisearchCommunicationError}, true},
+		{"official client timeout", &meilisearch.Error{ErrCode: meilisearch.MeilisearchTimeoutError}, true},
+		{"official client server error", &meilisearch.Error{ErrCode: meilisearch.MeilisearchApiError, StatusCode: http.StatusInternalServerError}, true},
+		{"official client rejection", &meilisearch.Error{ErrCode: meilisearch.MeilisearchApiError, StatusCode: http.StatusBadRequest}, false},
+		{"cancelled", context.Canceled, false},
+		{"timed out", fmt.Errorf("search: %w", context.DeadlineExceeded), false},
+		{"circuit open", errCircuitOpen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	transient := &MeiliError{StatusCode: http.StatusServiceUnavailable}
+	permanent := &MeiliError{StatusCode: http.StatusBadRequest}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   int
+		err        error
+		wantCalls  int
+		wantErr    error
+	}{
+		{"succeeds at once", 3, 0, transient, 1, nil},
+		{"succeeds after failures", 3, 2, transient, 3, nil},
+		{"succeeds on the last retry", 3, 3, transient, 4, nil},
+		{"gives up after the cap", 3, 10, transient, 4, transient},
+		{"retries disabled", 0, 1, transient, 1, transient},
+		{"not retryable", 3, 10, permanent, 1, permanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := withRetry(context.Background(), tt.maxRetries, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithRetryBackoff(t *testing.T) {
+	var times []time.Time
+	withRetry(context.Background(), 3, 10*time.Millisecond, func() error {
+		times = append(times, time.Now())
+		return errors.New("connection refused")
+	})
+
+	// Retry n waits between base*2^(n-1) and twice that
+	for i, base := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		if wait := times[i+1].Sub(times[i]); wait < base || wait > 2*base+50*time.Millisecond {
+			t.Errorf("wait before retry %d = %s, want %s to %s", i+1, wait, base, 2*base)
+		}
+	}
+}
+
+func TestWithRetryStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	err := withRetry(ctx, 5, time.Second, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("error, calls = %v, %d, want an error after 1 call", err, calls)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("withRetry took %s after the context was done", elapsed)
+	}
+}
+
+func TestSearchRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		status     int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"recovers from transient errors", 2, http.StatusServiceUnavailable, http.StatusOK, 3},
+		{"gives up after the cap", 10, http.StatusServiceUnavailable, http.StatusInternalServerError, 4},
+		{"client errors are not retried", 10, http.StatusBadRequest, http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					writeFakeJSON(w, tt.status, map[string]string{"message": "failed", "code": "internal", "type": "internal"})
+					return
+				}
+				writeFakeJSON(w, http.StatusOK, searchHits(map[string]interface{}{"id": "1", "title": "Gopher"}))
+			})
+			config := testConfig(meili.URL)
+			config.MeiliMaxRetries = 3
+
+			w := serve(newSearchRouter(meili.searcher(), nil, config), http.MethodGet, "/search?q=gopher", "")
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("Meilisearch received %d searches, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API holds the dependencies of the API endpoints so the same routes can be
+// mounted under several prefixes
+type API struct {
+	client   *MeiliClient
+	searcher *MeiliSearcher
+	cache    Cache
+	config   *Config
+	metrics  *Metrics
+	limiter  *RateLimiter
+	crawler  *Crawler
+
+	analytics *Analytics
+}
+
+// mount registers the API endpoints under /v1. The unversioned paths remain
+// as deprecated aliases until LEGACY_ROUTES_SUNSET.
+func (api *API) mount(router *gin.Engine) {
+	api.register(router.Group("/v1"))
+
+	sunset, _ := api.config.legacyRoutesSunset()
+	api.register(router.Group("/", deprecatedRoute(sunset)))
+}
+
+// register mounts every API endpoint on base. Write endpoints require the API
+// key when API_AUTH_KEY is set; read endpoints only when REQUIRE_AUTH_FOR_READ
+// is set as well.
+func (api *API) register(base *gin.RouterGroup) {
+	client, searcher, cache, config := api.client, api.searcher, api.cache, api.config
+	metrics, limiter, analytics := api.metrics, api.limiter, api.analytics
+
+	write := base.Group("", requireAuth(config.APIAuthKey))
+	read := base.Group("")
+	if config.RequireAuthForRead {
+		read.Use(requireAuth(config.APIAuthKey))
+	}
+
+	// Search endpoints
+	read.GET("/search", metrics.instrument("/search"), limiter.middleware(), analytics.middleware(), indexParam(config), languageIndex(config), searchHandler(searcher, cache, config))
+	read.POST("/search", metrics.instrument("/search"), limiter.middleware(), analytics.middleware(), indexParam(config), languageIndex(config), postSearchHandler(searcher, cache, config))
+
+	read.POST("/search/batch", metrics.instrument("/search/batch"), limiter.middleware(), batchSearchHandler(searcher, cache, config))
+	read.POST("/multi-search", metrics.instrument("/multi-search"), limiter.middleware(), multiSearchHandler(searcher, config))
+	read.POST("/semantic-search", metrics.instrument("/semantic-search"), limiter.middleware(), analytics.middleware(), semanticSearchHandler(searcher, cache, config))
+
+	// Autocomplete endpoint
+	read.GET("/suggest", suggestHandler(searcher, config))
+
+	// RSS feed of matching or recent documents
+	read.GET("/feed.rss", limiter.middleware(), feedHandler(searcher, cache, config))
+
+	// Index stats endpoint
+	read.GET("/stats", statsHandler(client, config))
+
+	// Document endpoints
+	read.GET("/documents/:id", getDocumentHandler(client, config))
+	read.GET("/documents/:id/similar", similarDocumentsHandler(searcher, config))
+	bodyLimit := limitBody(config.MaxBodyBytes)
+	write.POST("/documents", bodyLimit, addDocumentsHandler(client, cache, config))
+	write.POST("/documents/ndjson", bodyLimit, addDocumentsNDJSONHandler(client, cache, config))
+	write.POST("/documents/csv", bodyLimit, addDocumentsCSVHandler(client, cache, config))
+	write.DELETE("/documents", bodyLimit, deleteDocumentsHandler(client, cache, config))
+	write.DELETE("/documents/:id", deleteDocumentHandler(client, cache, config))
+
+	// Website crawling
+	write.POST("/crawl", api.crawler.startHandler())
+	read.GET("/crawl/:id", api.crawler.statusHandler())
+
+	// Index management endpoints
+	read.GET("/indexes", listIndexesHandler(client))
+	write.POST("/index", createIndexHandler(client))
+	write.DELETE("/index/:uid", deleteIndexHandler(client, cache))
+	write.POST("/index/reset", resetIndexHandler(client, cache, config))
+	write.POST("/index/swap", swapIndexesHandler(client, cache))
+
+	// Index settings endpoints
+	read.GET("/settings", getSettingsHandler(client, config))
+	write.PUT("/settings", updateSettingsHandler(client, cache, config))
+	write.POST("/settings/reset", resetSettingsHandler(client, cache, config))
+	read.GET("/synonyms", getSynonymsHandler(client, config))
+	write.PUT("/synonyms", updateSynonymsHandler(client, cache, config))
+	read.GET("/stop-words", getStopWordsHandler(client, config))
+	write.PUT("/stop-words", updateStopWordsHandler(client, cache, config))
+	read.GET("/settings/searchable-attributes", getSearchableAttributesHandler(client, config))
+	write.PUT("/settings/searchable-attributes", updateSearchableAttributesHandler(client, cache, config))
+	read.GET("/settings/ranking-rules", getRankingRulesHandler(client, config))
+	write.PUT("/settings/ranking-rules", updateRankingRulesHandler(client, cache, config))
+	read.GET("/settings/typo-tolerance", getTypoToleranceHandler(searcher, config))
+	write.PATCH("/settings/typo-tolerance", updateTypoToleranceHandler(client, searcher, cache, config))
+
+	// Search analytics. The reports expose what users search for and so
+	// require the API key like write endpoints; clicks come from the frontend.
+	write.GET("/analytics/top-queries", analytics.topQueriesHandler())
+	write.GET("/analytics/zero-results", analytics.zeroResultsHandler())
+	write.GET("/analytics/ctr", analytics.ctrHandler())
+	read.POST("/analytics/click", limiter.middleware(), analytics.clickHandler(config))
+
+	// Cache administration
+	write.POST("/admin/flush-cache", flushCacheHandler(cache))
+
+	// Task status endpoint
+	read.GET("/tasks/:uid", getTaskHandler(client))
+}
+
+// deprecatedRoute marks responses of the unversioned aliases as deprecated
+// and points clients at the /v1 equivalent. The Sunset header is only sent
+// when a sunset date is configured.
+func deprecatedRoute(sunset time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", fmt.Sprintf(`</v1%s>; rel="successor-version"`, c.Request.URL.Path))
+		c.Next()
+	}
+}
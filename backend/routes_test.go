@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		query  string
+		body   string
+		want   int
+	}{
+		{"search", http.MethodGet, "/search", "?q=gopher", "", http.StatusOK},
+		{"search body", http.MethodPost, "/search", "", `{"query":"gopher"}`, http.StatusOK},
+		{"stats", http.MethodGet, "/stats", "", "", http.StatusOK},
+		{"document", http.MethodGet, "/documents/1", "", "", http.StatusOK},
+		{"missing document", http.MethodGet, "/documents/404", "", "", http.StatusNotFound},
+		{"add documents", http.MethodPost, "/documents", "", `[{"id": "2", "title": "Gopher tricks"}]`, http.StatusAccepted},
+		{"settings", http.MethodGet, "/settings", "", "", http.StatusOK},
+		{"bad request", http.MethodGet, "/search", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, prefix := range []string{"/v1", ""} {
+				meili := newFakeMeili(t)
+				index := meili.serveIndex("documents")
+				index.add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+				router := newAPIRouter(meili, testConfig(meili.URL))
+
+				w := serve(router, tt.method, prefix+tt.path+tt.query, tt.body)
+				if w.Code != tt.want {
+					t.Fatalf("%s %s status = %d, want %d, body %s", tt.method, prefix+tt.path, w.Code, tt.want, w.Body)
+				}
+
+				deprecation, sunset, links := w.Header().Get("Deprecation"), w.Header().Get("Sunset"), w.Header().Values("Link")
+				successor := `</v1` + tt.path + `>; rel="successor-version"`
+				if prefix == "/v1" {
+					if deprecation != "" || sunset != "" || slices.Contains(links, successor) {
+						t.Errorf("%s: Deprecation, Sunset, Link = %q, %q, %q, want none", prefix+tt.path, deprecation, sunset, links)
+					}
+					continue
+				}
+				if deprecation != "true" || sunset != "Thu, 15 Apr 2027 00:00:00 GMT" || !slices.Contains(links, successor) {
+					t.Errorf("%s: Deprecation, Sunset, Link = %q, %q, %q, want true, the configured date and %s", tt.path, deprecation, sunset, links, successor)
+				}
+			}
+		})
+	}
+}
+
+func TestDeprecatedRoutesWithoutSunset(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	config := testConfig(meili.URL)
+	config.LegacyRoutesSunset = ""
+	router := newAPIRouter(meili, config)
+
+	w := serve(router, http.MethodGet, "/stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Deprecation") != "true" {
+		t.Errorf("Deprecation = %q, want true", w.Header().Get("Deprecation"))
+	}
+	if sunset, ok := w.Header()["Sunset"]; ok {
+		t.Errorf("Sunset = %q, want none without LEGACY_ROUTES_SUNSET", sunset)
+	}
+}
+
+func TestUnknownVersionedRoute(t *testing.T) {
+	meili := newFakeMeili(t)
+	router := newAPIRouter(meili, testConfig(meili.URL))
+
+	for _, path := range []string{"/v1/unknown", "/v2/search"} {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d, want 404", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,1381 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SearchResult represents a search result document
+type SearchResult struct {
+	ID                 string  `json:"id" xml:"id"`
+	Title              string  `json:"title" xml:"title"`
+	Content            string  `json:"content" xml:"content"`
+	URL                string  `json:"url" xml:"url"`
+	Score              float64 `json:"score" xml:"score"`
+	HighlightedTitle   string  `json:"highlighted_title" xml:"highlighted_title"`
+	HighlightedContent string  `json:"highlighted_content" xml:"highlighted_content"`
+
+	// Snippet is the display-ready excerpt of the content: cropped around
+	// the matches with the matched terms highlighted
+	Snippet string `json:"snippet" xml:"snippet"`
+
+	MatchesPosition MatchesPosition `json:"matches_position,omitempty" xml:"matches_position,omitempty"`
+}
+
+// MatchesPosition maps attribute names to the matches found in them
+type MatchesPosition map[string][]MatchPosition
+
+// MatchPosition locates one query match within an attribute, in bytes
+type MatchPosition struct {
+	Start  int `json:"start" xml:"start,attr"`
+	Length int `json:"length" xml:"length,attr"`
+}
+
+// FacetCounts maps facet names to the number of hits per facet value
+type FacetCounts map[string]map[string]int64
+
+// SearchResponse represents the API response
+type SearchResponse struct {
+	XMLName xml.Name `json:"-" xml:"search_response"`
+
+	Success bool           `json:"success" xml:"success"`
+	Results []SearchResult `json:"results,omitempty" xml:"results>result,omitempty"`
+	Error   string         `json:"error,omitempty" xml:"error,omitempty"`
+	Query   string         `json:"query,omitempty" xml:"query,omitempty"`
+	Total   int            `json:"total,omitempty" xml:"total,omitempty"`
+	Count   int            `json:"count,omitempty" xml:"count,omitempty"`
+	Offset  int            `json:"offset,omitempty" xml:"offset,omitempty"`
+	Limit   int            `json:"limit,omitempty" xml:"limit,omitempty"`
+	Facets  FacetCounts    `json:"facets,omitempty" xml:"facets,omitempty"`
+
+	// Page, PerPage and TotalPages describe the results in pages when the
+	// search asked for page/per_page instead of offset/limit
+	Page       int `json:"page,omitempty" xml:"page,omitempty"`
+	PerPage    int `json:"per_page,omitempty" xml:"per_page,omitempty"`
+	TotalPages int `json:"total_pages,omitempty" xml:"total_pages,omitempty"`
+
+	// TotalHits is the exact number of matches Meilisearch counted for an
+	// exhaustive search; Total is otherwise an estimate
+	TotalHits int `json:"total_hits,omitempty" xml:"total_hits,omitempty"`
+
+	// ErrorCode is one of the errCode constants when Success is false
+	ErrorCode string `json:"error_code,omitempty" xml:"error_code,omitempty"`
+
+	// Hits holds the unconverted Meilisearch hits in place of Results when
+	// the search asked for raw output. They have no fixed shape, so they are
+	// only available as JSON.
+	Hits []map[string]interface{} `json:"hits,omitempty" xml:"-"`
+
+	// Suggestion is a corrected spelling of the query, offered when
+	// suggest=true and the search found few results
+	Suggestion string `json:"suggestion,omitempty" xml:"suggestion,omitempty"`
+
+	// ProcessingTimeMs is the time Meilisearch spent on the search, TookMs the
+	// time the backend spent handling the whole request
+	ProcessingTimeMs int64 `json:"processing_time_ms" xml:"processing_time_ms"`
+	TookMs           int64 `json:"took_ms" xml:"took_ms"`
+}
+
+// MarshalJSON writes a successful search without matches with an empty
+// "results" list, or "hits" for raw output, so clients always get an array
+func (r SearchResponse) MarshalJSON() ([]byte, error) {
+	type response SearchResponse
+	switch {
+	case !r.Success || len(r.Results) > 0 || len(r.Hits) > 0:
+		return json.Marshal(response(r))
+	case r.Hits != nil:
+		return json.Marshal(struct {
+			response
+			Hits []map[string]interface{} `json:"hits"`
+		}{response(r), r.Hits})
+	default:
+		return json.Marshal(struct {
+			response
+			Results []SearchResult `json:"results"`
+		}{response(r), []SearchResult{}})
+	}
+}
+
+// MarshalXML writes the matches as
+// <attribute name="title"><match start="0" length="5"/></attribute> elements
+// in attribute order
+func (m MatchesPosition) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, attribute := range sortedKeys(m) {
+		element := struct {
+			Name    string          `xml:"name,attr"`
+			Matches []MatchPosition `xml:"match"`
+		}{attribute, m[attribute]}
+		if err := e.EncodeElement(element, xml.StartElement{Name: xml.Name{Local: "attribute"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// MarshalXML writes the counts as
+// <facet name="category"><value name="news" count="3"/></facet> elements in
+// facet and value order
+func (f FacetCounts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type facetValue struct {
+		Name  string `xml:"name,attr"`
+		Count int64  `xml:"count,attr"`
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, facet := range sortedKeys(f) {
+		element := struct {
+			Name   string       `xml:"name,attr"`
+			Values []facetValue `xml:"value"`
+		}{Name: facet}
+		for _, value := range sortedKeys(f[facet]) {
+			element.Values = append(element.Values, facetValue{Name: value, Count: f[facet][value]})
+		}
+		if err := e.EncodeElement(element, xml.StartElement{Name: xml.Name{Local: "facet"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// SearchParams holds the options for a single search request
+type SearchParams struct {
+	Query      string
+	Limit      int
+	Offset     int
+	Filter     string
+	Sort       []string
+	Facets     []string
+	Attributes []string
+
+	// Page is the 1-based page Limit and Offset were derived from, 0 when
+	// the search used offset/limit
+	Page int
+
+	// Exhaustive has Meilisearch count every match, paginating by page and
+	// hitsPerPage. Offset must be a multiple of Limit.
+	Exhaustive bool
+
+	// HighlightPreTag and HighlightPostTag wrap matched terms, <mark> and
+	// </mark> when empty. DisableHighlight turns highlighting off entirely.
+	HighlightPreTag  string
+	HighlightPostTag string
+	DisableHighlight bool
+
+	// CropLength is the number of words content is cropped to, 200 when zero.
+	// CropMarker replaces Meilisearch's default marker when set.
+	CropLength int
+	CropMarker string
+
+	// MatchingStrategy is "last" (drop query words from the end until
+	// documents match) or "all" (every word must match)
+	MatchingStrategy string
+
+	// Raw returns the Meilisearch hits as-is instead of SearchResults, so
+	// attributes outside SearchResult reach the client
+	Raw bool
+
+	// Embedder turns the search into a hybrid search with that embedder,
+	// weighting vector matches by SemanticRatio
+	Embedder      string
+	SemanticRatio float64
+
+	// ShowMatches adds the position of every match to each result
+	ShowMatches bool
+
+	// Suggest asks for a "did you mean" suggestion when results are few
+	Suggest bool
+
+	// Distinct returns at most one hit per value of this attribute
+	Distinct string
+
+	// SearchOn restricts the query to these searchable attributes
+	SearchOn []string
+
+	// Locales are the ISO 639-3 languages Meilisearch tokenizes the query
+	// as, detected when empty
+	Locales []string
+}
+
+// SearchRequestBody is the JSON body accepted by POST /search
+type SearchRequestBody struct {
+	Query      string   `json:"query"`
+	Limit      int      `json:"limit"`
+	Offset     int      `json:"offset"`
+	Page       int      `json:"page"`
+	PerPage    int      `json:"per_page"`
+	Filter     string   `json:"filter"`
+	Sort       []string `json:"sort"`
+	Facets     []string `json:"facets"`
+	Attributes []string `json:"attributes"`
+
+	HighlightPre  string `json:"highlight_pre"`
+	HighlightPost string `json:"highlight_post"`
+	Highlight     *bool  `json:"highlight"`
+
+	CropLength int    `json:"crop_length"`
+	CropMarker string `json:"crop_marker"`
+
+	MatchingStrategy string `json:"matching_strategy"`
+
+	Raw bool `json:"raw"`
+
+	ShowMatches bool `json:"show_matches"`
+	Suggest     bool `json:"suggest"`
+	Exhaustive  bool `json:"exhaustive"`
+
+	From      string `json:"from"`
+	To        string `json:"to"`
+	DateField string `json:"date_field"`
+
+	Distinct string `json:"distinct"`
+	Browse   bool   `json:"browse"`
+
+	Lang     string   `json:"lang"`
+	Safe     *bool    `json:"safe"`
+	SearchOn []string `json:"search_on"`
+
+	// Lat and Lng are the center of a geo search, Radius its size in meters
+	Lat    *float64 `json:"lat"`
+	Lng    *float64 `json:"lng"`
+	Radius float64  `json:"radius"`
+}
+
+// searchHandler serves GET /search from query string parameters
+func searchHandler(searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := normalizeQuery(c.Query("q"), config.MaxQueryLength)
+		if err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidQuery,
+			})
+			return
+		}
+
+		// Parse browse parameter, browse=true lists documents without a query
+		browse := false
+		if browseStr := c.Query("browse"); browseStr != "" {
+			browse, err = strconv.ParseBool(browseStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'browse' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+		if query == "" && !browse {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query parameter 'q' is required, or pass browse=true to list documents",
+				ErrorCode: errCodeMissingQuery,
+			})
+			return
+		}
+		if onlyExclusions(query) && !browse {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query parameter 'q' needs a term besides -exclusions, or pass browse=true to list documents",
+				ErrorCode: errCodeMissingQuery,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse limit parameter
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil {
+			limit = 0
+		}
+		limit = clampLimit(limit, config.DefaultSearchLimit, config.MaxSearchLimit)
+
+		// Parse offset parameter
+		offsetStr := c.DefaultQuery("offset", "0")
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		// Parse page/per_page parameters, which replace offset/limit
+		page := 0
+		_, hasPage := c.GetQuery("page")
+		_, hasPerPage := c.GetQuery("per_page")
+		if hasPage || hasPerPage {
+			_, hasOffset := c.GetQuery("offset")
+			_, hasLimit := c.GetQuery("limit")
+			if hasOffset || hasLimit {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Use either page/per_page or offset/limit, not both",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+
+			page = 1
+			if hasPage {
+				page, err = strconv.Atoi(c.Query("page"))
+				if err != nil || page < 1 {
+					writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+						Success:   false,
+						Error:     "Query parameter 'page' must be a positive integer",
+						ErrorCode: errCodeInvalidParameter,
+						Query:     query,
+					})
+					return
+				}
+			}
+			perPage, err := strconv.Atoi(c.Query("per_page"))
+			if err != nil {
+				perPage = 0
+			}
+			offset, limit = pageBounds(page, perPage, config)
+		}
+
+		// Parse filter parameter
+		filter, hasFilter := c.GetQuery("filter")
+		filter = strings.TrimSpace(filter)
+		if hasFilter && filter == "" {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query parameter 'filter' must not be empty",
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse from/to parameters into a date range filter
+		filter, err = withDateRange(filter, c.Query("date_field"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse lang parameter, e.g. "fr", into a filter on the lang attribute
+		lang := c.Query("lang")
+		filter, err = withLanguage(filter, lang)
+		if err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse safe parameter, safe search is on unless safe=false
+		safe := true
+		if safeStr := c.Query("safe"); safeStr != "" {
+			safe, err = strconv.ParseBool(safeStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'safe' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+		filter = withSafeSearch(filter, safe, config)
+
+		// Parse lat/lng/radius parameters into a distance filter, sorting
+		// hits by distance
+		var geoSort string
+		lat, lng, radius, err := geoQuery(c)
+		if err == nil {
+			filter, geoSort, err = withGeo(filter, lat, lng, radius)
+		}
+		if err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse distinct parameter, e.g. "url"
+		distinct := c.Query("distinct")
+		if distinct != "" && !attributeNamePattern.MatchString(distinct) {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Invalid distinct attribute %q", distinct),
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse sort parameter, e.g. "date:desc,title:asc"
+		sort := splitList(c.Query("sort"))
+		if geoSort != "" {
+			sort = append(sort, geoSort)
+		}
+
+		// Parse facets parameter, e.g. "category,language"
+		facets := splitList(c.Query("facets"))
+
+		// Parse search_on parameter, e.g. "title"
+		searchOn := splitList(c.Query("search_on"))
+		if err := validateSearchOn(searchOn); err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidSearchOn,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse highlight parameter, highlighting is on unless highlight=false
+		highlight := true
+		if highlightStr := c.Query("highlight"); highlightStr != "" {
+			highlight, err = strconv.ParseBool(highlightStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'highlight' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		// Parse crop_length parameter
+		cropLength := 0
+		if cropStr := c.Query("crop_length"); cropStr != "" {
+			cropLength, err = strconv.Atoi(cropStr)
+			if err != nil || cropLength < 1 {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'crop_length' must be a positive integer",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		// Parse matching_strategy parameter
+		matchingStrategy := c.DefaultQuery("matching_strategy", "last")
+		if !validMatchingStrategy(matchingStrategy) {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query parameter 'matching_strategy' must be 'last' or 'all'",
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse raw parameter
+		raw := false
+		if rawStr := c.Query("raw"); rawStr != "" {
+			raw, err = strconv.ParseBool(rawStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'raw' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		// Parse show_matches parameter
+		showMatches := false
+		if showStr := c.Query("show_matches"); showStr != "" {
+			showMatches, err = strconv.ParseBool(showStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'show_matches' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		// Parse format parameter, format=csv downloads the results
+		if format := c.DefaultQuery("format", "json"); format != "json" && format != "csv" {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query parameter 'format' must be 'json' or 'csv'",
+				ErrorCode: errCodeInvalidParameter,
+				Query:     query,
+			})
+			return
+		}
+
+		// Parse suggest parameter
+		suggest := false
+		if suggestStr := c.Query("suggest"); suggestStr != "" {
+			suggest, err = strconv.ParseBool(suggestStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'suggest' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		// Parse exhaustive parameter
+		exhaustive := false
+		if exhaustiveStr := c.Query("exhaustive"); exhaustiveStr != "" {
+			exhaustive, err = strconv.ParseBool(exhaustiveStr)
+			if err != nil {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'exhaustive' must be true or false",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+			if exhaustive && offset%limit != 0 {
+				writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+					Success:   false,
+					Error:     "Query parameter 'offset' must be a multiple of 'limit' when exhaustive=true, or use page/per_page",
+					ErrorCode: errCodeInvalidParameter,
+					Query:     query,
+				})
+				return
+			}
+		}
+
+		useLanguageIndex(c, lang)
+		runSearch(c, searcher, cache, config, SearchParams{
+			Query:            query,
+			Limit:            limit,
+			Offset:           offset,
+			Page:             page,
+			Exhaustive:       exhaustive,
+			Filter:           filter,
+			Sort:             sort,
+			Facets:           facets,
+			Attributes:       splitList(c.Query("attributes")),
+			HighlightPreTag:  c.Query("highlight_pre"),
+			HighlightPostTag: c.Query("highlight_post"),
+			DisableHighlight: !highlight,
+			CropLength:       cropLength,
+			CropMarker:       c.Query("crop_marker"),
+			MatchingStrategy: matchingStrategy,
+			Raw:              raw,
+			ShowMatches:      showMatches,
+			Suggest:          suggest,
+			Distinct:         distinct,
+			SearchOn:         searchOn,
+			Locales:          searchLocales(config, lang),
+		})
+	}
+}
+
+// postSearchHandler serves POST /search for queries that combine filters,
+// sorts, facets and attribute lists
+func postSearchHandler(searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body SearchRequestBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Invalid request body: %v", err),
+				ErrorCode: errCodeInvalidBody,
+			})
+			return
+		}
+
+		params, err := body.searchParams(config)
+		if err != nil {
+			writeSearchResponse(c, http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errorCode(err, errCodeInvalidParameter),
+				Query:     body.Query,
+			})
+			return
+		}
+
+		useLanguageIndex(c, body.Lang)
+		runSearch(c, searcher, cache, config, params)
+	}
+}
+
+// searchParams validates the body and turns it into SearchParams, applying
+// the same defaults and limits as GET /search
+func (body SearchRequestBody) searchParams(config *Config) (SearchParams, error) {
+	query, err := normalizeQuery(body.Query, config.MaxQueryLength)
+	if err != nil {
+		return SearchParams{}, &apiError{code: errCodeInvalidQuery, message: err.Error()}
+	}
+	if query == "" && !body.Browse {
+		return SearchParams{}, newAPIError(errCodeMissingQuery, "Field 'query' is required, or set 'browse' to list documents")
+	}
+	if onlyExclusions(query) && !body.Browse {
+		return SearchParams{}, newAPIError(errCodeMissingQuery, "Field 'query' needs a term besides -exclusions, or set 'browse' to list documents")
+	}
+	body.Query = query
+
+	if body.Page != 0 || body.PerPage != 0 {
+		if body.Offset != 0 || body.Limit != 0 {
+			return SearchParams{}, newAPIError(errCodeInvalidParameter, "Use either page/per_page or offset/limit, not both")
+		}
+		if body.Page == 0 {
+			body.Page = 1
+		}
+		if body.Page < 1 {
+			return SearchParams{}, newAPIError(errCodeInvalidParameter, "Field 'page' must be a positive integer")
+		}
+		body.Offset, body.Limit = pageBounds(body.Page, body.PerPage, config)
+	}
+	body.Limit = clampLimit(body.Limit, config.DefaultSearchLimit, config.MaxSearchLimit)
+	if body.Offset < 0 {
+		body.Offset = 0
+	}
+	if body.Exhaustive && body.Offset%body.Limit != 0 {
+		return SearchParams{}, newAPIError(errCodeInvalidParameter, "Field 'offset' must be a multiple of 'limit' when 'exhaustive' is set, or use page/per_page")
+	}
+	if body.CropLength < 0 {
+		return SearchParams{}, newAPIError(errCodeInvalidParameter, "Field 'crop_length' must be a positive integer")
+	}
+	if body.MatchingStrategy == "" {
+		body.MatchingStrategy = "last"
+	}
+	if !validMatchingStrategy(body.MatchingStrategy) {
+		return SearchParams{}, newAPIError(errCodeInvalidParameter, "Field 'matching_strategy' must be 'last' or 'all'")
+	}
+	if body.Distinct != "" && !attributeNamePattern.MatchString(body.Distinct) {
+		return SearchParams{}, newAPIError(errCodeInvalidParameter, "Invalid distinct attribute %q", body.Distinct)
+	}
+	if err := validateSearchOn(body.SearchOn); err != nil {
+		return SearchParams{}, &apiError{code: errCodeInvalidSearchOn, message: err.Error()}
+	}
+	filter, err := withDateRange(strings.TrimSpace(body.Filter), body.DateField, body.From, body.To)
+	if err != nil {
+		return SearchParams{}, err
+	}
+	if filter, err = withLanguage(filter, body.Lang); err != nil {
+		return SearchParams{}, err
+	}
+	filter = withSafeSearch(filter, body.Safe == nil || *body.Safe, config)
+	filter, geoSort, err := withGeo(filter, body.Lat, body.Lng, body.Radius)
+	if err != nil {
+		return SearchParams{}, err
+	}
+	if geoSort != "" {
+		body.Sort = append(body.Sort, geoSort)
+	}
+
+	return SearchParams{
+		Query:      body.Query,
+		Limit:      body.Limit,
+		Offset:     body.Offset,
+		Page:       body.Page,
+		Exhaustive: body.Exhaustive,
+		Filter:     filter,
+		Sort:       body.Sort,
+		Facets:     body.Facets,
+		Attributes: body.Attributes,
+
+		HighlightPreTag:  body.HighlightPre,
+		HighlightPostTag: body.HighlightPost,
+		DisableHighlight: body.Highlight != nil && !*body.Highlight,
+		CropLength:       body.CropLength,
+		CropMarker:       body.CropMarker,
+		MatchingStrategy: body.MatchingStrategy,
+		Raw:              body.Raw,
+		ShowMatches:      body.ShowMatches,
+		Suggest:          body.Suggest,
+		Distinct:         body.Distinct,
+		SearchOn:         body.SearchOn,
+		Locales:          searchLocales(config, body.Lang),
+	}, nil
+}
+
+// runSearch performs the search and writes the response, turning timeouts and
+// requests Meilisearch rejects into 504 and 400 responses. Successful
+// responses are served from and stored in the query cache.
+func runSearch(c *gin.Context, searcher *MeiliSearcher, cache Cache, config *Config, params SearchParams) {
+	c.Set(logKeyQuery, params.Query)
+
+	status, response, cacheStatus := executeSearch(c.Request.Context(), searcher, cache, config, indexFor(c, config), params)
+	if cache != nil {
+		c.Header("X-Cache", cacheStatus)
+	}
+
+	if response.Success {
+		c.Set(logKeyResults, response.Count)
+		c.Set(analyticsKeyTotal, response.Total)
+		setPaginationHeaders(c, response)
+
+		etag := searchETag(response, searchFormat(c, response))
+		c.Header("ETag", etag)
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	writeSearchResponse(c, status, response)
+}
+
+// writeSearchResponse writes response as XML when the Accept header prefers
+// application/xml or text/xml, and as JSON otherwise. Successful GET
+// searches with format=csv are written as CSV.
+func writeSearchResponse(c *gin.Context, status int, response *SearchResponse) {
+	switch searchFormat(c, response) {
+	case "csv":
+		writeSearchCSV(c, status, response)
+	case "xml":
+		c.Writer.Header().Add("Vary", "Accept")
+		c.XML(status, response)
+	default:
+		c.Writer.Header().Add("Vary", "Accept")
+		c.JSON(status, response)
+	}
+}
+
+// searchFormat returns the representation writeSearchResponse uses for
+// response: "csv", "xml" or "json"
+func searchFormat(c *gin.Context, response *SearchResponse) string {
+	if response.Success && c.Request.Method == http.MethodGet && c.Query("format") == "csv" {
+		return "csv"
+	}
+	return negotiateFormat(c.GetHeader("Accept"))
+}
+
+// negotiateFormat returns "xml" when an Accept header prefers XML to JSON and
+// "json" otherwise. The media type with the highest q-value wins, the first
+// listed among equals; wildcards stand for JSON.
+func negotiateFormat(accept string) string {
+	format, best := "json", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		candidate := ""
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case gin.MIMEXML, gin.MIMEXML2:
+			candidate = "xml"
+		case gin.MIMEJSON, "application/*", "*/*":
+			candidate = "json"
+		default:
+			continue
+		}
+		if q := quality(params); q > best {
+			format, best = candidate, q
+		}
+	}
+	return format
+}
+
+// quality returns the q-value among media type parameters such as
+// "charset=utf-8; q=0.5", 1 when there is none
+func quality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(name), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return 0
+			}
+			return q
+		}
+	}
+	return 1
+}
+
+// searchETag returns a weak ETag for response in the given format. Timings are
+// left out so that repeating a search yields the same ETag as long as the
+// results are the same.
+func searchETag(response *SearchResponse, format string) string {
+	stable := *response
+	stable.TookMs = 0
+	stable.ProcessingTimeMs = 0
+
+	payload, err := json.Marshal(&stable)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(append([]byte(format+"\n"), payload...))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the
+// weak comparison If-None-Match calls for
+func etagMatches(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Values of the X-Cache header of search responses
+const (
+	cacheHit   = "HIT"
+	cacheMiss  = "MISS"
+	cacheStale = "STALE"
+)
+
+// executeSearch runs one search against indexName and returns the HTTP status
+// and response to send for it, and how the cache served it
+func executeSearch(ctx context.Context, searcher *MeiliSearcher, cache Cache, config *Config, indexName string, params SearchParams) (int, *SearchResponse, string) {
+	start := time.Now()
+
+	// Blocked queries never reach Meilisearch
+	if config.Blocklist.blocks(params.Query) {
+		slog.Info("Blocked query", "query", params.Query)
+		if config.BlocklistAction == "reject" {
+			return http.StatusBadRequest, &SearchResponse{
+				Success:   false,
+				Error:     "Query contains a blocked term",
+				ErrorCode: errCodeBlockedQuery,
+				Query:     params.Query,
+			}, cacheMiss
+		}
+		response := &SearchResponse{
+			Success: true,
+			Query:   params.Query,
+			Offset:  params.Offset,
+			Limit:   params.Limit,
+			TookMs:  time.Since(start).Milliseconds(),
+		}
+		if params.Raw {
+			response.Hits = []map[string]interface{}{}
+		}
+		return http.StatusOK, response, cacheMiss
+	}
+
+	cacheKey := searchCacheKey(indexName, params)
+	if cache != nil {
+		if cached, ok := cache.Get(cacheKey); ok {
+			// Copy so the cached response is never modified. Queries that
+			// differ only in case or spacing share an entry, so echo this one.
+			response := *cached
+			response.Query = params.Query
+			response.TookMs = time.Since(start).Milliseconds()
+			return http.StatusOK, &response, cacheHit
+		}
+	}
+
+	// Perform search, giving up once the search timeout elapses
+	ctx, cancel := context.WithTimeout(ctx, config.SearchTimeout)
+	defer cancel()
+
+	searchCtx, span := startSpan(ctx, "performSearch")
+	span.SetAttributes(
+		attribute.String("db.system", "meilisearch"),
+		attribute.String("search.index", indexName),
+		attribute.Int("search.limit", params.Limit),
+		attribute.Int("search.offset", params.Offset),
+	)
+
+	var response *SearchResponse
+	err := withRetry(searchCtx, config.MeiliMaxRetries, config.MeiliRetryBaseDelay, func() error {
+		var err error
+		response, err = performSearch(searchCtx, searcher, indexName, params)
+		return err
+	})
+	if response != nil {
+		span.SetAttributes(attribute.Int("search.total", response.Total))
+	}
+	endSpan(span, err)
+
+	if err != nil {
+		// With STALE_ON_ERROR an outage serves the last good response
+		// instead, but a request Meilisearch rejects with a 4xx still fails
+		var meiliErr *MeiliError
+		rejected := errors.As(err, &meiliErr) && meiliErr.StatusCode >= 400 && meiliErr.StatusCode < 500
+		if config.StaleOnError && cache != nil && !rejected {
+			if stale, ok := cache.GetStale(cacheKey); ok {
+				slog.Warn("Search failed, serving stale response", "query", params.Query, "error", err)
+				response := *stale
+				response.Query = params.Query
+				response.TookMs = time.Since(start).Milliseconds()
+				return http.StatusOK, &response, cacheStale
+			}
+		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("Search timed out", "query", params.Query, "timeout", config.SearchTimeout.String(), "error", err)
+			return http.StatusGatewayTimeout, &SearchResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Search timed out after %s", config.SearchTimeout),
+				ErrorCode: errCodeTimeout,
+				Query:     params.Query,
+			}, cacheMiss
+		}
+
+		if errors.Is(err, errCircuitOpen) {
+			return http.StatusServiceUnavailable, &SearchResponse{
+				Success:   false,
+				Error:     "Search is temporarily unavailable, please retry later",
+				ErrorCode: errCodeMeiliUnavailable,
+				Query:     params.Query,
+			}, cacheMiss
+		}
+
+		if rejected {
+			message := fmt.Sprintf("Invalid search request: %s", meiliErr.Message)
+			code := errCodeInvalidRequest
+			switch meiliErr.Code {
+			case "invalid_search_filter":
+				message = fmt.Sprintf("Invalid filter: %s", meiliErr.Message)
+				code = errCodeInvalidFilter
+			case "invalid_search_sort":
+				message = fmt.Sprintf("Invalid sort: %s", meiliErr.Message)
+				code = errCodeInvalidSort
+			case "invalid_search_distinct":
+				message = fmt.Sprintf("Invalid distinct attribute, it must be one of the index's filterable attributes: %s", meiliErr.Message)
+				code = errCodeInvalidDistinct
+			case "invalid_search_attributes_to_search_on":
+				message = fmt.Sprintf("Invalid search_on attribute, it must be one of the index's searchable attributes: %s", meiliErr.Message)
+				code = errCodeInvalidSearchOn
+			case "index_not_found":
+				message = fmt.Sprintf("Index not found: %s", meiliErr.Message)
+				code = errCodeNotFound
+			}
+			return meiliErr.StatusCode, &SearchResponse{
+				Success:   false,
+				Error:     message,
+				ErrorCode: code,
+				Query:     params.Query,
+			}, cacheMiss
+		}
+
+		slog.Error("Search failed", "query", params.Query, "error", err)
+		return http.StatusInternalServerError, &SearchResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Search failed: %v", err),
+			ErrorCode: errCodeSearchFailed,
+			Query:     params.Query,
+		}, cacheMiss
+	}
+
+	if params.Suggest && response.Total < config.DidYouMeanThreshold {
+		response.Suggestion = didYouMean(ctx, searcher, indexName, params.Query)
+	}
+
+	if config.MaxContentLength > 0 {
+		for i := range response.Results {
+			response.Results[i].Content = truncateRunes(response.Results[i].Content, config.MaxContentLength)
+		}
+		for _, hit := range response.Hits {
+			if content, ok := hit["content"].(string); ok {
+				hit["content"] = truncateRunes(content, config.MaxContentLength)
+			}
+		}
+	}
+
+	response.TookMs = time.Since(start).Milliseconds()
+	if cache != nil {
+		cache.Set(cacheKey, response)
+	}
+	return http.StatusOK, response, cacheMiss
+}
+
+func performSearch(ctx context.Context, searcher *MeiliSearcher, indexName string, params SearchParams) (*SearchResponse, error) {
+	request := params
+	request.Query = meiliQuery(params.Query)
+
+	searchRes, err := searcher.Search(ctx, indexName, buildSearchRequest(request))
+	if err != nil {
+		return nil, err
+	}
+
+	total := int(searchRes.EstimatedTotalHits)
+	if params.Exhaustive {
+		total = int(searchRes.TotalHits)
+	}
+
+	hits := searchRes.Hits
+	response := &SearchResponse{
+		Success:          true,
+		Query:            params.Query,
+		Total:            total,
+		Count:            len(hits),
+		Offset:           params.Offset,
+		Limit:            params.Limit,
+		ProcessingTimeMs: searchRes.ProcessingTimeMs,
+	}
+	if params.Raw {
+		response.Hits = hits
+	} else {
+		response.Results = toSearchResults(hits)
+	}
+
+	if params.Page > 0 {
+		response.Page = params.Page
+		response.PerPage = params.Limit
+		response.TotalPages = totalPages(response.Total, params.Limit)
+	}
+	if params.Exhaustive {
+		response.TotalPages = int(searchRes.TotalPages)
+		response.TotalHits = int(searchRes.TotalHits)
+	}
+
+	// Only report facet counts when they were asked for
+	if len(params.Facets) > 0 {
+		response.Facets = searchRes.FacetDistribution
+	}
+
+	return response, nil
+}
+
+// buildSearchRequest turns params into the body of a Meilisearch search
+func buildSearchRequest(params SearchParams) map[string]interface{} {
+	request := map[string]interface{}{
+		"q":                params.Query,
+		"limit":            params.Limit,
+		"offset":           params.Offset,
+		"attributesToCrop": []string{"content"},
+		"cropLength":       200,
+		"showRankingScore": true,
+	}
+	if params.Exhaustive {
+		// Meilisearch only counts every match in page mode
+		delete(request, "limit")
+		delete(request, "offset")
+		request["hitsPerPage"] = params.Limit
+		request["page"] = params.Offset/params.Limit + 1
+	}
+	if params.ShowMatches {
+		request["showMatchesPosition"] = true
+	}
+	if params.Distinct != "" {
+		request["distinct"] = params.Distinct
+	}
+	if len(params.Locales) > 0 {
+		request["locales"] = params.Locales
+	}
+	if len(params.SearchOn) > 0 {
+		request["attributesToSearchOn"] = params.SearchOn
+	}
+	if params.Embedder != "" {
+		request["hybrid"] = map[string]interface{}{
+			"embedder":      params.Embedder,
+			"semanticRatio": params.SemanticRatio,
+		}
+	}
+	if params.MatchingStrategy != "" {
+		request["matchingStrategy"] = params.MatchingStrategy
+	}
+	if params.CropLength > 0 {
+		request["cropLength"] = params.CropLength
+	}
+	if params.CropMarker != "" {
+		request["cropMarker"] = params.CropMarker
+	}
+	if !params.DisableHighlight {
+		preTag, postTag := "<mark>", "</mark>"
+		if params.HighlightPreTag != "" {
+			preTag = params.HighlightPreTag
+		}
+		if params.HighlightPostTag != "" {
+			postTag = params.HighlightPostTag
+		}
+		request["attributesToHighlight"] = []string{"title", "content"}
+		request["highlightPreTag"] = preTag
+		request["highlightPostTag"] = postTag
+	}
+	if len(params.Attributes) > 0 {
+		request["attributesToRetrieve"] = params.Attributes
+	} else {
+		request["attributesToRetrieve"] = []string{"*"}
+	}
+	if params.Filter != "" {
+		request["filter"] = params.Filter
+	}
+	if len(params.Sort) > 0 {
+		request["sort"] = params.Sort
+	}
+	if len(params.Facets) > 0 {
+		request["facets"] = params.Facets
+	}
+	return request
+}
+
+// validMatchingStrategy reports whether Meilisearch accepts strategy
+func validMatchingStrategy(strategy string) bool {
+	return strategy == "last" || strategy == "all"
+}
+
+// toSearchResults converts raw Meilisearch hits into SearchResults
+func toSearchResults(hits []map[string]interface{}) []SearchResult {
+	var results []SearchResult
+	for i, doc := range hits {
+		score, ok := doc["_rankingScore"].(float64)
+		if !ok {
+			score = float64(len(hits) - i) // Fall back to position when no ranking score is returned
+		}
+
+		result := SearchResult{
+			ID:      getString(doc, "id"),
+			Title:   getString(doc, "title"),
+			Content: getString(doc, "content"),
+			URL:     getString(doc, "url"),
+			Score:   score,
+		}
+
+		// Highlighted and cropped values live under _formatted
+		result.HighlightedTitle = result.Title
+		result.HighlightedContent = result.Content
+		if formatted, ok := doc["_formatted"].(map[string]interface{}); ok {
+			if title := getString(formatted, "title"); title != "" {
+				result.HighlightedTitle = title
+			}
+			if content := getString(formatted, "content"); content != "" {
+				result.HighlightedContent = content
+			}
+		}
+
+		if positions, ok := doc["_matchesPosition"].(map[string]interface{}); ok {
+			result.MatchesPosition = toMatchesPosition(positions)
+		}
+
+		// Meilisearch's cropped and highlighted content makes the snippet,
+		// when it formatted the hit
+		if formatted, ok := doc["_formatted"].(map[string]interface{}); ok && getString(formatted, "content") != "" {
+			result.Snippet = getString(formatted, "content")
+		} else {
+			result.Snippet = localSnippet(result.Content, result.MatchesPosition["content"])
+		}
+
+		results = append(results, result)
+	}
+	return results
+}
+
+// toMatchesPosition converts a raw _matchesPosition object, which maps each
+// attribute to a list of {start, length} objects
+func toMatchesPosition(raw map[string]interface{}) map[string][]MatchPosition {
+	positions := make(map[string][]MatchPosition, len(raw))
+	for attribute, value := range raw {
+		matches, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, match := range matches {
+			m, ok := match.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			start, _ := m["start"].(float64)
+			length, _ := m["length"].(float64)
+			positions[attribute] = append(positions[attribute], MatchPosition{
+				Start:  int(start),
+				Length: int(length),
+			})
+		}
+	}
+	return positions
+}
+
+// getString returns the value stored under key as a string, formatting
+// numbers and booleans so documents with numeric IDs keep their IDs
+func getString(m map[string]interface{}, key string) string {
+	switch val := m[key].(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case bool:
+		return strconv.FormatBool(val)
+	case json.Number:
+		return val.String()
+	}
+	return ""
+}
+
+// attributeNamePattern matches attribute names that are safe to splice into
+// a filter expression
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// withDateRange adds a range on dateField (default "date") to filter for the
+// from and to bounds, either of which may be empty. Bounds are RFC 3339
+// timestamps or Unix seconds, and are compared as Unix seconds, so dateField
+// must hold Unix timestamps.
+func withDateRange(filter, dateField, from, to string) (string, error) {
+	if from == "" && to == "" {
+		return filter, nil
+	}
+
+	if dateField == "" {
+		dateField = "date"
+	}
+	if !attributeNamePattern.MatchString(dateField) {
+		return "", fmt.Errorf("Invalid date_field %q", dateField)
+	}
+
+	var conditions []string
+	var fromUnix int64
+	if from != "" {
+		var err error
+		if fromUnix, err = parseTimestamp(from); err != nil {
+			return "", fmt.Errorf("Invalid 'from' timestamp %q, expected RFC 3339 or Unix seconds", from)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s >= %d", dateField, fromUnix))
+	}
+	if to != "" {
+		toUnix, err := parseTimestamp(to)
+		if err != nil {
+			return "", fmt.Errorf("Invalid 'to' timestamp %q, expected RFC 3339 or Unix seconds", to)
+		}
+		if from != "" && toUnix < fromUnix {
+			return "", fmt.Errorf("'from' must not be after 'to'")
+		}
+		conditions = append(conditions, fmt.Sprintf("%s <= %d", dateField, toUnix))
+	}
+
+	dateFilter := strings.Join(conditions, " AND ")
+	if filter == "" {
+		return dateFilter, nil
+	}
+	return "(" + filter + ") AND " + dateFilter, nil
+}
+
+// validateSearchOn checks the search_on attribute names; Meilisearch itself
+// rejects attributes that are not searchable
+func validateSearchOn(attributes []string) error {
+	for _, attribute := range attributes {
+		if !attributeNamePattern.MatchString(attribute) {
+			return fmt.Errorf("Invalid search_on attribute %q", attribute)
+		}
+	}
+	return nil
+}
+
+// withSafeSearch excludes the documents flagged by SAFE_SEARCH_ATTRIBUTE from
+// filter when SAFE_SEARCH is on and safe is true
+func withSafeSearch(filter string, safe bool, config *Config) string {
+	if !config.SafeSearch || !safe {
+		return filter
+	}
+
+	// != also matches documents without the attribute
+	safeFilter := config.SafeSearchAttribute + " != true"
+	if filter == "" {
+		return safeFilter
+	}
+	return "(" + filter + ") AND " + safeFilter
+}
+
+// parseTimestamp reads an RFC 3339 timestamp or a count of Unix seconds
+func parseTimestamp(value string) (int64, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// clampLimit returns the number of hits to request: defaultLimit when limit
+// is not positive, and at most maxLimit
+func clampLimit(limit, defaultLimit, maxLimit int) int {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	return min(limit, maxLimit)
+}
+
+// normalizeQuery trims query, drops control characters and collapses runs of
+// whitespace into single spaces. It fails when the result is longer than
+// maxLength characters.
+func normalizeQuery(query string, maxLength int) (string, error) {
+	query = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, query)
+	query = collapseWhitespace(query)
+
+	if utf8.RuneCountInString(query) > maxLength {
+		return "", fmt.Errorf("Query must be at most %d characters long", maxLength)
+	}
+	return query, nil
+}
+
+// truncateRunes shortens s to at most maxLength characters, ending it with an
+// ellipsis when it was cut
+func truncateRunes(s string, maxLength int) string {
+	if utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxLength-1]) + "…"
+}
+
+// splitList splits a comma-separated query value, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,2484 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const searchPath = "/indexes/documents/search"
+
+// newSearchRouter mounts GET and POST /search the way the API does, in front
+// of searcher
+func newSearchRouter(searcher *MeiliSearcher, cache Cache, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/search", indexParam(config), languageIndex(config), searchHandler(searcher, cache, config))
+	router.POST("/search", indexParam(config), languageIndex(config), postSearchHandler(searcher, cache, config))
+	return router
+}
+
+func TestSearchReturnsRankingScore(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(
+		map[string]interface{}{"id": "a", "title": "Best", "_rankingScore": 0.97},
+		map[string]interface{}{"id": "b", "title": "Good", "_rankingScore": 0.61},
+		map[string]interface{}{"id": "c", "title": "Weak", "_rankingScore": 0.12},
+	))
+	config := testConfig(meili.URL)
+	router := newSearchRouter(meili.searcher(), nil, config)
+
+	w := serve(router, http.MethodGet, "/search?q=go", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	if request := meili.last(t, http.MethodPost, searchPath).JSON(t); request["showRankingScore"] != true {
+		t.Errorf("showRankingScore = %v, want true", request["showRankingScore"])
+	}
+
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	want := []float64{0.97, 0.61, 0.12}
+	if len(response.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(response.Results), len(want))
+	}
+	for i, result := range response.Results {
+		if result.Score != want[i] {
+			t.Errorf("result %d score = %v, want %v", i, result.Score, want[i])
+		}
+		if i > 0 && result.Score > response.Results[i-1].Score {
+			t.Errorf("result %d score %v is above the previous %v", i, result.Score, response.Results[i-1].Score)
+		}
+	}
+}
+
+func TestToSearchResultsScore(t *testing.T) {
+	tests := []struct {
+		name string
+		hits []map[string]interface{}
+		want []float64
+	}{
+		{
+			name: "ranking score",
+			hits: []map[string]interface{}{
+				{"id": "a", "_rankingScore": 0.9},
+				{"id": "b", "_rankingScore": 0.4},
+			},
+			want: []float64{0.9, 0.4},
+		},
+		{
+			name: "falls back to position",
+			hits: []map[string]interface{}{{"id": "a"}, {"id": "b"}, {"id": "c"}},
+			want: []float64{3, 2, 1},
+		},
+		{
+			name: "non-numeric score",
+			hits: []map[string]interface{}{{"id": "a", "_rankingScore": "high"}},
+			want: []float64{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := toSearchResults(tt.hits)
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.want))
+			}
+			for i, result := range results {
+				if result.Score != tt.want[i] {
+					t.Errorf("result %d score = %v, want %v", i, result.Score, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// seededIndex answers searches from docs like Meilisearch would for an
+// empty query: it honors offset and limit, "attribute = value" filters joined
+// by AND and numeric or string sorts, and reports the full match count and
+// the facet distribution of every match
+func seededIndex(docs []map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Offset int      `json:"offset"`
+			Limit  int      `json:"limit"`
+			Filter string   `json:"filter"`
+			Sort   []string `json:"sort"`
+			Facets []string `json:"facets"`
+
+			AttributesToRetrieve []string `json:"attributesToRetrieve"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error(), "code": "bad_request"})
+			return
+		}
+
+		var matches []map[string]interface{}
+		for _, doc := range docs {
+			if matchesFilter(doc, request.Filter) {
+				matches = append(matches, doc)
+			}
+		}
+		for i := len(request.Sort) - 1; i >= 0; i-- {
+			field, direction, _ := strings.Cut(request.Sort[i], ":")
+			sort.SliceStable(matches, func(a, b int) bool {
+				if direction == "desc" {
+					a, b = b, a
+				}
+				return lessValue(matches[a][field], matches[b][field])
+			})
+		}
+
+		page := []map[string]interface{}{}
+		if request.Offset < len(matches) {
+			page = matches[request.Offset:min(request.Offset+request.Limit, len(matches))]
+		}
+		response := map[string]interface{}{
+			"hits":               retrieve(page, request.AttributesToRetrieve),
+			"estimatedTotalHits": len(matches),
+			"processingTimeMs":   1,
+		}
+		if len(request.Facets) > 0 {
+			distribution := map[string]map[string]int64{}
+			for _, facet := range request.Facets {
+				distribution[facet] = map[string]int64{}
+				for _, doc := range matches {
+					if value, ok := doc[facet]; ok {
+						distribution[facet][fmt.Sprint(value)]++
+					}
+				}
+			}
+			response["facetDistribution"] = distribution
+		}
+		writeFakeJSON(w, http.StatusOK, response)
+	}
+}
+
+// retrieve keeps only the given attributes of each hit, or every attribute
+// for "*"
+func retrieve(hits []map[string]interface{}, attributes []string) []map[string]interface{} {
+	if len(attributes) == 0 || slices.Contains(attributes, "*") {
+		return hits
+	}
+	projected := make([]map[string]interface{}, len(hits))
+	for i, hit := range hits {
+		projected[i] = map[string]interface{}{}
+		for _, attribute := range attributes {
+			if value, ok := hit[attribute]; ok {
+				projected[i][attribute] = value
+			}
+		}
+	}
+	return projected
+}
+
+// lessValue orders two document values, numerically when both are numbers
+func lessValue(a, b interface{}) bool {
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if xok && yok {
+		return x < y
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// matchesFilter evaluates the "attribute = value AND attribute != value ..."
+// subset of the Meilisearch filter syntax against doc
+func matchesFilter(doc map[string]interface{}, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, condition := range strings.Split(filter, " AND ") {
+		condition = strings.Trim(condition, "() ")
+		if args, ok := strings.CutPrefix(condition, "_geoRadius("); ok {
+			point := parseNumbers(args)
+			if len(point) != 3 {
+				return false
+			}
+			distance, ok := geoDistance(doc, point[0], point[1])
+			if !ok || distance > point[2] {
+				return false
+			}
+			continue
+		}
+		attribute, value, equal := strings.Cut(condition, " = ")
+		if !equal {
+			var ok bool
+			if attribute, value, ok = strings.Cut(condition, " != "); !ok {
+				return false
+			}
+		}
+		if (fmt.Sprint(doc[strings.TrimSpace(attribute)]) == strings.Trim(strings.TrimSpace(value), `"'`)) != equal {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumbers parses a comma-separated list of numbers, e.g. the arguments
+// of _geoRadius
+func parseNumbers(list string) []float64 {
+	var numbers []float64
+	for _, field := range strings.Split(list, ",") {
+		number, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// geoDistance returns the distance in meters between the _geo point of doc
+// and lat, lng, and false when doc has no _geo point
+func geoDistance(doc map[string]interface{}, lat, lng float64) (float64, bool) {
+	geo, _ := doc["_geo"].(map[string]interface{})
+	docLat, latOK := geo["lat"].(float64)
+	docLng, lngOK := geo["lng"].(float64)
+	if !latOK || !lngOK {
+		return 0, false
+	}
+	const earthRadius = 6371000
+	radians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat, dLng := radians(docLat-lat), radians(docLng-lng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(radians(lat))*math.Cos(radians(docLat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a)), true
+}
+
+// numberedDocs returns n documents with ids "0" to "n-1" and a numeric rank
+func numberedDocs(n int) []map[string]interface{} {
+	docs := make([]map[string]interface{}, n)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"id": strconv.Itoa(i), "title": fmt.Sprintf("Doc %d", i), "rank": float64(i)}
+	}
+	return docs
+}
+
+// resultIDs returns the IDs of results in order
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestSearchOffset(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(numberedDocs(10)))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantOffset int
+		wantIDs    []string
+	}{
+		{"default offset", "/search?q=doc&limit=3", 0, []string{"0", "1", "2"}},
+		{"zero offset", "/search?q=doc&limit=3&offset=0", 0, []string{"0", "1", "2"}},
+		{"mid-range offset", "/search?q=doc&limit=3&offset=4", 4, []string{"4", "5", "6"}},
+		{"offset near the end", "/search?q=doc&limit=3&offset=8", 8, []string{"8", "9"}},
+		{"offset beyond results", "/search?q=doc&limit=3&offset=50", 50, []string{}},
+		{"negative offset clamped", "/search?q=doc&limit=3&offset=-5", 0, []string{"0", "1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if sent := meili.last(t, http.MethodPost, searchPath).JSON(t)["offset"]; sent != float64(tt.wantOffset) {
+				t.Errorf("offset sent to Meilisearch = %v, want %d", sent, tt.wantOffset)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Offset != tt.wantOffset || response.Limit != 3 {
+				t.Errorf("offset, limit = %d, %d, want %d, 3", response.Offset, response.Limit, tt.wantOffset)
+			}
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchTotalAndCount(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(numberedDocs(100)))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name      string
+		target    string
+		wantCount int
+	}{
+		{"default page size", "/search?q=doc", 20},
+		{"explicit limit", "/search?q=doc&limit=7", 7},
+		{"last partial page", "/search?q=doc&limit=30&offset=90", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Total != 100 {
+				t.Errorf("total = %d, want 100", response.Total)
+			}
+			if response.Count != tt.wantCount || len(response.Results) != tt.wantCount {
+				t.Errorf("count = %d with %d results, want %d", response.Count, len(response.Results), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestSearchHighlighting(t *testing.T) {
+	tests := []struct {
+		name        string
+		hit         map[string]interface{}
+		wantTitle   string
+		wantContent string
+	}{
+		{
+			name: "formatted values",
+			hit: map[string]interface{}{
+				"id": "1", "title": "Go generics", "content": "Generics arrived in Go 1.18",
+				"_formatted": map[string]interface{}{
+					"title":   "<mark>Go</mark> generics",
+					"content": "Generics arrived in <mark>Go</mark> 1.18",
+				},
+			},
+			wantTitle:   "<mark>Go</mark> generics",
+			wantContent: "Generics arrived in <mark>Go</mark> 1.18",
+		},
+		{
+			name:        "no formatted values",
+			hit:         map[string]interface{}{"id": "1", "title": "Go generics", "content": "Generics arrived"},
+			wantTitle:   "Go generics",
+			wantContent: "Generics arrived",
+		},
+		{
+			name: "partially formatted",
+			hit: map[string]interface{}{
+				"id": "1", "title": "Go generics", "content": "Generics arrived",
+				"_formatted": map[string]interface{}{"title": "<mark>Go</mark> generics"},
+			},
+			wantTitle:   "<mark>Go</mark> generics",
+			wantContent: "Generics arrived",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(tt.hit))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, "/search?q=go", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, searchPath).JSON(t)
+			if request["highlightPreTag"] != "<mark>" || request["highlightPostTag"] != "</mark>" {
+				t.Errorf("highlight tags = %v, %v, want <mark>, </mark>", request["highlightPreTag"], request["highlightPostTag"])
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			result := response.Results[0]
+			if result.HighlightedTitle != tt.wantTitle {
+				t.Errorf("highlighted_title = %q, want %q", result.HighlightedTitle, tt.wantTitle)
+			}
+			if result.HighlightedContent != tt.wantContent {
+				t.Errorf("highlighted_content = %q, want %q", result.HighlightedContent, tt.wantContent)
+			}
+		})
+	}
+}
+
+// categoryDocs are documents with a category to filter on
+var categoryDocs = []map[string]interface{}{
+	{"id": "1", "title": "Release notes", "category": "blog"},
+	{"id": "2", "title": "Install guide", "category": "docs"},
+	{"id": "3", "title": "Roadmap", "category": "blog"},
+}
+
+// rejectingFilters answers like next, except that filters mentioning an
+// unknown attribute are rejected the way Meilisearch rejects them
+func rejectingFilters(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "unknown") {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": "Attribute `unknown` is not filterable.",
+				"code":    "invalid_search_filter",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, rejectingFilters(seededIndex(categoryDocs)))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantCode   string
+		wantIDs    []string
+	}{
+		{"no filter", "/search?q=a", http.StatusOK, "", []string{"1", "2", "3"}},
+		{"matching category", "/search?q=a&filter=" + url.QueryEscape("category = blog"), http.StatusOK, "", []string{"1", "3"}},
+		{"no match", "/search?q=a&filter=" + url.QueryEscape("category = news"), http.StatusOK, "", []string{}},
+		{"empty filter", "/search?q=a&filter=", http.StatusBadRequest, errCodeInvalidParameter, nil},
+		{"blank filter", "/search?q=a&filter=%20%20", http.StatusBadRequest, errCodeInvalidParameter, nil},
+		{"rejected by Meilisearch", "/search?q=a&filter=" + url.QueryEscape("unknown = 1"), http.StatusBadRequest, errCodeInvalidFilter, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantCode {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, tt.wantCode)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+					t.Errorf("ids = %v, want %v", got, tt.wantIDs)
+				}
+			} else if response.Error == "" {
+				t.Error("error message is empty")
+			}
+		})
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(categoryDocs))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantSent   interface{}
+		wantFacets FacetCounts
+	}{
+		{"not requested", "/search?q=a", nil, nil},
+		{"one facet", "/search?q=a&facets=category", []interface{}{"category"}, FacetCounts{"category": {"blog": 2, "docs": 1}}},
+		{"with a filter", "/search?q=a&facets=category&filter=" + url.QueryEscape("category = docs"), []interface{}{"category"}, FacetCounts{"category": {"docs": 1}}},
+		{"several facets", "/search?q=a&facets=category,%20title", []interface{}{"category", "title"}, FacetCounts{
+			"category": {"blog": 2, "docs": 1},
+			"title":    {"Release notes": 1, "Install guide": 1, "Roadmap": 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if sent := meili.last(t, http.MethodPost, searchPath).JSON(t)["facets"]; !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("facets sent to Meilisearch = %v, want %v", sent, tt.wantSent)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if !reflect.DeepEqual(response.Facets, tt.wantFacets) {
+				t.Errorf("facets = %v, want %v", response.Facets, tt.wantFacets)
+			}
+			if tt.wantFacets == nil && strings.Contains(w.Body.String(), `"facets"`) {
+				t.Errorf("response has a facets field although none were requested: %s", w.Body)
+			}
+		})
+	}
+}
+
+// rejectingSorts answers like next, except that sorts on an unknown
+// attribute are rejected the way Meilisearch rejects them
+func rejectingSorts(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "unknown:") {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": "Attribute `unknown` is not sortable.",
+				"code":    "invalid_search_sort",
+				"type":    "invalid_request",
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"id": "a", "title": "b", "price": 30.0},
+		{"id": "b", "title": "a", "price": 10.0},
+		{"id": "c", "title": "c", "price": 20.0},
+	}
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, rejectingSorts(seededIndex(docs)))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name       string
+		sort       string
+		wantStatus int
+		wantSort   []interface{}
+		wantIDs    []string
+	}{
+		{"ascending", "price:asc", http.StatusOK, []interface{}{"price:asc"}, []string{"b", "c", "a"}},
+		{"descending", "price:desc", http.StatusOK, []interface{}{"price:desc"}, []string{"a", "c", "b"}},
+		{"several fields", "title:asc, price:desc", http.StatusOK, []interface{}{"title:asc", "price:desc"}, []string{"b", "a", "c"}},
+		{"not sortable", "unknown:asc", http.StatusBadRequest, []interface{}{"unknown:asc"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, "/search?q=x&sort="+url.QueryEscape(tt.sort), "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if sent := meili.last(t, http.MethodPost, searchPath).JSON(t)["sort"]; !reflect.DeepEqual(sent, tt.wantSort) {
+				t.Errorf("sort sent to Meilisearch = %v, want %v", sent, tt.wantSort)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.wantStatus != http.StatusOK {
+				if response.ErrorCode != errCodeInvalidSort {
+					t.Errorf("error_code = %q, want %q", response.ErrorCode, errCodeInvalidSort)
+				}
+				return
+			}
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      time.Duration
+		wantStatus int
+		wantCode   string
+	}{
+		{"fast search", 0, http.StatusOK, ""},
+		{"slow search", time.Second, http.StatusGatewayTimeout, errCodeTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.delay):
+					writeFakeJSON(w, http.StatusOK, searchHits())
+				case <-r.Context().Done():
+				}
+			})
+			config := testConfig(meili.URL)
+			config.SearchTimeout = 50 * time.Millisecond
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				start := time.Now()
+				w := serve(router, method, "/search?q=go", `{"query": "go"}`)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("%s status = %d, want %d, body %s", method, w.Code, tt.wantStatus, w.Body)
+				}
+				if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+					t.Errorf("%s took %s, want it cut short by the %s timeout", method, elapsed, config.SearchTimeout)
+				}
+
+				var response SearchResponse
+				decodeJSON(t, w, &response)
+				if response.ErrorCode != tt.wantCode {
+					t.Errorf("%s error_code = %q, want %q", method, response.ErrorCode, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestGetString(t *testing.T) {
+	doc := map[string]interface{}{
+		"string":  "abc",
+		"float":   42.0,
+		"decimal": 3.25,
+		"int":     7,
+		"int64":   int64(9007199254740993),
+		"bool":    true,
+		"number":  json.Number("12345678901234567890"),
+		"nil":     nil,
+		"object":  map[string]interface{}{"a": 1},
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"string", "abc"},
+		{"float", "42"},
+		{"decimal", "3.25"},
+		{"int", "7"},
+		{"int64", "9007199254740993"},
+		{"bool", "true"},
+		{"number", "12345678901234567890"},
+		{"nil", ""},
+		{"object", ""},
+		{"missing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := getString(doc, tt.key); got != tt.want {
+				t.Errorf("getString(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNumericIDs(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(
+		map[string]interface{}{"id": 1001, "title": "Numeric"},
+		map[string]interface{}{"id": "abc", "title": "String"},
+	))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	var response SearchResponse
+	decodeJSON(t, serve(router, http.MethodGet, "/search?q=x", ""), &response)
+	if got, want := resultIDs(response.Results), []string{"1001", "abc"}; !slices.Equal(got, want) {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+}
+
+func TestPostSearch(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"id": "a", "title": "Gopher guide", "category": "books", "price": 30.0},
+		{"id": "b", "title": "Gopher plush", "category": "toys", "price": 10.0},
+		{"id": "c", "title": "Gopher mug", "category": "books", "price": 20.0},
+		{"id": "d", "title": "Gopher poster", "category": "books", "price": 5.0},
+	}
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(docs))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	body := `{
+		"query": "gopher",
+		"limit": 2,
+		"offset": 1,
+		"filter": "category = books",
+		"sort": ["price:asc"],
+		"facets": ["category"],
+		"attributes": ["id", "title"]
+	}`
+	w := serve(router, http.MethodPost, "/search", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	sent := meili.last(t, http.MethodPost, searchPath).JSON(t)
+	wantSent := map[string]interface{}{
+		"q":                    "gopher",
+		"limit":                2.0,
+		"offset":               1.0,
+		"filter":               "category = books",
+		"sort":                 []interface{}{"price:asc"},
+		"facets":               []interface{}{"category"},
+		"attributesToRetrieve": []interface{}{"id", "title"},
+	}
+	for key, want := range wantSent {
+		if !reflect.DeepEqual(sent[key], want) {
+			t.Errorf("%s sent to Meilisearch = %v, want %v", key, sent[key], want)
+		}
+	}
+
+	var response SearchResponse
+	decodeJSON(t, w, &response)
+	// books by price are d, c, a; offset 1 and limit 2 leave c and a
+	if got := resultIDs(response.Results); !slices.Equal(got, []string{"c", "a"}) {
+		t.Errorf("ids = %v, want [c a]", got)
+	}
+	if response.Query != "gopher" || response.Offset != 1 || response.Limit != 2 {
+		t.Errorf("query, offset, limit = %q, %d, %d, want gopher, 1, 2", response.Query, response.Offset, response.Limit)
+	}
+}
+
+func TestPostSearchRejectsBadBodies(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"not JSON", `query=gopher`, errCodeInvalidBody},
+		{"wrong field type", `{"query": "gopher", "limit": "ten"}`, errCodeInvalidBody},
+		{"missing query", `{"limit": 5}`, errCodeMissingQuery},
+		{"page and offset", `{"query": "gopher", "page": 2, "offset": 10}`, errCodeInvalidParameter},
+		{"bad matching strategy", `{"query": "gopher", "matching_strategy": "most"}`, errCodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, http.MethodPost, "/search", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Success || response.ErrorCode != tt.wantCode {
+				t.Errorf("success, error_code = %v, %q, want false, %q", response.Success, response.ErrorCode, tt.wantCode)
+			}
+		})
+	}
+	if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+		t.Errorf("Meilisearch received %d searches, want none", n)
+	}
+}
+
+func TestSearchTimings(t *testing.T) {
+	delay := 30 * time.Millisecond
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		response := searchHits(map[string]interface{}{"id": "1", "title": "Gopher"})
+		response["processingTimeMs"] = 12
+		writeFakeJSON(w, http.StatusOK, response)
+	})
+	router := newSearchRouter(meili.searcher(), newQueryCache(100, time.Minute, 0), testConfig(meili.URL))
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantProcessing int64
+		wantMinTook    time.Duration
+	}{
+		{"GET", http.MethodGet, "/search?q=gopher", "", 12, delay},
+		{"POST", http.MethodPost, "/search", `{"query":"gopher","limit":5}`, 12, delay},
+		// A cache hit keeps the Meilisearch timing of the original search
+		{"cache hit", http.MethodGet, "/search?q=gopher", "", 12, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ProcessingTimeMs != tt.wantProcessing {
+				t.Errorf("processing_time_ms = %d, want %d", response.ProcessingTimeMs, tt.wantProcessing)
+			}
+			if response.TookMs < tt.wantMinTook.Milliseconds() {
+				t.Errorf("took_ms = %d, want at least %d", response.TookMs, tt.wantMinTook.Milliseconds())
+			}
+
+			var raw map[string]interface{}
+			decodeJSON(t, w, &raw)
+			for _, field := range []string{"processing_time_ms", "took_ms"} {
+				if _, ok := raw[field]; !ok {
+					t.Errorf("response has no %q field: %s", field, w.Body)
+				}
+			}
+		})
+	}
+}
+
+// highlightingIndex answers with one hit whose _formatted title wraps "Go" in
+// the requested tags, the way Meilisearch highlights, and no _formatted
+// values when highlighting was not requested
+func highlightingIndex(w http.ResponseWriter, r *http.Request) {
+	var request map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	hit := map[string]interface{}{"id": "1", "title": "Go generics", "content": "Generics arrived"}
+	if _, ok := request["attributesToHighlight"]; ok {
+		pre, _ := request["highlightPreTag"].(string)
+		post, _ := request["highlightPostTag"].(string)
+		hit["_formatted"] = map[string]interface{}{"title": pre + "Go" + post + " generics"}
+	}
+	writeFakeJSON(w, http.StatusOK, searchHits(hit))
+}
+
+func TestSearchHighlightOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantTags  []string
+		wantTitle string
+	}{
+		{"default tags", http.MethodGet, "/search?q=go", "", []string{"<mark>", "</mark>"}, "<mark>Go</mark> generics"},
+		{"custom tags", http.MethodGet, "/search?q=go&highlight_pre=%3Cem%3E&highlight_post=%3C%2Fem%3E", "", []string{"<em>", "</em>"}, "<em>Go</em> generics"},
+		{"custom pre tag only", http.MethodGet, "/search?q=go&highlight_pre=**", "", []string{"**", "</mark>"}, "**Go</mark> generics"},
+		{"custom tags in POST", http.MethodPost, "/search", `{"query":"go","highlight_pre":"[","highlight_post":"]"}`, []string{"[", "]"}, "[Go] generics"},
+		{"explicitly enabled", http.MethodGet, "/search?q=go&highlight=true", "", []string{"<mark>", "</mark>"}, "<mark>Go</mark> generics"},
+		{"disabled", http.MethodGet, "/search?q=go&highlight=false&highlight_pre=%3Cem%3E", "", nil, "Go generics"},
+		{"disabled in POST", http.MethodPost, "/search", `{"query":"go","highlight":false}`, nil, "Go generics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, highlightingIndex)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, searchPath).JSON(t)
+			if tt.wantTags == nil {
+				for _, field := range []string{"attributesToHighlight", "highlightPreTag", "highlightPostTag"} {
+					if value, ok := request[field]; ok {
+						t.Errorf("%s = %v sent with highlighting disabled", field, value)
+					}
+				}
+			} else if request["highlightPreTag"] != tt.wantTags[0] || request["highlightPostTag"] != tt.wantTags[1] {
+				t.Errorf("highlight tags = %v, %v, want %v", request["highlightPreTag"], request["highlightPostTag"], tt.wantTags)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := response.Results[0].HighlightedTitle; got != tt.wantTitle {
+				t.Errorf("highlighted_title = %q, want %q", got, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsBadHighlight(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, highlightingIndex)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	w := serve(router, http.MethodGet, "/search?q=go&highlight=maybe", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400, body %s", w.Code, w.Body)
+	}
+	if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+		t.Errorf("Meilisearch received %d searches for a rejected request", n)
+	}
+}
+
+// croppingIndex answers with one hit whose _formatted content is cropped to
+// the requested number of words and marked with the crop marker, the way
+// Meilisearch crops
+func croppingIndex(w http.ResponseWriter, r *http.Request) {
+	var request map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	words := strings.Fields(strings.Repeat("lorem ipsum ", 150))
+	length, _ := request["cropLength"].(float64)
+	marker := "…"
+	if m, ok := request["cropMarker"].(string); ok {
+		marker = m
+	}
+	cropped := strings.Join(words[:min(int(length), len(words))], " ") + marker
+
+	writeFakeJSON(w, http.StatusOK, searchHits(map[string]interface{}{
+		"id": "1", "title": "Lorem", "content": strings.Join(words, " "),
+		"_formatted": map[string]interface{}{"content": cropped},
+	}))
+}
+
+func TestSearchCrop(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantLength float64
+		wantMarker string
+	}{
+		{"default length", http.MethodGet, "/search?q=lorem", "", 200, ""},
+		{"short crop", http.MethodGet, "/search?q=lorem&crop_length=5", "", 5, ""},
+		{"crop marker", http.MethodGet, "/search?q=lorem&crop_length=5&crop_marker=%5B...%5D", "", 5, "[...]"},
+		{"POST", http.MethodPost, "/search", `{"query":"lorem","crop_length":3,"crop_marker":"~"}`, 3, "~"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, croppingIndex)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, searchPath).JSON(t)
+			if request["cropLength"] != tt.wantLength {
+				t.Errorf("cropLength = %v, want %v", request["cropLength"], tt.wantLength)
+			}
+			if marker, _ := request["cropMarker"].(string); marker != tt.wantMarker {
+				t.Errorf("cropMarker = %q, want %q", marker, tt.wantMarker)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			snippet := response.Results[0].Snippet
+			if words := len(strings.Fields(snippet)); words != int(tt.wantLength) {
+				t.Errorf("snippet has %d words, want %v: %q", words, tt.wantLength, snippet)
+			}
+			if tt.wantMarker != "" && !strings.HasSuffix(snippet, tt.wantMarker) {
+				t.Errorf("snippet %q does not end with the crop marker %q", snippet, tt.wantMarker)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsBadCropLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"zero", http.MethodGet, "/search?q=lorem&crop_length=0", ""},
+		{"negative", http.MethodGet, "/search?q=lorem&crop_length=-4", ""},
+		{"not a number", http.MethodGet, "/search?q=lorem&crop_length=short", ""},
+		{"negative in POST", http.MethodPost, "/search", `{"query":"lorem","crop_length":-1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, croppingIndex)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != errCodeInvalidParameter {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, errCodeInvalidParameter)
+			}
+		})
+	}
+}
+
+func TestSearchMatchingStrategy(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(
+		map[string]interface{}{"id": "1", "title": "Go concurrency patterns", "content": "Channels and goroutines"},
+		map[string]interface{}{"id": "2", "title": "Go modules", "content": "Versioning dependencies"},
+		map[string]interface{}{"id": "3", "title": "Rust concurrency", "content": "Ownership and threads"},
+		map[string]interface{}{"id": "4", "title": "Python packaging", "content": "Wheels and eggs"},
+	)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		wantStrategy string
+		wantIDs      []string
+	}{
+		{"defaults to last", http.MethodGet, "/search?q=go+concurrency", "", "last", []string{"1", "2"}},
+		{"last", http.MethodGet, "/search?q=go+concurrency&matching_strategy=last", "", "last", []string{"1", "2"}},
+		{"all", http.MethodGet, "/search?q=go+concurrency&matching_strategy=all", "", "all", []string{"1"}},
+		{"all in POST", http.MethodPost, "/search", `{"query":"go concurrency","matching_strategy":"all"}`, "all", []string{"1"}},
+		{"last in POST", http.MethodPost, "/search", `{"query":"go concurrency"}`, "last", []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := meili.last(t, http.MethodPost, searchPath).JSON(t)["matchingStrategy"]; got != tt.wantStrategy {
+				t.Errorf("matchingStrategy = %v, want %q", got, tt.wantStrategy)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			var ids []string
+			for _, result := range response.Results {
+				ids = append(ids, result.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsBadMatchingStrategy(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	for _, target := range []string{"/search?q=go&matching_strategy=any", "/search?q=go&matching_strategy=ALL", "/search?q=go&matching_strategy="} {
+		w := serve(router, http.MethodGet, target, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", target, w.Code)
+		}
+	}
+	if w := serve(router, http.MethodPost, "/search", `{"query":"go","matching_strategy":"some"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("POST status = %d, want 400", w.Code)
+	}
+	if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+		t.Errorf("Meilisearch received %d searches for rejected requests", n)
+	}
+}
+
+// articleDocs are documents with attributes outside SearchResult
+var articleDocs = []map[string]interface{}{
+	{"id": "1", "title": "Go", "content": "A long article body", "url": "https://example.com/go", "author": "Ada", "tags": []interface{}{"lang"}},
+	{"id": "2", "title": "Gin", "content": "Another long body", "url": "https://example.com/gin", "author": "Grace"},
+}
+
+func TestSearchAttributes(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(articleDocs))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantAttributes []interface{}
+		wantResult     SearchResult
+	}{
+		{
+			name: "all attributes by default", method: http.MethodGet, target: "/search?q=go",
+			wantAttributes: []interface{}{"*"},
+			wantResult:     SearchResult{ID: "1", Title: "Go", Content: "A long article body", URL: "https://example.com/go"},
+		},
+		{
+			name: "slimmed", method: http.MethodGet, target: "/search?q=go&attributes=id,title,url",
+			wantAttributes: []interface{}{"id", "title", "url"},
+			wantResult:     SearchResult{ID: "1", Title: "Go", URL: "https://example.com/go"},
+		},
+		{
+			name: "spaces and empty entries", method: http.MethodGet, target: "/search?q=go&attributes=id,+title,,",
+			wantAttributes: []interface{}{"id", "title"},
+			wantResult:     SearchResult{ID: "1", Title: "Go"},
+		},
+		{
+			name: "POST", method: http.MethodPost, target: "/search", body: `{"query":"go","attributes":["id","url"]}`,
+			wantAttributes: []interface{}{"id", "url"},
+			wantResult:     SearchResult{ID: "1", URL: "https://example.com/go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := meili.last(t, http.MethodPost, searchPath).JSON(t)["attributesToRetrieve"]; !reflect.DeepEqual(got, tt.wantAttributes) {
+				t.Errorf("attributesToRetrieve = %v, want %v", got, tt.wantAttributes)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			got := response.Results[0]
+			got.Score, got.HighlightedTitle, got.HighlightedContent, got.Snippet = 0, "", "", ""
+			if !reflect.DeepEqual(got, tt.wantResult) {
+				t.Errorf("result = %+v, want %+v", got, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestSearchRaw(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, seededIndex(articleDocs))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantHits []map[string]interface{}
+	}{
+		{
+			name: "every attribute", method: http.MethodGet, target: "/search?q=g&raw=true",
+			wantHits: articleDocs,
+		},
+		{
+			name: "selected attributes", method: http.MethodGet, target: "/search?q=g&raw=true&attributes=id,author",
+			wantHits: []map[string]interface{}{{"id": "1", "author": "Ada"}, {"id": "2", "author": "Grace"}},
+		},
+		{
+			name: "POST", method: http.MethodPost, target: "/search", body: `{"query":"g","raw":true,"attributes":["tags"]}`,
+			wantHits: []map[string]interface{}{{"tags": []interface{}{"lang"}}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			var response struct {
+				Results []SearchResult           `json:"results"`
+				Hits    []map[string]interface{} `json:"hits"`
+			}
+			decodeJSON(t, w, &response)
+			if response.Results != nil {
+				t.Errorf("raw response has results: %s", w.Body)
+			}
+			if !reflect.DeepEqual(response.Hits, tt.wantHits) {
+				t.Errorf("hits = %v, want %v", response.Hits, tt.wantHits)
+			}
+		})
+	}
+
+	if w := serve(router, http.MethodGet, "/search?q=g&raw=yes", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("raw=yes status = %d, want 400", w.Code)
+	}
+}
+
+// matchingIndex answers with docs, adding the byte offsets of every query
+// word in their title and content as _matchesPosition when asked to, like
+// Meilisearch
+func matchingIndex(docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query               string `json:"q"`
+			ShowMatchesPosition bool   `json:"showMatchesPosition"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		hits := make([]map[string]interface{}, len(docs))
+		for i, doc := range docs {
+			hits[i] = map[string]interface{}{}
+			for k, v := range doc {
+				hits[i][k] = v
+			}
+			if !request.ShowMatchesPosition {
+				continue
+			}
+			positions := map[string]interface{}{}
+			for _, attribute := range []string{"title", "content"} {
+				text := strings.ToLower(getString(doc, attribute))
+				var matches []interface{}
+				for _, word := range strings.Fields(strings.ToLower(request.Query)) {
+					for offset := 0; ; {
+						i := strings.Index(text[offset:], word)
+						if i < 0 {
+							break
+						}
+						matches = append(matches, map[string]interface{}{"start": offset + i, "length": len(word)})
+						offset += i + len(word)
+					}
+				}
+				if matches != nil {
+					positions[attribute] = matches
+				}
+			}
+			hits[i]["_matchesPosition"] = positions
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+	}
+}
+
+func TestSearchMatchesPosition(t *testing.T) {
+	doc := map[string]interface{}{"id": "1", "title": "Go gophers", "content": "Gophers love Go. Go is fun."}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		wantRequest bool
+		want        MatchesPosition
+	}{
+		{"omitted by default", http.MethodGet, "/search?q=go", "", false, nil},
+		{"explicitly omitted", http.MethodGet, "/search?q=go&show_matches=false", "", false, nil},
+		{
+			name: "single word", method: http.MethodGet, target: "/search?q=go&show_matches=true", wantRequest: true,
+			want: MatchesPosition{
+				"title":   {{Start: 0, Length: 2}, {Start: 3, Length: 2}},
+				"content": {{Start: 0, Length: 2}, {Start: 13, Length: 2}, {Start: 17, Length: 2}},
+			},
+		},
+		{
+			name: "POST", method: http.MethodPost, target: "/search", body: `{"query":"fun","show_matches":true}`, wantRequest: true,
+			want: MatchesPosition{"content": {{Start: 23, Length: 3}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, matchingIndex(doc))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := meili.last(t, http.MethodPost, searchPath).JSON(t)["showMatchesPosition"] == true; got != tt.wantRequest {
+				t.Errorf("showMatchesPosition sent = %v, want %v", got, tt.wantRequest)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := response.Results[0].MatchesPosition; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches_position = %v, want %v", got, tt.want)
+			}
+			if tt.want == nil && strings.Contains(w.Body.String(), "matches_position") {
+				t.Errorf("response includes matches_position: %s", w.Body)
+			}
+
+			// The offsets point at the query words
+			for attribute, matches := range response.Results[0].MatchesPosition {
+				text := getString(doc, attribute)
+				for _, match := range matches {
+					if word := strings.ToLower(text[match.Start : match.Start+match.Length]); !strings.Contains(tt.target+tt.body, word) {
+						t.Errorf("%s match %+v covers %q, not a query word", attribute, match, word)
+					}
+				}
+			}
+		})
+	}
+
+	meili := newFakeMeili(t)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+	if w := serve(router, http.MethodGet, "/search?q=go&show_matches=sure", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("show_matches=sure status = %d, want 400", w.Code)
+	}
+}
+
+func TestToMatchesPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want map[string][]MatchPosition
+	}{
+		{"empty", `{}`, map[string][]MatchPosition{}},
+		{
+			name: "several attributes",
+			raw:  `{"title": [{"start": 0, "length": 2}], "content": [{"start": 4, "length": 3}, {"start": 10, "length": 3}]}`,
+			want: map[string][]MatchPosition{
+				"title":   {{Start: 0, Length: 2}},
+				"content": {{Start: 4, Length: 3}, {Start: 10, Length: 3}},
+			},
+		},
+		{
+			name: "malformed entries are skipped",
+			raw:  `{"title": "oops", "content": [42, {"start": 1, "length": 4}]}`,
+			want: map[string][]MatchPosition{"content": {{Start: 1, Length: 4}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+			if got := toMatchesPosition(raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toMatchesPosition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		maxLength int
+		want      string
+		wantErr   bool
+	}{
+		{"unchanged", "gopher guide", 512, "gopher guide", false},
+		{"trimmed", "  gopher  ", 512, "gopher", false},
+		{"whitespace collapsed", "gopher \t\n  guide", 512, "gopher guide", false},
+		{"unicode spaces collapsed", "gopher  guide", 512, "gopher guide", false},
+		{"control characters stripped", "go\x00ph\x07er\x1b", 512, "gopher", false},
+		{"only whitespace", " \t\n ", 512, "", false},
+		{"empty", "", 512, "", false},
+		{"at the limit", "gopher", 6, "gopher", false},
+		{"counted in characters", "été", 3, "été", false},
+		{"limit applies after normalizing", "  go   pher  ", 7, "go pher", false},
+		{"too long", "gophers", 6, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeQuery(tt.query, tt.maxLength)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeQuery(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNormalizesQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		wantStatus    int
+		wantErrorCode string
+		wantQuery     string
+	}{
+		{"GET", http.MethodGet, "/search?q=%20%20gopher%09%0A%20guide%07%20", "", http.StatusOK, "", "gopher guide"},
+		{"POST", http.MethodPost, "/search", `{"query":"  gopher \t\n guide\u0007 "}`, http.StatusOK, "", "gopher guide"},
+		{"GET too long", http.MethodGet, "/search?q=" + strings.Repeat("g", 13), "", http.StatusBadRequest, errCodeInvalidQuery, ""},
+		{"POST too long", http.MethodPost, "/search", `{"query":"` + strings.Repeat("g", 13) + `"}`, http.StatusBadRequest, errCodeInvalidQuery, ""},
+		{"GET only whitespace", http.MethodGet, "/search?q=%20%09", "", http.StatusBadRequest, errCodeMissingQuery, ""},
+		{"POST only control characters", http.MethodPost, "/search", `{"query":"\u0000\u0007"}`, http.StatusBadRequest, errCodeMissingQuery, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			config := testConfig(meili.URL)
+			config.MaxQueryLength = 12
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, tt.wantErrorCode)
+			}
+
+			searches := meili.received(http.MethodPost, searchPath)
+			if tt.wantStatus != http.StatusOK {
+				if len(searches) != 0 {
+					t.Errorf("rejected query reached Meilisearch")
+				}
+				return
+			}
+			if len(searches) != 1 || searches[0].JSON(t)["q"] != tt.wantQuery {
+				t.Errorf("Meilisearch searched %v, want q %q", searches, tt.wantQuery)
+			}
+			if response.Query != tt.wantQuery {
+				t.Errorf("response query = %q, want %q", response.Query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"valid", 10, 10},
+		{"at the maximum", 100, 100},
+		{"over the maximum", 1000000, 100},
+		{"zero", 0, 20},
+		{"negative", -5, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clampLimit(tt.limit, 20, 100); got != tt.want {
+				t.Errorf("clampLimit(%d, 20, 100) = %d, want %d", tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"GET valid", http.MethodGet, "/search?q=gopher&limit=10", "", 10},
+		{"GET over the maximum", http.MethodGet, "/search?q=gopher&limit=1000000", "", 50},
+		{"GET negative", http.MethodGet, "/search?q=gopher&limit=-3", "", 15},
+		{"GET zero", http.MethodGet, "/search?q=gopher&limit=0", "", 15},
+		{"GET not a number", http.MethodGet, "/search?q=gopher&limit=many", "", 15},
+		{"GET omitted", http.MethodGet, "/search?q=gopher", "", 15},
+		{"POST valid", http.MethodPost, "/search", `{"query":"gopher","limit":10}`, 10},
+		{"POST over the maximum", http.MethodPost, "/search", `{"query":"gopher","limit":1000000}`, 50},
+		{"POST negative", http.MethodPost, "/search", `{"query":"gopher","limit":-3}`, 15},
+		{"POST omitted", http.MethodPost, "/search", `{"query":"gopher"}`, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			config := testConfig(meili.URL)
+			config.MaxSearchLimit = 50
+			config.DefaultSearchLimit = 15
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Limit != tt.want {
+				t.Errorf("response limit = %d, want %d", response.Limit, tt.want)
+			}
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 || searches[0].JSON(t)["limit"] != float64(tt.want) {
+				t.Errorf("Meilisearch searched %v, want limit %d", searches, tt.want)
+			}
+		})
+	}
+}
+
+// filterCondition matches one comparison of a Meilisearch filter
+var filterCondition = regexp.MustCompile(`^(\w+) (>=|<=|!=|=) (.+)$`)
+
+// filteringIndex returns the docs that satisfy the filter of the search, a
+// conjunction of comparisons that may be wrapped in parentheses
+func filteringIndex(t *testing.T, docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Filter string `json:"filter"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		var conditions [][]string
+		if request.Filter != "" {
+			for _, condition := range strings.Split(request.Filter, " AND ") {
+				match := filterCondition.FindStringSubmatch(strings.Trim(condition, "()"))
+				if match == nil {
+					t.Errorf("unsupported filter condition %q in %q", condition, request.Filter)
+					writeFakeJSON(w, http.StatusBadRequest, map[string]string{"message": "invalid filter", "code": "invalid_search_filter", "type": "invalid_request"})
+					return
+				}
+				conditions = append(conditions, match[1:])
+			}
+		}
+
+		var hits []map[string]interface{}
+		for _, doc := range docs {
+			if !slices.ContainsFunc(conditions, func(c []string) bool { return !satisfies(doc[c[0]], c[1], c[2]) }) {
+				hits = append(hits, doc)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+	}
+}
+
+// satisfies compares value to operand, numerically when both are numbers
+func satisfies(value interface{}, op, operand string) bool {
+	if n, ok := value.(float64); ok {
+		if m, err := strconv.ParseFloat(operand, 64); err == nil {
+			switch op {
+			case ">=":
+				return n >= m
+			case "<=":
+				return n <= m
+			case "!=":
+				return n != m
+			}
+			return n == m
+		}
+	}
+	equal := fmt.Sprint(value) == strings.Trim(operand, `"'`)
+	if op == "!=" {
+		return !equal
+	}
+	return op == "=" && equal
+}
+
+// datedDocs are dated with Unix seconds, one per day of March 2024 at noon
+var datedDocs = []map[string]interface{}{
+	{"id": "1", "title": "First", "date": float64(1709294400), "published": float64(1709294400), "category": "go"},    // 2024-03-01
+	{"id": "2", "title": "Second", "date": float64(1709380800), "published": float64(1704110400), "category": "rust"}, // 2024-03-02
+	{"id": "3", "title": "Third", "date": float64(1709467200), "published": float64(1709467200), "category": "go"},    // 2024-03-03
+	{"id": "4", "title": "Fourth", "date": float64(1709553600), "published": float64(1709553600), "category": "go"},   // 2024-03-04
+}
+
+func TestSearchDateRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantFilter string
+		wantIDs    []string
+	}{
+		{"RFC 3339 range", "from=2024-03-02T00:00:00Z&to=2024-03-03T23:59:59Z", "", "date >= 1709337600 AND date <= 1709510399", []string{"2", "3"}},
+		{"Unix range", "from=1709380800&to=1709467200", "", "date >= 1709380800 AND date <= 1709467200", []string{"2", "3"}},
+		{"from only", "from=2024-03-03T12:00:00Z", "", "date >= 1709467200", []string{"3", "4"}},
+		{"to only", "to=1709380800", "", "date <= 1709380800", []string{"1", "2"}},
+		{"time zone offset", "from=2024-03-03T13:00:00%2B01:00", "", "date >= 1709467200", []string{"3", "4"}},
+		{"other date field", "date_field=published&from=2024-03-01T00:00:00Z", "", "published >= 1709251200", []string{"1", "3", "4"}},
+		{"combined with filter", "filter=category+%3D+go&from=1709380800", "", "(category = go) AND date >= 1709380800", []string{"3", "4"}},
+		{"empty range", "from=1709640000", "", "date >= 1709640000", nil},
+		{"POST", "", `{"query":"doc","from":"2024-03-02T00:00:00Z","to":"1709467200","filter":"category = go"}`, "(category = go) AND date >= 1709337600 AND date <= 1709467200", []string{"3"}},
+		{"POST date field", "", `{"query":"doc","from":"1709337600","date_field":"published"}`, "published >= 1709337600", []string{"3", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, filteringIndex(t, datedDocs...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			var w *httptest.ResponseRecorder
+			if tt.body != "" {
+				w = serve(router, http.MethodPost, "/search", tt.body)
+			} else {
+				w = serve(router, http.MethodGet, "/search?q=doc&"+tt.query, "")
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 || searches[0].JSON(t)["filter"] != tt.wantFilter {
+				t.Errorf("Meilisearch searched %v, want filter %q", searches, tt.wantFilter)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsBadDateRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantError string
+	}{
+		{"bad from", http.MethodGet, "/search?q=doc&from=yesterday", "", `Invalid 'from' timestamp "yesterday", expected RFC 3339 or Unix seconds`},
+		{"bad to", http.MethodGet, "/search?q=doc&to=2024-03-02", "", `Invalid 'to' timestamp "2024-03-02", expected RFC 3339 or Unix seconds`},
+		{"from after to", http.MethodGet, "/search?q=doc&from=1709467200&to=1709380800", "", "'from' must not be after 'to'"},
+		{"bad date field", http.MethodGet, "/search?q=doc&from=1709467200&date_field=date%20OR%201", "", `Invalid date_field "date OR 1"`},
+		{"POST bad from", http.MethodPost, "/search", `{"query":"doc","from":"soon"}`, `Invalid 'from' timestamp "soon", expected RFC 3339 or Unix seconds`},
+		{"POST from after to", http.MethodPost, "/search", `{"query":"doc","from":"2024-03-03T00:00:00Z","to":"2024-03-02T00:00:00Z"}`, "'from' must not be after 'to'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Error != tt.wantError || response.ErrorCode != errCodeInvalidParameter {
+				t.Errorf("error = %q %q, want %q %q", response.Error, response.ErrorCode, tt.wantError, errCodeInvalidParameter)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+				t.Errorf("Meilisearch received %d searches, want none", n)
+			}
+		})
+	}
+}
+
+// distinctIndex returns docs with at most one hit per value of the distinct
+// attribute, which must be one of filterable like in Meilisearch
+func distinctIndex(filterable []string, docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Distinct string `json:"distinct"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Distinct != "" && !slices.Contains(filterable, request.Distinct) {
+			writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+				"message": fmt.Sprintf("Attribute `%s` is not filterable.", request.Distinct),
+				"code":    "invalid_search_distinct",
+				"type":    "invalid_request",
+			})
+			return
+		}
+
+		var hits []map[string]interface{}
+		seen := make(map[interface{}]bool)
+		for _, doc := range docs {
+			if request.Distinct != "" {
+				value := doc[request.Distinct]
+				if seen[value] {
+					continue
+				}
+				seen[value] = true
+			}
+			hits = append(hits, doc)
+		}
+		writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+	}
+}
+
+// duplicateDocs are crawled pages, several of them for the same URL
+var duplicateDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher guide", "url": "https://example.com/guide", "site": "example.com"},
+	{"id": "2", "title": "Gopher guide (print)", "url": "https://example.com/guide", "site": "example.com"},
+	{"id": "3", "title": "Gopher FAQ", "url": "https://example.com/faq", "site": "example.com"},
+	{"id": "4", "title": "Gopher guide (mirror)", "url": "https://example.com/guide", "site": "mirror.example.com"},
+	{"id": "5", "title": "Gopher news", "url": "https://news.example.com/", "site": "news.example.com"},
+}
+
+func TestSearchDistinct(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		wantDistinct interface{}
+		wantIDs      []string
+	}{
+		{"all duplicates without distinct", http.MethodGet, "/search?q=gopher", "", nil, []string{"1", "2", "3", "4", "5"}},
+		{"one per url", http.MethodGet, "/search?q=gopher&distinct=url", "", "url", []string{"1", "3", "5"}},
+		{"one per site", http.MethodGet, "/search?q=gopher&distinct=site", "", "site", []string{"1", "4", "5"}},
+		{"POST one per url", http.MethodPost, "/search", `{"query":"gopher","distinct":"url"}`, "url", []string{"1", "3", "5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, distinctIndex([]string{"url", "site"}, duplicateDocs...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+			searches := meili.received(http.MethodPost, searchPath)
+			if len(searches) != 1 || searches[0].JSON(t)["distinct"] != tt.wantDistinct {
+				t.Errorf("Meilisearch searched %v, want distinct %v", searches, tt.wantDistinct)
+			}
+		})
+	}
+}
+
+func TestSearchRejectsBadDistinct(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		wantError     string
+		wantErrorCode string
+		wantSearches  int
+	}{
+		{"invalid name", http.MethodGet, "/search?q=gopher&distinct=url%20OR%20id", "", `Invalid distinct attribute "url OR id"`, errCodeInvalidParameter, 0},
+		{"POST invalid name", http.MethodPost, "/search", `{"query":"gopher","distinct":"url;"}`, `Invalid distinct attribute "url;"`, errCodeInvalidParameter, 0},
+		{"not filterable", http.MethodGet, "/search?q=gopher&distinct=title", "", "Invalid distinct attribute, it must be one of the index's filterable attributes: Attribute `title` is not filterable.", errCodeInvalidDistinct, 1},
+		{"POST not filterable", http.MethodPost, "/search", `{"query":"gopher","distinct":"title"}`, "Invalid distinct attribute, it must be one of the index's filterable attributes: Attribute `title` is not filterable.", errCodeInvalidDistinct, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, distinctIndex([]string{"url"}, duplicateDocs...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Error != tt.wantError || response.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error = %q %q, want %q %q", response.Error, response.ErrorCode, tt.wantError, tt.wantErrorCode)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != tt.wantSearches {
+				t.Errorf("Meilisearch received %d searches, want %d", n, tt.wantSearches)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `W/"abc123"`
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"no header", "", false},
+		{"same weak tag", `W/"abc123"`, true},
+		{"strong form of the tag", `"abc123"`, true},
+		{"other tag", `W/"def456"`, false},
+		{"in a list", `W/"def456", W/"abc123"`, true},
+		{"list without spaces", `"def456",W/"abc123"`, true},
+		{"wildcard", "*", true},
+		{"unquoted", "abc123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+
+	if etagMatches("*", "") {
+		t.Error("etagMatches matched a response without an ETag")
+	}
+}
+
+func TestSearchETag(t *testing.T) {
+	meili := newFakeMeili(t)
+	seedGophers(meili, 3)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	first := serve(router, http.MethodGet, "/search?q=gopher", "")
+	etag := first.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || !strings.HasSuffix(etag, `"`) {
+		t.Fatalf("ETag = %q, want a weak ETag", etag)
+	}
+
+	// Timings differ between searches but the ETag does not
+	time.Sleep(2 * time.Millisecond)
+	if again := serve(router, http.MethodGet, "/search?q=gopher", "").Header().Get("ETag"); again != etag {
+		t.Errorf("ETag of the repeated search = %q, want %q", again, etag)
+	}
+	if post := serve(router, http.MethodPost, "/search", `{"query":"gopher"}`).Header().Get("ETag"); post != etag {
+		t.Errorf("ETag of the same search by POST = %q, want %q", post, etag)
+	}
+
+	// Other results or representations get other ETags
+	for _, other := range []struct {
+		target  string
+		headers []string
+	}{
+		{"/search?q=gopher&limit=1", nil},
+		{"/search?q=gopher+2", nil},
+		{"/search?q=gopher", []string{"Accept", "application/xml"}},
+		{"/search?q=gopher&format=csv", nil},
+	} {
+		w := serve(router, http.MethodGet, other.target, "", other.headers...)
+		if got := w.Header().Get("ETag"); got == "" || got == etag {
+			t.Errorf("%s %v ETag = %q, want one other than %q", other.target, other.headers, got, etag)
+		}
+	}
+
+	// A change to the index changes the ETag
+	meili.indexes["documents"].add(map[string]interface{}{"id": "new", "title": "Gopher news"})
+	if changed := serve(router, http.MethodGet, "/search?q=gopher", "").Header().Get("ETag"); changed == etag {
+		t.Error("ETag did not change with the results")
+	}
+}
+
+func TestSearchConditionalGET(t *testing.T) {
+	tests := []struct {
+		name        string
+		noneMatch   func(etag string) string
+		wantStatus  int
+		wantHasBody bool
+	}{
+		{"matching ETag", func(etag string) string { return etag }, http.StatusNotModified, false},
+		{"matching strong form", func(etag string) string { return strings.TrimPrefix(etag, "W/") }, http.StatusNotModified, false},
+		{"matching one of several", func(etag string) string { return `W/"stale", ` + etag }, http.StatusNotModified, false},
+		{"wildcard", func(string) string { return "*" }, http.StatusNotModified, false},
+		{"stale ETag", func(string) string { return `W/"stale"` }, http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			seedGophers(meili, 3)
+			router := newSearchRouter(meili.searcher(), newQueryCache(100, time.Minute, 0), testConfig(meili.URL))
+
+			etag := serve(router, http.MethodGet, "/search?q=gopher", "").Header().Get("ETag")
+			w := serve(router, http.MethodGet, "/search?q=gopher", "", "If-None-Match", tt.noneMatch(etag))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if hasBody := w.Body.Len() > 0; hasBody != tt.wantHasBody {
+				t.Errorf("body %q, want a body: %v", w.Body, tt.wantHasBody)
+			}
+			// The cached response has the ETag of the original one
+			if w.Header().Get("ETag") != etag || w.Header().Get("X-Cache") != cacheHit {
+				t.Errorf("ETag, X-Cache = %q, %q, want %q, %s", w.Header().Get("ETag"), w.Header().Get("X-Cache"), etag, cacheHit)
+			}
+		})
+	}
+}
+
+func TestSearchErrorsHaveNoETag(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusInternalServerError, map[string]string{"message": "down", "code": "internal", "type": "internal"})
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	for _, target := range []string{"/search", "/search?q=gopher"} {
+		w := serve(router, http.MethodGet, target, "", "If-None-Match", "*")
+		if w.Code == http.StatusOK || w.Code == http.StatusNotModified {
+			t.Fatalf("%s status = %d, want an error", target, w.Code)
+		}
+		if etag := w.Header().Get("ETag"); etag != "" {
+			t.Errorf("%s ETag = %q, want none", target, etag)
+		}
+	}
+}
+
+// browsingIndex answers searches over docs honoring the filter, a single
+// attribute:direction sort, offset and limit. An empty query matches every
+// document, like in Meilisearch; otherwise titles must contain the query.
+func browsingIndex(t *testing.T, docs ...map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Query  string   `json:"q"`
+			Sort   []string `json:"sort"`
+			Offset int      `json:"offset"`
+			Limit  int      `json:"limit"`
+		}
+		json.Unmarshal(body, &request)
+
+		// Filter like filteringIndex, from a recorder of its own
+		rec := httptest.NewRecorder()
+		filteringIndex(t, docs...)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		var filtered struct {
+			Hits []map[string]interface{} `json:"hits"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &filtered)
+
+		var matches []map[string]interface{}
+		for _, doc := range filtered.Hits {
+			if strings.Contains(strings.ToLower(getString(doc, "title")), strings.ToLower(request.Query)) {
+				matches = append(matches, doc)
+			}
+		}
+		if len(request.Sort) > 0 {
+			attribute, direction, _ := strings.Cut(request.Sort[0], ":")
+			sort.SliceStable(matches, func(i, j int) bool {
+				a, b := fmt.Sprint(matches[i][attribute]), fmt.Sprint(matches[j][attribute])
+				if direction == "desc" {
+					return a > b
+				}
+				return a < b
+			})
+		}
+
+		hits := []map[string]interface{}{}
+		if request.Offset < len(matches) {
+			hits = matches[request.Offset:min(request.Offset+request.Limit, len(matches))]
+		}
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"hits":               hits,
+			"estimatedTotalHits": len(matches),
+			"processingTimeMs":   1,
+		})
+	}
+}
+
+// catalogDocs are products to browse
+var catalogDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher plush", "category": "toys", "price": float64(20)},
+	{"id": "2", "title": "Go book", "category": "books", "price": float64(40)},
+	{"id": "3", "title": "Gopher mug", "category": "kitchen", "price": float64(12)},
+	{"id": "4", "title": "Rust book", "category": "books", "price": float64(35)},
+	{"id": "5", "title": "Gopher stickers", "category": "toys", "price": float64(5)},
+}
+
+func TestSearchBrowse(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantIDs   []string
+		wantTotal int
+	}{
+		{"every document", http.MethodGet, "/search?browse=true", "", []string{"1", "2", "3", "4", "5"}, 5},
+		{"paginated", http.MethodGet, "/search?browse=true&limit=2&offset=2", "", []string{"3", "4"}, 5},
+		{"filtered", http.MethodGet, "/search?browse=true&filter=category+%3D+toys", "", []string{"1", "5"}, 2},
+		{"sorted", http.MethodGet, "/search?browse=true&sort=title:asc&limit=3", "", []string{"2", "3", "1"}, 5},
+		{"filtered, sorted and paginated", http.MethodGet, "/search?browse=1&filter=category+%3D+books&sort=title:desc&limit=1&offset=1", "", []string{"2"}, 2},
+		{"numbered pages", http.MethodGet, "/search?browse=true&page=3&per_page=2", "", []string{"5"}, 5},
+		{"query narrows the listing", http.MethodGet, "/search?browse=true&q=gopher", "", []string{"1", "3", "5"}, 3},
+		{"POST", http.MethodPost, "/search", `{"browse":true,"filter":"category = toys","sort":["title:desc"]}`, []string{"5", "1"}, 2},
+		{"POST paginated", http.MethodPost, "/search", `{"browse":true,"limit":2,"offset":4}`, []string{"5"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, browsingIndex(t, catalogDocs...))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+			if response.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", response.Total, tt.wantTotal)
+			}
+			// Meilisearch lists everything for an empty query
+			searches := meili.received(http.MethodPost, searchPath)
+			if q := searches[0].JSON(t)["q"]; !strings.Contains(tt.target, "q=") && q != "" {
+				t.Errorf("Meilisearch searched for %q, want an empty query", q)
+			}
+		})
+	}
+}
+
+func TestSearchRequiresQueryOutsideBrowseMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		wantErrorCode string
+	}{
+		{"GET without q", http.MethodGet, "/search", "", errCodeMissingQuery},
+		{"GET empty q", http.MethodGet, "/search?q=", "", errCodeMissingQuery},
+		{"GET browse false", http.MethodGet, "/search?browse=false", "", errCodeMissingQuery},
+		{"GET invalid browse", http.MethodGet, "/search?browse=maybe", "", errCodeInvalidParameter},
+		{"POST without query", http.MethodPost, "/search", `{}`, errCodeMissingQuery},
+		{"POST browse false", http.MethodPost, "/search", `{"browse":false,"query":"  "}`, errCodeMissingQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantErrorCode {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, tt.wantErrorCode)
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != 0 {
+				t.Errorf("Meilisearch received %d searches, want none", n)
+			}
+		})
+	}
+}
+
+func TestSearchDefaultLimitFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		target string
+		want   int
+	}{
+		{"environment default", "7", "/search?q=gopher", 7},
+		{"explicit limit wins", "7", "/search?q=gopher&limit=3", 3},
+		{"unparseable limit", "7", "/search?q=gopher&limit=all", 7},
+		{"clamped to the maximum", "500", "/search?q=gopher", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits())
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("MEILISEARCH_URL", meili.URL)
+			t.Setenv("DEFAULT_SEARCH_LIMIT", tt.env)
+			config, err := loadConfig()
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.Limit != tt.want {
+				t.Errorf("limit = %d, want %d", response.Limit, tt.want)
+			}
+		})
+	}
+}
+
+// xmlSearchResponse mirrors the XML form of SearchResponse
+type xmlSearchResponse struct {
+	XMLName   xml.Name `xml:"search_response"`
+	Success   bool     `xml:"success"`
+	Query     string   `xml:"query"`
+	Total     int      `xml:"total"`
+	Error     string   `xml:"error"`
+	ErrorCode string   `xml:"error_code"`
+	Results   []struct {
+		ID    string  `xml:"id"`
+		Title string  `xml:"title"`
+		Score float64 `xml:"score"`
+	} `xml:"results>result"`
+	Facets []struct {
+		Name   string `xml:"name,attr"`
+		Values []struct {
+			Name  string `xml:"name,attr"`
+			Count int64  `xml:"count,attr"`
+		} `xml:"value"`
+	} `xml:"facets>facet"`
+	Hits []struct{} `xml:"hits"`
+}
+
+func TestSearchContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		accept      string
+		wantXML     bool
+		contentType string
+	}{
+		{"no Accept header", http.MethodGet, "", false, "application/json"},
+		{"JSON", http.MethodGet, "application/json", false, "application/json"},
+		{"anything", http.MethodGet, "*/*", false, "application/json"},
+		{"XML", http.MethodGet, "application/xml", true, "application/xml"},
+		{"text XML", http.MethodGet, "text/xml", true, "application/xml"},
+		{"XML with a body", http.MethodPost, "application/xml", true, "application/xml"},
+		{"XML preferred", http.MethodGet, "application/json;q=0.5, application/xml", true, "application/xml"},
+		{"JSON preferred", http.MethodGet, "application/xml;q=0.5, application/json", false, "application/json"},
+		{"unsupported type", http.MethodGet, "text/html", false, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			response := searchHits(map[string]interface{}{"id": "1", "title": "Gopher <guide> & tricks", "_rankingScore": 0.75})
+			response["facetDistribution"] = map[string]interface{}{"category": map[string]interface{}{"books": 1}}
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, response)
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			var headers []string
+			if tt.accept != "" {
+				headers = []string{"Accept", tt.accept}
+			}
+			w := serve(router, tt.method, "/search?q=gopher&facets=category&show_ranking_score=true", `{"query":"gopher","facets":["category"],"show_ranking_score":true}`, headers...)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.contentType)
+			}
+			if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+				t.Errorf("Vary = %q, want Accept", w.Header().Values("Vary"))
+			}
+
+			if !tt.wantXML {
+				var got SearchResponse
+				decodeJSON(t, w, &got)
+				if !got.Success || got.Total != 1 || len(got.Results) != 1 || got.Results[0].Title != "Gopher <guide> & tricks" || got.Facets["category"]["books"] != 1 {
+					t.Errorf("JSON response = %+v", got)
+				}
+				return
+			}
+
+			var got xmlSearchResponse
+			if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not XML: %v\n%s", err, w.Body)
+			}
+			if !got.Success || got.Query != "gopher" || got.Total != 1 {
+				t.Errorf("success, query, total = %v, %q, %d", got.Success, got.Query, got.Total)
+			}
+			if len(got.Results) != 1 || got.Results[0].ID != "1" || got.Results[0].Title != "Gopher <guide> & tricks" || got.Results[0].Score != 0.75 {
+				t.Errorf("results = %+v", got.Results)
+			}
+			if len(got.Facets) != 1 || got.Facets[0].Name != "category" || len(got.Facets[0].Values) != 1 || got.Facets[0].Values[0].Name != "books" || got.Facets[0].Values[0].Count != 1 {
+				t.Errorf("facets = %+v", got.Facets)
+			}
+		})
+	}
+}
+
+func TestSearchXMLErrors(t *testing.T) {
+	meili := newFakeMeili(t)
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	w := serve(router, http.MethodGet, "/search", "", "Accept", "application/xml")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got xmlSearchResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not XML: %v\n%s", err, w.Body)
+	}
+	if got.Success || got.ErrorCode != errCodeMissingQuery || got.Error == "" {
+		t.Errorf("response = %+v, want the missing query error", got)
+	}
+}
+
+// Raw hits have no fixed shape and are left out of XML
+func TestSearchXMLOmitsRawHits(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(map[string]interface{}{"id": "1", "title": "Gopher", "tags": []string{"go"}}))
+	router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+	w := serve(router, http.MethodGet, "/search?q=gopher&raw=true", "", "Accept", "application/xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got xmlSearchResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not XML: %v\n%s", err, w.Body)
+	}
+	if !got.Success || len(got.Hits) != 0 || strings.Contains(w.Body.String(), "tags") {
+		t.Errorf("XML response = %s, want no raw hits", w.Body)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "json"},
+		{"application/json", "json"},
+		{"application/xml", "xml"},
+		{"text/xml", "xml"},
+		{"Application/XML", "xml"},
+		{"*/*", "json"},
+		{"application/*", "json"},
+		{"text/html", "json"},
+		{"text/html, application/xml", "xml"},
+		{"application/xml, application/json", "xml"},
+		{"application/json, application/xml", "json"},
+		{"application/xml;q=0.5, application/json", "json"},
+		{"application/json;q=0.5, application/xml", "xml"},
+		{"application/json; charset=utf-8; q=0.2, text/xml; q=0.9", "xml"},
+		{"application/xml, */*;q=0.1", "xml"},
+		{"application/xml;q=0", "json"},
+		{"application/xml;q=bad", "json"},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateFormat(tt.accept); got != tt.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         string
+		maxLength int
+		want      string
+	}{
+		{"short", "gopher", 10, "gopher"},
+		{"exact length", "gopher", 6, "gopher"},
+		{"long", "gopher guide", 7, "gopher…"},
+		{"accents", "crème brûlée", 8, "crème b…"},
+		{"multi-byte letters", "日本語のテキスト", 4, "日本語…"},
+		{"emoji", "🐹🐹🐹🐹", 3, "🐹🐹…"},
+		{"one character", "gopher", 1, "…"},
+		{"empty", "", 5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateRunes(tt.s, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.maxLength, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateRunes(%q, %d) = %q, not valid UTF-8", tt.s, tt.maxLength, got)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.maxLength {
+				t.Errorf("truncateRunes(%q, %d) has %d characters", tt.s, tt.maxLength, n)
+			}
+		})
+	}
+}
+
+// MAX_CONTENT_LENGTH caps the content of every result
+func TestSearchMaxContentLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxLength   int
+		raw         bool
+		content     string
+		wantContent string
+	}{
+		{"no limit", 0, false, "Ünïcödé gopher content", "Ünïcödé gopher content"},
+		{"under the limit", 50, false, "Ünïcödé gopher content", "Ünïcödé gopher content"},
+		{"cut on characters", 8, false, "Ünïcödé gopher content", "Ünïcödé…"},
+		{"multi-byte content", 3, false, "日本語のテキスト", "日本…"},
+		{"raw hits", 8, true, "Ünïcödé gopher content", "Ünïcödé…"},
+		{"raw hits under the limit", 50, true, "Ünïcödé gopher content", "Ünïcödé gopher content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(map[string]interface{}{
+				"id": "1", "title": "Gopher", "content": tt.content,
+				"_formatted": map[string]interface{}{"content": tt.content},
+			}))
+			config := testConfig(meili.URL)
+			config.MaxContentLength = tt.maxLength
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, http.MethodGet, fmt.Sprintf("/search?q=gopher&raw=%v", tt.raw), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.raw {
+				if len(response.Hits) != 1 {
+					t.Fatalf("got %d hits, want 1", len(response.Hits))
+				}
+				if content := response.Hits[0]["content"]; content != tt.wantContent {
+					t.Errorf("hit content = %q, want %q", content, tt.wantContent)
+				}
+				return
+			}
+			if len(response.Results) != 1 {
+				t.Fatalf("got %d results, want 1", len(response.Results))
+			}
+			result := response.Results[0]
+			if result.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", result.Content, tt.wantContent)
+			}
+			// The cropped snippet is left to Meilisearch's cropping
+			if result.HighlightedContent != tt.content {
+				t.Errorf("highlighted content = %q, want %q", result.HighlightedContent, tt.content)
+			}
+		})
+	}
+}
+
+func TestWithSafeSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		attribute string
+		filter    string
+		safe      bool
+		want      string
+	}{
+		{"disabled", false, "nsfw", "category = go", true, "category = go"},
+		{"turned off", true, "nsfw", "category = go", false, "category = go"},
+		{"no filter", true, "nsfw", "", true, "nsfw != true"},
+		{"with filter", true, "nsfw", "a = 1 OR b = 2", true, "(a = 1 OR b = 2) AND nsfw != true"},
+		{"custom attribute", true, "adult", "", true, "adult != true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig("http://127.0.0.1:7700")
+			config.SafeSearch = tt.enabled
+			config.SafeSearchAttribute = tt.attribute
+			if got := withSafeSearch(tt.filter, tt.safe, config); got != tt.want {
+				t.Errorf("withSafeSearch(%q, %v) = %q, want %q", tt.filter, tt.safe, got, tt.want)
+			}
+		})
+	}
+}
+
+// safeDocs are gopher pages, some of them flagged
+var safeDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher guide"},
+	{"id": "2", "title": "Gopher party", "nsfw": true, "adult": false},
+	{"id": "3", "title": "Gopher tips", "nsfw": false, "adult": true},
+}
+
+func TestSearchSafeSearch(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		attribute  string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"disabled", false, "nsfw", http.MethodGet, "/search?q=gopher", "", http.StatusOK, []string{"1", "2", "3"}},
+		{"enabled", true, "nsfw", http.MethodGet, "/search?q=gopher", "", http.StatusOK, []string{"1", "3"}},
+		{"safe=true", true, "nsfw", http.MethodGet, "/search?q=gopher&safe=true", "", http.StatusOK, []string{"1", "3"}},
+		{"safe=false", true, "nsfw", http.MethodGet, "/search?q=gopher&safe=false", "", http.StatusOK, []string{"1", "2", "3"}},
+		{"combined with a filter", true, "nsfw", http.MethodGet, "/search?q=gopher&filter=id%20!%3D%201", "", http.StatusOK, []string{"3"}},
+		{"custom attribute", true, "adult", http.MethodGet, "/search?q=gopher", "", http.StatusOK, []string{"1", "2"}},
+		{"POST", true, "nsfw", http.MethodPost, "/search", `{"query":"gopher"}`, http.StatusOK, []string{"1", "3"}},
+		{"POST safe false", true, "nsfw", http.MethodPost, "/search", `{"query":"gopher","safe":false}`, http.StatusOK, []string{"1", "2", "3"}},
+		{"invalid safe", true, "nsfw", http.MethodGet, "/search?q=gopher&safe=maybe", "", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(safeDocs...)
+			config := testConfig(meili.URL)
+			config.SafeSearch = tt.enabled
+			config.SafeSearchAttribute = tt.attribute
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.wantStatus != http.StatusOK {
+				if response.ErrorCode != errCodeInvalidParameter {
+					t.Errorf("error code = %q, want %q", response.ErrorCode, errCodeInvalidParameter)
+				}
+				return
+			}
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestValidateSearchOn(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes []string
+		wantErr    bool
+	}{
+		{"none", nil, false},
+		{"attributes", []string{"title", "content"}, false},
+		{"nested attribute", []string{"author.name"}, false},
+		{"space", []string{"title", "bad name"}, true},
+		{"filter syntax", []string{"title = x"}, true},
+		{"empty", []string{""}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSearchOn(tt.attributes); (err != nil) != tt.wantErr {
+				t.Errorf("validateSearchOn(%q) error = %v, want error %v", tt.attributes, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// searchOnDocs mention "burrow" in their title or only in their content
+var searchOnDocs = []map[string]interface{}{
+	{"id": "1", "title": "Gopher burrow", "content": "Tunnels", "author": "Ann"},
+	{"id": "2", "title": "Gopher diet", "content": "They eat near the burrow", "author": "Burrow"},
+}
+
+func TestSearchOn(t *testing.T) {
+	tests := []struct {
+		name       string
+		searchable []interface{}
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"every attribute", nil, http.MethodGet, "/search?q=burrow", "", http.StatusOK, []string{"1", "2"}},
+		{"title only", nil, http.MethodGet, "/search?q=burrow&search_on=title", "", http.StatusOK, []string{"1"}},
+		{"content only", nil, http.MethodGet, "/search?q=burrow&search_on=content", "", http.StatusOK, []string{"2"}},
+		{"several attributes", nil, http.MethodGet, "/search?q=burrow&search_on=title,content", "", http.StatusOK, []string{"1", "2"}},
+		{"POST", nil, http.MethodPost, "/search", `{"query":"burrow","search_on":["title"]}`, http.StatusOK, []string{"1"}},
+		{"searchable attribute", []interface{}{"title", "content"}, http.MethodGet, "/search?q=burrow&search_on=title", "", http.StatusOK, []string{"1"}},
+		{"attribute that is not searchable", []interface{}{"title", "content"}, http.MethodGet, "/search?q=burrow&search_on=author", "", http.StatusBadRequest, nil},
+		{"invalid attribute name", nil, http.MethodGet, "/search?q=burrow&search_on=bad%20name", "", http.StatusBadRequest, nil},
+		{"invalid attribute name in the body", nil, http.MethodPost, "/search", `{"query":"burrow","search_on":["a,b"]}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			index.add(searchOnDocs...)
+			if tt.searchable != nil {
+				index.settings["searchableAttributes"] = tt.searchable
+			}
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if tt.wantStatus != http.StatusOK {
+				if response.ErrorCode != errCodeInvalidSearchOn {
+					t.Errorf("error code = %q, want %q", response.ErrorCode, errCodeInvalidSearchOn)
+				}
+				return
+			}
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
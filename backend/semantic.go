@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SemanticSearchRequest is the JSON body accepted by POST /semantic-search
+type SemanticSearchRequest struct {
+	Query         string   `json:"query"`
+	Limit         int      `json:"limit"`
+	Offset        int      `json:"offset"`
+	Filter        string   `json:"filter"`
+	SemanticRatio *float64 `json:"semantic_ratio"`
+}
+
+// semanticSearchHandler runs a Meilisearch hybrid search, which embeds the
+// query with the index's configured embedder and blends vector matches with
+// keyword matches. semantic_ratio (0 keyword only, 1 vector only) overrides
+// SEMANTIC_RATIO for a single request.
+func semanticSearchHandler(searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body SemanticSearchRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, SearchResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Invalid request body: %v", err),
+				ErrorCode: errCodeInvalidBody,
+			})
+			return
+		}
+
+		query, err := normalizeQuery(body.Query, config.MaxQueryLength)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, SearchResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: errCodeInvalidQuery,
+			})
+			return
+		}
+		if query == "" {
+			c.JSON(http.StatusBadRequest, SearchResponse{
+				Success:   false,
+				Error:     "Field 'query' is required",
+				ErrorCode: errCodeMissingQuery,
+			})
+			return
+		}
+		body.Query = query
+
+		ratio := config.SemanticRatio
+		if body.SemanticRatio != nil {
+			ratio = *body.SemanticRatio
+		}
+		if ratio < 0 || ratio > 1 {
+			c.JSON(http.StatusBadRequest, SearchResponse{
+				Success:   false,
+				Error:     "Field 'semantic_ratio' must be between 0 and 1",
+				ErrorCode: errCodeInvalidParameter,
+				Query:     body.Query,
+			})
+			return
+		}
+
+		body.Limit = clampLimit(body.Limit, config.DefaultSearchLimit, config.MaxSearchLimit)
+		if body.Offset < 0 {
+			body.Offset = 0
+		}
+
+		runSearch(c, searcher, cache, config, SearchParams{
+			Query:            body.Query,
+			Limit:            body.Limit,
+			Offset:           body.Offset,
+			Filter:           strings.TrimSpace(body.Filter),
+			MatchingStrategy: "last",
+			Embedder:         config.SemanticEmbedder,
+			SemanticRatio:    ratio,
+		})
+	}
+}
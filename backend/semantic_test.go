@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conceptVectors is the vocabulary of mockEmbed: words naming the same
+// concept share a vector, so "automobile" is close to "car" without sharing
+// a keyword with it
+var conceptVectors = map[string][]float64{
+	"car":        {1, 0, 0},
+	"cars":       {1, 0, 0},
+	"automobile": {1, 0, 0},
+	"vehicle":    {1, 0, 0},
+	"apple":      {0, 1, 0},
+	"fruit":      {0, 1, 0},
+	"banana":     {0, 1, 0},
+}
+
+// mockEmbed embeds text as the sum of the concept vectors of its words
+func mockEmbed(text string) []float64 {
+	vector := make([]float64, 3)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		for i, v := range conceptVectors[strings.Trim(word, ".,")] {
+			vector[i] += v
+		}
+	}
+	return vector
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// hybridIndex answers searches over docs the way Meilisearch's hybrid search
+// does with mockEmbed as the embedder: each document scores the share of
+// query words it contains weighted by 1-semanticRatio, plus its similarity to
+// the query weighted by semanticRatio. Without hybrid it is a keyword search.
+func hybridIndex(docs []map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query  string `json:"q"`
+			Limit  int    `json:"limit"`
+			Hybrid *struct {
+				Embedder      string  `json:"embedder"`
+				SemanticRatio float64 `json:"semanticRatio"`
+			} `json:"hybrid"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		ratio := 0.0
+		if request.Hybrid != nil {
+			if request.Hybrid.Embedder != "mock" {
+				writeFakeJSON(w, http.StatusBadRequest, map[string]string{
+					"message": "Cannot find embedder with name `" + request.Hybrid.Embedder + "`.",
+					"code":    "invalid_search_embedder",
+					"type":    "invalid_request",
+				})
+				return
+			}
+			ratio = request.Hybrid.SemanticRatio
+		}
+
+		words := strings.Fields(strings.ToLower(request.Query))
+		queryVector := mockEmbed(request.Query)
+		var hits []map[string]interface{}
+		for _, doc := range docs {
+			text := strings.ToLower(getString(doc, "title") + " " + getString(doc, "content"))
+			matched := 0
+			for _, word := range words {
+				if strings.Contains(text, word) {
+					matched++
+				}
+			}
+			keyword := float64(matched) / float64(len(words))
+			score := (1-ratio)*keyword + ratio*cosine(queryVector, mockEmbed(text))
+			if score > 0 {
+				hit := map[string]interface{}{"_rankingScore": score}
+				for k, v := range doc {
+					hit[k] = v
+				}
+				hits = append(hits, hit)
+			}
+		}
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i]["_rankingScore"].(float64) > hits[j]["_rankingScore"].(float64)
+		})
+
+		response := searchHits(hits[:min(request.Limit, len(hits))]...)
+		response["estimatedTotalHits"] = len(hits)
+		writeFakeJSON(w, http.StatusOK, response)
+	}
+}
+
+// vehicleDocs mention cars by keyword, by concept only, or not at all
+var vehicleDocs = []map[string]interface{}{
+	{"id": "keyword", "title": "Automobile insurance", "content": "Policies and premiums"},
+	{"id": "concept", "title": "Buying a car", "content": "Dealers and test drives"},
+	{"id": "unrelated", "title": "Apple pie", "content": "Fruit and pastry"},
+}
+
+func newSemanticRouter(searcher *MeiliSearcher, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.POST("/semantic-search", semanticSearchHandler(searcher, nil, config))
+	return router
+}
+
+func TestSemanticSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		ratio     float64
+		wantRatio float64
+		wantIDs   []string
+	}{
+		{"keyword only", `{"query": "automobile", "semantic_ratio": 0}`, 0.5, 0, []string{"keyword"}},
+		{"vector only", `{"query": "automobile", "semantic_ratio": 1}`, 0.5, 1, []string{"keyword", "concept"}},
+		{"hybrid ranks keyword and vector matches first", `{"query": "automobile"}`, 0.5, 0.5, []string{"keyword", "concept"}},
+		{"configured ratio", `{"query": "automobile"}`, 0, 0, []string{"keyword"}},
+		{"vector matches without shared keywords", `{"query": "vehicle", "semantic_ratio": 0.9}`, 0.5, 0.9, []string{"keyword", "concept"}},
+		{"request ratio overrides the configured one", `{"query": "fruit", "semantic_ratio": 0.8}`, 0, 0.8, []string{"unrelated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, hybridIndex(vehicleDocs))
+			config := testConfig(meili.URL)
+			config.SemanticEmbedder = "mock"
+			config.SemanticRatio = tt.ratio
+			router := newSemanticRouter(meili.searcher(), config)
+
+			w := serve(router, http.MethodPost, "/semantic-search", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, searchPath).JSON(t)
+			wantHybrid := map[string]interface{}{"embedder": "mock", "semanticRatio": tt.wantRatio}
+			if !reflect.DeepEqual(request["hybrid"], wantHybrid) {
+				t.Errorf("hybrid = %v, want %v", request["hybrid"], wantHybrid)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSemanticSearchHybridBlend(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, hybridIndex(vehicleDocs))
+	config := testConfig(meili.URL)
+	config.SemanticEmbedder = "mock"
+	router := newSemanticRouter(meili.searcher(), config)
+
+	// The more weight the vector match gets, the closer the conceptual
+	// match's score gets to the keyword match's
+	previous := -1.0
+	for _, ratio := range []string{"0.1", "0.5", "0.9"} {
+		w := serve(router, http.MethodPost, "/semantic-search", `{"query": "automobile", "semantic_ratio": `+ratio+`}`)
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		if len(response.Results) != 2 || response.Results[1].ID != "concept" {
+			t.Fatalf("ratio %s results = %v, want keyword then concept", ratio, resultIDs(response.Results))
+		}
+		score := response.Results[1].Score
+		if score <= previous {
+			t.Errorf("ratio %s concept score = %v, want above %v", ratio, score, previous)
+		}
+		previous = score
+	}
+}
+
+func TestSemanticSearchRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		embedder   string
+		wantStatus int
+		wantCode   string
+	}{
+		{"malformed body", `{"query":`, "mock", http.StatusBadRequest, errCodeInvalidBody},
+		{"missing query", `{"limit": 5}`, "mock", http.StatusBadRequest, errCodeMissingQuery},
+		{"blank query", `{"query": "   "}`, "mock", http.StatusBadRequest, errCodeMissingQuery},
+		{"negative ratio", `{"query": "car", "semantic_ratio": -0.1}`, "mock", http.StatusBadRequest, errCodeInvalidParameter},
+		{"ratio above one", `{"query": "car", "semantic_ratio": 1.5}`, "mock", http.StatusBadRequest, errCodeInvalidParameter},
+		{"unknown embedder", `{"query": "car"}`, "missing", http.StatusBadRequest, errCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, hybridIndex(vehicleDocs))
+			config := testConfig(meili.URL)
+			config.SemanticEmbedder = tt.embedder
+			router := newSemanticRouter(meili.searcher(), config)
+
+			w := serve(router, http.MethodPost, "/semantic-search", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantCode {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// getSettingsHandler returns the current index settings
+func getSettingsHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings, err := client.Index(indexFor(c, config)).GetSettings()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get settings: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// updateSettingsHandler applies searchable, filterable and sortable
+// attributes, ranking rules, stop words and synonyms from the request body.
+// Fields left out of the body are not changed.
+func updateSettingsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var settings meilisearch.Settings
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid settings body: %v", err),
+			})
+			return
+		}
+
+		task, err := client.Index(indexFor(c, config)).UpdateSettings(&settings)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update settings: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// resetSettingsHandler restores every index setting to its Meilisearch
+// default. Documents are kept; see POST /index/reset to delete them instead.
+func resetSettingsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, err := client.Index(indexFor(c, config)).ResetSettings()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to reset settings: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// getSynonymsHandler returns the index synonyms
+func getSynonymsHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		synonyms, err := client.Index(indexFor(c, config)).GetSynonyms()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get synonyms: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, synonyms)
+	}
+}
+
+// updateSynonymsHandler replaces the index synonyms with the request body,
+// e.g. {"tv": ["television"]}
+func updateSynonymsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var synonyms map[string][]string
+		if err := c.ShouldBindJSON(&synonyms); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid synonyms body, expected an object of string arrays: %v", err),
+			})
+			return
+		}
+
+		task, err := client.Index(indexFor(c, config)).UpdateSynonyms(&synonyms)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update synonyms: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// getStopWordsHandler returns the index stop words
+func getStopWordsHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stopWords, err := client.Index(indexFor(c, config)).GetStopWords()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get stop words: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, stopWords)
+	}
+}
+
+// updateStopWordsHandler replaces the index stop words with the JSON array in
+// the request body
+func updateStopWordsHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var stopWords []string
+		if err := c.ShouldBindJSON(&stopWords); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid stop words body, expected a JSON array of strings: %v", err),
+			})
+			return
+		}
+
+		task, err := client.Index(indexFor(c, config)).UpdateStopWords(&stopWords)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update stop words: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// getSearchableAttributesHandler returns the index searchable attributes in
+// order of importance
+func getSearchableAttributesHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attributes, err := client.Index(indexFor(c, config)).GetSearchableAttributes()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get searchable attributes: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, attributes)
+	}
+}
+
+// updateSearchableAttributesHandler replaces the index searchable attributes
+// with the JSON array in the request body. Meilisearch ranks matches in
+// earlier attributes higher, so ["title", "content"] boosts title matches.
+func updateSearchableAttributesHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var attributes []string
+		if err := c.ShouldBindJSON(&attributes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid searchable attributes body, expected a JSON array of strings: %v", err),
+			})
+			return
+		}
+
+		if len(attributes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one searchable attribute is required, use [\"*\"] to search every attribute",
+			})
+			return
+		}
+		seen := make(map[string]bool, len(attributes))
+		for _, attribute := range attributes {
+			if attribute != "*" && !attributeNamePattern.MatchString(attribute) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Invalid searchable attribute %q", attribute),
+				})
+				return
+			}
+			if seen[attribute] {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Searchable attribute %q is listed twice", attribute),
+				})
+				return
+			}
+			seen[attribute] = true
+		}
+
+		task, err := client.Index(indexFor(c, config)).UpdateSearchableAttributes(&attributes)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update searchable attributes: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// builtinRankingRules are the ranking rules Meilisearch provides
+var builtinRankingRules = map[string]bool{
+	"words":     true,
+	"typo":      true,
+	"proximity": true,
+	"attribute": true,
+	"sort":      true,
+	"exactness": true,
+}
+
+// validRankingRule reports whether rule is a built-in ranking rule or a
+// custom one of the form field:asc or field:desc
+func validRankingRule(rule string) bool {
+	if builtinRankingRules[rule] {
+		return true
+	}
+	field, order, ok := strings.Cut(rule, ":")
+	return ok && attributeNamePattern.MatchString(field) && (order == "asc" || order == "desc")
+}
+
+// getRankingRulesHandler returns the index ranking rules in the order they
+// are applied
+func getRankingRulesHandler(client *MeiliClient, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := client.Index(indexFor(c, config)).GetRankingRules()
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get ranking rules: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// updateRankingRulesHandler replaces the index ranking rules with the JSON
+// array in the request body, e.g. adding "rating:desc" after the built-in
+// rules to prefer highly rated documents among equally relevant ones
+func updateRankingRulesHandler(client *MeiliClient, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []string
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid ranking rules body, expected a JSON array of strings: %v", err),
+			})
+			return
+		}
+
+		if len(rules) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "At least one ranking rule is required",
+			})
+			return
+		}
+		for _, rule := range rules {
+			if !validRankingRule(rule) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Invalid ranking rule %q, expected words, typo, proximity, attribute, sort, exactness or <field>:asc/desc", rule),
+				})
+				return
+			}
+		}
+
+		task, err := client.Index(indexFor(c, config)).UpdateRankingRules(&rules)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update ranking rules: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
+
+// getTypoToleranceHandler returns the index typo-tolerance settings
+func getTypoToleranceHandler(searcher *MeiliSearcher, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings, err := searcher.GetTypoTolerance(c.Request.Context(), indexFor(c, config))
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get typo tolerance: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// updateTypoToleranceHandler changes the typo-tolerance fields present in the
+// request body (enabled, minWordSizeForTypos, disableOnWords,
+// disableOnAttributes) and leaves the others untouched
+func updateTypoToleranceHandler(client *MeiliClient, searcher *MeiliSearcher, cache Cache, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var settings TypoToleranceSettings
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid typo tolerance body: %v", err),
+			})
+			return
+		}
+
+		task, err := searcher.UpdateTypoTolerance(c.Request.Context(), indexFor(c, config), &settings)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to update typo tolerance: %v", err),
+			})
+			return
+		}
+
+		invalidateAfterTasks(client, cache, task.TaskUID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"task_uid": task.TaskUID,
+			"status":   task.Status,
+		})
+	}
+}
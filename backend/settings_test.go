@@ -0,0 +1,535 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSettingsRouter mounts the settings endpoints and search in front of
+// meili, sharing cache
+func newSettingsRouter(meili *fakeMeili, config *Config, cache Cache) *gin.Engine {
+	client := newMeiliClient(config)
+	searcher := meili.searcher()
+
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/search", searchHandler(searcher, cache, config))
+	router.GET("/settings", getSettingsHandler(client, config))
+	router.PUT("/settings", updateSettingsHandler(client, cache, config))
+	router.POST("/settings/reset", resetSettingsHandler(client, cache, config))
+	router.GET("/synonyms", getSynonymsHandler(client, config))
+	router.PUT("/synonyms", updateSynonymsHandler(client, cache, config))
+	router.GET("/stop-words", getStopWordsHandler(client, config))
+	router.PUT("/stop-words", updateStopWordsHandler(client, cache, config))
+	router.GET("/settings/searchable-attributes", getSearchableAttributesHandler(client, config))
+	router.PUT("/settings/searchable-attributes", updateSearchableAttributesHandler(client, cache, config))
+	router.GET("/settings/ranking-rules", getRankingRulesHandler(client, config))
+	router.PUT("/settings/ranking-rules", updateRankingRulesHandler(client, cache, config))
+	router.GET("/settings/typo-tolerance", getTypoToleranceHandler(searcher, config))
+	router.PATCH("/settings/typo-tolerance", updateTypoToleranceHandler(client, searcher, cache, config))
+	return router
+}
+
+// putSetting sends body to target and fails the test unless a task was
+// enqueued for it
+func putSetting(t *testing.T, router http.Handler, method, target, body string) {
+	t.Helper()
+	w := serve(router, method, target, body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("%s %s status = %d, want 202, body %s", method, target, w.Code, w.Body)
+	}
+	var response struct {
+		TaskUID *int64 `json:"task_uid"`
+	}
+	decodeJSON(t, w, &response)
+	if response.TaskUID == nil {
+		t.Fatalf("%s %s returned no task_uid: %s", method, target, w.Body)
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+	putSetting(t, router, http.MethodPut, "/settings", `{
+		"searchableAttributes": ["title", "content"],
+		"filterableAttributes": ["category"],
+		"sortableAttributes": ["date"],
+		"rankingRules": ["words", "typo", "date:desc"],
+		"stopWords": ["the"],
+		"synonyms": {"tv": ["television"]}
+	}`)
+	// A later update only changes the fields it sends
+	putSetting(t, router, http.MethodPut, "/settings", `{"sortableAttributes": ["date", "price"]}`)
+
+	w := serve(router, http.MethodGet, "/settings", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got map[string]interface{}
+	decodeJSON(t, w, &got)
+	want := map[string]interface{}{
+		"searchableAttributes": []interface{}{"title", "content"},
+		"filterableAttributes": []interface{}{"category"},
+		"sortableAttributes":   []interface{}{"date", "price"},
+		"rankingRules":         []interface{}{"words", "typo", "date:desc"},
+		"stopWords":            []interface{}{"the"},
+		"synonyms":             map[string]interface{}{"tv": []interface{}{"television"}},
+	}
+	for key, value := range want {
+		if !reflect.DeepEqual(got[key], value) {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+
+	putSetting(t, router, http.MethodPost, "/settings/reset", "")
+	var reset map[string]interface{}
+	decodeJSON(t, serve(router, http.MethodGet, "/settings", ""), &reset)
+	if reset["stopWords"] != nil || reset["synonyms"] != nil {
+		t.Errorf("settings after reset = %v, want defaults", reset)
+	}
+}
+
+func TestSettingsErrors(t *testing.T) {
+	meili := newFakeMeili(t)
+	router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"invalid body", http.MethodPut, "/settings", `{"stopWords": "the"}`, http.StatusBadRequest},
+		{"unknown index on read", http.MethodGet, "/settings", "", http.StatusNotFound},
+		{"unknown index on update", http.MethodPut, "/settings", `{"stopWords": ["the"]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if response.Error == "" {
+				t.Error("error message is empty")
+			}
+		})
+	}
+}
+
+func TestSynonyms(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(
+		map[string]interface{}{"id": "1", "title": "Television buying guide"},
+		map[string]interface{}{"id": "2", "title": "Radio repair"},
+	)
+	router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+	if got := searchIDs(t, router, "tv"); len(got) != 0 {
+		t.Fatalf("search for tv found %v before synonyms were set", got)
+	}
+
+	putSetting(t, router, http.MethodPut, "/synonyms", `{"tv": ["television"], "television": ["tv"]}`)
+	if got := searchIDs(t, router, "tv"); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("search for tv found %v, want [1]", got)
+	}
+
+	w := serve(router, http.MethodGet, "/synonyms", "")
+	var synonyms map[string][]string
+	decodeJSON(t, w, &synonyms)
+	if want := map[string][]string{"tv": {"television"}, "television": {"tv"}}; !reflect.DeepEqual(synonyms, want) {
+		t.Errorf("GET /synonyms = %v, want %v", synonyms, want)
+	}
+
+	for _, body := range []string{`["tv"]`, `{"tv": "television"}`} {
+		if w := serve(router, http.MethodPut, "/synonyms", body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT /synonyms %s status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestStopWords(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(
+		map[string]interface{}{"id": "1", "title": "Gopher guide"},
+		map[string]interface{}{"id": "2", "title": "Rust guide"},
+	)
+	router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+	if got := searchIDs(t, router, "the+gopher"); len(got) != 0 {
+		t.Fatalf("search for 'the gopher' found %v before stop words were set", got)
+	}
+
+	putSetting(t, router, http.MethodPut, "/stop-words", `["the", "a"]`)
+	if got := searchIDs(t, router, "the+gopher"); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("search for 'the gopher' found %v, want [1]", got)
+	}
+
+	var stopWords []string
+	decodeJSON(t, serve(router, http.MethodGet, "/stop-words", ""), &stopWords)
+	if !slices.Equal(stopWords, []string{"the", "a"}) {
+		t.Errorf("GET /stop-words = %v, want [the a]", stopWords)
+	}
+
+	for _, body := range []string{`"the"`, `{"the": true}`, `[1]`} {
+		if w := serve(router, http.MethodPut, "/stop-words", body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT /stop-words %s status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestTypoTolerance(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents").add(
+		map[string]interface{}{"id": "1", "title": "Gopher guide"},
+		map[string]interface{}{"id": "2", "title": "Part AB-1234"},
+	)
+	router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+	tests := []struct {
+		name     string
+		patch    string
+		query    string
+		wantIDs  []string
+		wantSent map[string]interface{}
+	}{
+		{"typo tolerated by default", "", "gophr", []string{"1"}, nil},
+		{"typo tolerance disabled", `{"enabled": false}`, "gophr", nil, map[string]interface{}{"enabled": false}},
+		{"exact match still found", "", "gopher", []string{"1"}, nil},
+		{"typo tolerance enabled again", `{"enabled": true}`, "gophr", []string{"1"}, map[string]interface{}{"enabled": true}},
+		{
+			"thresholds and exceptions",
+			`{"minWordSizeForTypos": {"oneTypo": 4, "twoTypos": 8}, "disableOnWords": ["ab-1234"], "disableOnAttributes": ["sku"]}`,
+			"gopher", []string{"1"},
+			map[string]interface{}{
+				"minWordSizeForTypos": map[string]interface{}{"oneTypo": 4.0, "twoTypos": 8.0},
+				"disableOnWords":      []interface{}{"ab-1234"},
+				"disableOnAttributes": []interface{}{"sku"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.patch != "" {
+				putSetting(t, router, http.MethodPatch, "/settings/typo-tolerance", tt.patch)
+				// Only the fields in the body are sent, so false is not dropped
+				// and the other fields are left alone
+				sent := meili.last(t, http.MethodPatch, "/indexes/documents/settings/typo-tolerance").JSON(t)
+				if !reflect.DeepEqual(sent, tt.wantSent) {
+					t.Errorf("sent %v, want %v", sent, tt.wantSent)
+				}
+			}
+			if got := searchIDs(t, router, tt.query); !slices.Equal(got, tt.wantIDs) && len(got)+len(tt.wantIDs) > 0 {
+				t.Errorf("search for %q found %v, want %v", tt.query, got, tt.wantIDs)
+			}
+		})
+	}
+
+	var settings TypoToleranceSettings
+	decodeJSON(t, serve(router, http.MethodGet, "/settings/typo-tolerance", ""), &settings)
+	if settings.Enabled == nil || !*settings.Enabled || settings.DisableOnWords == nil || !slices.Equal(*settings.DisableOnWords, []string{"ab-1234"}) {
+		t.Errorf("GET /settings/typo-tolerance = %+v, want enabled with disableOnWords [ab-1234]", settings)
+	}
+
+	if w := serve(router, http.MethodPatch, "/settings/typo-tolerance", `{"enabled": "no"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body status = %d, want 400", w.Code)
+	}
+}
+
+func TestSearchableAttributesBoostFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes string
+		wantIDs    []string
+	}{
+		{"title first", `["title", "content"]`, []string{"in-title", "in-content"}},
+		{"content first", `["content", "title"]`, []string{"in-content", "in-title"}},
+		{"title only", `["title"]`, []string{"in-title"}},
+		{"every attribute in document order", `["*"]`, []string{"in-title", "in-content"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(
+				map[string]interface{}{"id": "in-content", "title": "Pet care", "content": "Feeding a gopher"},
+				map[string]interface{}{"id": "in-title", "title": "Gopher care", "content": "Feeding pets"},
+			)
+			router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+			putSetting(t, router, http.MethodPut, "/settings/searchable-attributes", tt.attributes)
+
+			var want, sent []string
+			json.Unmarshal([]byte(tt.attributes), &want)
+			updates := meili.received(http.MethodPut, "/indexes/documents/settings/searchable-attributes")
+			if len(updates) != 1 || json.Unmarshal(updates[0].Body, &sent) != nil || !slices.Equal(sent, want) {
+				t.Errorf("Meilisearch received %v, want %s", updates, tt.attributes)
+			}
+			var got []string
+			decodeJSON(t, serve(router, http.MethodGet, "/settings/searchable-attributes", ""), &got)
+			if !slices.Equal(got, want) {
+				t.Errorf("searchable attributes = %v, want %v", got, want)
+			}
+
+			w := serve(router, http.MethodGet, "/search?q=gopher", "")
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSearchableAttributesRejectsBadBodies(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"malformed", `["title",`, "Invalid searchable attributes body"},
+		{"not an array", `{"attributes": ["title"]}`, "Invalid searchable attributes body"},
+		{"not strings", `[1, 2]`, "Invalid searchable attributes body"},
+		{"empty", `[]`, "At least one searchable attribute is required"},
+		{"invalid name", `["title", "bad name"]`, `Invalid searchable attribute "bad name"`},
+		{"duplicate", `["title", "content", "title"]`, `Searchable attribute "title" is listed twice`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, http.MethodPut, "/settings/searchable-attributes", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPut, "/indexes/documents/settings/searchable-attributes")); n != 0 {
+				t.Errorf("Meilisearch received %d updates, want none", n)
+			}
+		})
+	}
+}
+
+func TestRankingRules(t *testing.T) {
+	builtins := `"words", "typo", "proximity", "attribute", "sort", "exactness"`
+
+	tests := []struct {
+		name    string
+		rules   string
+		wantIDs []string
+	}{
+		{"default rules", "", []string{"a", "c", "b"}},
+		{"custom rule breaks ties", `[` + builtins + `, "rating:desc"]`, []string{"c", "a", "b"}},
+		{"custom rule first", `["rating:desc", ` + builtins + `]`, []string{"b", "c", "a"}},
+		{"ascending custom rule", `["rating:asc", ` + builtins + `]`, []string{"a", "c", "b"}},
+		{"text field", `[` + builtins + `, "title:desc"]`, []string{"c", "a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(
+				map[string]interface{}{"id": "a", "title": "Gopher guide", "rating": 3},
+				map[string]interface{}{"id": "b", "title": "Pet care", "content": "Feeding a gopher", "rating": 5},
+				map[string]interface{}{"id": "c", "title": "Gopher tricks", "rating": 4},
+			)
+			router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+			if tt.rules != "" {
+				putSetting(t, router, http.MethodPut, "/settings/ranking-rules", tt.rules)
+
+				var want, sent, got []string
+				json.Unmarshal([]byte(tt.rules), &want)
+				updates := meili.received(http.MethodPut, "/indexes/documents/settings/ranking-rules")
+				if len(updates) != 1 || json.Unmarshal(updates[0].Body, &sent) != nil || !slices.Equal(sent, want) {
+					t.Errorf("Meilisearch received %v, want %s", updates, tt.rules)
+				}
+				decodeJSON(t, serve(router, http.MethodGet, "/settings/ranking-rules", ""), &got)
+				if !slices.Equal(got, want) {
+					t.Errorf("ranking rules = %v, want %v", got, want)
+				}
+			}
+
+			var response SearchResponse
+			decodeJSON(t, serve(router, http.MethodGet, "/search?q=gopher", ""), &response)
+			if ids := resultIDs(response.Results); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("results = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestRankingRulesRejectsBadBodies(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"malformed", `["words",`, "Invalid ranking rules body"},
+		{"not an array", `{"rules": ["words"]}`, "Invalid ranking rules body"},
+		{"empty", `[]`, "At least one ranking rule is required"},
+		{"unknown rule", `["words", "relevance"]`, `Invalid ranking rule "relevance"`},
+		{"unknown order", `["words", "rating:up"]`, `Invalid ranking rule "rating:up"`},
+		{"missing field", `[":desc"]`, `Invalid ranking rule ":desc"`},
+		{"invalid field", `["bad field:desc"]`, `Invalid ranking rule "bad field:desc"`},
+		{"uppercase rule", `["Words"]`, `Invalid ranking rule "Words"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents")
+			router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, http.MethodPut, "/settings/ranking-rules", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var response struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, w, &response)
+			if !strings.HasPrefix(response.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if n := len(meili.received(http.MethodPut, "/indexes/documents/settings/ranking-rules")); n != 0 {
+				t.Errorf("Meilisearch received %d updates, want none", n)
+			}
+		})
+	}
+}
+
+func TestValidRankingRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"words", true},
+		{"exactness", true},
+		{"rating:desc", true},
+		{"published_at:asc", true},
+		{"rating", false},
+		{"rating:", false},
+		{"rating:descending", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := validRankingRule(tt.rule); got != tt.want {
+			t.Errorf("validRankingRule(%q) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+// POST /settings/reset brings back the settings of a new index, whatever was
+// changed before, and keeps the documents
+func TestResetSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []string
+	}{
+		{"unchanged", nil},
+		{"every setting", []string{`{
+			"searchableAttributes": ["title"],
+			"filterableAttributes": ["category"],
+			"sortableAttributes": ["date"],
+			"rankingRules": ["date:desc", "words"],
+			"stopWords": ["the"],
+			"synonyms": {"tv": ["television"]},
+			"distinctAttribute": "url"
+		}`}},
+		{"successive updates", []string{`{"stopWords": ["the"]}`, `{"displayedAttributes": ["id", "title"]}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			index := meili.serveIndex("documents")
+			index.add(numberedDocs(3)...)
+			router := newSettingsRouter(meili, testConfig(meili.URL), nil)
+
+			var defaults map[string]interface{}
+			decodeJSON(t, serve(router, http.MethodGet, "/settings", ""), &defaults)
+			if !reflect.DeepEqual(defaults["rankingRules"], meiliDefaultSettings()["rankingRules"]) {
+				t.Fatalf("ranking rules of a new index = %v, want the Meilisearch defaults", defaults["rankingRules"])
+			}
+
+			for _, change := range tt.changes {
+				putSetting(t, router, http.MethodPut, "/settings", change)
+			}
+			var changed map[string]interface{}
+			decodeJSON(t, serve(router, http.MethodGet, "/settings", ""), &changed)
+			if reflect.DeepEqual(changed, defaults) != (len(tt.changes) == 0) {
+				t.Fatalf("settings before the reset = %v", changed)
+			}
+
+			putSetting(t, router, http.MethodPost, "/settings/reset", "")
+			var reset map[string]interface{}
+			decodeJSON(t, serve(router, http.MethodGet, "/settings", ""), &reset)
+			if !reflect.DeepEqual(reset, defaults) {
+				t.Errorf("settings after the reset = %v, want the defaults %v", reset, defaults)
+			}
+			if n := len(index.documents()); n != 3 {
+				t.Errorf("index has %d documents after the reset, want 3", n)
+			}
+		})
+	}
+}
+
+func TestResetSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    []string
+		serveIndex bool
+		wantStatus int
+	}{
+		{"without the API key", nil, true, http.StatusUnauthorized},
+		{"with a wrong API key", []string{"Authorization", "Bearer wrong"}, true, http.StatusUnauthorized},
+		{"unknown index", []string{"Authorization", "Bearer secret"}, false, http.StatusNotFound},
+		{"authorized", []string{"Authorization", "Bearer secret"}, true, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			if tt.serveIndex {
+				meili.serveIndex("documents")
+			}
+			config := testConfig(meili.URL)
+			config.APIAuthKey = "secret"
+			router := newAPIRouter(meili, config)
+
+			w := serve(router, http.MethodPost, "/settings/reset", "", tt.headers...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			resets := meili.received(http.MethodDelete, "/indexes/documents/settings")
+			if (len(resets) != 0) != (tt.wantStatus != http.StatusUnauthorized) {
+				t.Errorf("Meilisearch received %d resets", len(resets))
+			}
+		})
+	}
+}
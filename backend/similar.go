@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// similarDocumentsHandler returns the documents closest to the one with the
+// given ID according to SEMANTIC_EMBEDDER, never including the document itself
+func similarDocumentsHandler(searcher *MeiliSearcher, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if err != nil || limit < 1 {
+			limit = 10
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), config.SearchTimeout)
+		defer cancel()
+
+		// Ask for one extra hit in case the source document is returned
+		searchRes, err := searcher.Similar(ctx, indexFor(c, config), map[string]interface{}{
+			"id":               id,
+			"embedder":         config.SemanticEmbedder,
+			"limit":            limit + 1,
+			"showRankingScore": true,
+		})
+		if err != nil {
+			status := meiliErrorStatus(err)
+			if status == http.StatusNotFound {
+				c.JSON(status, SearchResponse{
+					Success:   false,
+					Error:     fmt.Sprintf("Document %q not found", id),
+					ErrorCode: errCodeNotFound,
+				})
+				return
+			}
+			code := errCodeSearchFailed
+			if errors.Is(err, errCircuitOpen) {
+				code = errCodeMeiliUnavailable
+			}
+			c.JSON(status, SearchResponse{
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to find similar documents: %v", err),
+				ErrorCode: code,
+			})
+			return
+		}
+
+		hits := make([]map[string]interface{}, 0, len(searchRes.Hits))
+		for _, hit := range searchRes.Hits {
+			if getString(hit, "id") != id {
+				hits = append(hits, hit)
+			}
+		}
+		if len(hits) > limit {
+			hits = hits[:limit]
+		}
+
+		results := toSearchResults(hits)
+		c.JSON(http.StatusOK, SearchResponse{
+			Success:          true,
+			Results:          results,
+			Count:            len(results),
+			Limit:            limit,
+			ProcessingTimeMs: searchRes.ProcessingTimeMs,
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const similarPath = "/indexes/documents/similar"
+
+// similarIndex answers /similar over docs with mockEmbed as the embedder.
+// Like Meilisearch it ranks every other document by closeness to the source;
+// it also returns the source itself first, which the handler must drop.
+func similarIndex(docs []map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID       string `json:"id"`
+			Embedder string `json:"embedder"`
+			Limit    int    `json:"limit"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		var source map[string]interface{}
+		for _, doc := range docs {
+			if getString(doc, "id") == request.ID {
+				source = doc
+			}
+		}
+		if source == nil {
+			writeFakeJSON(w, http.StatusNotFound, map[string]string{
+				"message": "Document `" + request.ID + "` not found.",
+				"code":    "not_found_similar_id",
+				"type":    "invalid_request",
+			})
+			return
+		}
+
+		sourceVector := mockEmbed(getString(source, "title") + " " + getString(source, "content"))
+		var hits []map[string]interface{}
+		for _, doc := range docs {
+			score := cosine(sourceVector, mockEmbed(getString(doc, "title")+" "+getString(doc, "content")))
+			if score > 0 {
+				hit := map[string]interface{}{"_rankingScore": score}
+				for k, v := range doc {
+					hit[k] = v
+				}
+				hits = append(hits, hit)
+			}
+		}
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i]["_rankingScore"].(float64) > hits[j]["_rankingScore"].(float64)
+		})
+		writeFakeJSON(w, http.StatusOK, searchHits(hits[:min(request.Limit, len(hits))]...))
+	}
+}
+
+// relatedDocs are two families of related documents
+var relatedDocs = []map[string]interface{}{
+	{"id": "car-1", "title": "Car maintenance", "content": "Oil changes"},
+	{"id": "car-2", "title": "Automobile history", "content": "Early engines"},
+	{"id": "car-3", "title": "Vehicle safety", "content": "Crash tests"},
+	{"id": "fruit-1", "title": "Apple varieties", "content": "Sweet and sour"},
+	{"id": "fruit-2", "title": "Banana bread", "content": "Ripe fruit"},
+}
+
+func newSimilarRouter(meili *fakeMeili, config *Config) *gin.Engine {
+	router := gin.New()
+	router.Use(tenantIndex(config))
+	router.GET("/documents/:id/similar", similarDocumentsHandler(meili.searcher(), config))
+	return router
+}
+
+func TestSimilarDocuments(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		wantLimit float64
+		wantIDs   []string
+	}{
+		{"related documents", "/documents/car-1/similar", 11, []string{"car-2", "car-3"}},
+		{"other family", "/documents/fruit-2/similar", 11, []string{"fruit-1"}},
+		{"limit", "/documents/car-1/similar?limit=1", 2, []string{"car-2"}},
+		{"invalid limit falls back to the default", "/documents/car-1/similar?limit=none", 11, []string{"car-2", "car-3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, similarPath, similarIndex(relatedDocs))
+			config := testConfig(meili.URL)
+			config.SemanticEmbedder = "mock"
+			router := newSimilarRouter(meili, config)
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, similarPath).JSON(t)
+			if request["embedder"] != "mock" || request["limit"] != tt.wantLimit {
+				t.Errorf("request = %v, want embedder mock and limit %v", request, tt.wantLimit)
+			}
+
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			got := resultIDs(response.Results)
+			if !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("similar = %v, want %v", got, tt.wantIDs)
+			}
+			if response.Count != len(tt.wantIDs) {
+				t.Errorf("count = %d, want %d", response.Count, len(tt.wantIDs))
+			}
+		})
+	}
+}
+
+func TestSimilarDocumentsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing source document", similarIndex(relatedDocs), http.StatusNotFound, errCodeNotFound},
+		{"Meilisearch failure", func(w http.ResponseWriter, r *http.Request) {
+			writeFakeJSON(w, http.StatusInternalServerError, map[string]string{"message": "boom", "code": "internal", "type": "internal"})
+		}, http.StatusInternalServerError, errCodeSearchFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, similarPath, tt.handler)
+			router := newSimilarRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, "/documents/missing/similar", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if response.ErrorCode != tt.wantCode {
+				t.Errorf("error_code = %q, want %q", response.ErrorCode, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "regexp"
+
+// snippetWords is the length in words of a snippet computed locally
+const snippetWords = 30
+
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// localSnippet crops content to snippetWords words around the first of
+// matches, wrapped in <mark> tags, for hits Meilisearch returned without a
+// formatted content. Without matches the snippet is the start of content.
+func localSnippet(content string, matches []MatchPosition) string {
+	words := wordPattern.FindAllStringIndex(content, -1)
+	if len(words) == 0 {
+		return ""
+	}
+
+	matchStart, matchEnd := -1, -1
+	if len(matches) > 0 {
+		m := matches[0]
+		if m.Start >= 0 && m.Length > 0 && m.Start+m.Length <= len(content) {
+			matchStart, matchEnd = m.Start, m.Start+m.Length
+		}
+	}
+
+	// Center the snippet on the word holding the match
+	from := 0
+	if matchStart >= 0 {
+		for i, word := range words {
+			if word[1] > matchStart {
+				from = max(i-snippetWords/2, 0)
+				break
+			}
+		}
+	}
+	to := min(from+snippetWords, len(words))
+	start, end := words[from][0], words[to-1][1]
+
+	snippet := content[start:end]
+	if matchStart >= start && matchEnd <= end {
+		snippet = content[start:matchStart] + "<mark>" + content[matchStart:matchEnd] + "</mark>" + content[matchEnd:end]
+	}
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
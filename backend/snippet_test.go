@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// numberedWords returns "w0 w1 ... w<n-1>"
+func numberedWords(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	return strings.Join(words, " ")
+}
+
+// wordRange returns words from to to-1 of numberedWords, with word mark
+// wrapped in <mark> tags
+func wordRange(from, to, mark int) string {
+	words := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		word := fmt.Sprintf("w%d", i)
+		if i == mark {
+			word = "<mark>" + word + "</mark>"
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// matchOf returns the position of the first occurrence of word in content
+func matchOf(content, word string) []MatchPosition {
+	start := strings.Index(" "+content+" ", " "+word+" ")
+	return []MatchPosition{{Start: start, Length: len(word)}}
+}
+
+func TestLocalSnippet(t *testing.T) {
+	long := numberedWords(60)
+	tests := []struct {
+		name    string
+		content string
+		matches []MatchPosition
+		want    string
+	}{
+		{"empty content", "", nil, ""},
+		{"whitespace only", "  \n ", nil, ""},
+		{"short content without matches", "Gophers dig burrows", nil, "Gophers dig burrows"},
+		{"long content without matches", long, nil, wordRange(0, 30, -1) + "…"},
+		{"match at the start", long, matchOf(long, "w0"), wordRange(0, 30, 0) + "…"},
+		{"match in the middle", long, matchOf(long, "w30"), "…" + wordRange(15, 45, 30) + "…"},
+		{"match at the end", long, matchOf(long, "w59"), "…" + wordRange(44, 60, 59)},
+		{"only the first match", long, append(matchOf(long, "w30"), matchOf(long, "w40")...), "…" + wordRange(15, 45, 30) + "…"},
+		{"part of a word", "Gophers dig burrows", []MatchPosition{{Start: 0, Length: 6}}, "<mark>Gopher</mark>s dig burrows"},
+		{"match past the content", "Gophers dig burrows", []MatchPosition{{Start: 50, Length: 3}}, "Gophers dig burrows"},
+		{"empty match", "Gophers dig burrows", []MatchPosition{{Start: 8, Length: 0}}, "Gophers dig burrows"},
+		{"extra spacing trimmed", "  Gophers   dig  ", []MatchPosition{{Start: 12, Length: 3}}, "Gophers   <mark>dig</mark>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localSnippet(tt.content, tt.matches); got != tt.want {
+				t.Errorf("localSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := numberedWords(60)
+	tests := []struct {
+		name        string
+		hit         map[string]interface{}
+		wantSnippet string
+	}{
+		{
+			name: "Meilisearch formatted content",
+			hit: map[string]interface{}{
+				"id": "1", "title": "Gopher", "content": long,
+				"_formatted": map[string]interface{}{"content": "…w29 <mark>w30</mark> w31…"},
+			},
+			wantSnippet: "…w29 <mark>w30</mark> w31…",
+		},
+		{
+			name: "local snippet around the match",
+			hit: map[string]interface{}{
+				"id": "1", "title": "Gopher", "content": long,
+				"_matchesPosition": map[string]interface{}{"content": []interface{}{
+					map[string]interface{}{"start": matchOf(long, "w30")[0].Start, "length": 3},
+				}},
+			},
+			wantSnippet: "…" + wordRange(15, 45, 30) + "…",
+		},
+		{
+			name: "empty formatted content",
+			hit: map[string]interface{}{
+				"id": "1", "title": "Gopher", "content": long,
+				"_formatted": map[string]interface{}{"title": "<mark>Gopher</mark>", "content": ""},
+			},
+			wantSnippet: wordRange(0, 30, -1) + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handle(http.MethodPost, searchPath, http.StatusOK, searchHits(tt.hit))
+			router := newSearchRouter(meili.searcher(), nil, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, "/search?q=w30", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if len(response.Results) != 1 {
+				t.Fatalf("got %d results, want 1", len(response.Results))
+			}
+			result := response.Results[0]
+			if result.Snippet != tt.wantSnippet {
+				t.Errorf("snippet = %q, want %q", result.Snippet, tt.wantSnippet)
+			}
+			// The raw content stays available next to the snippet
+			if result.Content != long {
+				t.Errorf("content = %q, want the full content", result.Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// suggestHandler returns a short list of document titles matching the
+// q prefix, for search-as-you-type
+func suggestHandler(searcher *MeiliSearcher, config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Query("q")
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Query parameter 'q' is required",
+			})
+			return
+		}
+
+		limit := config.MaxSuggestions
+		if limitStr := c.Query("limit"); limitStr != "" {
+			if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed < limit {
+				limit = parsed
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), config.SearchTimeout)
+		defer cancel()
+
+		searchRes, err := searcher.Search(ctx, indexFor(c, config), map[string]interface{}{
+			"q":                    query,
+			"limit":                limit,
+			"attributesToRetrieve": []string{"title"},
+		})
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Suggest failed: %v", err),
+			})
+			return
+		}
+
+		suggestions := make([]string, 0, len(searchRes.Hits))
+		seen := make(map[string]bool, len(searchRes.Hits))
+		for _, hit := range searchRes.Hits {
+			title := getString(hit, "title")
+			if title == "" || seen[title] {
+				continue
+			}
+			seen[title] = true
+			suggestions = append(suggestions, title)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"suggestions": suggestions,
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSuggest(t *testing.T) {
+	titles := []string{"golang", "gopher", "gopher", "google", "gorilla", "goroutine"}
+
+	tests := []struct {
+		name      string
+		target    string
+		wantLimit float64
+		want      []string
+	}{
+		{"capped at the maximum", "/suggest?q=go", 4, []string{"golang", "gopher", "google"}},
+		{"smaller limit", "/suggest?q=go&limit=2", 2, []string{"golang", "gopher"}},
+		{"limit above the maximum", "/suggest?q=go&limit=50", 4, []string{"golang", "gopher", "google"}},
+		{"invalid limit", "/suggest?q=go&limit=x", 4, []string{"golang", "gopher", "google"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.handleFunc(http.MethodPost, searchPath, func(w http.ResponseWriter, r *http.Request) {
+				var request struct {
+					Limit int `json:"limit"`
+				}
+				json.NewDecoder(r.Body).Decode(&request)
+				var hits []map[string]interface{}
+				for _, title := range titles[:min(request.Limit, len(titles))] {
+					hits = append(hits, map[string]interface{}{"title": title})
+				}
+				writeFakeJSON(w, http.StatusOK, searchHits(hits...))
+			})
+			config := testConfig(meili.URL)
+			config.MaxSuggestions = 4
+			router := gin.New()
+			router.GET("/suggest", suggestHandler(meili.searcher(), config))
+
+			w := serve(router, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			request := meili.last(t, http.MethodPost, searchPath).JSON(t)
+			if request["q"] != "go" || request["limit"] != tt.wantLimit {
+				t.Errorf("q, limit = %v, %v, want go, %v", request["q"], request["limit"], tt.wantLimit)
+			}
+			if attributes := request["attributesToRetrieve"]; !reflect.DeepEqual(attributes, []interface{}{"title"}) {
+				t.Errorf("attributesToRetrieve = %v, want [title]", attributes)
+			}
+
+			var response struct {
+				Suggestions []string `json:"suggestions"`
+			}
+			decodeJSON(t, w, &response)
+			if !slices.Equal(response.Suggestions, tt.want) {
+				t.Errorf("suggestions = %v, want %v", response.Suggestions, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestRequiresQuery(t *testing.T) {
+	router := gin.New()
+	router.GET("/suggest", suggestHandler(newMeiliSearcher(nil, "", http.DefaultClient), testConfig("http://127.0.0.1:7700")))
+
+	if w := serve(router, http.MethodGet, "/suggest", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTaskHandler reports the state of an asynchronous Meilisearch task so
+// clients of the indexing endpoints can poll until it succeeds or fails
+func getTaskHandler(client *MeiliClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, err := strconv.ParseInt(c.Param("uid"), 10, 64)
+		if err != nil || uid < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Task UID must be a non-negative integer",
+			})
+			return
+		}
+
+		task, err := client.GetTask(uid)
+		if err != nil {
+			c.JSON(meiliErrorStatus(err), gin.H{
+				"error": fmt.Sprintf("Failed to get task: %v", err),
+			})
+			return
+		}
+
+		response := gin.H{
+			"task_uid":  task.UID,
+			"index_uid": task.IndexUID,
+			"status":    task.Status,
+			"type":      task.Type,
+		}
+		if task.Duration != "" {
+			response["duration"] = task.Duration
+		}
+		if task.Error.Code != "" {
+			response["error"] = gin.H{
+				"code":    task.Error.Code,
+				"message": task.Error.Message,
+				"type":    task.Error.Type,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		taskStatus string
+		wantError  bool
+	}{
+		{"succeeded", "succeeded", false},
+		{"failed", "failed", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").taskStatus = tt.taskStatus
+			router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+			w := serve(router, http.MethodPost, "/documents", `[{"id": "1", "title": "Gopher"}]`)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("indexing status = %d, body %s", w.Code, w.Body)
+			}
+			var submitted struct {
+				TaskUID int64 `json:"task_uid"`
+			}
+			decodeJSON(t, w, &submitted)
+
+			w = serve(router, http.MethodGet, fmt.Sprintf("/tasks/%d", submitted.TaskUID), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("task status = %d, body %s", w.Code, w.Body)
+			}
+			var task struct {
+				TaskUID  int64                  `json:"task_uid"`
+				IndexUID string                 `json:"index_uid"`
+				Status   string                 `json:"status"`
+				Type     string                 `json:"type"`
+				Error    map[string]interface{} `json:"error"`
+			}
+			decodeJSON(t, w, &task)
+			if task.TaskUID != submitted.TaskUID || task.IndexUID != "documents" || task.Type != "documentAdditionOrUpdate" {
+				t.Errorf("task = %+v, want task %d on documents", task, submitted.TaskUID)
+			}
+			if task.Status != tt.taskStatus {
+				t.Errorf("status = %q, want %q", task.Status, tt.taskStatus)
+			}
+			if (task.Error != nil) != tt.wantError {
+				t.Errorf("error = %v, want error: %v", task.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestGetTaskRejectsBadUIDs(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveTasks()
+	router := newDocumentsRouter(meili, testConfig(meili.URL), nil)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/tasks/abc", http.StatusBadRequest},
+		{"/tasks/-1", http.StatusBadRequest},
+		{"/tasks/42", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(router, http.MethodGet, tt.target, ""); w.Code != tt.wantStatus {
+			t.Errorf("GET %s status = %d, want %d", tt.target, w.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tenantHeader = "X-Tenant-ID"
+	indexNameKey = "index_name"
+)
+
+// tenantIDPattern keeps tenant IDs to characters that are valid in a
+// Meilisearch index UID, so a header cannot address arbitrary indexes
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// tenantIndex resolves the X-Tenant-ID header into a per-tenant index named
+// <IndexName>_<tenant>. Requests without the header use the configured index.
+func tenantIndex(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.GetHeader(tenantHeader)
+		if tenant == "" {
+			c.Next()
+			return
+		}
+
+		if !tenantIDPattern.MatchString(tenant) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "X-Tenant-ID must be 1-64 letters, digits or dashes",
+			})
+			return
+		}
+
+		c.Set(indexNameKey, config.IndexName+"_"+tenant)
+		c.Next()
+	}
+}
+
+// indexParam lets a request pick its index with the index query parameter,
+// resolved through the configured aliases and otherwise used as an index UID.
+// It cannot be combined with X-Tenant-ID, which would otherwise be bypassed.
+func indexParam(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Query("index")
+		if name == "" {
+			c.Next()
+			return
+		}
+
+		if c.GetHeader(tenantHeader) != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Query parameter 'index' cannot be combined with X-Tenant-ID",
+			})
+			return
+		}
+
+		uid, ok := resolveIndex(config, name, "")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Query parameter 'index' must be an alias or 1-400 letters, digits, dashes or underscores",
+			})
+			return
+		}
+
+		c.Set(indexNameKey, uid)
+		c.Next()
+	}
+}
+
+// resolveIndex maps an alias or index UID to the index to search. A tenant
+// gets its own copy of the index, <uid>_<tenant>, named the way tenantIndex
+// names the tenant's default index. ok is false when the result is not a
+// valid index UID.
+func resolveIndex(config *Config, name, tenant string) (uid string, ok bool) {
+	uid, isAlias := config.Aliases[name]
+	if !isAlias {
+		uid = name
+	}
+	if tenant != "" {
+		uid += "_" + tenant
+	}
+	return uid, indexUIDPattern.MatchString(uid)
+}
+
+// indexFor returns the index a request targets: the index named by the index
+// parameter or the tenant's index when an X-Tenant-ID header was sent,
+// otherwise the configured index
+func indexFor(c *gin.Context, config *Config) string {
+	if name := c.GetString(indexNameKey); name != "" {
+		return name
+	}
+	return config.IndexName
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	meili.serveIndex("documents_acme")
+	meili.serveIndex("documents_globex")
+	router := newAPIRouter(meili, testConfig(meili.URL))
+
+	uploads := []struct {
+		tenant string
+		body   string
+	}{
+		{"", `[{"id": "shared", "title": "Gopher handbook"}]`},
+		{"acme", `[{"id": "acme-1", "title": "Gopher rockets"}, {"id": "acme-2", "title": "Gopher anvils"}]`},
+		{"globex", `[{"id": "globex-1", "title": "Gopher domes"}]`},
+	}
+	for _, upload := range uploads {
+		if w := serve(router, http.MethodPost, "/documents", upload.body, tenantHeader, upload.tenant); w.Code != http.StatusAccepted {
+			t.Fatalf("upload for %q status = %d, body %s", upload.tenant, w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		tenant  string
+		wantIDs []string
+	}{
+		{"", []string{"shared"}},
+		{"acme", []string{"acme-1", "acme-2"}},
+		{"globex", []string{"globex-1"}},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/search?q=gopher", "", tenantHeader, tt.tenant)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search for %q status = %d, body %s", tt.tenant, w.Code, w.Body)
+		}
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+			t.Errorf("tenant %q found %v, want %v", tt.tenant, got, tt.wantIDs)
+		}
+	}
+
+	// A tenant cannot read another tenant's document by ID
+	if w := serve(router, http.MethodGet, "/documents/acme-1", "", tenantHeader, "globex"); w.Code != http.StatusNotFound {
+		t.Errorf("cross-tenant document read status = %d, want 404", w.Code)
+	}
+}
+
+func TestTenantHeaderValidation(t *testing.T) {
+	tests := []struct {
+		tenant     string
+		wantStatus int
+	}{
+		{"acme", http.StatusOK},
+		{"acme-2", http.StatusOK},
+		{"a_b", http.StatusBadRequest},
+		{"../keys", http.StatusBadRequest},
+		{"acme corp", http.StatusBadRequest},
+		{"0123456789012345678901234567890123456789012345678901234567890123456789", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents_" + tt.tenant)
+			router := newAPIRouter(meili, testConfig(meili.URL))
+
+			w := serve(router, http.MethodGet, "/search?q=gopher", "", tenantHeader, tt.tenant)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if n := len(meili.received(http.MethodPost, "/indexes/documents_"+tt.tenant+"/search")); tt.wantStatus != http.StatusOK && n != 0 {
+				t.Errorf("rejected tenant reached Meilisearch with %d searches", n)
+			}
+		})
+	}
+}
+
+func TestTenantSettings(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("documents")
+	meili.serveIndex("documents_acme").add(
+		map[string]interface{}{"id": "1", "title": "Television buying guide"},
+	)
+	router := newAPIRouter(meili, testConfig(meili.URL))
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		path   string
+	}{
+		{http.MethodPut, "/settings", `{"stopWords": ["the"]}`, "/indexes/documents_acme/settings"},
+		{http.MethodPost, "/settings/reset", "", "/indexes/documents_acme/settings"},
+		{http.MethodPut, "/synonyms", `{"tv": ["television"]}`, "/indexes/documents_acme/settings/synonyms"},
+		{http.MethodPut, "/stop-words", `["the"]`, "/indexes/documents_acme/settings/stop-words"},
+		{http.MethodPut, "/settings/searchable-attributes", `["title"]`, "/indexes/documents_acme/settings/searchable-attributes"},
+		{http.MethodPut, "/settings/ranking-rules", `["words", "typo"]`, "/indexes/documents_acme/settings/ranking-rules"},
+		{http.MethodPatch, "/settings/typo-tolerance", `{"enabled": false}`, "/indexes/documents_acme/settings/typo-tolerance"},
+		{http.MethodGet, "/settings", "", "/indexes/documents_acme/settings"},
+		{http.MethodGet, "/synonyms", "", "/indexes/documents_acme/settings/synonyms"},
+		{http.MethodGet, "/stop-words", "", "/indexes/documents_acme/settings/stop-words"},
+		{http.MethodGet, "/settings/searchable-attributes", "", "/indexes/documents_acme/settings/searchable-attributes"},
+		{http.MethodGet, "/settings/ranking-rules", "", "/indexes/documents_acme/settings/ranking-rules"},
+		{http.MethodGet, "/settings/typo-tolerance", "", "/indexes/documents_acme/settings/typo-tolerance"},
+	}
+	for _, tt := range tests {
+		method := tt.method
+		if tt.target == "/settings/reset" {
+			method = http.MethodDelete
+		} else if tt.target == "/settings" && method == http.MethodPut {
+			method = http.MethodPatch
+		}
+
+		before := len(meili.received(method, tt.path))
+		w := serve(router, tt.method, tt.target, tt.body, tenantHeader, "acme")
+		if w.Code >= 300 {
+			t.Errorf("%s %s status = %d, body %s", tt.method, tt.target, w.Code, w.Body)
+		}
+		if len(meili.received(method, tt.path)) != before+1 {
+			t.Errorf("%s %s did not reach %s %s", tt.method, tt.target, method, tt.path)
+		}
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		if n := len(meili.received(method, "/indexes/documents/settings")); n != 0 {
+			t.Errorf("%d tenant %s requests reached the default index", n, method)
+		}
+	}
+}
+
+func TestSettingsInvalidateCache(t *testing.T) {
+	meili := newFakeMeili(t)
+	index := meili.serveIndex("documents")
+	index.add(map[string]interface{}{"id": "1", "title": "Television buying guide"})
+	index.taskStatus = "enqueued"
+	router := newSettingsRouter(meili, testConfig(meili.URL), newQueryCache(10, time.Minute, 0))
+
+	if ids, _ := searchCache(t, router, "tv"); len(ids) != 0 {
+		t.Fatalf("search for tv found %v before synonyms were set", ids)
+	}
+	w := serve(router, http.MethodPut, "/synonyms", `{"tv": ["television"]}`)
+	var task struct {
+		TaskUID int `json:"task_uid"`
+	}
+	decodeJSON(t, w, &task)
+	if _, cacheStatus := searchCache(t, router, "tv"); cacheStatus != cacheHit {
+		t.Errorf("X-Cache while the update runs = %q, want HIT", cacheStatus)
+	}
+
+	meili.complete(task.TaskUID)
+	eventually(t, func() bool {
+		ids, _ := searchCache(t, router, "tv")
+		return slices.Equal(ids, []string{"1"})
+	}, "search for tv did not find the synonym after the update succeeded")
+}
+
+func TestResolveIndex(t *testing.T) {
+	config := testConfig("http://127.0.0.1:7700")
+	config.Aliases = map[string]string{"current": "docs_v2", "broken": "bad uid"}
+
+	tests := []struct {
+		name   string
+		index  string
+		tenant string
+		want   string
+		wantOK bool
+	}{
+		{"alias", "current", "", "docs_v2", true},
+		{"index UID", "docs_v1", "", "docs_v1", true},
+		{"alias for a tenant", "current", "acme", "docs_v2_acme", true},
+		{"index UID for a tenant", "docs_v1", "acme", "docs_v1_acme", true},
+		{"invalid UID", "bad.name", "", "bad.name", false},
+		{"alias to an invalid UID", "broken", "", "bad uid", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveIndex(config, tt.index, tt.tenant)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("resolveIndex(%q, %q) = %q, %v, want %q, %v", tt.index, tt.tenant, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSearchIndexAliases(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		headers    []string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"default index", http.MethodGet, "/search?q=gopher", "", nil, http.StatusOK, []string{"default"}},
+		{"alias", http.MethodGet, "/search?q=gopher&index=current", "", nil, http.StatusOK, []string{"v2"}},
+		{"alias with a body", http.MethodPost, "/search?index=current", `{"query":"gopher"}`, nil, http.StatusOK, []string{"v2"}},
+		{"index UID", http.MethodGet, "/search?q=gopher&index=docs_v1", "", nil, http.StatusOK, []string{"v1"}},
+		{"aliased index by UID", http.MethodGet, "/search?q=gopher&index=docs_v2", "", nil, http.StatusOK, []string{"v2"}},
+		{"invalid UID", http.MethodGet, "/search?q=gopher&index=bad.name", "", nil, http.StatusBadRequest, nil},
+		{"alias with a tenant", http.MethodGet, "/search?q=gopher&index=current", "", []string{tenantHeader, "acme"}, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(map[string]interface{}{"id": "default", "title": "Gopher"})
+			meili.serveIndex("docs_v1").add(map[string]interface{}{"id": "v1", "title": "Gopher"})
+			meili.serveIndex("docs_v2").add(map[string]interface{}{"id": "v2", "title": "Gopher"})
+			config := testConfig(meili.URL)
+			config.Aliases = map[string]string{"current": "docs_v2"}
+			router := newSearchRouter(meili.searcher(), nil, config)
+
+			w := serve(router, tt.method, tt.target, tt.body, tt.headers...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response SearchResponse
+			decodeJSON(t, w, &response)
+			if got := resultIDs(response.Results); !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("found %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// Pointing an alias at another index moves its searches along
+func TestSearchAliasRetargeted(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.serveIndex("docs_v1").add(map[string]interface{}{"id": "v1", "title": "Gopher"})
+	meili.serveIndex("docs_v2").add(map[string]interface{}{"id": "v2", "title": "Gopher"})
+
+	for _, target := range []string{"docs_v1", "docs_v2"} {
+		config := testConfig(meili.URL)
+		config.Aliases = map[string]string{"current": target}
+		router := newSearchRouter(meili.searcher(), nil, config)
+
+		w := serve(router, http.MethodGet, "/search?q=gopher&index=current", "")
+		var response SearchResponse
+		decodeJSON(t, w, &response)
+		if got, want := resultIDs(response.Results), []string{strings.TrimPrefix(target, "docs_")}; !slices.Equal(got, want) {
+			t.Errorf("current=%s found %v, want %v", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the instrumentation scope of the spans started here
+const tracerName = "search-engine-backend"
+
+// propagator reads and writes W3C traceparent and tracestate headers
+var propagator = propagation.TraceContext{}
+
+// newTracerProvider creates a tracer provider that exports spans in batches
+// to endpoint, the base URL of an OTLP/HTTP collector such as
+// http://otel-collector:4318. Spans are sampled unless an incoming
+// traceparent says its trace is not.
+func newTracerProvider(endpoint, serviceName string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimRight(endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// tracing starts a server span for every request with otelgin, continuing
+// the trace of an incoming traceparent header, and makes it available to
+// handlers through the request context. A nil provider traces nothing.
+func tracing(provider *sdktrace.TracerProvider, serviceName string) gin.HandlersChain {
+	if provider == nil {
+		return nil
+	}
+
+	return gin.HandlersChain{
+		otelgin.Middleware(serviceName,
+			otelgin.WithTracerProvider(provider),
+			otelgin.WithPropagators(propagator),
+		),
+		func(c *gin.Context) {
+			if requestID := c.GetString(requestIDKey); requestID != "" {
+				trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request_id", requestID))
+			}
+		},
+	}
+}
+
+// startSpan starts a child of the span carried by ctx and returns a context
+// carrying the child. Without a span in ctx the child is a no-op, so callers
+// can trace unconditionally.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+}
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTraceparent passes the trace of the span carried by ctx on to an
+// outgoing request, keeping its sampling decision
+func injectTraceparent(ctx context.Context, header map[string][]string) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
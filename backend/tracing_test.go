@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpanID  = "00f067aa0ba902b7"
+)
+
+// tracedMeili is a Meilisearch stand-in answering every search with status
+// and body, recording the requests it receives
+type tracedMeili struct {
+	*httptest.Server
+	mu       sync.Mutex
+	searches []*http.Request
+}
+
+func newTracedMeili(t *testing.T, status int, body string) *tracedMeili {
+	meili := &tracedMeili{}
+	meili.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meili.mu.Lock()
+		meili.searches = append(meili.searches, r)
+		meili.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(meili.Close)
+	return meili
+}
+
+func (m *tracedMeili) received() []*http.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*http.Request(nil), m.searches...)
+}
+
+// newTracingRouter mounts GET /search behind the request ID and tracing
+// middleware, exporting spans to exporter as soon as they end. A nil
+// exporter disables tracing.
+func newTracingRouter(meili *tracedMeili, exporter *tracetest.InMemoryExporter) *gin.Engine {
+	var provider *sdktrace.TracerProvider
+	if exporter != nil {
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	}
+	config := defaultConfig()
+	config.MeilisearchURL = meili.URL
+	config.MeiliMaxRetries = 0
+
+	router := gin.New()
+	router.Use(requestID())
+	router.Use(tracing(provider, "search-engine-backend")...)
+	router.GET("/search", searchHandler(newMeiliSearcher([]string{meili.URL}, "", &http.Client{}), nil, config))
+	return router
+}
+
+// serveTraced sends a GET request for target through router
+func serveTraced(router *gin.Engine, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// spanAttributes returns the attributes of span keyed by name
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestTracingSearch(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		meiliStatus int
+		wantRemote  bool
+		wantStatus  codes.Code
+	}{
+		{"new trace", "", http.StatusOK, false, codes.Unset},
+		{"continues the incoming trace", "00-" + remoteTraceID + "-" + remoteSpanID + "-01", http.StatusOK, true, codes.Unset},
+		{"malformed traceparent starts a new trace", "00-not-a-trace-01", http.StatusOK, false, codes.Unset},
+		{"failed search", "", http.StatusInternalServerError, false, codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"hits":[{"id":"1","title":"Gopher"}],"estimatedTotalHits":1}`
+			if tt.meiliStatus != http.StatusOK {
+				body = `{"message":"down","code":"internal","type":"internal"}`
+			}
+			meili := newTracedMeili(t, tt.meiliStatus, body)
+			exporter := tracetest.NewInMemoryExporter()
+			router := newTracingRouter(meili, exporter)
+
+			var headers []string
+			if tt.traceparent != "" {
+				headers = []string{"traceparent", tt.traceparent}
+			}
+			w := serveTraced(router, "/search?q=gopher&limit=5", append(headers, requestIDHeader, "req-42")...)
+			if (w.Code == http.StatusOK) != (tt.meiliStatus == http.StatusOK) {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("exported %d spans, want 2", len(spans))
+			}
+			// The child ends first
+			child, server := spans[0], spans[1]
+
+			if server.Name != "/search" || server.SpanKind != trace.SpanKindServer {
+				t.Errorf("server span = %q %s, want /search server", server.Name, server.SpanKind)
+			}
+			serverAttributes := spanAttributes(server)
+			if serverAttributes["http.route"].AsString() != "/search" || serverAttributes["request_id"].AsString() != "req-42" {
+				t.Errorf("server span attributes = %v, want the route and request ID", serverAttributes)
+			}
+			if got := serverAttributes["http.status_code"].AsInt64(); got != int64(w.Code) {
+				t.Errorf("http.status_code = %d, want %d", got, w.Code)
+			}
+			if server.Status.Code != tt.wantStatus {
+				t.Errorf("server span status = %s, want %s", server.Status.Code, tt.wantStatus)
+			}
+
+			if tt.wantRemote {
+				if server.SpanContext.TraceID().String() != remoteTraceID || server.Parent.SpanID().String() != remoteSpanID || !server.Parent.IsRemote() {
+					t.Errorf("server span trace, parent = %s, %s, want the incoming %s, %s", server.SpanContext.TraceID(), server.Parent.SpanID(), remoteTraceID, remoteSpanID)
+				}
+			} else if server.Parent.IsValid() {
+				t.Errorf("server span has parent %s, want a root span", server.Parent.SpanID())
+			}
+
+			if child.Name != "performSearch" || child.SpanKind != trace.SpanKindInternal {
+				t.Errorf("child span = %q %s, want performSearch internal", child.Name, child.SpanKind)
+			}
+			if child.Parent.SpanID() != server.SpanContext.SpanID() || child.SpanContext.TraceID() != server.SpanContext.TraceID() {
+				t.Errorf("child span is not a child of the server span")
+			}
+			childAttributes := spanAttributes(child)
+			if childAttributes["db.system"].AsString() != "meilisearch" || childAttributes["search.index"].AsString() != "documents" ||
+				childAttributes["search.limit"].AsInt64() != 5 || childAttributes["search.offset"].AsInt64() != 0 {
+				t.Errorf("child span attributes = %v, want the index, limit and offset", childAttributes)
+			}
+			if tt.meiliStatus == http.StatusOK {
+				if total, ok := childAttributes["search.total"]; !ok || total.AsInt64() != 1 {
+					t.Errorf("search.total = %v, want 1", total)
+				}
+			}
+			if child.Status.Code != tt.wantStatus {
+				t.Errorf("child span status = %s, want %s", child.Status.Code, tt.wantStatus)
+			}
+
+			// Meilisearch is told about the search span, sampled like its
+			// trace
+			searches := meili.received()
+			want := "00-" + child.SpanContext.TraceID().String() + "-" + child.SpanContext.SpanID().String() + "-01"
+			if len(searches) == 0 || searches[0].Header.Get("traceparent") != want {
+				t.Errorf("traceparent sent to Meilisearch = %v, want %q", searches, want)
+			}
+		})
+	}
+}
+
+func TestTracingKeepsUnsampledTraces(t *testing.T) {
+	meili := newTracedMeili(t, http.StatusOK, `{"hits":[]}`)
+	exporter := tracetest.NewInMemoryExporter()
+	router := newTracingRouter(meili, exporter)
+
+	w := serveTraced(router, "/search?q=gopher", "traceparent", "00-"+remoteTraceID+"-"+remoteSpanID+"-00")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("exported %d spans of an unsampled trace, want none", len(spans))
+	}
+
+	// The trace continues downstream, still unsampled
+	searches := meili.received()
+	if len(searches) != 1 {
+		t.Fatalf("Meilisearch received %d searches, want 1", len(searches))
+	}
+	traceparent := searches[0].Header.Get("traceparent")
+	if !strings.HasPrefix(traceparent, "00-"+remoteTraceID+"-") || !strings.HasSuffix(traceparent, "-00") {
+		t.Errorf("traceparent sent to Meilisearch = %q, want trace %s unsampled", traceparent, remoteTraceID)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	meili := newTracedMeili(t, http.StatusOK, `{"hits":[]}`)
+	router := newTracingRouter(meili, nil)
+
+	if w := serveTraced(router, "/search?q=gopher"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	searches := meili.received()
+	if len(searches) != 1 || searches[0].Header.Get("traceparent") != "" {
+		t.Errorf("Meilisearch received %v, want one search without a traceparent", searches)
+	}
+}
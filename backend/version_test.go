@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setBuildInfo overrides the build information for the rest of the test, as
+// -ldflags would
+func setBuildInfo(t *testing.T, v, c, d string) {
+	oldVersion, oldCommit, oldBuildDate := version, commit, buildDate
+	version, commit, buildDate = v, c, d
+	t.Cleanup(func() { version, commit, buildDate = oldVersion, oldCommit, oldBuildDate })
+}
+
+func TestBuildInfoEndpoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		inject bool
+		want   BuildInfo
+	}{
+		{"defaults", false, BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown", GoVersion: runtime.Version()}},
+		{"injected", true, BuildInfo{Version: "1.2.0", Commit: "0123abcd", BuildDate: "2026-04-01T12:00:00Z", GoVersion: runtime.Version()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.inject {
+				setBuildInfo(t, tt.want.Version, tt.want.Commit, tt.want.BuildDate)
+			}
+			router := gin.New()
+			router.GET("/version", versionHandler)
+			router.GET("/health", healthHandler(testConfig("http://127.0.0.1:7700")))
+
+			for _, path := range []string{"/version", "/health"} {
+				w := serve(router, http.MethodGet, path, "")
+				if w.Code != http.StatusOK {
+					t.Fatalf("%s status = %d, want 200", path, w.Code)
+				}
+				var got BuildInfo
+				decodeJSON(t, w, &got)
+				if got != tt.want {
+					t.Errorf("%s build info = %+v, want %+v", path, got, tt.want)
+				}
+			}
+		})
+	}
+}
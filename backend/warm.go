@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// loadWarmQueries reads WARM_QUERIES: the path of a file with one query per
+// line, or else a comma-separated list of queries
+func loadWarmQueries(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WARM_QUERIES file: %w", err)
+		}
+		var queries []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				queries = append(queries, line)
+			}
+		}
+		return queries, nil
+	}
+
+	return splitList(value), nil
+}
+
+// warmCache runs each query the way GET /search?q=<query> would, so the
+// responses land in the query cache under the same keys and Meilisearch has
+// the index loaded before the first user searches. The INDEX_LANGUAGES
+// indexes are warmed along with INDEX_NAME.
+func warmCache(searcher *MeiliSearcher, cache Cache, config *Config, queries []string) {
+	indexes := []string{config.IndexName}
+	for _, tag := range sortedKeys(config.IndexLanguages) {
+		if uid := config.IndexLanguages[tag]; !slices.Contains(indexes, uid) {
+			indexes = append(indexes, uid)
+		}
+	}
+
+	warmed, failed := 0, 0
+	for _, raw := range queries {
+		params, err := SearchRequestBody{Query: raw}.searchParams(config)
+		if err != nil {
+			slog.Warn("Skipping invalid warm-up query", "query", raw, "error", err)
+			failed++
+			continue
+		}
+
+		for _, index := range indexes {
+			status, response, _ := executeSearch(context.Background(), searcher, cache, config, index, params)
+			if status != http.StatusOK {
+				slog.Warn("Warm-up query failed", "query", params.Query, "index", index, "error", response.Error)
+				failed++
+				continue
+			}
+			warmed++
+		}
+	}
+	slog.Info("Warmed query cache", "searches", warmed, "failed", failed)
+}
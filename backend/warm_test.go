@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadWarmQueries(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "warm.txt")
+	if err := os.WriteFile(file, []byte("gopher guide\n\n  rust book  \npython, snakes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"unset", "", nil},
+		{"list", "gopher,rust book", []string{"gopher", "rust book"}},
+		{"list with blanks", " gopher , ,rust ", []string{"gopher", "rust"}},
+		{"file", file, []string{"gopher guide", "rust book", "python, snakes"}},
+		{"directory is a query", dir, []string{dir}},
+		{"missing file is a query", filepath.Join(dir, "missing.txt"), []string{filepath.Join(dir, "missing.txt")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadWarmQueries(tt.value)
+			if err != nil {
+				t.Fatalf("loadWarmQueries(%q) error = %v", tt.value, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("loadWarmQueries(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		queries      []string
+		wantWarmed   []string
+		wantSearches int
+	}{
+		{"queries", []string{"gopher", "rust book"}, []string{"gopher", "rust book"}, 2},
+		{"queries are normalized", []string{"  gopher   guide "}, []string{"gopher guide"}, 1},
+		{"invalid queries are skipped", []string{"", "   ", "gopher"}, []string{"gopher"}, 1},
+		{"duplicates are searched once", []string{"gopher", "gopher"}, []string{"gopher"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			meili.serveIndex("documents").add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+			cache := newQueryCache(100, time.Minute, 0)
+			config := testConfig(meili.URL)
+			searcher := meili.searcher()
+
+			warmCache(searcher, cache, config, tt.queries)
+			if n := len(meili.received(http.MethodPost, searchPath)); n != tt.wantSearches {
+				t.Errorf("warming sent %d searches, want %d", n, tt.wantSearches)
+			}
+
+			// The first user searches are served from the cache
+			router := newSearchRouter(searcher, cache, config)
+			for _, query := range tt.wantWarmed {
+				w := serve(router, http.MethodGet, "/search?q="+url.QueryEscape(query), "")
+				if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "HIT" {
+					t.Errorf("search for %q = %d, X-Cache %q, want a cache hit", query, w.Code, w.Header().Get("X-Cache"))
+				}
+			}
+			if n := len(meili.received(http.MethodPost, searchPath)); n != tt.wantSearches {
+				t.Errorf("Meilisearch received %d searches after warming, want %d", n, tt.wantSearches)
+			}
+		})
+	}
+}
+
+// A failing query does not stop the others from warming
+func TestWarmCacheSkipsFailedQueries(t *testing.T) {
+	meili := newFakeMeili(t)
+	meili.handleFunc(http.MethodPost, searchPath, titleIndex(map[string]interface{}{"id": "1", "title": "Gopher guide"}))
+	cache := newQueryCache(100, time.Minute, 0)
+	config := testConfig(meili.URL)
+	searcher := meili.searcher()
+
+	warmCache(searcher, cache, config, []string{"broken", "gopher"})
+
+	router := newSearchRouter(searcher, cache, config)
+	if w := serve(router, http.MethodGet, "/search?q=gopher", ""); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache = %q after a failed warm-up query, want HIT", w.Header().Get("X-Cache"))
+	}
+	if w := serve(router, http.MethodGet, "/search?q=broken", ""); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("X-Cache = %q for the failed query, want MISS", w.Header().Get("X-Cache"))
+	}
+}
+
+// searchedIndexes lists the fake indexes searched, once per search
+func searchedIndexes(meili *fakeMeili) []string {
+	var indexes []string
+	for _, index := range []string{"documents", "docs_en", "docs_fr"} {
+		for range meili.received(http.MethodPost, "/indexes/"+index+"/search") {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// Warmed queries are cache hits for the searches they stand for, whatever
+// defaults and index GET /search picks
+func TestWarmCacheMatchesSearch(t *testing.T) {
+	tests := []struct {
+		name           string
+		safeSearch     bool
+		indexLanguages map[string]string
+		acceptLanguage string
+		wantIndexes    []string
+	}{
+		{"defaults", false, nil, "", []string{"documents"}},
+		{"safe search", true, nil, "", []string{"documents"}},
+		{"language index", false, map[string]string{"en": "docs_en", "fr": "docs_fr"}, "fr-CH, fr;q=0.9", []string{"documents", "docs_en", "docs_fr"}},
+		{"default index next to language indexes", false, map[string]string{"en": "docs_en", "fr": "docs_fr"}, "", []string{"documents", "docs_en", "docs_fr"}},
+		{"shared language index", true, map[string]string{"en": "docs_en", "en-GB": "docs_en"}, "en-GB", []string{"documents", "docs_en"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meili := newFakeMeili(t)
+			for _, index := range []string{"documents", "docs_en", "docs_fr"} {
+				meili.serveIndex(index).add(map[string]interface{}{"id": "1", "title": "Gopher guide"})
+			}
+			cache := newQueryCache(100, time.Minute, 0)
+			config := testConfig(meili.URL)
+			config.SafeSearch = tt.safeSearch
+			config.IndexLanguages = tt.indexLanguages
+			searcher := meili.searcher()
+
+			warmCache(searcher, cache, config, []string{"Gopher  guide"})
+			if got := searchedIndexes(meili); !slices.Equal(got, tt.wantIndexes) {
+				t.Errorf("warming searched %q, want %q", got, tt.wantIndexes)
+			}
+
+			router := newSearchRouter(searcher, cache, config)
+			w := serve(router, http.MethodGet, "/search?q=Gopher%20guide", "", "Accept-Language", tt.acceptLanguage)
+			if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "HIT" {
+				t.Errorf("search = %d, X-Cache %q, want a cache hit", w.Code, w.Header().Get("X-Cache"))
+			}
+			if got := searchedIndexes(meili); !slices.Equal(got, tt.wantIndexes) {
+				t.Errorf("Meilisearch searched %q after warming, want only the warm-up searches", got)
+			}
+		})
+	}
+}